@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// flagsEntorno son los flags de línea de comandos y la variable de entorno a
+// la que sustituyen. El orden de prioridad es:
+//
+//  1. el flag, si se pasa;
+//  2. la variable de entorno del proceso;
+//  3. el fichero .env.<APP_ENV> y después .env (godotenv no pisa las
+//     variables ya definidas, ver server.LoadEnv);
+//  4. el valor por defecto del perfil o de server.LoadConfig.
+var flagsEntorno = []struct {
+	nombre, env, uso string
+}{
+	{"port", "portback", "puerto HTTP"},
+	{"dsn", "dsn", "cadena de conexión a la base de datos"},
+	{"upstream-url", "url", "URL de la API de la que se sincronizan los items"},
+	{"admin-addr", "admin_addr", "dirección (host:puerto) del listener de administración"},
+	{"unix-socket", "unix_socket", "ruta del socket Unix en el que escuchar además del puerto"},
+	{"reuse-port", "reuse_port", "true para compartir el puerto con el proceso que releva a éste (SO_REUSEPORT)"},
+}
+
+// aplicarFlags lee los flags de args y pasa los indicados a su variable de
+// entorno, de modo que LoadConfig los vea con prioridad sobre el entorno y
+// los ficheros .env. Debe llamarse después de server.LoadEnv.
+func aplicarFlags(args []string) error {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	valores := make(map[string]*string, len(flagsEntorno))
+	for _, f := range flagsEntorno {
+		valores[f.nombre] = fs.String(f.nombre, "", fmt.Sprintf("%s (sustituye a la variable %s)", f.uso, f.env))
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Uso: %s [flags]\n\n", fs.Name())
+		fmt.Fprintln(fs.Output(), "Los flags tienen prioridad sobre las variables de entorno, y éstas sobre los ficheros .env.<APP_ENV> y .env.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nSubcomandos:\n  %s\tcomprueba que el servidor está listo (ver %s %s -h)\n", subcomandoHealthcheck, fs.Name(), subcomandoHealthcheck)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, fe := range flagsEntorno {
+			if fe.nombre == f.Name && err == nil {
+				err = os.Setenv(fe.env, *valores[fe.nombre])
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"prueba/server"
+	"time"
+)
+
+// subcomandoHealthcheck es el primer argumento con el que el binario, en
+// lugar de arrancar el servidor, comprueba el que ya está en marcha:
+//
+//	HEALTHCHECK CMD ["/app", "healthcheck"]
+const subcomandoHealthcheck = "healthcheck"
+
+// healthcheck ejecuta el subcomando healthcheck con los argumentos que le
+// siguen y devuelve el código de salida: 0 si GET /readyz responde 200 y 1
+// si no. Debe llamarse después de server.LoadEnv, para tomar el puerto de
+// los ficheros .env igual que el servidor; si el servidor se arrancó con
+// -port hay que pasarle el mismo. Con mtls=all el servidor pide
+// certificado de cliente en todas las peticiones, así que hay que pasarlo
+// con -cert y -key (o comprobar otra URL con -url).
+func healthcheck(args []string) int {
+	fs := flag.NewFlagSet(subcomandoHealthcheck, flag.ContinueOnError)
+	destino := fs.String("url", "", "URL que se comprueba (por defecto /readyz en 127.0.0.1 y el puerto de -port o portback)")
+	port := fs.String("port", "", "puerto HTTP del servidor, si se arrancó con -port (sustituye a la variable portback)")
+	timeout := fs.Duration("timeout", 5*time.Second, "tiempo máximo de la comprobación")
+	cert := fs.String("cert", "", "certificado de cliente (PEM) para el servidor con mtls=all")
+	key := fs.String("key", "", "clave privada (PEM) del certificado de -cert")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Uso: %s %s [flags]\n\n", os.Args[0], subcomandoHealthcheck)
+		fmt.Fprintln(fs.Output(), "Comprueba que el servidor está listo (GET /readyz): sale con 0 si lo está y con 1 si no.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if (*cert == "") != (*key == "") {
+		fmt.Fprintln(os.Stderr, "healthcheck: -cert and -key must be given together")
+		return 2
+	}
+	if *port != "" {
+		// Como en el servidor (ver aplicarFlags), el flag pisa la variable
+		if err := os.Setenv("portback", *port); err != nil {
+			fmt.Fprintf(os.Stderr, "healthcheck: %v\n", err)
+			return 2
+		}
+	}
+	if *destino == "" {
+		if os.Getenv("mtls") == "all" && *cert == "" {
+			fmt.Fprintln(os.Stderr, "healthcheck: mtls=all requires a client certificate: pass -cert and -key, or -url for an endpoint that does not require one")
+			return 2
+		}
+		*destino = server.HealthcheckURL()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err := server.Healthcheck(ctx, *destino, *cert, *key); err != nil {
+		fmt.Fprintf(os.Stderr, "healthcheck: %s: %v\n", *destino, err)
+		return 1
+	}
+	fmt.Println("ok")
+	return 0
+}
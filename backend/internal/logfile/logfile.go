@@ -0,0 +1,178 @@
+// Package logfile escribe los logs en un fichero que se rota por tamaño y por
+// antigüedad, para los despliegues en máquinas sin un colector que recoja la
+// salida estándar.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formato de la fecha que se añade al nombre de los ficheros rotados:
+// app.log.20261016-184700. Ordena igual como texto que como fecha.
+const formatoRotado = "20060102-150405"
+
+// Config es la configuración de un Writer.
+type Config struct {
+	// Path es el fichero de log; el directorio se crea si no existe.
+	Path string
+	// MaxSize es el tamaño a partir del cual se rota; 0 es sin límite.
+	MaxSize int64
+	// MaxAge es la antigüedad del fichero a partir de la cual se rota; 0 es
+	// sin límite.
+	MaxAge time.Duration
+	// MaxBackups es el número de ficheros rotados que se conservan; los más
+	// antiguos se borran. 0 los conserva todos.
+	MaxBackups int
+}
+
+// Writer es un io.Writer sobre el fichero de Config.Path. Antes de cada
+// escritura comprueba si toca rotar: el fichero actual se renombra con la
+// fecha y se abre uno nuevo. Cada Write va entero al mismo fichero, así que
+// un registro de log no se parte entre dos.
+type Writer struct {
+	Config
+
+	mu      sync.Mutex
+	f       *os.File
+	tamano  int64
+	abierto time.Time
+}
+
+// Open abre (o crea) el fichero de cfg.Path para añadir al final.
+func Open(cfg Config) (*Writer, error) {
+	w := &Writer{Config: cfg}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("logfile: %w", err)
+	}
+	if err := w.abrir(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write escribe p, rotando antes el fichero si p no cabe o es demasiado
+// antiguo.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return 0, os.ErrClosed
+	}
+	if w.tocaRotar(int64(len(p))) {
+		if err := w.rotar(); err != nil {
+			// Mejor seguir escribiendo en el fichero grande que perder logs
+			fmt.Fprintf(os.Stderr, "logfile: %v\n", err)
+		}
+	}
+	n, err := w.f.Write(p)
+	w.tamano += int64(n)
+	return n, err
+}
+
+// Close cierra el fichero; las escrituras posteriores fallan.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
+
+func (w *Writer) tocaRotar(n int64) bool {
+	// Un fichero vacío no se rota aunque el registro no quepa
+	if w.tamano == 0 {
+		return false
+	}
+	if w.MaxSize > 0 && w.tamano+n > w.MaxSize {
+		return true
+	}
+	return w.MaxAge > 0 && time.Since(w.abierto) >= w.MaxAge
+}
+
+// abrir abre el fichero de Path. La antigüedad de un fichero que ya existía
+// se cuenta desde su última modificación: se rotará como mucho MaxAge
+// después de que se reinicie el proceso.
+func (w *Writer) abrir() error {
+	f, err := os.OpenFile(w.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("logfile: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("logfile: %w", err)
+	}
+	w.f = f
+	w.tamano = info.Size()
+	w.abierto = time.Now()
+	if w.tamano > 0 {
+		w.abierto = info.ModTime()
+	}
+	return nil
+}
+
+func (w *Writer) rotar() error {
+	if err := w.f.Close(); err != nil {
+		return fmt.Errorf("logfile: %w", err)
+	}
+	fecha := time.Now().Format(formatoRotado)
+	destino := w.Path + "." + fecha
+	// Dos rotaciones en el mismo segundo: la segunda lleva sufijo
+	for i := 1; ; i++ {
+		if _, err := os.Stat(destino); os.IsNotExist(err) {
+			break
+		}
+		destino = fmt.Sprintf("%s.%s.%d", w.Path, fecha, i)
+	}
+	errRenombrar := os.Rename(w.Path, destino)
+	// El fichero se vuelve a abrir aunque no se haya podido renombrar
+	if err := w.abrir(); err != nil {
+		return err
+	}
+	if errRenombrar != nil {
+		return fmt.Errorf("logfile: %w", errRenombrar)
+	}
+	return w.limpiar()
+}
+
+// limpiar borra los ficheros rotados que sobran según MaxBackups.
+func (w *Writer) limpiar() error {
+	if w.MaxBackups <= 0 {
+		return nil
+	}
+	rotados, err := filepath.Glob(w.Path + ".*")
+	if err != nil {
+		return fmt.Errorf("logfile: %w", err)
+	}
+	var propios []string
+	for _, r := range rotados {
+		sufijo := strings.TrimPrefix(r, w.Path+".")
+		fecha, _, _ := strings.Cut(sufijo, ".")
+		if _, err := time.Parse(formatoRotado, fecha); err == nil {
+			propios = append(propios, r)
+		}
+	}
+	if len(propios) <= w.MaxBackups {
+		return nil
+	}
+	sort.Strings(propios)
+	var errs []error
+	for _, r := range propios[:len(propios)-w.MaxBackups] {
+		if err := os.Remove(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("logfile: %v", errs)
+	}
+	return nil
+}
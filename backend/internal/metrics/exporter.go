@@ -0,0 +1,13 @@
+package metrics
+
+// Exporter envía las métricas de un registro a un sistema externo (StatsD,
+// DogStatsD...). Es para los sistemas de tipo push: Prometheus lee las
+// métricas cuando quiere con WritePrometheus y no necesita uno.
+type Exporter interface {
+	// Export envía el estado actual de r. Se llama periódicamente; cada
+	// exportador decide si manda valores absolutos o lo que ha cambiado desde
+	// el envío anterior.
+	Export(r *Registry) error
+	// Close libera la conexión; no envía nada pendiente.
+	Close() error
+}
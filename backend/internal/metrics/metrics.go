@@ -0,0 +1,274 @@
+// Package metrics es el registro en memoria de las métricas del proceso:
+// contadores, gauges e histogramas con etiquetas, que luego se exportan en el
+// formato que haga falta.
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets son los buckets por defecto (en segundos) para
+// histogramas de duración.
+var DefaultDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Registry guarda en memoria un conjunto de métricas. Es deliberadamente
+// simple: contadores, gauges e histogramas con etiquetas, que luego se pueden exportar
+// en el formato que haga falta.
+type Registry struct {
+	mu         sync.Mutex
+	counters   map[string]*Counter
+	gauges     map[string]*Gauge
+	histograms map[string]*Histogram
+}
+
+// NewRegistry crea un registro vacío.
+func NewRegistry() *Registry {
+	return &Registry{
+		counters:   map[string]*Counter{},
+		gauges:     map[string]*Gauge{},
+		histograms: map[string]*Histogram{},
+	}
+}
+
+// Default es el registro global del proceso.
+var Default = NewRegistry()
+
+// NewCounter registra un contador en Default.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.Counter(name, help, labels...)
+}
+
+// NewGauge registra un gauge en Default.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.Gauge(name, help, labels...)
+}
+
+// NewHistogram registra un histograma en Default.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.Histogram(name, help, buckets, labels...)
+}
+
+// Counter es un contador monótono con etiquetas.
+type Counter struct {
+	Name   string
+	Help   string
+	Labels []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labels []string
+	value  float64
+}
+
+// Gauge es un valor que sube y baja (conexiones abiertas...), con etiquetas.
+type Gauge struct {
+	Name   string
+	Help   string
+	Labels []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+// Histogram acumula observaciones en buckets con etiquetas.
+type Histogram struct {
+	Name    string
+	Help    string
+	Labels  []string
+	Buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // una entrada por bucket, no acumulativa
+	count  uint64
+	sum    float64
+}
+
+// Counter registra (o devuelve el ya registrado) un contador.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.counters[name]; ok {
+		return c
+	}
+	c := &Counter{Name: name, Help: help, Labels: labels, series: map[string]*counterSeries{}}
+	r.counters[name] = c
+	return c
+}
+
+// Gauge registra (o devuelve el ya registrado) un gauge.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if g, ok := r.gauges[name]; ok {
+		return g
+	}
+	g := &Gauge{Name: name, Help: help, Labels: labels, series: map[string]*counterSeries{}}
+	r.gauges[name] = g
+	return g
+}
+
+// Histogram registra (o devuelve el ya registrado) un histograma. Si buckets es
+// nil se usan DefaultDurationBuckets.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok := r.histograms[name]; ok {
+		return h
+	}
+	if buckets == nil {
+		buckets = DefaultDurationBuckets
+	}
+	h := &Histogram{Name: name, Help: help, Labels: labels, Buckets: buckets, series: map[string]*histogramSeries{}}
+	r.histograms[name] = h
+	return h
+}
+
+// metricas devuelve las métricas registradas, para exportarlas.
+func (r *Registry) metricas() ([]*Counter, []*Gauge, []*Histogram) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counters := make([]*Counter, 0, len(r.counters))
+	for _, c := range r.counters {
+		counters = append(counters, c)
+	}
+	gauges := make([]*Gauge, 0, len(r.gauges))
+	for _, g := range r.gauges {
+		gauges = append(gauges, g)
+	}
+	histograms := make([]*Histogram, 0, len(r.histograms))
+	for _, h := range r.histograms {
+		histograms = append(histograms, h)
+	}
+	return counters, gauges, histograms
+}
+
+// Add suma v al contador para los valores de etiqueta dados (en el mismo orden
+// con el que se registró).
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{labels: labelValues}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+// Inc suma uno al contador.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Set fija el valor del gauge para los valores de etiqueta dados.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.series[key]
+	if !ok {
+		s = &counterSeries{labels: labelValues}
+		g.series[key] = s
+	}
+	s.value = v
+}
+
+// Observe registra una observación en el histograma.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labels: labelValues, counts: make([]uint64, len(h.Buckets))}
+		h.series[key] = s
+	}
+	for i, b := range h.Buckets {
+		if v <= b {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// ObserveSince registra el tiempo transcurrido desde start, en segundos.
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// CounterSnapshot es una copia de un valor de contador para exportarlo.
+type CounterSnapshot struct {
+	Labels []string
+	Value  float64
+}
+
+// HistogramSnapshot es una copia de una serie de histograma para exportarla;
+// Cumulative tiene los conteos acumulados por bucket.
+type HistogramSnapshot struct {
+	Labels     []string
+	Cumulative []uint64
+	Count      uint64
+	Sum        float64
+}
+
+// Snapshot devuelve las series del contador ordenadas por etiquetas.
+func (c *Counter) Snapshot() []CounterSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]CounterSnapshot, 0, len(c.series))
+	for _, s := range c.series {
+		out = append(out, CounterSnapshot{Labels: s.labels, Value: s.value})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].Labels, ",") < strings.Join(out[j].Labels, ",")
+	})
+	return out
+}
+
+// Snapshot devuelve las series del gauge ordenadas por etiquetas.
+func (g *Gauge) Snapshot() []CounterSnapshot {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := make([]CounterSnapshot, 0, len(g.series))
+	for _, s := range g.series {
+		out = append(out, CounterSnapshot{Labels: s.labels, Value: s.value})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].Labels, ",") < strings.Join(out[j].Labels, ",")
+	})
+	return out
+}
+
+// Snapshot devuelve las series del histograma ordenadas por etiquetas.
+func (h *Histogram) Snapshot() []HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]HistogramSnapshot, 0, len(h.series))
+	for _, s := range h.series {
+		cum := make([]uint64, len(s.counts))
+		var acc uint64
+		for i, n := range s.counts {
+			acc += n
+			cum[i] = acc
+		}
+		out = append(out, HistogramSnapshot{Labels: s.labels, Cumulative: cum, Count: s.count, Sum: s.sum})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].Labels, ",") < strings.Join(out[j].Labels, ",")
+	})
+	return out
+}
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType es el tipo de la respuesta de WritePrometheus: el formato de
+// texto de Prometheus, versión 0.0.4.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WritePrometheus escribe todas las métricas del registro en el formato de
+// texto de Prometheus, ordenadas por nombre.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	counters, gauges, histograms := r.metricas()
+
+	// Cada métrica se escribe con una función para ordenarlas todas juntas
+	type metrica struct {
+		nombre   string
+		escribir func(*bufio.Writer)
+	}
+	var todas []metrica
+	for _, c := range counters {
+		todas = append(todas, metrica{c.Name, func(b *bufio.Writer) {
+			cabecera(b, c.Name, c.Help, "counter")
+			for _, s := range c.Snapshot() {
+				muestra(b, c.Name, c.Labels, s.Labels, "", "", s.Value)
+			}
+		}})
+	}
+	for _, g := range gauges {
+		todas = append(todas, metrica{g.Name, func(b *bufio.Writer) {
+			cabecera(b, g.Name, g.Help, "gauge")
+			for _, s := range g.Snapshot() {
+				muestra(b, g.Name, g.Labels, s.Labels, "", "", s.Value)
+			}
+		}})
+	}
+	for _, h := range histograms {
+		todas = append(todas, metrica{h.Name, func(b *bufio.Writer) {
+			cabecera(b, h.Name, h.Help, "histogram")
+			for _, s := range h.Snapshot() {
+				for i, limite := range h.Buckets {
+					muestra(b, h.Name+"_bucket", h.Labels, s.Labels, "le", numero(limite), float64(s.Cumulative[i]))
+				}
+				muestra(b, h.Name+"_bucket", h.Labels, s.Labels, "le", "+Inf", float64(s.Count))
+				muestra(b, h.Name+"_sum", h.Labels, s.Labels, "", "", s.Sum)
+				muestra(b, h.Name+"_count", h.Labels, s.Labels, "", "", float64(s.Count))
+			}
+		}})
+	}
+	sort.Slice(todas, func(i, j int) bool { return todas[i].nombre < todas[j].nombre })
+
+	b := bufio.NewWriter(w)
+	for _, m := range todas {
+		m.escribir(b)
+	}
+	return b.Flush()
+}
+
+func cabecera(b *bufio.Writer, nombre, ayuda, tipo string) {
+	b.WriteString("# HELP " + nombre + " " + escaparAyuda(ayuda) + "\n")
+	b.WriteString("# TYPE " + nombre + " " + tipo + "\n")
+}
+
+// muestra escribe una línea nombre{etiquetas} valor; extra y valorExtra son
+// una etiqueta más (le de los buckets) si no están vacías.
+func muestra(b *bufio.Writer, nombre string, etiquetas, valores []string, extra, valorExtra string, v float64) {
+	b.WriteString(nombre)
+	n := 0
+	for i, e := range etiquetas {
+		if i >= len(valores) {
+			break
+		}
+		if n == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(e + `="` + escaparEtiqueta(valores[i]) + `"`)
+		n++
+	}
+	if extra != "" {
+		if n == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(extra + `="` + valorExtra + `"`)
+		n++
+	}
+	if n > 0 {
+		b.WriteByte('}')
+	}
+	b.WriteString(" " + numero(v) + "\n")
+}
+
+func numero(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	escapeAyuda    = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	escapeEtiqueta = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escaparAyuda(s string) string    { return escapeAyuda.Replace(s) }
+func escaparEtiqueta(s string) string { return escapeEtiqueta.Replace(s) }
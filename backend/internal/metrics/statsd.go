@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Tamaño máximo de cada datagrama: cabe en la MTU de Ethernet sin
+// fragmentarse, lo que recomiendan StatsD y el agente de Datadog.
+const tamanoPaquete = 1432
+
+// StatsDConfig es la configuración de un exportador StatsD.
+type StatsDConfig struct {
+	// Addr es el host:puerto UDP del servidor StatsD o del agente de Datadog.
+	Addr string
+	// Prefix se antepone al nombre de todas las métricas ("prueba." ...).
+	Prefix string
+	// DogStatsD manda las etiquetas como tags (|#route:...); sin él, en el
+	// StatsD clásico, los valores de las etiquetas se añaden al nombre
+	// separados por puntos.
+	DogStatsD bool
+	// Tags son tags fijos (k:v) que se añaden a todas las métricas; solo con
+	// DogStatsD.
+	Tags []string
+}
+
+// StatsD exporta un registro por UDP en el protocolo de StatsD o en el de
+// DogStatsD.
+//
+// Los contadores se mandan como incrementos (|c) desde el envío anterior y
+// los gauges con su valor (|g). De los histogramas no se guardan las
+// observaciones sino los buckets, así que se mandan como contadores
+// nombre.count, nombre.sum y nombre.bucket (con la etiqueta le), con los
+// que se calculan medias y percentiles aproximados. Lo que se pierde por UDP
+// no se reenvía.
+type StatsD struct {
+	StatsDConfig
+	conn net.Conn
+
+	mu      sync.Mutex
+	previos map[string]float64
+}
+
+// NewStatsD crea un exportador que envía a cfg.Addr.
+func NewStatsD(cfg StatsDConfig) (*StatsD, error) {
+	conn, err := net.Dial("udp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+	return &StatsD{StatsDConfig: cfg, conn: conn, previos: map[string]float64{}}, nil
+}
+
+// Export envía el estado de r.
+func (s *StatsD) Export(r *Registry) error {
+	counters, gauges, histograms := r.metricas()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := &paquetes{conn: s.conn}
+	for _, c := range counters {
+		for _, m := range c.Snapshot() {
+			s.incremento(p, c.Name, c.Labels, m.Labels, "", "", m.Value)
+		}
+	}
+	for _, g := range gauges {
+		for _, m := range g.Snapshot() {
+			// En el StatsD clásico un gauge con signo es un incremento: los
+			// negativos se mandan poniendo antes el gauge a cero
+			if m.Value < 0 && !s.DogStatsD {
+				p.escribir(s.linea(g.Name, g.Labels, m.Labels, "", "", 0, "g"))
+			}
+			p.escribir(s.linea(g.Name, g.Labels, m.Labels, "", "", m.Value, "g"))
+		}
+	}
+	for _, h := range histograms {
+		for _, m := range h.Snapshot() {
+			s.incremento(p, h.Name+".count", h.Labels, m.Labels, "", "", float64(m.Count))
+			s.incremento(p, h.Name+".sum", h.Labels, m.Labels, "", "", m.Sum)
+			for i, limite := range h.Buckets {
+				s.incremento(p, h.Name+".bucket", h.Labels, m.Labels, "le", numero(limite), float64(m.Cumulative[i]))
+			}
+			s.incremento(p, h.Name+".bucket", h.Labels, m.Labels, "le", "+Inf", float64(m.Count))
+		}
+	}
+	p.vaciar()
+	return p.err
+}
+
+// Close cierra la conexión.
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+// incremento manda lo que ha crecido el valor acumulado v de una serie desde
+// el envío anterior, si ha crecido.
+func (s *StatsD) incremento(p *paquetes, nombre string, etiquetas, valores []string, extra, valorExtra string, v float64) {
+	clave := nombre + "\xff" + strings.Join(valores, "\xff") + "\xff" + valorExtra
+	delta := v - s.previos[clave]
+	s.previos[clave] = v
+	if delta <= 0 {
+		return
+	}
+	p.escribir(s.linea(nombre, etiquetas, valores, extra, valorExtra, delta, "c"))
+}
+
+// linea forma nombre:valor|tipo, con las etiquetas como tags o en el nombre
+// según el protocolo; extra y valorExtra son una etiqueta más (le de los
+// buckets) si no están vacías.
+func (s *StatsD) linea(nombre string, etiquetas, valores []string, extra, valorExtra string, v float64, tipo string) string {
+	var b strings.Builder
+	b.WriteString(limpiarNombre(s.Prefix + nombre))
+	var tags []string
+	for i, e := range etiquetas {
+		if i >= len(valores) {
+			break
+		}
+		if s.DogStatsD {
+			tags = append(tags, e+":"+limpiarTag(valores[i]))
+		} else {
+			b.WriteString("." + limpiarSegmento(valores[i]))
+		}
+	}
+	if extra != "" {
+		if s.DogStatsD {
+			tags = append(tags, extra+":"+valorExtra)
+		} else {
+			b.WriteString("." + extra + "_" + limpiarSegmento(valorExtra))
+		}
+	}
+	// Sin notación científica, que no entienden todos los servidores StatsD
+	b.WriteString(":" + strconv.FormatFloat(v, 'f', -1, 64) + "|" + tipo)
+	if s.DogStatsD {
+		tags = append(tags, s.Tags...)
+		if len(tags) > 0 {
+			b.WriteString("|#" + strings.Join(tags, ","))
+		}
+	}
+	return b.String()
+}
+
+// paquetes junta las líneas en datagramas de hasta tamanoPaquete bytes.
+type paquetes struct {
+	conn net.Conn
+	buf  bytes.Buffer
+	err  error
+}
+
+func (p *paquetes) escribir(linea string) {
+	if p.buf.Len() > 0 && p.buf.Len()+1+len(linea) > tamanoPaquete {
+		p.vaciar()
+	}
+	if p.buf.Len() > 0 {
+		p.buf.WriteByte('\n')
+	}
+	p.buf.WriteString(linea)
+}
+
+func (p *paquetes) vaciar() {
+	if p.buf.Len() == 0 {
+		return
+	}
+	if _, err := p.conn.Write(p.buf.Bytes()); err != nil && p.err == nil {
+		p.err = fmt.Errorf("statsd: %w", err)
+	}
+	p.buf.Reset()
+}
+
+var (
+	// En los nombres no pueden ir los separadores del protocolo
+	limpiezaNombre = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", "\n", "_", " ", "_")
+	// Los tags se separan por comas
+	limpiezaTag = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+	// En el StatsD clásico cada etiqueta es un segmento del nombre: sin
+	// puntos (que separan segmentos) ni barras
+	limpiezaSegmento = strings.NewReplacer(".", "_", "/", "_", ":", "_", "|", "_", "@", "_", "#", "_", "\n", "_", " ", "_", "{", "", "}", "")
+)
+
+func limpiarNombre(s string) string { return limpiezaNombre.Replace(s) }
+func limpiarTag(s string) string    { return limpiezaTag.Replace(s) }
+
+func limpiarSegmento(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return limpiezaSegmento.Replace(s)
+}
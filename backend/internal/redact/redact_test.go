@@ -0,0 +1,34 @@
+package redact
+
+import "testing"
+
+func TestString(t *testing.T) {
+	Register("s3cr3t-del-entorno", "corto")
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"sin secretos", "connection refused", "connection refused"},
+		{"url con contraseña", "dial postgres://app:hunter2@db:26257/prueba", "dial postgres://app:" + Mask + "@db:26257/prueba"},
+		{"dsn de mysql", "app:hunter2@tcp(db:3306)/prueba", "app:" + Mask + "@tcp(db:3306)/prueba"},
+		{"clave=valor", "host=db password=hunter2 sslmode=disable", "host=db password=" + Mask + " sslmode=disable"},
+		{"query string", "GET /list?api_key=abc123&page=2", "GET /list?api_key=" + Mask + "&page=2"},
+		{"campo json", `{"user":"ana","password": "hunter2"}`, `{"user":"ana","password":"` + Mask + `"}`},
+		{"bearer", "Authorization: Bearer abcdefgh12345678", "Authorization: Bearer " + Mask},
+		{"x-api-key", "X-API-Key: k-admin-0123456789", "X-API-Key: " + Mask},
+		{"jwt", "token eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJhIn0.c2ln rechazado", "token " + Mask + " rechazado"},
+		{"sesión", "ses_0123456789abcdefXYZ caducada", "ses_" + Mask + " caducada"},
+		{"registrado", "upstream: s3cr3t-del-entorno inválido", "upstream: " + Mask + " inválido"},
+		// Los valores cortos no se registran: aparecerían en cualquier texto
+		{"registrado corto", "respuesta corto", "respuesta corto"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := String(tt.in); got != tt.want {
+				t.Errorf("String(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
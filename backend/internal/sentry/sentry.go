@@ -0,0 +1,315 @@
+// Package sentry envía errores a Sentry (o a un servidor compatible, como
+// GlitchTip) con su protocolo de envelopes sobre HTTP, sin el SDK: los
+// eventos se encolan y se envían en segundo plano.
+package sentry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Default es el cliente del proceso; nil (por defecto) descarta los eventos.
+var Default *Client
+
+// Niveles de los eventos.
+const (
+	LevelError = "error"
+	LevelFatal = "fatal"
+)
+
+// Tamaño de la cola de eventos por enviar.
+const colaEventos = 100
+
+// Config es la configuración de un Client.
+type Config struct {
+	// DSN es el DSN del proyecto: https://<clave>@<host>/<id de proyecto>.
+	DSN string
+	// Release es la versión desplegada (tag release de los eventos).
+	Release string
+	// Environment es el entorno (production, staging...).
+	Environment string
+	// ServerName identifica la máquina o el pod; vacío es el hostname.
+	ServerName string
+	// Logger recibe los errores de envío; nil es slog.Default().
+	Logger *slog.Logger
+}
+
+// Client envía eventos a un proyecto de Sentry. Si la cola se llena, los
+// eventos se descartan: informar de un error no debe frenar la petición.
+type Client struct {
+	Config
+	endpoint string
+	auth     string
+	client   *http.Client
+	cola     chan *Event
+	hecho    chan struct{}
+}
+
+// ValidateDSN comprueba que dsn tiene la forma de un DSN de Sentry.
+func ValidateDSN(dsn string) error {
+	_, _, err := parsearDSN(dsn)
+	return err
+}
+
+// parsearDSN devuelve la URL de envelopes y la clave pública de dsn.
+func parsearDSN(dsn string) (endpoint, clave string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User == nil || u.User.Username() == "" {
+		return "", "", errors.New("invalid Sentry DSN: expected https://<key>@<host>/<project id>")
+	}
+	proyecto := strings.Trim(u.Path, "/")
+	prefijo := ""
+	if i := strings.LastIndex(proyecto, "/"); i >= 0 {
+		prefijo, proyecto = "/"+proyecto[:i], proyecto[i+1:]
+	}
+	if proyecto == "" {
+		return "", "", errors.New("invalid Sentry DSN: missing project id")
+	}
+	return fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefijo, proyecto), u.User.Username(), nil
+}
+
+// New valida el DSN de cfg y crea un Client con su envío en segundo plano;
+// Close lo para.
+func New(cfg Config) (*Client, error) {
+	endpoint, clave, err := parsearDSN(cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName, _ = os.Hostname()
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	c := &Client{
+		Config:   cfg,
+		endpoint: endpoint,
+		auth:     "Sentry sentry_version=7, sentry_client=prueba/1.0, sentry_key=" + clave,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		cola:     make(chan *Event, colaEventos),
+		hecho:    make(chan struct{}),
+	}
+	go c.enviar()
+	return c, nil
+}
+
+// Event es un evento de Sentry. Capture rellena los campos comunes (id,
+// hora, release...).
+type Event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Exception   []Exception       `json:"exception,omitempty"`
+	Request     *Request          `json:"request,omitempty"`
+	User        *User             `json:"user,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]any    `json:"extra,omitempty"`
+	Contexts    map[string]any    `json:"contexts,omitempty"`
+}
+
+// Exception es un error del evento, con la pila de llamadas.
+type Exception struct {
+	Type       string      `json:"type"`
+	Value      string      `json:"value"`
+	Stacktrace *Stacktrace `json:"stacktrace,omitempty"`
+}
+
+// Stacktrace es una pila de llamadas, de la más externa a la más interna
+// (como la espera Sentry).
+type Stacktrace struct {
+	Frames []Frame `json:"frames"`
+}
+
+// Frame es una llamada de la pila.
+type Frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// Request es la petición HTTP en la que se produjo el error.
+type Request struct {
+	URL         string            `json:"url"`
+	Method      string            `json:"method"`
+	QueryString string            `json:"query_string,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+// User es quien hizo la petición.
+type User struct {
+	ID string `json:"id"`
+}
+
+// NewException crea la excepción de err con la pila de quien llama a
+// NewException, saltándose skip llamadas más. El tipo es el del error más
+// interno de la cadena de %w (el primero si hay varios), que suele ser el que identifica el fallo.
+func NewException(err error, skip int) Exception {
+	interno := err
+	for {
+		var u error
+		switch e := interno.(type) {
+		case interface{ Unwrap() error }:
+			u = e.Unwrap()
+		case interface{ Unwrap() []error }:
+			if errs := e.Unwrap(); len(errs) > 0 {
+				u = errs[0]
+			}
+		}
+		if u == nil {
+			break
+		}
+		interno = u
+	}
+	return Exception{
+		Type:       reflect.TypeOf(interno).String(),
+		Value:      err.Error(),
+		Stacktrace: NewStacktrace(skip + 1),
+	}
+}
+
+// NewStacktrace es la pila de quien llama a NewStacktrace, saltándose skip
+// llamadas más. Dentro de un recover la pila incluye la del panic.
+func NewStacktrace(skip int) *Stacktrace {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var out []Frame
+	for {
+		f, more := frames.Next()
+		modulo, funcion := dividirFuncion(f.Function)
+		out = append(out, Frame{
+			Function: funcion,
+			Module:   modulo,
+			Filename: nombreCorto(f.File),
+			AbsPath:  f.File,
+			Lineno:   f.Line,
+			InApp:    strings.HasPrefix(modulo, "prueba/") || modulo == "main",
+		})
+		if !more {
+			break
+		}
+	}
+	// Sentry espera la llamada más reciente al final
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return &Stacktrace{Frames: out}
+}
+
+// dividirFuncion separa "prueba/server.(*Server).getItem.func1" en el
+// paquete y la función.
+func dividirFuncion(nombre string) (modulo, funcion string) {
+	barra := strings.LastIndex(nombre, "/")
+	if i := strings.Index(nombre[barra+1:], "."); i >= 0 {
+		return nombre[:barra+1+i], nombre[barra+2+i:]
+	}
+	return "", nombre
+}
+
+// nombreCorto es la ruta del fichero desde el directorio de su paquete.
+func nombreCorto(ruta string) string {
+	partes := strings.Split(ruta, "/")
+	if len(partes) > 2 {
+		return strings.Join(partes[len(partes)-2:], "/")
+	}
+	return ruta
+}
+
+// Capture pone ev en cola para enviarlo con Default, rellenando los campos
+// comunes. Sin Default no hace nada.
+func Capture(ev *Event) {
+	Default.Capture(ev)
+}
+
+// Capture pone ev en cola para enviarlo con c.
+func (c *Client) Capture(ev *Event) {
+	if c == nil {
+		return
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	ev.EventID = hex.EncodeToString(id)
+	ev.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	ev.Platform = "go"
+	if ev.Level == "" {
+		ev.Level = LevelError
+	}
+	ev.Release, ev.Environment, ev.ServerName = c.Release, c.Environment, c.ServerName
+	select {
+	case c.cola <- ev:
+	default:
+		c.Logger.Warn("Cola de eventos de Sentry llena, evento descartado", "message", ev.Message)
+	}
+}
+
+// Close envía los eventos en cola y para el envío, o se rinde al vencer ctx.
+func (c *Client) Close(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	close(c.cola)
+	select {
+	case <-c.hecho:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) enviar() {
+	defer close(c.hecho)
+	for ev := range c.cola {
+		if err := c.post(ev); err != nil {
+			c.Logger.Warn("Error enviando evento a Sentry", "event_id", ev.EventID, "error", err)
+		}
+	}
+}
+
+// post envía ev en un envelope: cabecera, cabecera del item y el evento, una
+// línea JSON cada uno.
+func (c *Client) post(ev *Event) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.Encode(map[string]string{"event_id": ev.EventID, "sent_at": time.Now().UTC().Format(time.RFC3339Nano)})
+	enc.Encode(map[string]string{"type": "event"})
+	if err := enc.Encode(ev); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", c.auth)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d from Sentry", resp.StatusCode)
+	}
+	return nil
+}
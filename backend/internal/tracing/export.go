@@ -0,0 +1,241 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Tamaño de la cola de spans por exportar, de cada envío y cada cuánto se
+// envía como mucho.
+const (
+	colaSpans      = 4096
+	loteSpans      = 512
+	intervaloEnvio = 5 * time.Second
+)
+
+// Config es la configuración de un Tracer.
+type Config struct {
+	// Endpoint es la URL de OTLP/HTTP de las trazas (…/v1/traces).
+	Endpoint string
+	// Headers se añaden a cada envío (autenticación del colector).
+	Headers map[string]string
+	// Service es el service.name de los spans.
+	Service string
+	// Version es el service.version, si se conoce.
+	Version string
+	// Ratio es la fracción de trazas nuevas que se guardan (de 0 a 1); las
+	// que vienen de otro servicio siguen su decisión (traceparent).
+	Ratio float64
+	// Logger recibe los errores de exportación; nil es slog.Default().
+	Logger *slog.Logger
+}
+
+// Tracer genera spans y los exporta en segundo plano. Si la cola se llena,
+// los spans se descartan: las trazas no deben frenar las peticiones.
+type Tracer struct {
+	Config
+	client *http.Client
+	cola   chan spanTerminado
+	hecho  chan struct{}
+}
+
+type spanTerminado struct {
+	s   *Span
+	fin time.Time
+}
+
+// New crea un Tracer y arranca su exportador; Shutdown lo para.
+func New(cfg Config) *Tracer {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	t := &Tracer{
+		Config: cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		cola:   make(chan spanTerminado, colaSpans),
+		hecho:  make(chan struct{}),
+	}
+	go t.exportar()
+	return t
+}
+
+func (t *Tracer) encolar(s *Span, fin time.Time) {
+	select {
+	case t.cola <- spanTerminado{s, fin}:
+	default:
+	}
+}
+
+// Shutdown envía los spans en cola y para el exportador, o se rinde al
+// vencer ctx.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	close(t.cola)
+	select {
+	case <-t.hecho:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) exportar() {
+	defer close(t.hecho)
+	ticker := time.NewTicker(intervaloEnvio)
+	defer ticker.Stop()
+	var lote []spanTerminado
+	for {
+		select {
+		case st, ok := <-t.cola:
+			if !ok {
+				t.enviar(lote)
+				return
+			}
+			lote = append(lote, st)
+			if len(lote) < loteSpans {
+				continue
+			}
+		case <-ticker.C:
+		}
+		t.enviar(lote)
+		lote = lote[:0]
+	}
+}
+
+func (t *Tracer) enviar(lote []spanTerminado) {
+	if len(lote) == 0 {
+		return
+	}
+	cuerpo, err := json.Marshal(t.otlp(lote))
+	if err == nil {
+		err = t.post(cuerpo)
+	}
+	if err != nil {
+		t.Logger.Warn("Error exportando trazas", "spans", len(lote), "error", err)
+	}
+}
+
+func (t *Tracer) post(cuerpo []byte) error {
+	req, err := http.NewRequest(http.MethodPost, t.Endpoint, bytes.NewReader(cuerpo))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, t.Endpoint)
+	}
+	return nil
+}
+
+// Mensaje ExportTraceServiceRequest de OTLP en su codificación JSON (ids en
+// hexadecimal y enteros de 64 bits como texto).
+type (
+	otlpPeticion struct {
+		ResourceSpans []otlpRecurso `json:"resourceSpans"`
+	}
+	otlpRecurso struct {
+		Resource struct {
+			Attributes []otlpAtributo `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []otlpAmbito `json:"scopeSpans"`
+	}
+	otlpAmbito struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpSpan struct {
+		TraceID      string         `json:"traceId"`
+		SpanID       string         `json:"spanId"`
+		ParentSpanID string         `json:"parentSpanId,omitempty"`
+		Name         string         `json:"name"`
+		Kind         int            `json:"kind"`
+		Start        string         `json:"startTimeUnixNano"`
+		End          string         `json:"endTimeUnixNano"`
+		Attributes   []otlpAtributo `json:"attributes,omitempty"`
+		Status       *otlpEstado    `json:"status,omitempty"`
+	}
+	otlpEstado struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpAtributo struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+)
+
+// Código de estado de error de OTLP.
+const otlpStatusError = 2
+
+func (t *Tracer) otlp(lote []spanTerminado) otlpPeticion {
+	var r otlpRecurso
+	r.Resource.Attributes = []otlpAtributo{atributo("service.name", t.Service)}
+	if t.Version != "" {
+		r.Resource.Attributes = append(r.Resource.Attributes, atributo("service.version", t.Version))
+	}
+	var a otlpAmbito
+	a.Scope.Name = "prueba"
+	for _, st := range lote {
+		s := st.s
+		s.mu.Lock()
+		o := otlpSpan{
+			TraceID: hex.EncodeToString(s.sc.TraceID[:]),
+			SpanID:  hex.EncodeToString(s.sc.SpanID[:]),
+			Name:    s.name,
+			Kind:    s.kind,
+			Start:   strconv.FormatInt(s.start.UnixNano(), 10),
+			End:     strconv.FormatInt(st.fin.UnixNano(), 10),
+		}
+		if s.parent != [8]byte{} {
+			o.ParentSpanID = hex.EncodeToString(s.parent[:])
+		}
+		for k, v := range s.attrs {
+			o.Attributes = append(o.Attributes, atributo(k, v))
+		}
+		if s.err != "" {
+			o.Status = &otlpEstado{Code: otlpStatusError, Message: s.err}
+		}
+		s.mu.Unlock()
+		a.Spans = append(a.Spans, o)
+	}
+	r.ScopeSpans = []otlpAmbito{a}
+	return otlpPeticion{ResourceSpans: []otlpRecurso{r}}
+}
+
+func atributo(k string, v any) otlpAtributo {
+	var val map[string]any
+	switch x := v.(type) {
+	case string:
+		val = map[string]any{"stringValue": x}
+	case bool:
+		val = map[string]any{"boolValue": x}
+	case int:
+		val = map[string]any{"intValue": strconv.Itoa(x)}
+	case int64:
+		val = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+	case float64:
+		val = map[string]any{"doubleValue": x}
+	default:
+		val = map[string]any{"stringValue": fmt.Sprint(x)}
+	}
+	return otlpAtributo{Key: k, Value: val}
+}
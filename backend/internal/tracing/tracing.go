@@ -0,0 +1,286 @@
+// Package tracing es una implementación mínima de trazas distribuidas
+// compatible con OpenTelemetry: spans con propagación W3C Trace Context
+// (cabecera traceparent) que se exportan por OTLP/HTTP en JSON al colector
+// configurado.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tipos de span (SpanKind de OTLP).
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// Default es el tracer del proceso; nil (por defecto) no genera trazas y
+// Start devuelve spans nil, cuyos métodos no hacen nada.
+var Default *Tracer
+
+// SpanContext identifica un span dentro de su traza.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// Span es una operación de una traza. Un *Span nil (trazas desactivadas o
+// traza no muestreada) acepta todas las llamadas sin hacer nada.
+type Span struct {
+	t      *Tracer
+	sc     SpanContext
+	parent [8]byte
+	name   string
+	kind   int
+	start  time.Time
+
+	mu    sync.Mutex
+	attrs map[string]any
+	err   string
+	ended bool
+}
+
+type claveSpan struct{}
+
+// FromContext devuelve el span en curso de ctx, o nil.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(claveSpan{}).(*Span)
+	return s
+}
+
+// ContextWithSpan devuelve ctx con s como span en curso: para que el
+// trabajo que sigue en segundo plano, con otro contexto, cuelgue de la traza
+// de la petición que lo lanzó. Con s nil devuelve ctx.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, claveSpan{}, s)
+}
+
+// remoto es el span de otro proceso (traceparent de la petición) del que
+// cuelgan los de esta.
+type claveRemoto struct{}
+
+// WithRemote devuelve ctx con el span remoto sc como padre de los que se
+// creen a partir de él.
+func WithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, claveRemoto{}, sc)
+}
+
+// Start empieza un span hijo del de ctx (o del remoto de WithRemote, o uno
+// raíz) con Default y lo devuelve junto con ctx con él.
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	return Default.Start(ctx, name, kind)
+}
+
+// Start empieza un span con el tracer t.
+func (t *Tracer) Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	s := t.nuevo(ctx, name, kind, time.Now())
+	if s == nil {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, claveSpan{}, s), s
+}
+
+// Record registra un span ya terminado, hijo del de ctx, que empezó en start
+// y duró d: las operaciones que solo se conocen al acabar (consultas de pgx).
+func Record(ctx context.Context, name string, kind int, start time.Time, d time.Duration, attrs map[string]any, err error) {
+	s := Default.nuevo(ctx, name, kind, start)
+	if s == nil {
+		return
+	}
+	s.attrs = attrs
+	s.SetError(err)
+	s.terminar(start.Add(d))
+}
+
+func (t *Tracer) nuevo(ctx context.Context, name string, kind int, start time.Time) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{t: t, name: name, kind: kind, start: start}
+	if padre := FromContext(ctx); padre != nil {
+		s.sc.TraceID, s.parent = padre.sc.TraceID, padre.sc.SpanID
+	} else if sc, ok := ctx.Value(claveRemoto{}).(SpanContext); ok {
+		if !sc.Sampled {
+			return nil
+		}
+		s.sc.TraceID, s.parent = sc.TraceID, sc.SpanID
+	} else {
+		rand.Read(s.sc.TraceID[:])
+		if !t.muestrear(s.sc.TraceID) {
+			return nil
+		}
+	}
+	rand.Read(s.sc.SpanID[:])
+	s.sc.Sampled = true
+	return s
+}
+
+// muestrear decide si se guarda una traza nueva según Ratio, a partir de su
+// id para que la decisión sea estable.
+func (t *Tracer) muestrear(id [16]byte) bool {
+	if t.Ratio >= 1 {
+		return true
+	}
+	return float64(binary.BigEndian.Uint64(id[8:])>>11)/(1<<53) < t.Ratio
+}
+
+// Context es el SpanContext de s.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// TraceID es el id de la traza de s en hexadecimal, o "" si s es nil.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.sc.TraceID[:])
+}
+
+// SpanID es el id de s en hexadecimal, o "" si s es nil.
+func (s *Span) SpanID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.sc.SpanID[:])
+}
+
+// SetName cambia el nombre de s (p. ej. cuando la ruta se conoce al final).
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttr añade un atributo a s. Los valores son string, bool, int, int64 o
+// float64; el resto se exporta como texto.
+func (s *Span) SetAttr(key string, v any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.attrs == nil {
+		s.attrs = map[string]any{}
+	}
+	s.attrs[key] = v
+	s.mu.Unlock()
+}
+
+// SetError marca s como fallido con el mensaje de err, si no es nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.err = err.Error()
+	s.mu.Unlock()
+}
+
+// End termina s y lo pone en cola para exportarlo. Solo cuenta la primera
+// llamada.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.terminar(time.Now())
+}
+
+func (s *Span) terminar(fin time.Time) {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.mu.Unlock()
+	s.t.encolar(s, fin)
+}
+
+// Cabecera de W3C Trace Context.
+const traceparentHeader = "traceparent"
+
+// Extract lee el traceparent de h ("00-<trace id>-<span id>-<flags>").
+func Extract(h http.Header) (SpanContext, bool) {
+	var sc SpanContext
+	partes := strings.Split(strings.TrimSpace(h.Get(traceparentHeader)), "-")
+	if len(partes) < 4 || len(partes[0]) != 2 || partes[0] == "ff" || len(partes[1]) != 32 || len(partes[2]) != 16 || len(partes[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(partes[1])); err != nil || sc.TraceID == [16]byte{} {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(partes[2])); err != nil || sc.SpanID == [8]byte{} {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(partes[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+// Inject pone en h el traceparent del span de ctx, si lo hay.
+func Inject(ctx context.Context, h http.Header) {
+	s := FromContext(ctx)
+	if s == nil {
+		return
+	}
+	h.Set(traceparentHeader, "00-"+hex.EncodeToString(s.sc.TraceID[:])+"-"+hex.EncodeToString(s.sc.SpanID[:])+"-01")
+}
+
+// Transport envuelve base (http.DefaultTransport si es nil) para que cada
+// petición sea un span de cliente y lleve el traceparent.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return transporte{base}
+}
+
+type transporte struct{ base http.RoundTripper }
+
+func (t transporte) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Start(req.Context(), "HTTP "+req.Method, KindClient)
+	if span == nil {
+		return t.base.RoundTrip(req)
+	}
+	defer span.End()
+	span.SetAttr("http.request.method", req.Method)
+	span.SetAttr("server.address", req.URL.Host)
+	span.SetAttr("url.path", req.URL.Path)
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttr("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 500 {
+		span.SetError(errorEstado(resp.Status))
+	}
+	return resp, nil
+}
+
+type errorEstado string
+
+func (e errorEstado) Error() string { return string(e) }
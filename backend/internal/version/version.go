@@ -0,0 +1,74 @@
+// Package version identifica el binario en ejecución: versión, commit y
+// fecha de compilación. Se fijan al compilar con -ldflags:
+//
+//	go build -ldflags "-X prueba/internal/version.Version=1.4.0 \
+//	  -X prueba/internal/version.Commit=$(git rev-parse HEAD) \
+//	  -X prueba/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Sin ellos, Commit y BuildTime salen de la información de git que go build
+// guarda en el binario (si se compiló dentro del repositorio).
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Valores de -ldflags.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info describe el binario.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	// Modified indica que se compiló con cambios sin commitear (solo si el
+	// commit sale de la información de git del binario).
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+var info = sync.OnceValue(func() Info {
+	i := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return i
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if i.Commit == "" {
+				i.Commit = s.Value
+			}
+		case "vcs.time":
+			if i.BuildTime == "" {
+				i.BuildTime = s.Value
+			}
+		case "vcs.modified":
+			i.Modified = Commit == "" && s.Value == "true"
+		}
+	}
+	return i
+})
+
+// Get devuelve la información del binario.
+func Get() Info {
+	return info()
+}
+
+// String es la versión con el commit abreviado, como "1.4.0 (3f2a9c1)".
+func (i Info) String() string {
+	if len(i.Commit) < 7 {
+		return i.Version
+	}
+	s := i.Version + " (" + i.Commit[:7]
+	if i.Modified {
+		s += "-dirty"
+	}
+	return s + ")"
+}
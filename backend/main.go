@@ -1,32 +1,98 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"prueba/internal/version"
 	"prueba/server"
-
-	"github.com/joho/godotenv"
+	"syscall"
 )
 
 func main() {
-	// Cargar variables de entorno
-	if err := godotenv.Load(); err != nil {
-		log.Println("No se encontró archivo .env, usando variables de entorno del sistema")
+	// Cargar variables de entorno de los ficheros del perfil (APP_ENV)
+	if _, err := server.LoadEnv(); err != nil {
+		fatal("Error cargando el entorno", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == subcomandoHealthcheck {
+		os.Exit(healthcheck(os.Args[2:]))
+	}
+	if err := aplicarFlags(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fatal("Flags incorrectos", err)
+	}
+
+	cfg, err := server.LoadConfig()
+	if err != nil {
+		fatal("Configuración incorrecta", err)
+	}
+	// A partir de aquí los logs salen en el formato y nivel configurados
+	logger, err := server.NewLogger(cfg)
+	if err != nil {
+		fatal("Error abriendo el fichero de log", err)
 	}
+	logger.Info("Configuración cargada", "profile", cfg.Profile, "log_level", cfg.LogLevel, "version", version.Get().String())
 
-	port := os.Getenv("portback")
-	if port == "" {
-		port = "8080"
+	srv, err := server.New(cfg)
+	if err != nil {
+		fatal("Error iniciando el servidor", err)
 	}
 
-	addr := fmt.Sprintf(":%s", port)
-	srv := server.New(addr)
+	// Apagado ordenado ante SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Relevo por otro proceso ante SIGUSR2 (despliegue sin cortes con
+	// reuse_port): se deja terminar lo que esté en curso
+	relevo := make(chan os.Signal, 1)
+	if len(senalesRelevo) > 0 {
+		signal.Notify(relevo, senalesRelevo...)
+	}
+	// Recarga de la configuración ante SIGHUP
+	recarga := make(chan os.Signal, 1)
+	if len(senalesRecarga) > 0 {
+		signal.Notify(recarga, senalesRecarga...)
+	}
 
-	log.Printf("Servidor iniciado en http://localhost%s", addr)
-	err := srv.ListenAndServe()
+	go func() {
+		logger.Info("Servidor iniciado", "addr", srv.Addr, "scheme", cfg.Scheme())
+		if err := server.ListenAndServe(srv, cfg); err != nil && err != http.ErrServerClosed {
+			panic(err)
+		}
+	}()
 
-	if err != nil {
-		panic(err)
+	var apagar func(context.Context, *http.Server) error
+	for apagar == nil {
+		select {
+		case <-recarga:
+			logger.Info("Recargando la configuración...")
+			if err := server.Reload(); err != nil {
+				logger.Error("Configuración no recargada", "error", err)
+			}
+		case <-ctx.Done():
+			logger.Info("Señal de apagado recibida, deteniendo el servidor...")
+			apagar = server.Shutdown
+		case <-relevo:
+			logger.Info("Relevo solicitado, terminando lo que está en curso...")
+			apagar = server.Handover
+		}
 	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := apagar(shutdownCtx, srv); err != nil {
+		logger.Error("Error durante el apagado", "error", err)
+	}
+	logger.Info("Servidor detenido")
+}
+
+// fatal registra un error de arranque y termina el proceso.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,27 @@
+// Package cache son los almacenes clave-valor con caducidad en los que el
+// servidor guarda respuestas ya calculadas: en memoria del proceso o en Redis,
+// compartido por todas las réplicas.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache es un almacén de valores con caducidad. Un fallo de Get o Set no
+// debe hacer fallar la petición: quien la usa puede tratarlo como un fallo de
+// caché y calcular el valor.
+type Cache interface {
+	// Get devuelve el valor de key; ok es false si no está o caducó.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set guarda value en key durante ttl; 0 es sin caducidad.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Counter es un almacén de contadores con caducidad, para contar peticiones
+// por ventana de tiempo. Get de Cache devuelve el valor en decimal.
+type Counter interface {
+	// Incr suma uno al contador key y devuelve el nuevo valor. Un contador
+	// que no existía empieza en 1 y caduca pasado ttl.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
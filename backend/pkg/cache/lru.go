@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LRU es una Cache en memoria del proceso, para instancias únicas sin Redis.
+// Está acotada en entradas y en bytes (la suma de claves y valores): al
+// superar cualquiera de los dos límites se descartan las entradas usadas hace
+// más tiempo. Un valor que no cabe entero no se guarda.
+type LRU struct {
+	maxEntries int
+	maxBytes   int
+
+	mu    sync.Mutex
+	orden *list.List // de la más reciente a la más antigua
+	items map[string]*list.Element
+	bytes int
+}
+
+type entradaLRU struct {
+	clave string
+	valor []byte
+	// expira es cero en las entradas sin caducidad.
+	expira time.Time
+}
+
+func (e *entradaLRU) peso() int {
+	return len(e.clave) + len(e.valor)
+}
+
+// NewLRU crea una caché LRU de como mucho maxEntries entradas y maxBytes
+// bytes; 0 deja sin límite ese criterio.
+func NewLRU(maxEntries, maxBytes int) *LRU {
+	return &LRU{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		orden:      list.New(),
+		items:      map[string]*list.Element{},
+	}
+}
+
+func (c *LRU) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*entradaLRU)
+	if !e.expira.IsZero() && time.Now().After(e.expira) {
+		c.quitar(el)
+		return nil, false, nil
+	}
+	c.orden.MoveToFront(el)
+	return e.valor, true, nil
+}
+
+func (c *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	e := &entradaLRU{clave: key, valor: value}
+	if ttl > 0 {
+		e.expira = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.quitar(el)
+	}
+	if c.maxBytes > 0 && e.peso() > c.maxBytes {
+		return nil
+	}
+	c.items[key] = c.orden.PushFront(e)
+	c.bytes += e.peso()
+	c.desalojar()
+	return nil
+}
+
+func (c *LRU) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n int64
+	var expira time.Time
+	if ttl > 0 {
+		expira = time.Now().Add(ttl)
+	}
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entradaLRU)
+		if e.expira.IsZero() || time.Now().Before(e.expira) {
+			n, _ = strconv.ParseInt(string(e.valor), 10, 64)
+			expira = e.expira
+		}
+		c.quitar(el)
+	}
+	n++
+	e := &entradaLRU{clave: key, valor: strconv.AppendInt(nil, n, 10), expira: expira}
+	c.items[key] = c.orden.PushFront(e)
+	c.bytes += e.peso()
+	c.desalojar()
+	return n, nil
+}
+
+// desalojar descarta las entradas más antiguas hasta volver a los límites.
+func (c *LRU) desalojar() {
+	for (c.maxEntries > 0 && c.orden.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.quitar(c.orden.Back())
+	}
+}
+
+func (c *LRU) quitar(el *list.Element) {
+	e := c.orden.Remove(el).(*entradaLRU)
+	delete(c.items, e.clave)
+	c.bytes -= e.peso()
+}
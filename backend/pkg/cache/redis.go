@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conexiones a Redis que se guardan abiertas para reutilizarlas.
+const redisMaxIdle = 8
+
+// Redis es una Cache en un servidor Redis, compartida por todas las réplicas.
+// Habla RESP2 directamente con un pool pequeño de conexiones; solo usa GET y
+// SET (y AUTH y SELECT al conectar).
+type Redis struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+	// timeout limita cada conexión y cada comando cuando el contexto no
+	// tiene un plazo menor.
+	timeout time.Duration
+
+	libres chan *redisConn
+}
+
+// NewRedis crea el cliente de rawURL, con la forma
+// redis://[[usuario]:contraseña@]host[:puerto][/db] (rediss:// con TLS). No
+// conecta hasta el primer uso.
+func NewRedis(rawURL string, timeout time.Duration) (*Redis, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid redis url %q: expected redis://host[:port][/db] or rediss://", u.Redacted())
+	}
+	r := &Redis{
+		addr:    u.Host,
+		timeout: timeout,
+		libres:  make(chan *redisConn, redisMaxIdle),
+	}
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil || r.db < 0 {
+			return nil, fmt.Errorf("invalid redis url %q: bad database %q", u.Redacted(), db)
+		}
+	}
+	if u.Scheme == "rediss" {
+		r.tls = &tls.Config{MinVersion: tls.VersionTLS12, ServerName: u.Hostname()}
+	}
+	return r, nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	v, err := r.do(ctx, "GET", key)
+	if err != nil {
+		return nil, false, err
+	}
+	if v == nil {
+		return nil, false, nil
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis GET: unexpected reply %v", v)
+	}
+	return b, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+func (r *Redis) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	v, err := r.do(ctx, "INCR", key)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis INCR: unexpected reply %v", v)
+	}
+	// La caducidad se pone al crearlo: así la ventana no se alarga con cada
+	// petición
+	if n == 1 && ttl > 0 {
+		if _, err := r.do(ctx, "PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10)); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Close cierra las conexiones libres.
+func (r *Redis) Close() {
+	for {
+		select {
+		case c := <-r.libres:
+			c.conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// errorRedis es una respuesta de error del servidor (-ERR ...): la conexión
+// sigue siendo válida.
+type errorRedis string
+
+func (e errorRedis) Error() string { return "redis: " + string(e) }
+
+// do ejecuta un comando y devuelve su respuesta: string, int64, []byte o nil.
+// Si falla la conexión se descarta.
+func (r *Redis) do(ctx context.Context, args ...string) (any, error) {
+	c, err := r.conexion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v, err := c.comando(r.plazo(ctx), args...)
+	var errR errorRedis
+	if err != nil && !errors.As(err, &errR) {
+		c.conn.Close()
+		return nil, err
+	}
+	select {
+	case r.libres <- c:
+	default:
+		c.conn.Close()
+	}
+	return v, err
+}
+
+// plazo es el límite de un comando: el del contexto o timeout, el menor.
+func (r *Redis) plazo(ctx context.Context) time.Time {
+	d := time.Now().Add(r.timeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(d) {
+		return dl
+	}
+	return d
+}
+
+// conexion toma una conexión libre o abre una nueva.
+func (r *Redis) conexion(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-r.libres:
+		return c, nil
+	default:
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, r.plazo(ctx))
+	defer cancel()
+	var conn net.Conn
+	var err error
+	if r.tls != nil {
+		d := tls.Dialer{Config: r.tls}
+		conn, err = d.DialContext(ctx, "tcp", r.addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", r.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to redis: %w", err)
+	}
+	c := &redisConn{conn: conn, rd: bufio.NewReader(conn), wr: bufio.NewWriter(conn)}
+
+	var iniciales [][]string
+	switch {
+	case r.username != "":
+		iniciales = append(iniciales, []string{"AUTH", r.username, r.password})
+	case r.password != "":
+		iniciales = append(iniciales, []string{"AUTH", r.password})
+	}
+	if r.db != 0 {
+		iniciales = append(iniciales, []string{"SELECT", strconv.Itoa(r.db)})
+	}
+	for _, args := range iniciales {
+		if _, err := c.comando(r.plazo(ctx), args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error initializing redis connection (%s): %w", args[0], err)
+		}
+	}
+	return c, nil
+}
+
+type redisConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+	wr   *bufio.Writer
+}
+
+// comando envía args como un array de bulk strings y lee la respuesta.
+func (c *redisConn) comando(plazo time.Time, args ...string) (any, error) {
+	c.conn.SetDeadline(plazo)
+	fmt.Fprintf(c.wr, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(c.wr, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if err := c.wr.Flush(); err != nil {
+		return nil, err
+	}
+	return c.leer()
+}
+
+// leer lee una respuesta RESP2 que no sea un array (los comandos que se usan
+// no los devuelven).
+func (c *redisConn) leer() (any, error) {
+	linea, err := c.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	linea = strings.TrimSuffix(linea, "\r\n")
+	if linea == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch linea[0] {
+	case '+':
+		return linea[1:], nil
+	case '-':
+		return nil, errorRedis(linea[1:])
+	case ':':
+		return strconv.ParseInt(linea[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(linea[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad bulk length %q", linea)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.rd, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", linea)
+	}
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashAPIKey es el hash con el que se guarda y se busca una clave de la API:
+// SHA-256 en hexadecimal. Las claves son aleatorias y largas, así que no
+// hace falta un hash lento como el de las contraseñas.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,54 @@
+package repository
+
+import "strings"
+
+const auditColumns = `id, created_at, tenant_id, action, actor, auth_method, ip, request_id, target, status, detail`
+
+// auditInsert es el INSERT de un evento; created_at va en el último
+// parámetro.
+func auditInsert(d *dialecto) string {
+	ph := make([]string, 10)
+	for i := range ph {
+		ph[i] = d.placeholder(i + 1)
+	}
+	return `INSERT INTO audit_log (tenant_id, action, actor, auth_method, ip, request_id, target, status, detail, created_at) VALUES (` + strings.Join(ph, ", ") + `)`
+}
+
+// auditArgs son los argumentos de auditInsert.
+func auditArgs(ev AuditEvent) []interface{} {
+	return []interface{}{ev.Tenant, ev.Action, ev.Actor, ev.AuthMethod, ev.IP, ev.RequestID, ev.Target, ev.Status, ev.Detail, ev.Time.UTC()}
+}
+
+// auditSelect es la consulta de List para f.
+func auditSelect(d *dialecto, f AuditFilter) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	filtro := func(cond string, v interface{}) {
+		args = append(args, v)
+		where = append(where, cond+" "+d.placeholder(len(args)))
+	}
+	if f.Tenant != "" {
+		filtro("tenant_id =", f.Tenant)
+	}
+	if f.Action != "" {
+		filtro("action =", f.Action)
+	}
+	if f.Actor != "" {
+		filtro("actor =", f.Actor)
+	}
+	if !f.Since.IsZero() {
+		filtro("created_at >=", f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		filtro("created_at <", f.Until.UTC())
+	}
+	if f.Before > 0 {
+		filtro("id <", f.Before)
+	}
+	query := `SELECT ` + auditColumns + ` FROM audit_log`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit)
+	return query + ` ORDER BY id DESC LIMIT ` + d.placeholder(len(args)), args
+}
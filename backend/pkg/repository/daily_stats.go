@@ -0,0 +1,26 @@
+package repository
+
+// dailyStatsUpsert es el destino de los upserts de daily_stats.
+var dailyStatsUpsert = upsertSpec{
+	Table:   "daily_stats",
+	Columns: []string{"tenant_id", "day", "total", "upgrades", "downgrades", "targets_raised", "targets_lowered", "avg_target_change"},
+	Key:     []string{"tenant_id", "day"},
+}
+
+const dailyStatsColumns = `day, total, upgrades, downgrades, targets_raised, targets_lowered, avg_target_change`
+
+// dailyStatValues devuelve los valores de dailyStatsUpsert para tenant.
+func dailyStatValues(tenant string) func(DailyStat) []interface{} {
+	return func(s DailyStat) []interface{} {
+		return []interface{}{
+			tenant,
+			s.Day.UTC(),
+			s.Total,
+			s.Upgrades,
+			s.Downgrades,
+			s.TargetsRaised,
+			s.TargetsLowered,
+			s.AvgTargetChange,
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// decimalesPrecio son los decimales de los precios objetivo, los de las
+// columnas DECIMAL(18, 4) de MySQL.
+const decimalesPrecio = 4
+
+// escalaDecimal es 10^decimalesPrecio.
+var escalaDecimal = big.NewRat(10000, 1)
+
+// Decimal es un importe con cuatro decimales exactos (los precios objetivo).
+// Se guarda en diezmilésimas para no pasar por float64: "$1,234.10" se lee,
+// se guarda en la columna NUMERIC/DECIMAL y se devuelve en el JSON sin
+// errores de redondeo. SQLite no tiene tipo decimal y guarda REAL; al leer se
+// redondea a cuatro decimales.
+type Decimal struct {
+	diezmilesimas int64
+}
+
+// formatoDecimal es lo que acepta ParseDecimal: notación decimal, con
+// exponente opcional. big.Rat acepta además fracciones ("1/3"), hexadecimal
+// ("0x1p4") y exponentes enormes, lentos de calcular.
+var formatoDecimal = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]{1,3})?$`)
+
+// ParseDecimal interpreta un número decimal ("1234.5", "-3", "12345e-1").
+// Los decimales a partir del quinto se redondean.
+func ParseDecimal(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if !formatoDecimal.MatchString(s) {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	return decimalDeRat(r)
+}
+
+// decimalDeRat redondea r a cuatro decimales (los empates, alejándose de
+// cero).
+func decimalDeRat(r *big.Rat) (Decimal, error) {
+	s := new(big.Rat).Mul(r, escalaDecimal).FloatString(0)
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return Decimal{}, fmt.Errorf("decimal %s out of range", r.FloatString(decimalesPrecio))
+	}
+	return Decimal{diezmilesimas: n}, nil
+}
+
+// Sign devuelve -1, 0 o 1 según el signo de d.
+func (d Decimal) Sign() int {
+	switch {
+	case d.diezmilesimas < 0:
+		return -1
+	case d.diezmilesimas > 0:
+		return 1
+	}
+	return 0
+}
+
+// Float64 es d como float64, para cálculos aproximados (porcentajes...).
+func (d Decimal) Float64() float64 {
+	return float64(d.diezmilesimas) / 10000
+}
+
+// String devuelve d sin ceros a la derecha: "1234.5", "12", "-0.0001".
+func (d Decimal) String() string {
+	signo := ""
+	n := d.diezmilesimas
+	if n < 0 {
+		signo = "-"
+	}
+	digitos := strings.TrimPrefix(strconv.FormatInt(n, 10), "-")
+	if len(digitos) <= decimalesPrecio {
+		digitos = strings.Repeat("0", decimalesPrecio+1-len(digitos)) + digitos
+	}
+	entera, frac := digitos[:len(digitos)-decimalesPrecio], strings.TrimRight(digitos[len(digitos)-decimalesPrecio:], "0")
+	if frac == "" {
+		return signo + entera
+	}
+	return signo + entera + "." + frac
+}
+
+// MarshalJSON escribe d como número JSON.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON lee un número JSON sin pasar por float64.
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	v, err := ParseDecimal(string(b))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// decimalNulo lee una columna decimal que puede ser NULL, con el valor que
+// devuelva cada driver: texto (pgx, MySQL) o REAL (SQLite).
+type decimalNulo struct {
+	Decimal Decimal
+	Valid   bool
+}
+
+func (n *decimalNulo) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		n.Valid = false
+		return nil
+	case string:
+		n.Decimal, err = ParseDecimal(v)
+	case []byte:
+		n.Decimal, err = ParseDecimal(string(v))
+	case float64:
+		r := new(big.Rat)
+		if r.SetFloat64(v) == nil {
+			return fmt.Errorf("invalid decimal %v", v)
+		}
+		n.Decimal, err = decimalDeRat(r)
+	case int64:
+		n.Decimal, err = decimalDeRat(new(big.Rat).SetInt64(v))
+	default:
+		return fmt.Errorf("cannot scan %T into a decimal", src)
+	}
+	n.Valid = err == nil
+	return err
+}
+
+// ptr devuelve el decimal leído, o nil si era NULL.
+func (n decimalNulo) ptr() *Decimal {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Decimal
+}
+
+// valorDecimal es el parámetro de una columna decimal: el número como texto,
+// que todos los drivers convierten sin pérdida, o NULL si d es nil.
+func valorDecimal(d *Decimal) interface{} {
+	if d == nil {
+		return nil
+	}
+	return d.String()
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"1234.10", "1234.1", false},
+		{"0.1", "0.1", false},
+		{"-3", "-3", false},
+		{"12345e-1", "1234.5", false},
+		{" 7 ", "7", false},
+		{"0.00005", "0.0001", false},
+		{"0.00004", "0", false},
+		{"-0.0001", "-0.0001", false},
+		{"1/3", "", true},
+		{"0x1p4", "", true},
+		{"1e100000", "", true},
+		{"+.5", "0.5", false},
+		{"2.", "2", false},
+		{"abc", "", true},
+		{"", "", true},
+		{"1e30", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			d, err := ParseDecimal(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDecimal(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if err == nil && d.String() != tt.want {
+				t.Errorf("ParseDecimal(%q) = %s, want %s", tt.in, d, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var v struct {
+		Precio *Decimal `json:"precio"`
+	}
+	if err := json.Unmarshal([]byte(`{"precio": 0.30000000000000004}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != `{"precio":0.3}` {
+		t.Errorf("json = %s, want {\"precio\":0.3}", got)
+	}
+}
+
+func TestDecimalNuloScan(t *testing.T) {
+	tests := []struct {
+		name string
+		src  any
+		want string
+	}{
+		{"nil", nil, "NULL"},
+		{"texto", "1234.1000", "1234.1"},
+		{"bytes", []byte("0.25"), "0.25"},
+		// SQLite guarda REAL: se redondea a cuatro decimales
+		{"float64", 0.1 + 0.2, "0.3"},
+		{"int64", int64(42), "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n decimalNulo
+			if err := n.Scan(tt.src); err != nil {
+				t.Fatal(err)
+			}
+			got := "NULL"
+			if d := n.ptr(); d != nil {
+				got = d.String()
+			}
+			if got != tt.want {
+				t.Errorf("Scan(%v) = %s, want %s", tt.src, got, tt.want)
+			}
+		})
+	}
+}
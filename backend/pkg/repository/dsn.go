@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+)
+
+// DSNPassword devuelve la contraseña del dsn de driver (vacío o postgres, o
+// mysql), o "" si no lleva o no se entiende. Es para quitarla de los logs.
+func DSNPassword(driver, dsn string) string {
+	switch driver {
+	case "", "postgres":
+		if c, err := pgconn.ParseConfig(dsn); err == nil {
+			return c.Password
+		}
+	case "mysql":
+		if c, err := mysql.ParseDSN(dsn); err == nil {
+			return c.Passwd
+		}
+	}
+	return ""
+}
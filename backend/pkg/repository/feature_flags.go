@@ -0,0 +1,8 @@
+package repository
+
+// featureFlagsUpsert es el destino de FeatureFlagRepository.Set.
+var featureFlagsUpsert = upsertSpec{
+	Table:   "feature_flags",
+	Columns: []string{"name", "enabled", "updated_at"},
+	Key:     []string{"name"},
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AsOf es el momento del pasado en el que se consulta items: una generación
+// (el id de la sync_run que la escribió) o, si Generation es 0, una fecha.
+type AsOf struct {
+	Generation int64
+	Time       time.Time
+}
+
+// tablaHistorico es la tabla con todas las versiones de las filas de items.
+func tablaHistorico(items string) string {
+	return items + "_history"
+}
+
+// columnasComparadas son las columnas de items que, si cambian, crean una
+// versión nueva en el histórico (el resto forma la clave).
+var columnasComparadas = []string{"target_from", "target_to", "company", "action", "rating_from", "rating_to", "version"}
+
+// sentencia es una consulta con sus parámetros.
+type sentencia struct {
+	query string
+	args  []interface{}
+}
+
+// registroGeneracion son las sentencias que llevan al histórico el contenido
+// actual de items de tenant como generación generation: primero se marcan como
+// superadas las filas vigentes que ya no están en items o que cambiaron, y
+// después se insertan las que no tienen fila vigente. Las filas sin cambios
+// conservan la generación en la que aparecieron.
+func registroGeneracion(items string, d *dialecto, tenant string, generation int64, at time.Time) []sentencia {
+	hist := tablaHistorico(items)
+	mismaClave := func(a, b string) string {
+		return fmt.Sprintf("%[1]s.tenant_id = %[2]s.tenant_id AND %[1]s.ticker = %[2]s.ticker AND %[1]s.brokerage = %[2]s.brokerage AND %[1]s.time = %[2]s.time", a, b)
+	}
+	iguales := make([]string, len(columnasComparadas))
+	for i, col := range columnasComparadas {
+		iguales[i] = d.igualNulo("i."+col, hist+"."+col)
+	}
+
+	superar := `UPDATE ` + hist + `
+		SET superseded_generation = ` + d.placeholder(1) + `, superseded_at = ` + d.placeholder(2) + `
+		WHERE tenant_id = ` + d.placeholder(3) + ` AND superseded_generation IS NULL AND NOT EXISTS (
+			SELECT 1 FROM ` + items + ` i
+			WHERE ` + mismaClave("i", hist) + ` AND ` + strings.Join(iguales, " AND ") + `
+		)`
+	insertar := `INSERT INTO ` + hist + ` (tenant_id, ` + itemColumns + `, generation, recorded_at)
+		SELECT tenant_id, ` + itemColumns + `, ` + parametroTipado(d, 1, "INT8") + `, ` + parametroTipado(d, 2, "TIMESTAMPTZ") + `
+		FROM ` + items + `
+		WHERE tenant_id = ` + d.placeholder(3) + ` AND NOT EXISTS (
+			SELECT 1 FROM ` + hist + ` h
+			WHERE ` + mismaClave("h", items) + ` AND h.superseded_generation IS NULL
+		)`
+	return []sentencia{
+		{query: superar, args: []interface{}{generation, at, tenant}},
+		{query: insertar, args: []interface{}{generation, at, tenant}},
+	}
+}
+
+// consultaAsOf es la consulta de las filas de items de tenant vigentes en
+// asOf, según el histórico. sistema es la cláusula AS OF SYSTEM TIME de las
+// lecturas, o vacía.
+func consultaAsOf(items string, d *dialecto, tenant string, asOf AsOf, sistema string) sentencia {
+	desde, hasta := "recorded_at", "superseded_at"
+	var punto interface{} = asOf.Time.UTC()
+	if asOf.Generation != 0 {
+		desde, hasta = "generation", "superseded_generation"
+		punto = asOf.Generation
+	}
+	return sentencia{
+		query: fmt.Sprintf(`SELECT %s FROM %s%s WHERE tenant_id = %s AND %s <= %s AND (%s IS NULL OR %s > %s)`,
+			itemColumns, tablaHistorico(items), sistema, d.placeholder(1), desde, d.placeholder(2), hasta, hasta, d.placeholder(3)),
+		args: []interface{}{tenant, punto, punto},
+	}
+}
+
+// parametroTipado es el placeholder n con el tipo indicado en los backends que
+// no pueden inferirlo (parámetros en la lista de un SELECT).
+func parametroTipado(d *dialecto, n int, tipo string) string {
+	if d.tipado == nil {
+		return d.placeholder(n)
+	}
+	return d.tipado(n, tipo)
+}
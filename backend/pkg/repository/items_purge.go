@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// purgarItems borra de items y de su histórico las filas de tenant con time
+// anterior a before, con sentencias de como mucho lote filas que se confirman
+// por separado: así no se bloquea la tabla ni se genera una transacción
+// enorme al borrar años de historial.
+func purgarItems(ctx context.Context, exec execFunc, items string, d *dialecto, tenant string, before time.Time, lote int) (int64, error) {
+	if lote <= 0 {
+		return 0, fmt.Errorf("invalid purge batch size %d", lote)
+	}
+	var total int64
+	for _, tabla := range []string{items, tablaHistorico(items)} {
+		query := d.borrarLote(tabla, "tenant_id = "+d.placeholder(1)+" AND time < "+d.placeholder(2), lote)
+		for {
+			n, err := exec(ctx, query, tenant, before.UTC())
+			if err != nil {
+				return total, fmt.Errorf("error purging %s: %w", tabla, err)
+			}
+			total += n
+			if n < int64(lote) {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// borrarConLimit es el DELETE por lotes de CockroachDB y MySQL.
+func borrarConLimit(tabla, condicion string, n int) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s LIMIT %d", tabla, condicion, n)
+}
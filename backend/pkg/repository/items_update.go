@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// versionMaxima es la consulta de la mayor versión de los items de un tenant
+// (0 si no tiene ninguno); recibe el tenant como único parámetro.
+func versionMaxima(tabla string, d *dialecto) string {
+	return `SELECT COALESCE(MAX(version), 0) FROM ` + tabla + ` WHERE tenant_id = ` + d.placeholder(1)
+}
+
+// siguienteVersion es la versión de las filas que escribe una sincronización
+// (Upsert o Replace): mayor que cualquiera de las del tenant (actual) y que la
+// hora actual en microsegundos. Así la versión no vuelve a un valor anterior
+// aunque Replace borre y reinserte las filas, o la tabla se quede vacía, y un
+// If-Match tomado antes de la sincronización no coincide después.
+func siguienteVersion(actual int64, ahora time.Time) int64 {
+	return max(actual+1, ahora.UnixMicro())
+}
+
+// actualizacionItem arma el UPDATE de una edición manual: fija los campos de
+// patch que no son nil e incrementa version, solo si la fila sigue en la
+// versión esperada. ok es false si patch no cambia nada.
+func actualizacionItem(tabla string, d *dialecto, tenant string, key ItemKey, version int64, patch ItemPatch) (query string, args []interface{}, ok bool) {
+	var set []string
+	add := func(col string, v interface{}) {
+		args = append(args, v)
+		set = append(set, fmt.Sprintf("%s = %s", col, d.placeholder(len(args))))
+	}
+	if patch.TargetFrom != nil {
+		add("target_from", valorDecimal(patch.TargetFrom))
+	}
+	if patch.TargetTo != nil {
+		add("target_to", valorDecimal(patch.TargetTo))
+	}
+	if patch.Company != nil {
+		add("company", *patch.Company)
+	}
+	if patch.Action != nil {
+		add("action", *patch.Action)
+	}
+	if patch.RatingFrom != nil {
+		add("rating_from", *patch.RatingFrom)
+	}
+	if patch.RatingTo != nil {
+		add("rating_to", *patch.RatingTo)
+	}
+	if len(set) == 0 {
+		return "", nil, false
+	}
+	set = append(set, "version = version + 1")
+
+	args = append(args, tenant, key.Ticker, key.Brokerage, key.Time.UTC(), version)
+	n := len(args)
+	query = fmt.Sprintf(`UPDATE %s SET %s WHERE tenant_id = %s AND ticker = %s AND brokerage = %s AND time = %s AND version = %s`,
+		tabla, strings.Join(set, ", "), d.placeholder(n-4), d.placeholder(n-3), d.placeholder(n-2), d.placeholder(n-1), d.placeholder(n))
+	return query, args, true
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSiguienteVersion(t *testing.T) {
+	ahora := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	micros := ahora.UnixMicro()
+
+	tests := []struct {
+		name   string
+		actual int64
+		want   int64
+	}{
+		// Tras un Replace que vacía la tabla no se vuelve a la versión 1
+		{"tabla vacía", 0, micros},
+		{"versiones de ediciones", 7, micros},
+		{"versión de una sincronización anterior", micros - 1, micros},
+		{"misma hora", micros, micros + 1},
+		// Con el reloj atrasado la versión sigue creciendo
+		{"reloj atrasado", micros + 1000, micros + 1001},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := siguienteVersion(tt.actual, ahora); got != tt.want {
+				t.Errorf("siguienteVersion(%d) = %d, want %d", tt.actual, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package repository
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+//go:embed migrations/postgres/*.sql migrations/postgres_rls/*.sql
+var pgMigrations embed.FS
+
+// dirMigracionesRLS son las migraciones que solo se aplican con aislamiento
+// de tenants por RLS (ver NewPostgres).
+const dirMigracionesRLS = "migrations/postgres_rls"
+
+var dialectoPostgres = &dialecto{
+	nombre:         "postgres",
+	migraciones:    pgMigrations,
+	dirMigraciones: "migrations/postgres",
+	ddlMigraciones: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT8 PRIMARY KEY,
+			name STRING NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`,
+	placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+	tipado:      func(n int, tipo string) string { return fmt.Sprintf("$%d::%s", n, tipo) },
+	igualNulo:   func(a, b string) string { return a + " IS NOT DISTINCT FROM " + b },
+	conflicto:   onConflictDoUpdate,
+	borrarLote:  borrarConLimit,
+}
+
+// migracion es un fichero NNNN_nombre.sql del directorio de migraciones.
+type migracion struct {
+	version int64
+	name    string
+	sql     string
+}
+
+// marcaSinTransaccion, en una línea propia de una migración, hace que se
+// aplique sentencia a sentencia en lugar de en una transacción. Solo para las
+// que el backend no admite en una transacción; deben poder repetirse si se
+// interrumpen a medias.
+const marcaSinTransaccion = "-- sin transacción"
+
+// transaccional indica si la migración se aplica en una transacción.
+func (m migracion) transaccional() bool {
+	for _, line := range strings.Split(m.sql, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), marcaSinTransaccion) {
+			return false
+		}
+	}
+	return true
+}
+
+// cargarMigraciones lee las migraciones de los directorios dirs ordenadas por
+// versión.
+func cargarMigraciones(fsys fs.FS, dirs ...string) ([]migracion, error) {
+	var out []migracion
+	for _, dir := range dirs {
+		migs, err := cargarDirMigraciones(fsys, dir)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, migs...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].version < out[j].version })
+	return out, nil
+}
+
+func cargarDirMigraciones(fsys fs.FS, dir string) ([]migracion, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	var out []migracion
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", name, err)
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %q: %w", name, err)
+		}
+		out = append(out, migracion{version: version, name: strings.TrimSuffix(name, ".sql"), sql: string(body)})
+	}
+	return out, nil
+}
+
+// dividirSentencias parte un fichero de migración en sentencias. Cada
+// sentencia termina en ";" al final de una línea; CockroachDB no admite mezclar
+// DDL y DML en un mismo lote, así que se ejecutan una a una.
+func dividirSentencias(sql string) []string {
+	var out []string
+	var cur strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if stmt := strings.TrimSpace(cur.String()); stmt != ";" {
+				out = append(out, stmt)
+			}
+			cur.Reset()
+		}
+	}
+	if stmt := strings.TrimSpace(cur.String()); stmt != "" {
+		out = append(out, stmt)
+	}
+	return out
+}
+
+// ejecutorMigraciones es lo que necesita aplicarMigraciones de cada driver.
+type ejecutorMigraciones interface {
+	exec(ctx context.Context, sql string, args ...interface{}) (int64, error)
+	versiones(ctx context.Context) (map[int64]bool, error)
+	// transaccion ejecuta fn en una transacción; fn recibe con qué ejecutar
+	// las sentencias dentro de ella.
+	transaccion(ctx context.Context, fn func(exec execFunc) error) error
+}
+
+// aplicarMigraciones aplica las migraciones pendientes del dialecto, y las de
+// los directorios extra, registrándolas en la tabla schema_migrations.
+//
+// Cada migración se aplica junto con su registro en una transacción, de modo
+// que si el proceso cae a medias no queda aplicada en parte (salvo las
+// marcadas con marcaSinTransaccion, y en MySQL, donde el DDL confirma la
+// transacción en curso). Mientras tanto se tiene el bloqueo de
+// schema_migrations_lock para que dos procesos no migren a la vez.
+func aplicarMigraciones(ctx context.Context, db ejecutorMigraciones, d *dialecto, t Tablas, extra ...string) error {
+	migs, err := cargarMigraciones(d.migraciones, append([]string{d.dirMigraciones}, extra...)...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.exec(ctx, d.ddlMigraciones); err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+
+	bloqueo, err := tomarBloqueoMigraciones(ctx, db, d)
+	if err != nil {
+		return err
+	}
+	defer bloqueo.soltar(ctx)
+
+	// Las versiones se leen con el bloqueo tomado: otro proceso puede haber
+	// aplicado migraciones mientras se esperaba.
+	applied, err := db.versiones(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading applied migrations: %w", err)
+	}
+
+	insert := fmt.Sprintf(`INSERT INTO schema_migrations (version, name) VALUES (%s, %s)`, d.placeholder(1), d.placeholder(2))
+	for _, m := range migs {
+		if applied[m.version] {
+			continue
+		}
+		if err := bloqueo.renovar(ctx); err != nil {
+			return err
+		}
+		slog.Info("Aplicando migración", "component", "migrations", "migration", m.name, "dialect", d.nombre)
+		aplicar := func(exec execFunc) error {
+			for _, stmt := range dividirSentencias(t.sustituir(m.sql)) {
+				if _, err := exec(ctx, stmt); err != nil {
+					return fmt.Errorf("error applying migration %s: %w", m.name, err)
+				}
+			}
+			if _, err := exec(ctx, insert, m.version, m.name); err != nil {
+				return fmt.Errorf("error recording migration %s: %w", m.name, err)
+			}
+			return nil
+		}
+		if m.transaccional() {
+			err = db.transaccion(ctx, aplicar)
+		} else {
+			err = aplicar(db.exec)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bloqueo de las migraciones entre procesos: una fila de
+// schema_migrations_lock con el proceso que migra y hasta cuándo. Si el
+// proceso cae sin soltarlo, otro puede tomarlo cuando caduca. Es una tabla y
+// no un advisory lock porque CockroachDB, SQLite y MySQL no los tienen en
+// común.
+const (
+	duracionBloqueoMigraciones = 10 * time.Minute
+	esperaBloqueoMigraciones   = 2 * time.Second
+)
+
+const ddlBloqueoMigraciones = `
+	CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+		id INTEGER PRIMARY KEY,
+		owner VARCHAR(128) NOT NULL DEFAULT '',
+		expires_at BIGINT NOT NULL DEFAULT 0
+	)
+`
+
+// bloqueoMigraciones es el bloqueo tomado por este proceso.
+type bloqueoMigraciones struct {
+	db       ejecutorMigraciones
+	d        *dialecto
+	dueno    string
+	vence    time.Time
+	ahora    func() time.Time
+	duracion time.Duration
+}
+
+// tomarBloqueoMigraciones espera a que el bloqueo esté libre (o caducado) y lo
+// toma para este proceso.
+func tomarBloqueoMigraciones(ctx context.Context, db ejecutorMigraciones, d *dialecto) (*bloqueoMigraciones, error) {
+	if _, err := db.exec(ctx, ddlBloqueoMigraciones); err != nil {
+		return nil, fmt.Errorf("error creating schema_migrations_lock table: %w", err)
+	}
+	fila, args := upsertSQL(d, upsertSpec{Table: "schema_migrations_lock", Columns: []string{"id"}, Key: []string{"id"}}, [][]interface{}{{1}})
+	if _, err := db.exec(ctx, fila, args...); err != nil {
+		return nil, fmt.Errorf("error creating migrations lock: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	b := &bloqueoMigraciones{db: db, d: d, dueno: fmt.Sprintf("%.100s:%d", host, os.Getpid()), ahora: time.Now, duracion: duracionBloqueoMigraciones}
+	tomar := fmt.Sprintf(`UPDATE schema_migrations_lock SET owner = %s, expires_at = %s WHERE id = 1 AND (owner = '' OR expires_at < %s)`,
+		d.placeholder(1), d.placeholder(2), d.placeholder(3))
+	for avisado := false; ; avisado = true {
+		ahora := b.ahora()
+		vence := ahora.Add(b.duracion)
+		n, err := db.exec(ctx, tomar, b.dueno, vence.Unix(), ahora.Unix())
+		if err != nil {
+			return nil, fmt.Errorf("error taking migrations lock: %w", err)
+		}
+		if n == 1 {
+			b.vence = vence
+			return b, nil
+		}
+		if !avisado {
+			slog.Info("Esperando a que otro proceso termine de aplicar las migraciones", "component", "migrations")
+		}
+		select {
+		case <-time.After(esperaBloqueoMigraciones):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for migrations lock: %w", ctx.Err())
+		}
+	}
+}
+
+// renovar alarga el bloqueo antes de cada migración, si ha pasado más de la
+// mitad de su duración. Falla si otro proceso lo tomó al caducar.
+func (b *bloqueoMigraciones) renovar(ctx context.Context) error {
+	ahora := b.ahora()
+	if b.vence.Sub(ahora) > b.duracion/2 {
+		return nil
+	}
+	vence := ahora.Add(b.duracion)
+	n, err := b.db.exec(ctx, fmt.Sprintf(`UPDATE schema_migrations_lock SET expires_at = %s WHERE id = 1 AND owner = %s`,
+		b.d.placeholder(1), b.d.placeholder(2)), vence.Unix(), b.dueno)
+	if err != nil {
+		return fmt.Errorf("error renewing migrations lock: %w", err)
+	}
+	if n != 1 {
+		return fmt.Errorf("migrations lock lost: it expired and another process took it")
+	}
+	b.vence = vence
+	return nil
+}
+
+// soltar libera el bloqueo, aunque ctx se haya cancelado.
+func (b *bloqueoMigraciones) soltar(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), esperaBloqueoMigraciones)
+	defer cancel()
+	_, err := b.db.exec(ctx, fmt.Sprintf(`UPDATE schema_migrations_lock SET owner = '', expires_at = 0 WHERE id = 1 AND owner = %s`,
+		b.d.placeholder(1)), b.dueno)
+	if err != nil {
+		slog.Warn("Error soltando el bloqueo de las migraciones", "component", "migrations", "error", err)
+	}
+}
+
+// MigratePostgres aplica las migraciones pendientes de PostgreSQL/CockroachDB.
+// Si t.Schema no está vacío crea el esquema; el pool debe tenerlo en su
+// search_path para que las tablas se creen en él. Con rls se crean además las
+// políticas de aislamiento de tenants.
+func MigratePostgres(ctx context.Context, db *pgxpool.Pool, t Tablas, rls bool) error {
+	if t.Schema != "" {
+		if _, err := db.Exec(ctx, `CREATE SCHEMA IF NOT EXISTS `+t.Schema); err != nil {
+			return fmt.Errorf("error creating schema %s: %w", t.Schema, err)
+		}
+	}
+	var extra []string
+	if rls {
+		extra = append(extra, dirMigracionesRLS)
+	}
+	return aplicarMigraciones(ctx, pgMigrable{db}, dialectoPostgres, t, extra...)
+}
+
+type pgMigrable struct{ db *pgxpool.Pool }
+
+func (m pgMigrable) exec(ctx context.Context, sql string, args ...interface{}) (int64, error) {
+	tag, err := m.db.Exec(ctx, sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (m pgMigrable) transaccion(ctx context.Context, fn func(exec execFunc) error) error {
+	return enTransaccion(ctx, m.db, func(tx pgx.Tx) error {
+		return fn(pgExec(tx))
+	})
+}
+
+func (m pgMigrable) versiones(ctx context.Context) (map[int64]bool, error) {
+	rows, err := m.db.Query(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]bool{}
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+// esquema aplica las migraciones una sola vez por proceso. El servidor lo hace
+// al arrancar (Store.Migrate); los repositorios lo comprueban también en cada
+// operación por si se usan sin pasar por ahí. Si falla (p. ej. la base aún no
+// está disponible) se reintenta en la siguiente llamada.
+type esquema struct {
+	migrar func(ctx context.Context) error
+
+	mu    sync.Mutex
+	listo bool
+}
+
+func (e *esquema) asegurar(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.listo {
+		return nil
+	}
+	if err := e.migrar(ctx); err != nil {
+		return err
+	}
+	e.listo = true
+	return nil
+}
@@ -0,0 +1,48 @@
+-- Esquema para MySQL 8 / MariaDB, equivalente al de migrations/postgres. Las
+-- fechas se guardan en UTC.
+CREATE TABLE IF NOT EXISTS {{items}} (
+	ticker VARCHAR(32) NOT NULL,
+	target_from DECIMAL(18, 4),
+	target_to DECIMAL(18, 4),
+	company VARCHAR(255),
+	action VARCHAR(64),
+	brokerage VARCHAR(255) NOT NULL DEFAULT '',
+	rating_from VARCHAR(64),
+	rating_to VARCHAR(64),
+	time DATETIME(6) NOT NULL,
+	PRIMARY KEY (ticker, brokerage, time)
+);
+
+CREATE INDEX {{items}}_ticker_time_idx ON {{items}} (ticker, time DESC);
+
+CREATE INDEX {{items}}_brokerage_idx ON {{items}} (brokerage);
+
+CREATE INDEX {{items}}_action_idx ON {{items}} (action);
+
+-- Equivalente al índice de trigramas de CockroachDB para buscar por empresa.
+CREATE FULLTEXT INDEX {{items}}_company_ft_idx ON {{items}} (company);
+
+CREATE TABLE IF NOT EXISTS sync_runs (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	`trigger` VARCHAR(32) NOT NULL,
+	status VARCHAR(32) NOT NULL,
+	params JSON NOT NULL,
+	retry_of BIGINT,
+	items_fetched INT NOT NULL DEFAULT 0,
+	items_inserted BIGINT NOT NULL DEFAULT 0,
+	error TEXT,
+	checkpoint JSON,
+	started_at DATETIME(6) NOT NULL,
+	finished_at DATETIME(6)
+);
+
+CREATE TABLE IF NOT EXISTS sync_retries (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	status VARCHAR(32) NOT NULL,
+	attempt INT NOT NULL DEFAULT 0,
+	max_attempts INT NOT NULL,
+	next_attempt_at DATETIME(6) NOT NULL,
+	last_error TEXT,
+	created_at DATETIME(6) NOT NULL,
+	updated_at DATETIME(6) NOT NULL
+);
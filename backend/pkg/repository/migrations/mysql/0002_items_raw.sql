@@ -0,0 +1,2 @@
+-- JSON original de cada item (ver migrations/postgres/0005_items_raw.sql).
+ALTER TABLE {{items}} ADD COLUMN raw JSON;
@@ -0,0 +1,19 @@
+-- Última valoración de cada ticker (ver migrations/postgres/0006_items_latest.sql).
+CREATE TABLE IF NOT EXISTS {{items}}_latest (
+	ticker VARCHAR(32) PRIMARY KEY,
+	target_from DECIMAL(18, 4),
+	target_to DECIMAL(18, 4),
+	company VARCHAR(255),
+	action VARCHAR(64),
+	brokerage VARCHAR(255) NOT NULL,
+	rating_from VARCHAR(64),
+	rating_to VARCHAR(64),
+	time DATETIME(6) NOT NULL
+);
+
+INSERT INTO {{items}}_latest (ticker, target_from, target_to, company, action, brokerage, rating_from, rating_to, time)
+SELECT ticker, target_from, target_to, company, action, brokerage, rating_from, rating_to, time FROM (
+	SELECT *, row_number() OVER (PARTITION BY ticker ORDER BY time DESC, brokerage) AS rn
+	FROM {{items}}
+) AS ranked
+WHERE rn = 1;
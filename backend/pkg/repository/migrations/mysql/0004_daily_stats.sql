@@ -0,0 +1,10 @@
+-- Resumen diario de valoraciones (ver migrations/postgres/0007_daily_stats.sql).
+CREATE TABLE IF NOT EXISTS daily_stats (
+	day DATE PRIMARY KEY,
+	total BIGINT NOT NULL DEFAULT 0,
+	upgrades BIGINT NOT NULL DEFAULT 0,
+	downgrades BIGINT NOT NULL DEFAULT 0,
+	targets_raised BIGINT NOT NULL DEFAULT 0,
+	targets_lowered BIGINT NOT NULL DEFAULT 0,
+	avg_target_change DOUBLE
+);
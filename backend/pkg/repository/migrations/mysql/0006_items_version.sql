@@ -0,0 +1,3 @@
+-- Versión de cada fila (ver migrations/postgres/0009_items_version.sql).
+ALTER TABLE {{items}} ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE {{items}}_latest ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
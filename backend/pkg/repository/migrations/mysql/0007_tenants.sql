@@ -0,0 +1,41 @@
+-- Modelo multi-tenant (ver migrations/postgres/0010_tenants.sql).
+ALTER TABLE {{items}} ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' FIRST;
+
+ALTER TABLE {{items}} DROP PRIMARY KEY, ADD PRIMARY KEY (tenant_id, ticker, brokerage, time);
+
+ALTER TABLE sync_runs ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+CREATE INDEX sync_runs_tenant_idx ON sync_runs (tenant_id, id DESC);
+
+ALTER TABLE sync_retries ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+DROP TABLE IF EXISTS {{items}}_latest;
+
+CREATE TABLE {{items}}_latest (
+	tenant_id VARCHAR(64) NOT NULL,
+	ticker VARCHAR(32) NOT NULL,
+	target_from DECIMAL(18, 4),
+	target_to DECIMAL(18, 4),
+	company VARCHAR(255),
+	action VARCHAR(64),
+	brokerage VARCHAR(255) NOT NULL,
+	rating_from VARCHAR(64),
+	rating_to VARCHAR(64),
+	time DATETIME(6) NOT NULL,
+	version BIGINT NOT NULL DEFAULT 1,
+	PRIMARY KEY (tenant_id, ticker)
+);
+
+DROP TABLE IF EXISTS daily_stats;
+
+CREATE TABLE daily_stats (
+	tenant_id VARCHAR(64) NOT NULL,
+	day DATE NOT NULL,
+	total BIGINT NOT NULL DEFAULT 0,
+	upgrades BIGINT NOT NULL DEFAULT 0,
+	downgrades BIGINT NOT NULL DEFAULT 0,
+	targets_raised BIGINT NOT NULL DEFAULT 0,
+	targets_lowered BIGINT NOT NULL DEFAULT 0,
+	avg_target_change DOUBLE,
+	PRIMARY KEY (tenant_id, day)
+);
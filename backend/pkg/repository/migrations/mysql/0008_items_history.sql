@@ -0,0 +1,24 @@
+-- Histórico de items por generación (ver migrations/postgres/0011_items_history.sql).
+-- MySQL no tiene índices parciales; el de la clave incluye superseded_generation.
+CREATE TABLE IF NOT EXISTS {{items}}_history (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	tenant_id VARCHAR(64) NOT NULL,
+	ticker VARCHAR(32) NOT NULL,
+	target_from DECIMAL(18, 4),
+	target_to DECIMAL(18, 4),
+	company VARCHAR(255),
+	action VARCHAR(64),
+	brokerage VARCHAR(255) NOT NULL,
+	rating_from VARCHAR(64),
+	rating_to VARCHAR(64),
+	time DATETIME(6) NOT NULL,
+	version BIGINT NOT NULL,
+	generation BIGINT NOT NULL,
+	recorded_at DATETIME(6) NOT NULL,
+	superseded_generation BIGINT,
+	superseded_at DATETIME(6)
+);
+
+CREATE INDEX {{items}}_history_generation_idx ON {{items}}_history (tenant_id, generation);
+
+CREATE INDEX {{items}}_history_current_idx ON {{items}}_history (tenant_id, ticker, brokerage, time, superseded_generation);
@@ -0,0 +1,6 @@
+-- Feature flags fijados en tiempo de ejecución (ver migrations/postgres/0012_feature_flags.sql).
+CREATE TABLE IF NOT EXISTS feature_flags (
+	name VARCHAR(64) PRIMARY KEY,
+	enabled BOOLEAN NOT NULL,
+	updated_at DATETIME(6) NOT NULL
+);
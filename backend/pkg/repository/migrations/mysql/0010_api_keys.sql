@@ -0,0 +1,8 @@
+-- Claves de la API (ver migrations/postgres/0013_api_keys.sql).
+CREATE TABLE IF NOT EXISTS api_keys (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(128) NOT NULL,
+	key_hash CHAR(64) NOT NULL UNIQUE,
+	created_at DATETIME(6) NOT NULL,
+	revoked_at DATETIME(6)
+);
@@ -0,0 +1,2 @@
+-- Rol de cada clave de la API (ver migrations/postgres/0014_api_keys_role.sql).
+ALTER TABLE api_keys ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'admin';
@@ -0,0 +1,18 @@
+-- Registro de auditoría de seguridad (ver migrations/postgres/0015_audit_log.sql).
+CREATE TABLE IF NOT EXISTS audit_log (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	created_at DATETIME(6) NOT NULL,
+	tenant_id VARCHAR(64) NOT NULL,
+	action VARCHAR(64) NOT NULL,
+	actor VARCHAR(255) NOT NULL DEFAULT '',
+	auth_method VARCHAR(32) NOT NULL DEFAULT '',
+	ip VARCHAR(64) NOT NULL DEFAULT '',
+	request_id VARCHAR(128) NOT NULL DEFAULT '',
+	target VARCHAR(255) NOT NULL DEFAULT '',
+	status INT NOT NULL DEFAULT 0,
+	detail TEXT NOT NULL
+);
+
+CREATE INDEX audit_log_action_idx ON audit_log (action, id DESC);
+
+CREATE INDEX audit_log_actor_idx ON audit_log (actor, id DESC);
@@ -0,0 +1,21 @@
+-- Cuentas de usuario y sesiones (ver migrations/postgres/0017_users.sql).
+CREATE TABLE IF NOT EXISTS users (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	email VARCHAR(255) NOT NULL UNIQUE,
+	name VARCHAR(255) NOT NULL DEFAULT '',
+	password_hash VARCHAR(255) NOT NULL,
+	role VARCHAR(16) NOT NULL DEFAULT 'viewer',
+	created_at DATETIME(6) NOT NULL,
+	last_login_at DATETIME(6)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	token_hash CHAR(64) PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	expires_at DATETIME(6) NOT NULL,
+	revoked_at DATETIME(6),
+	FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX sessions_user_idx ON sessions (user_id, expires_at);
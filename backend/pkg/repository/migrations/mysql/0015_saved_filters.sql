@@ -0,0 +1,13 @@
+-- Filtros guardados de cada usuario (ver migrations/postgres/0018_saved_filters.sql).
+CREATE TABLE IF NOT EXISTS saved_filters (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+	owner VARCHAR(255) NOT NULL,
+	name VARCHAR(128) NOT NULL,
+	query VARCHAR(255) NOT NULL DEFAULT '',
+	sort_by VARCHAR(16) NOT NULL,
+	sort_order VARCHAR(4) NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	updated_at DATETIME(6) NOT NULL,
+	UNIQUE (tenant_id, owner, name)
+);
@@ -0,0 +1,2 @@
+-- Tiempos de cada etapa de las sincronizaciones (ver migrations/postgres/0019_sync_run_stages.sql).
+ALTER TABLE sync_runs ADD COLUMN stages JSON;
@@ -0,0 +1,40 @@
+-- Esquema inicial tal y como lo creaba la aplicación antes de tener
+-- migraciones; con IF NOT EXISTS para adoptar bases ya existentes.
+CREATE TABLE IF NOT EXISTS {{items}} (
+	ticker STRING,
+	target_from STRING,
+	target_to STRING,
+	company STRING,
+	action STRING,
+	brokerage STRING,
+	rating_from STRING,
+	rating_to STRING,
+	time TIMESTAMP,
+	PRIMARY KEY (ticker, time)
+);
+
+CREATE TABLE IF NOT EXISTS sync_runs (
+	id SERIAL PRIMARY KEY,
+	trigger STRING NOT NULL,
+	status STRING NOT NULL,
+	params JSONB NOT NULL,
+	retry_of INT8,
+	items_fetched INT NOT NULL DEFAULT 0,
+	items_inserted INT8 NOT NULL DEFAULT 0,
+	error STRING,
+	started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	finished_at TIMESTAMPTZ
+);
+
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS checkpoint JSONB;
+
+CREATE TABLE IF NOT EXISTS sync_retries (
+	id SERIAL PRIMARY KEY,
+	status STRING NOT NULL,
+	attempt INT NOT NULL DEFAULT 0,
+	max_attempts INT NOT NULL,
+	next_attempt_at TIMESTAMPTZ NOT NULL,
+	last_error STRING,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
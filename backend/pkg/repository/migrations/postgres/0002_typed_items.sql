@@ -0,0 +1,38 @@
+-- Precios objetivo como NUMERIC y time como TIMESTAMPTZ. Cambiar el tipo de
+-- una columna de la clave primaria no es posible en sitio, así que se crea la
+-- tabla nueva, se copian los datos convirtiéndolos y se sustituye la antigua.
+-- Todo en la transacción de la migración: si se interrumpe, la tabla antigua
+-- sigue intacta y la copia a medias desaparece con el rollback.
+DROP TABLE IF EXISTS {{items}}_typed;
+
+CREATE TABLE {{items}}_typed (
+	ticker STRING NOT NULL,
+	target_from NUMERIC,
+	target_to NUMERIC,
+	company STRING,
+	action STRING,
+	brokerage STRING,
+	rating_from STRING,
+	rating_to STRING,
+	time TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (ticker, time)
+);
+
+-- Los precios venían como texto con formato ("$1,234.50"); los valores que no
+-- se puedan interpretar quedan en NULL. Las horas se guardaban en UTC.
+INSERT INTO {{items}}_typed
+SELECT
+	ticker,
+	NULLIF(regexp_replace(target_from, '[^0-9.-]', '', 'g'), '')::NUMERIC,
+	NULLIF(regexp_replace(target_to, '[^0-9.-]', '', 'g'), '')::NUMERIC,
+	company,
+	action,
+	brokerage,
+	rating_from,
+	rating_to,
+	time AT TIME ZONE 'UTC'
+FROM {{items}};
+
+DROP TABLE {{items}};
+
+ALTER TABLE {{items}}_typed RENAME TO {{items}};
@@ -0,0 +1,26 @@
+-- Un mismo ticker puede recibir valoraciones de dos brókers con la misma hora;
+-- con la clave (ticker, time) la segunda se perdía. La clave pasa a incluir
+-- brokerage. Como en 0002, se reconstruye la tabla en lugar de alterar la
+-- clave primaria en sitio, dentro de la transacción de la migración.
+DROP TABLE IF EXISTS {{items}}_keyed;
+
+CREATE TABLE {{items}}_keyed (
+	ticker STRING NOT NULL,
+	target_from NUMERIC,
+	target_to NUMERIC,
+	company STRING,
+	action STRING,
+	brokerage STRING NOT NULL DEFAULT '',
+	rating_from STRING,
+	rating_to STRING,
+	time TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (ticker, brokerage, time)
+);
+
+INSERT INTO {{items}}_keyed
+SELECT ticker, target_from, target_to, company, action, COALESCE(brokerage, ''), rating_from, rating_to, time
+FROM {{items}};
+
+DROP TABLE {{items}};
+
+ALTER TABLE {{items}}_keyed RENAME TO {{items}};
@@ -0,0 +1,12 @@
+-- Índices para los filtros habituales sobre items: últimas valoraciones de un
+-- ticker, por bróker, por acción y búsqueda por nombre de empresa.
+CREATE INDEX IF NOT EXISTS {{items}}_ticker_time_idx ON {{items}} (ticker, time DESC);
+
+CREATE INDEX IF NOT EXISTS {{items}}_brokerage_idx ON {{items}} (brokerage);
+
+CREATE INDEX IF NOT EXISTS {{items}}_action_idx ON {{items}} (action);
+
+-- El índice de trigramas sirve a búsquedas ILIKE '%texto%' sobre company.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS {{items}}_company_trgm_idx ON {{items}} USING GIN (company gin_trgm_ops);
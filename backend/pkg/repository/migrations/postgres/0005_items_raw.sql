@@ -0,0 +1,3 @@
+-- JSON original de cada item, para poder corregir la interpretación de los
+-- campos (moneda del precio, campos nuevos) sin volver a descargarlos.
+ALTER TABLE {{items}} ADD COLUMN IF NOT EXISTS raw JSONB;
@@ -0,0 +1,21 @@
+-- Última valoración de cada ticker, para servir /item/latest y
+-- /recommendations sin recorrer todo el historial en cada petición. Se rehace
+-- al final de cada sincronización.
+CREATE TABLE IF NOT EXISTS {{items}}_latest (
+	ticker STRING PRIMARY KEY,
+	target_from NUMERIC,
+	target_to NUMERIC,
+	company STRING,
+	action STRING,
+	brokerage STRING NOT NULL,
+	rating_from STRING,
+	rating_to STRING,
+	time TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO {{items}}_latest (ticker, target_from, target_to, company, action, brokerage, rating_from, rating_to, time)
+SELECT ticker, target_from, target_to, company, action, brokerage, rating_from, rating_to, time FROM (
+	SELECT *, row_number() OVER (PARTITION BY ticker ORDER BY time DESC, brokerage) AS rn
+	FROM {{items}}
+) AS ranked
+WHERE rn = 1;
@@ -0,0 +1,11 @@
+-- Resumen diario de valoraciones para las vistas de tendencia. Se actualiza al
+-- final de cada sincronización; se rellena en la primera.
+CREATE TABLE IF NOT EXISTS daily_stats (
+	day DATE PRIMARY KEY,
+	total INT8 NOT NULL DEFAULT 0,
+	upgrades INT8 NOT NULL DEFAULT 0,
+	downgrades INT8 NOT NULL DEFAULT 0,
+	targets_raised INT8 NOT NULL DEFAULT 0,
+	targets_lowered INT8 NOT NULL DEFAULT 0,
+	avg_target_change FLOAT8
+);
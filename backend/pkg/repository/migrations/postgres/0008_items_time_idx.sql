@@ -0,0 +1,5 @@
+-- Índice por fecha para las consultas de ventanas recientes y para la poda
+-- por retención (items_retention). En CockroachDB la poda la hace el
+-- row-level TTL (ver pgItems.SetTTL), que no exige licencia enterprise como
+-- las particiones por mes.
+CREATE INDEX IF NOT EXISTS {{items}}_time_idx ON {{items}} (time DESC);
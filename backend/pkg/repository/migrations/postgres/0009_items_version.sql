@@ -0,0 +1,5 @@
+-- Versión de cada fila para el control de concurrencia optimista de las
+-- ediciones manuales (PATCH /item con If-Match). Se copia a la tabla resumen
+-- para que los clientes la vean también en /item/latest.
+ALTER TABLE {{items}} ADD COLUMN IF NOT EXISTS version INT8 NOT NULL DEFAULT 1;
+ALTER TABLE {{items}}_latest ADD COLUMN IF NOT EXISTS version INT8 NOT NULL DEFAULT 1;
@@ -0,0 +1,50 @@
+-- Modelo multi-tenant: cada fila pertenece a un tenant (la organización
+-- cliente) y todas las consultas filtran por él. Los datos existentes pasan
+-- al tenant "default".
+--
+-- sin transacción: CockroachDB no cambia la clave primaria en la misma
+-- transacción que añade la columna. Todas las sentencias se pueden repetir.
+ALTER TABLE {{items}} ADD COLUMN IF NOT EXISTS tenant_id STRING NOT NULL DEFAULT 'default';
+
+-- CockroachDB cambia la clave primaria en sitio conservando los índices
+-- secundarios (al contrario que la reconstrucción de 0002 y 0003).
+ALTER TABLE {{items}} ALTER PRIMARY KEY USING COLUMNS (tenant_id, ticker, brokerage, time);
+
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS tenant_id STRING NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS sync_runs_tenant_idx ON sync_runs (tenant_id, id DESC);
+
+ALTER TABLE sync_retries ADD COLUMN IF NOT EXISTS tenant_id STRING NOT NULL DEFAULT 'default';
+
+-- Las tablas resumen se recrean con el tenant en la clave; se rellenan en la
+-- siguiente sincronización de cada tenant.
+DROP TABLE IF EXISTS {{items}}_latest;
+
+CREATE TABLE {{items}}_latest (
+	tenant_id STRING NOT NULL,
+	ticker STRING NOT NULL,
+	target_from NUMERIC,
+	target_to NUMERIC,
+	company STRING,
+	action STRING,
+	brokerage STRING NOT NULL,
+	rating_from STRING,
+	rating_to STRING,
+	time TIMESTAMPTZ NOT NULL,
+	version INT8 NOT NULL DEFAULT 1,
+	PRIMARY KEY (tenant_id, ticker)
+);
+
+DROP TABLE IF EXISTS daily_stats;
+
+CREATE TABLE daily_stats (
+	tenant_id STRING NOT NULL,
+	day DATE NOT NULL,
+	total INT8 NOT NULL DEFAULT 0,
+	upgrades INT8 NOT NULL DEFAULT 0,
+	downgrades INT8 NOT NULL DEFAULT 0,
+	targets_raised INT8 NOT NULL DEFAULT 0,
+	targets_lowered INT8 NOT NULL DEFAULT 0,
+	avg_target_change FLOAT8,
+	PRIMARY KEY (tenant_id, day)
+);
@@ -0,0 +1,27 @@
+-- Histórico de items por generación (la sincronización que escribió cada
+-- versión de una fila, identificada por el id de su sync_run). Las filas no
+-- se borran: al cambiar o desaparecer de items quedan superadas por la
+-- generación siguiente, y GET /item?as_of= reconstruye el contenido de items
+-- en una generación o fecha pasada.
+CREATE TABLE IF NOT EXISTS {{items}}_history (
+	id SERIAL PRIMARY KEY,
+	tenant_id STRING NOT NULL,
+	ticker STRING NOT NULL,
+	target_from NUMERIC,
+	target_to NUMERIC,
+	company STRING,
+	action STRING,
+	brokerage STRING NOT NULL,
+	rating_from STRING,
+	rating_to STRING,
+	time TIMESTAMPTZ NOT NULL,
+	version INT8 NOT NULL,
+	generation INT8 NOT NULL,
+	recorded_at TIMESTAMPTZ NOT NULL,
+	superseded_generation INT8,
+	superseded_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS {{items}}_history_generation_idx ON {{items}}_history (tenant_id, generation);
+
+CREATE INDEX IF NOT EXISTS {{items}}_history_current_idx ON {{items}}_history (tenant_id, ticker, brokerage, time) WHERE superseded_generation IS NULL;
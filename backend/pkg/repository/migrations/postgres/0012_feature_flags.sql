@@ -0,0 +1,8 @@
+-- Feature flags fijados en tiempo de ejecución (PUT /admin/flags/{name});
+-- prevalecen sobre los valores del entorno. Son de la instancia, comunes a
+-- todos los tenants.
+CREATE TABLE IF NOT EXISTS feature_flags (
+	name STRING PRIMARY KEY,
+	enabled BOOL NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
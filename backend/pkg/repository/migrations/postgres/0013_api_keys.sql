@@ -0,0 +1,10 @@
+-- Claves de la API (cabecera X-API-Key). Solo se guarda el SHA-256 de cada
+-- clave; una clave revocada deja de aceptarse pero se conserva. Son de la
+-- instancia, comunes a todos los tenants.
+CREATE TABLE IF NOT EXISTS api_keys (
+	id SERIAL PRIMARY KEY,
+	name STRING NOT NULL,
+	key_hash STRING NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	revoked_at TIMESTAMPTZ
+);
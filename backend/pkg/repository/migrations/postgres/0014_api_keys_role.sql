@@ -0,0 +1,3 @@
+-- Rol de cada clave de la API (viewer, analyst o admin). Las claves ya
+-- creadas conservan el acceso completo que tenían.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS role STRING NOT NULL DEFAULT 'admin';
@@ -0,0 +1,22 @@
+-- Registro de auditoría de seguridad: fallos de autenticación, uso de claves
+-- de la API, accesos denegados y acciones de administración. La aplicación
+-- solo inserta filas; para que el usuario de la base de datos tampoco pueda
+-- modificarlas, quitarle UPDATE y DELETE sobre la tabla. Es de la instancia:
+-- tenant_id es el de la petición que originó el evento.
+CREATE TABLE IF NOT EXISTS audit_log (
+	id SERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	tenant_id STRING NOT NULL,
+	action STRING NOT NULL,
+	actor STRING NOT NULL DEFAULT '',
+	auth_method STRING NOT NULL DEFAULT '',
+	ip STRING NOT NULL DEFAULT '',
+	request_id STRING NOT NULL DEFAULT '',
+	target STRING NOT NULL DEFAULT '',
+	status INT NOT NULL DEFAULT 0,
+	detail STRING NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_action_idx ON audit_log (action, id DESC);
+
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor, id DESC);
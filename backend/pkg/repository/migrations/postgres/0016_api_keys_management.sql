@@ -0,0 +1,8 @@
+-- Gestión de las claves de la API desde /admin/api-keys: una etiqueta libre,
+-- el principio de la clave para reconocerla (la clave no se guarda) y cuándo
+-- se rotó por última vez.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS label STRING NOT NULL DEFAULT '';
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS prefix STRING NOT NULL DEFAULT '';
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMPTZ;
@@ -0,0 +1,22 @@
+-- Cuentas de usuario (POST /auth/register) y sus sesiones (POST
+-- /auth/login). De las contraseñas se guarda el hash bcrypt y de los tokens
+-- de sesión el SHA-256. Son de la instancia, comunes a todos los tenants.
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	email STRING NOT NULL UNIQUE,
+	name STRING NOT NULL DEFAULT '',
+	password_hash STRING NOT NULL,
+	role STRING NOT NULL DEFAULT 'viewer',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	last_login_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	token_hash STRING PRIMARY KEY,
+	user_id INT8 NOT NULL REFERENCES users (id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_idx ON sessions (user_id, expires_at);
@@ -0,0 +1,16 @@
+-- Filtros guardados de cada usuario (/me/filters): búsqueda y orden de la
+-- vista de items con un nombre. owner es la identidad que los guarda (ver
+-- identidad.propietario); los nombres no se repiten por propietario y
+-- tenant.
+CREATE TABLE IF NOT EXISTS saved_filters (
+	id SERIAL PRIMARY KEY,
+	tenant_id STRING NOT NULL DEFAULT 'default',
+	owner STRING NOT NULL,
+	name STRING NOT NULL,
+	query STRING NOT NULL DEFAULT '',
+	sort_by STRING NOT NULL,
+	sort_order STRING NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	UNIQUE (tenant_id, owner, name)
+);
@@ -0,0 +1,4 @@
+-- Tiempos de cada etapa de las sincronizaciones (descarga de cada página,
+-- validación, lotes del upsert...), acumulados por etapa: ver
+-- repository.SyncStage.
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS stages JSONB;
@@ -0,0 +1,7 @@
+-- Tenant al que queda limitada cada clave de la API y cada usuario: las
+-- peticiones que se identifican con ellos solo ven los datos de ese tenant
+-- (solo las de rol admin pueden elegir otro con X-Tenant-ID). Las claves y
+-- usuarios existentes quedan en el tenant "default".
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant_id STRING NOT NULL DEFAULT 'default';
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id STRING NOT NULL DEFAULT 'default';
@@ -0,0 +1,3 @@
+-- Índice para borrar por lotes las filas del histórico fuera de
+-- items_retention (ver purgarItems) sin recorrer toda la tabla.
+CREATE INDEX IF NOT EXISTS {{items}}_history_time_idx ON {{items}}_history (tenant_id, time);
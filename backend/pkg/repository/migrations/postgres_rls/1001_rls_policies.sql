@@ -0,0 +1,32 @@
+-- Aislamiento de tenants en la base de datos (tenant_isolation=rls). Solo se
+-- aplica en ese modo: cada conexión fija app.tenant_id al adquirirse del pool
+-- y las políticas ocultan las filas de otros tenants, también al dueño de las
+-- tablas (FORCE). app.tenant_id es el tenant de la identidad autenticada, no
+-- el que pide el cliente (ver TenantBeforeAcquire); vacío no ve ninguna fila.
+-- sync_retries queda fuera: el worker reclama reintentos de cualquier tenant.
+--
+-- Requiere PostgreSQL o CockroachDB 25.2+. Las migraciones posteriores que
+-- toquen datos de estas tablas solo verán los del tenant de la conexión.
+ALTER TABLE {{items}} ENABLE ROW LEVEL SECURITY;
+ALTER TABLE {{items}} FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON {{items}}
+	USING (tenant_id = current_setting('app.tenant_id', true))
+	WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE {{items}}_latest ENABLE ROW LEVEL SECURITY;
+ALTER TABLE {{items}}_latest FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON {{items}}_latest
+	USING (tenant_id = current_setting('app.tenant_id', true))
+	WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE sync_runs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE sync_runs FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON sync_runs
+	USING (tenant_id = current_setting('app.tenant_id', true))
+	WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE daily_stats ENABLE ROW LEVEL SECURITY;
+ALTER TABLE daily_stats FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON daily_stats
+	USING (tenant_id = current_setting('app.tenant_id', true))
+	WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,6 @@
+-- Aislamiento de tenants del histórico de items (ver 1001_rls_policies.sql).
+ALTER TABLE {{items}}_history ENABLE ROW LEVEL SECURITY;
+ALTER TABLE {{items}}_history FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON {{items}}_history
+	USING (tenant_id = current_setting('app.tenant_id', true))
+	WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
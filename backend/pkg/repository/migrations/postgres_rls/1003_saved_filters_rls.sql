@@ -0,0 +1,6 @@
+-- Aislamiento de tenants de los filtros guardados (ver 1001_rls_policies.sql).
+ALTER TABLE saved_filters ENABLE ROW LEVEL SECURITY;
+ALTER TABLE saved_filters FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON saved_filters
+	USING (tenant_id = current_setting('app.tenant_id', true))
+	WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,45 @@
+-- Esquema para desarrollo local con SQLite, equivalente al de
+-- migrations/postgres. Las fechas se guardan como texto en UTC.
+CREATE TABLE IF NOT EXISTS {{items}} (
+	ticker TEXT NOT NULL,
+	target_from REAL,
+	target_to REAL,
+	company TEXT,
+	action TEXT,
+	brokerage TEXT NOT NULL DEFAULT '',
+	rating_from TEXT,
+	rating_to TEXT,
+	time TIMESTAMP NOT NULL,
+	PRIMARY KEY (ticker, brokerage, time)
+);
+
+CREATE INDEX IF NOT EXISTS {{items}}_ticker_time_idx ON {{items}} (ticker, time DESC);
+
+CREATE INDEX IF NOT EXISTS {{items}}_brokerage_idx ON {{items}} (brokerage);
+
+CREATE INDEX IF NOT EXISTS {{items}}_action_idx ON {{items}} (action);
+
+CREATE TABLE IF NOT EXISTS sync_runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	trigger TEXT NOT NULL,
+	status TEXT NOT NULL,
+	params TEXT NOT NULL,
+	retry_of INTEGER,
+	items_fetched INTEGER NOT NULL DEFAULT 0,
+	items_inserted INTEGER NOT NULL DEFAULT 0,
+	error TEXT,
+	checkpoint TEXT,
+	started_at TIMESTAMP NOT NULL,
+	finished_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sync_retries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	status TEXT NOT NULL,
+	attempt INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	next_attempt_at TIMESTAMP NOT NULL,
+	last_error TEXT,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
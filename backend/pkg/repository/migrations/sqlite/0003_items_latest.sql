@@ -0,0 +1,19 @@
+-- Última valoración de cada ticker (ver migrations/postgres/0006_items_latest.sql).
+CREATE TABLE IF NOT EXISTS {{items}}_latest (
+	ticker TEXT PRIMARY KEY,
+	target_from REAL,
+	target_to REAL,
+	company TEXT,
+	action TEXT,
+	brokerage TEXT NOT NULL,
+	rating_from TEXT,
+	rating_to TEXT,
+	time TIMESTAMP NOT NULL
+);
+
+INSERT INTO {{items}}_latest (ticker, target_from, target_to, company, action, brokerage, rating_from, rating_to, time)
+SELECT ticker, target_from, target_to, company, action, brokerage, rating_from, rating_to, time FROM (
+	SELECT *, row_number() OVER (PARTITION BY ticker ORDER BY time DESC, brokerage) AS rn
+	FROM {{items}}
+) AS ranked
+WHERE rn = 1;
@@ -0,0 +1,10 @@
+-- Resumen diario de valoraciones (ver migrations/postgres/0007_daily_stats.sql).
+CREATE TABLE IF NOT EXISTS daily_stats (
+	day TIMESTAMP PRIMARY KEY,
+	total INTEGER NOT NULL DEFAULT 0,
+	upgrades INTEGER NOT NULL DEFAULT 0,
+	downgrades INTEGER NOT NULL DEFAULT 0,
+	targets_raised INTEGER NOT NULL DEFAULT 0,
+	targets_lowered INTEGER NOT NULL DEFAULT 0,
+	avg_target_change REAL
+);
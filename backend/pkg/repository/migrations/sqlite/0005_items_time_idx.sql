@@ -0,0 +1,2 @@
+-- Índice por fecha (ver migrations/postgres/0008_items_time_idx.sql).
+CREATE INDEX IF NOT EXISTS {{items}}_time_idx ON {{items}} (time DESC);
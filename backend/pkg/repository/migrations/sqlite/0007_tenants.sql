@@ -0,0 +1,73 @@
+-- Modelo multi-tenant (ver migrations/postgres/0010_tenants.sql). SQLite no
+-- permite cambiar la clave primaria, así que se reconstruye la tabla y sus
+-- índices.
+DROP TABLE IF EXISTS {{items}}_tenant;
+
+CREATE TABLE {{items}}_tenant (
+	tenant_id TEXT NOT NULL DEFAULT 'default',
+	ticker TEXT NOT NULL,
+	target_from REAL,
+	target_to REAL,
+	company TEXT,
+	action TEXT,
+	brokerage TEXT NOT NULL DEFAULT '',
+	rating_from TEXT,
+	rating_to TEXT,
+	time TIMESTAMP NOT NULL,
+	raw TEXT,
+	version INTEGER NOT NULL DEFAULT 1,
+	PRIMARY KEY (tenant_id, ticker, brokerage, time)
+);
+
+INSERT INTO {{items}}_tenant (tenant_id, ticker, target_from, target_to, company, action, brokerage, rating_from, rating_to, time, raw, version)
+SELECT 'default', ticker, target_from, target_to, company, action, brokerage, rating_from, rating_to, time, raw, version
+FROM {{items}};
+
+DROP TABLE {{items}};
+
+ALTER TABLE {{items}}_tenant RENAME TO {{items}};
+
+CREATE INDEX IF NOT EXISTS {{items}}_ticker_time_idx ON {{items}} (ticker, time DESC);
+
+CREATE INDEX IF NOT EXISTS {{items}}_brokerage_idx ON {{items}} (brokerage);
+
+CREATE INDEX IF NOT EXISTS {{items}}_action_idx ON {{items}} (action);
+
+CREATE INDEX IF NOT EXISTS {{items}}_time_idx ON {{items}} (time DESC);
+
+ALTER TABLE sync_runs ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS sync_runs_tenant_idx ON sync_runs (tenant_id, id DESC);
+
+ALTER TABLE sync_retries ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+DROP TABLE IF EXISTS {{items}}_latest;
+
+CREATE TABLE {{items}}_latest (
+	tenant_id TEXT NOT NULL,
+	ticker TEXT NOT NULL,
+	target_from REAL,
+	target_to REAL,
+	company TEXT,
+	action TEXT,
+	brokerage TEXT NOT NULL,
+	rating_from TEXT,
+	rating_to TEXT,
+	time TIMESTAMP NOT NULL,
+	version INTEGER NOT NULL DEFAULT 1,
+	PRIMARY KEY (tenant_id, ticker)
+);
+
+DROP TABLE IF EXISTS daily_stats;
+
+CREATE TABLE daily_stats (
+	tenant_id TEXT NOT NULL,
+	day TIMESTAMP NOT NULL,
+	total INTEGER NOT NULL DEFAULT 0,
+	upgrades INTEGER NOT NULL DEFAULT 0,
+	downgrades INTEGER NOT NULL DEFAULT 0,
+	targets_raised INTEGER NOT NULL DEFAULT 0,
+	targets_lowered INTEGER NOT NULL DEFAULT 0,
+	avg_target_change REAL,
+	PRIMARY KEY (tenant_id, day)
+);
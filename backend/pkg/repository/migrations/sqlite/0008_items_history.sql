@@ -0,0 +1,23 @@
+-- Histórico de items por generación (ver migrations/postgres/0011_items_history.sql).
+CREATE TABLE IF NOT EXISTS {{items}}_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	tenant_id TEXT NOT NULL,
+	ticker TEXT NOT NULL,
+	target_from REAL,
+	target_to REAL,
+	company TEXT,
+	action TEXT,
+	brokerage TEXT NOT NULL,
+	rating_from TEXT,
+	rating_to TEXT,
+	time TIMESTAMP NOT NULL,
+	version INTEGER NOT NULL,
+	generation INTEGER NOT NULL,
+	recorded_at TIMESTAMP NOT NULL,
+	superseded_generation INTEGER,
+	superseded_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS {{items}}_history_generation_idx ON {{items}}_history (tenant_id, generation);
+
+CREATE INDEX IF NOT EXISTS {{items}}_history_current_idx ON {{items}}_history (tenant_id, ticker, brokerage, time) WHERE superseded_generation IS NULL;
@@ -0,0 +1,6 @@
+-- Feature flags fijados en tiempo de ejecución (ver migrations/postgres/0012_feature_flags.sql).
+CREATE TABLE IF NOT EXISTS feature_flags (
+	name TEXT PRIMARY KEY,
+	enabled BOOLEAN NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
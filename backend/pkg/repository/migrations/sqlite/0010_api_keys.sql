@@ -0,0 +1,8 @@
+-- Claves de la API (ver migrations/postgres/0013_api_keys.sql).
+CREATE TABLE IF NOT EXISTS api_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP
+);
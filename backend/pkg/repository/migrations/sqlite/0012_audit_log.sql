@@ -0,0 +1,18 @@
+-- Registro de auditoría de seguridad (ver migrations/postgres/0015_audit_log.sql).
+CREATE TABLE IF NOT EXISTS audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP NOT NULL,
+	tenant_id TEXT NOT NULL,
+	action TEXT NOT NULL,
+	actor TEXT NOT NULL DEFAULT '',
+	auth_method TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	request_id TEXT NOT NULL DEFAULT '',
+	target TEXT NOT NULL DEFAULT '',
+	status INTEGER NOT NULL DEFAULT 0,
+	detail TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_action_idx ON audit_log (action, id DESC);
+
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor, id DESC);
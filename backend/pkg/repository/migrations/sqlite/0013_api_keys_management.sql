@@ -0,0 +1,6 @@
+-- Gestión de las claves de la API (ver migrations/postgres/0016_api_keys_management.sql).
+ALTER TABLE api_keys ADD COLUMN label TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE api_keys ADD COLUMN prefix TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE api_keys ADD COLUMN rotated_at TIMESTAMP;
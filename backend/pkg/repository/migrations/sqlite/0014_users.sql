@@ -0,0 +1,20 @@
+-- Cuentas de usuario y sesiones (ver migrations/postgres/0017_users.sql).
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email TEXT NOT NULL UNIQUE,
+	name TEXT NOT NULL DEFAULT '',
+	password_hash TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'viewer',
+	created_at TIMESTAMP NOT NULL,
+	last_login_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	token_hash TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id),
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_idx ON sessions (user_id, expires_at);
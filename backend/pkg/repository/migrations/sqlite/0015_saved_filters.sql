@@ -0,0 +1,13 @@
+-- Filtros guardados de cada usuario (ver migrations/postgres/0018_saved_filters.sql).
+CREATE TABLE IF NOT EXISTS saved_filters (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	tenant_id TEXT NOT NULL DEFAULT 'default',
+	owner TEXT NOT NULL,
+	name TEXT NOT NULL,
+	query TEXT NOT NULL DEFAULT '',
+	sort_by TEXT NOT NULL,
+	sort_order TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	UNIQUE (tenant_id, owner, name)
+);
@@ -0,0 +1,4 @@
+-- Tenant de las claves de la API y los usuarios (ver migrations/postgres/0020_identity_tenants.sql).
+ALTER TABLE api_keys ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+ALTER TABLE users ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
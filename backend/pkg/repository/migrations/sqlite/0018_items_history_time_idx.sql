@@ -0,0 +1,2 @@
+-- Índice de la poda por retención (ver migrations/postgres/0021_items_history_time_idx.sql).
+CREATE INDEX IF NOT EXISTS {{items}}_history_time_idx ON {{items}}_history (tenant_id, time);
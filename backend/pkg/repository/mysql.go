@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"crypto/tls"
+	"embed"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Backend MySQL 8 / MariaDB. Se selecciona con db_driver=mysql y un dsn del
+// driver go-sql-driver/mysql, p. ej. user:pass@tcp(host:3306)/prueba.
+
+//go:embed migrations/mysql/*.sql
+var mysqlMigrations embed.FS
+
+func init() {
+	registrarDialecto(&dialecto{
+		nombre:         "mysql",
+		driver:         "mysql",
+		migraciones:    mysqlMigrations,
+		dirMigraciones: "migrations/mysql",
+		ddlMigraciones: `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version BIGINT PRIMARY KEY,
+				name VARCHAR(255) NOT NULL,
+				applied_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+			)
+		`,
+		placeholder: func(int) string { return "?" },
+		igualNulo:   func(a, b string) string { return a + " <=> " + b },
+		conflicto:   onDuplicateKeyUpdate,
+		borrarLote:  borrarConLimit,
+		conTLS:      mysqlConTLS,
+	})
+}
+
+// mysqlTLSName es el nombre con el que se registra en el driver la
+// configuración TLS de db_tls_*.
+const mysqlTLSName = "prueba"
+
+// mysqlConTLS registra cfg en el driver y la selecciona en el dsn con tls=.
+// El driver completa el ServerName con el host del dsn.
+func mysqlConTLS(dsn string, cfg *tls.Config) (string, error) {
+	mc, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", fmt.Errorf("error parsing mysql dsn: %w", err)
+	}
+	if err := mysql.RegisterTLSConfig(mysqlTLSName, cfg); err != nil {
+		return "", fmt.Errorf("error registering mysql TLS config: %w", err)
+	}
+	mc.TLSConfig = mysqlTLSName
+	return mc.FormatDSN(), nil
+}
+
+// onDuplicateKeyUpdate es la cláusula de upsert de MySQL. MySQL cuenta dos
+// filas afectadas por cada fila que actualiza, así que en un upsert sobre
+// datos existentes el total devuelto puede superar el número de items.
+func onDuplicateKeyUpdate(spec upsertSpec) string {
+	cols := columnasActualizables(spec)
+	if len(cols) == 0 {
+		// Equivalente a DO NOTHING: asignar la clave a sí misma.
+		cols = spec.Key[:1]
+	}
+	set := make([]string, len(cols))
+	for i, c := range cols {
+		set[i] = fmt.Sprintf("%s = VALUES(%s)", c, c)
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+}
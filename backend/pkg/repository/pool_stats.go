@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// PoolStats es el estado de un pool de conexiones. Los campos Acquire* son
+// acumulados desde que se abrió el pool.
+type PoolStats struct {
+	// Pool identifica el pool: "primary" o "replica".
+	Pool  string
+	Max   int
+	Total int
+	Idle  int
+	InUse int
+	// AcquireCount y AcquireWait cuentan las esperas por una conexión. En pgx
+	// son todas las adquisiciones (incluida la apertura de conexiones nuevas);
+	// en database/sql solo las que tuvieron que esperar a una libre.
+	AcquireCount int64
+	AcquireWait  time.Duration
+}
+
+func pgPoolStats(name string, p *pgxpool.Pool) PoolStats {
+	st := p.Stat()
+	return PoolStats{
+		Pool:         name,
+		Max:          int(st.MaxConns()),
+		Total:        int(st.TotalConns()),
+		Idle:         int(st.IdleConns()),
+		InUse:        int(st.AcquiredConns()),
+		AcquireCount: st.AcquireCount(),
+		AcquireWait:  st.AcquireDuration(),
+	}
+}
+
+func sqlPoolStats(name string, db *sql.DB) PoolStats {
+	st := db.Stats()
+	return PoolStats{
+		Pool:         name,
+		Max:          st.MaxOpenConnections,
+		Total:        st.OpenConnections,
+		Idle:         st.Idle,
+		InUse:        st.InUse,
+		AcquireCount: st.WaitCount,
+		AcquireWait:  st.WaitDuration,
+	}
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// NewPostgres crea los repositorios sobre un pool de PostgreSQL/CockroachDB.
+// Si replica no es nil, las lecturas de items (listado, estadísticas) van a
+// ella; las escrituras, la sincronización y las migraciones van siempre a db.
+//
+// Con opts.RLS las migraciones crean políticas de row-level security por
+// tenant; los pools deben usar TenantBeforeAcquire para fijar el tenant de
+// cada conexión. Con opts.FollowerReads las lecturas de los endpoints se
+// sirven de réplicas seguidoras (AS OF SYSTEM TIME), con datos algo
+// desfasados a cambio de no cargar al leaseholder. El resto de opts no
+// aplica a pgx.
+func NewPostgres(db, replica *pgxpool.Pool, t Tablas, opts Options) *Store {
+	pools := func() []PoolStats {
+		out := []PoolStats{pgPoolStats("primary", db)}
+		if replica != nil && replica != db {
+			out = append(out, pgPoolStats("replica", replica))
+		}
+		return out
+	}
+	if replica == nil {
+		replica = db
+	}
+	schema := &esquema{migrar: func(ctx context.Context) error {
+		return MigratePostgres(ctx, db, t, opts.RLS)
+	}}
+	asOf := asOfSystemTime(opts.FollowerReads)
+	items := &pgItems{db: db, read: replica, asOf: asOf, schema: schema, tabla: t.Items}
+	return &Store{
+		Items:    items,
+		SyncRuns: &pgSyncRuns{db: db, schema: schema},
+		Retries:  &pgRetries{db: db, schema: schema},
+		Daily:    &pgDailyStats{db: db, read: replica, asOf: asOf, schema: schema},
+		Flags:    &pgFeatureFlags{db: db, schema: schema},
+		APIKeys:  &pgAPIKeys{db: db, schema: schema},
+		Audit:    &pgAuditLog{db: db, schema: schema},
+		Users:    &pgUsers{db: db, schema: schema},
+		Sessions: &pgSessions{db: db, schema: schema},
+		Filters:  &pgSavedFilters{db: db, schema: schema},
+		Changes:  items,
+		TTL:      items,
+		Ping:     db.Ping,
+		Migrate:  schema.asegurar,
+		Pools:    pools,
+	}
+}
+
+// enUTC pasa a UTC una fecha leída con pgx, que devuelve las TIMESTAMPTZ en
+// la zona local del proceso. Todas las fechas de los repositorios van en UTC,
+// como las de los backends de database/sql (ver fechaSQL). t puede ser nil.
+func enUTC(t *time.Time) {
+	if t != nil {
+		*t = t.UTC()
+	}
+}
+
+// asOfSystemTime es la cláusula que se añade tras la tabla en las lecturas
+// con follower reads, o "" si retraso es 0. CockroachDB exige que el retraso
+// supere el intervalo de cierre de timestamps (por defecto ~4s) para poder
+// servir la lectura desde una réplica seguidora.
+func asOfSystemTime(retraso time.Duration) string {
+	if retraso <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" AS OF SYSTEM TIME '-%dms'", retraso.Milliseconds())
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const apiKeyColumns = `id, name, role, tenant_id, label, prefix, created_at, rotated_at, revoked_at`
+
+type pgAPIKeys struct {
+	db     *pgxpool.Pool
+	schema *esquema
+}
+
+func scanAPIKey(row pgx.Row) (*APIKey, error) {
+	var k APIKey
+	if err := row.Scan(&k.ID, &k.Name, &k.Role, &k.Tenant, &k.Label, &k.Prefix, &k.CreatedAt, &k.RotatedAt, &k.RevokedAt); err != nil {
+		return nil, err
+	}
+	enUTC(&k.CreatedAt)
+	enUTC(k.RotatedAt)
+	enUTC(k.RevokedAt)
+	return &k, nil
+}
+
+func (r *pgAPIKeys) FindByHash(ctx context.Context, hash string) (*APIKey, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	k, err := scanAPIKey(r.db.QueryRow(ctx, comentar(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`), hash))
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying api key: %w", err)
+	}
+	return k, nil
+}
+
+func (r *pgAPIKeys) Create(ctx context.Context, k APIKey, hash string) (*APIKey, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	// Solo se inserta si no hay otra clave no revocada con el mismo nombre
+	out, err := scanAPIKey(r.db.QueryRow(ctx, comentar(ctx, `
+		INSERT INTO api_keys (name, role, tenant_id, label, prefix, key_hash)
+		SELECT $1, $2, $6, $3, $4, $5
+		WHERE NOT EXISTS (SELECT 1 FROM api_keys WHERE name = $1 AND revoked_at IS NULL)
+		RETURNING `+apiKeyColumns), k.Name, k.Role, k.Label, k.Prefix, hash, k.Tenant))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("api key %q already exists: %w", k.Name, ErrConflict)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error inserting api key: %w", err)
+	}
+	return out, nil
+}
+
+func (r *pgAPIKeys) List(ctx context.Context) ([]APIKey, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, comentar(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id`))
+	if err != nil {
+		return nil, fmt.Errorf("error querying api keys: %w", err)
+	}
+	defer rows.Close()
+
+	out := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning api key: %w", err)
+		}
+		out = append(out, *k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading api keys: %w", err)
+	}
+	return out, nil
+}
+
+func (r *pgAPIKeys) Get(ctx context.Context, id int64) (*APIKey, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	k, err := scanAPIKey(r.db.QueryRow(ctx, comentar(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`), id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying api key %d: %w", id, err)
+	}
+	return k, nil
+}
+
+func (r *pgAPIKeys) Update(ctx context.Context, id int64, patch APIKeyPatch) (*APIKey, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	k, err := scanAPIKey(r.db.QueryRow(ctx, comentar(ctx, `
+		UPDATE api_keys SET label = COALESCE($1, label), role = COALESCE($2, role)
+		WHERE id = $3 AND revoked_at IS NULL
+		RETURNING `+apiKeyColumns), patch.Label, patch.Role, id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating api key %d: %w", id, err)
+	}
+	return k, nil
+}
+
+func (r *pgAPIKeys) Rotate(ctx context.Context, id int64, hash, prefix string) (*APIKey, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	k, err := scanAPIKey(r.db.QueryRow(ctx, comentar(ctx, `
+		UPDATE api_keys SET key_hash = $1, prefix = $2, rotated_at = now()
+		WHERE id = $3 AND revoked_at IS NULL
+		RETURNING `+apiKeyColumns), hash, prefix, id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error rotating api key %d: %w", id, err)
+	}
+	return k, nil
+}
+
+func (r *pgAPIKeys) Revoke(ctx context.Context, id int64) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	tag, err := r.db.Exec(ctx, comentar(ctx, `UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`), id)
+	if err != nil {
+		return fmt.Errorf("error revoking api key %d: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type pgAuditLog struct {
+	db     *pgxpool.Pool
+	schema *esquema
+}
+
+func (r *pgAuditLog) Append(ctx context.Context, ev AuditEvent) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	err := conReintentos(ctx, func() error {
+		_, err := r.db.Exec(ctx, comentar(ctx, auditInsert(dialectoPostgres)), auditArgs(ev)...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error inserting audit event: %w", err)
+	}
+	return nil
+}
+
+func (r *pgAuditLog) List(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	query, args := auditSelect(dialectoPostgres, f)
+	rows, err := r.db.Query(ctx, comentar(ctx, query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit log: %w", err)
+	}
+	defer rows.Close()
+
+	out := []AuditEvent{}
+	for rows.Next() {
+		var ev AuditEvent
+		if err := rows.Scan(&ev.ID, &ev.Time, &ev.Tenant, &ev.Action, &ev.Actor, &ev.AuthMethod, &ev.IP, &ev.RequestID, &ev.Target, &ev.Status, &ev.Detail); err != nil {
+			return nil, fmt.Errorf("error scanning audit event: %w", err)
+		}
+		enUTC(&ev.Time)
+		out = append(out, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audit log: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// changefeedResolved es cada cuánto manda el changefeed una marca "resolved",
+// que es desde donde se reanuda al reconectar.
+const changefeedResolved = "10s"
+
+// cursorChangefeed es el formato de las marcas resolved de CockroachDB
+// (nanosegundos y tiempo lógico: "1700000000000000000.0000000000"). Se
+// comprueba porque el cursor va en el texto de la sentencia.
+var cursorChangefeed = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// Watch sigue un changefeed "sinkless" de CockroachDB sobre la tabla de items y
+// llama a fn por cada fila cambiada, hasta que se cancele ctx o falle la
+// conexión. Requiere kv.rangefeed.enabled = true en el cluster.
+//
+// Sin cursor no se hace el escaneo inicial de la tabla (no_initial_scan): solo
+// interesan los cambios a partir de ahora. Con cursor se reanuda desde esa
+// marca; si es anterior al gc.ttlseconds de la tabla CockroachDB lo rechaza.
+func (r *pgItems) Watch(ctx context.Context, cursor string, fn func(ItemChange)) (string, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return cursor, err
+	}
+
+	opciones := `resolved = '` + changefeedResolved + `', no_initial_scan`
+	if cursor != "" {
+		if !cursorChangefeed.MatchString(cursor) {
+			return cursor, fmt.Errorf("invalid changefeed cursor %q", cursor)
+		}
+		opciones = `resolved = '` + changefeedResolved + `', cursor = '` + cursor + `'`
+	}
+
+	// El changefeed ocupa una conexión del pool mientras dure.
+	rows, err := r.db.Query(ctx, `EXPERIMENTAL CHANGEFEED FOR `+r.tabla+` WITH `+opciones)
+	if err != nil {
+		return cursor, fmt.Errorf("error starting changefeed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table *string
+		var key, value []byte
+		if err := rows.Scan(&table, &key, &value); err != nil {
+			return cursor, fmt.Errorf("error reading changefeed: %w", err)
+		}
+		// Las filas sin clave son marcas "resolved": {"resolved": "<hlc>"}.
+		if key == nil {
+			var marca struct {
+				Resolved string `json:"resolved"`
+			}
+			if err := json.Unmarshal(value, &marca); err != nil {
+				return cursor, fmt.Errorf("error decoding changefeed resolved timestamp: %w", err)
+			}
+			if marca.Resolved != "" {
+				cursor = marca.Resolved
+			}
+			continue
+		}
+
+		var envelope struct {
+			After json.RawMessage `json:"after"`
+		}
+		if err := json.Unmarshal(value, &envelope); err != nil {
+			return cursor, fmt.Errorf("error decoding changefeed value: %w", err)
+		}
+		// La clave empieza por tenant_id (ver migración 0010_tenants).
+		var pk []json.RawMessage
+		if err := json.Unmarshal(key, &pk); err != nil {
+			return cursor, fmt.Errorf("error decoding changefeed key: %w", err)
+		}
+		change := ItemChange{Key: key}
+		if len(pk) > 0 {
+			if err := json.Unmarshal(pk[0], &change.Tenant); err != nil {
+				return cursor, fmt.Errorf("error decoding changefeed tenant: %w", err)
+			}
+		}
+		if len(envelope.After) > 0 && string(envelope.After) != "null" {
+			change.After = envelope.After
+		}
+		fn(change)
+	}
+	if err := rows.Err(); err != nil {
+		return cursor, fmt.Errorf("changefeed ended: %w", err)
+	}
+	return cursor, nil
+}
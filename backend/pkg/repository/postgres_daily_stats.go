@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type pgDailyStats struct {
+	db   *pgxpool.Pool
+	read *pgxpool.Pool
+	// asOf es la cláusula AS OF SYSTEM TIME de las lecturas, o vacía.
+	asOf   string
+	schema *esquema
+}
+
+func (r *pgDailyStats) Save(ctx context.Context, stats []DailyStat) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	tenant := TenantFrom(ctx)
+	days := make([]time.Time, len(stats))
+	for i, s := range stats {
+		days[i] = s.Day.UTC()
+	}
+	return enTransaccion(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := upsertLote(ctx, pgExec(tx), dialectoPostgres, dailyStatsUpsert, stats, dailyStatValues(tenant)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, comentar(ctx, `DELETE FROM daily_stats WHERE tenant_id = $1 AND NOT (day = ANY($2::DATE[]))`), tenant, days); err != nil {
+			return fmt.Errorf("error pruning daily stats: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *pgDailyStats) List(ctx context.Context, since time.Time) ([]DailyStat, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.read.Query(ctx, comentar(ctx, `SELECT `+dailyStatsColumns+` FROM daily_stats`+r.asOf+` WHERE tenant_id = $1 AND day >= $2::DATE ORDER BY day`), TenantFrom(ctx), since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error querying daily stats: %w", err)
+	}
+	defer rows.Close()
+
+	out := []DailyStat{}
+	for rows.Next() {
+		var s DailyStat
+		if err := rows.Scan(&s.Day, &s.Total, &s.Upgrades, &s.Downgrades, &s.TargetsRaised, &s.TargetsLowered, &s.AvgTargetChange); err != nil {
+			return nil, fmt.Errorf("error scanning daily stats: %w", err)
+		}
+		enUTC(&s.Day)
+		out = append(out, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading daily stats: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type pgFeatureFlags struct {
+	db     *pgxpool.Pool
+	schema *esquema
+}
+
+func (r *pgFeatureFlags) List(ctx context.Context) (map[string]bool, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, comentar(ctx, `SELECT name, enabled FROM feature_flags`))
+	if err != nil {
+		return nil, fmt.Errorf("error querying feature flags: %w", err)
+	}
+	defer rows.Close()
+
+	out := map[string]bool{}
+	for rows.Next() {
+		var name string
+		var enabled bool
+		if err := rows.Scan(&name, &enabled); err != nil {
+			return nil, fmt.Errorf("error scanning feature flag: %w", err)
+		}
+		out[name] = enabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading feature flags: %w", err)
+	}
+	return out, nil
+}
+
+func (r *pgFeatureFlags) Set(ctx context.Context, name string, enabled bool) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	query, args := upsertSQL(dialectoPostgres, featureFlagsUpsert, [][]interface{}{{name, enabled, ahora()}})
+	err := conReintentos(ctx, func() error {
+		_, err := r.db.Exec(ctx, comentar(ctx, query), args...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error setting feature flag %s: %w", name, err)
+	}
+	return nil
+}
+
+func (r *pgFeatureFlags) Delete(ctx context.Context, name string) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	tag, err := r.db.Exec(ctx, comentar(ctx, `DELETE FROM feature_flags WHERE name = $1`), name)
+	if err != nil {
+		return fmt.Errorf("error deleting feature flag %s: %w", name, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type pgItems struct {
+	db *pgxpool.Pool
+	// read es el pool de las consultas de solo lectura: la réplica si la hay,
+	// si no el mismo db.
+	read *pgxpool.Pool
+	// asOf es la cláusula AS OF SYSTEM TIME de las lecturas (ver
+	// asOfSystemTime), o vacía.
+	asOf   string
+	schema *esquema
+	// tabla es el nombre configurado de la tabla de items.
+	tabla string
+	// ttl indica que CockroachDB borra las filas antiguas (ver SetTTL) y
+	// Purge no tiene nada que hacer.
+	ttl atomic.Bool
+}
+
+func (r *pgItems) List(ctx context.Context) ([]Item, error) {
+	return r.listar(ctx, `SELECT `+itemColumns+` FROM `+r.tabla+r.asOf+` WHERE tenant_id = $1`, TenantFrom(ctx))
+}
+
+func (r *pgItems) Latest(ctx context.Context) ([]Item, error) {
+	return r.listar(ctx, `SELECT `+itemColumns+` FROM `+tablaLatest(r.tabla)+r.asOf+` WHERE tenant_id = $1 ORDER BY ticker`, TenantFrom(ctx))
+}
+
+func (r *pgItems) RefreshLatest(ctx context.Context) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+	tenant := TenantFrom(ctx)
+	return enTransaccion(ctx, r.db, func(tx pgx.Tx) error {
+		for _, stmt := range refrescoLatest(r.tabla, dialectoPostgres) {
+			if _, err := tx.Exec(ctx, comentar(ctx, stmt), tenant); err != nil {
+				return fmt.Errorf("error refreshing latest ratings: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *pgItems) RecordGeneration(ctx context.Context, generation int64) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+	return enTransaccion(ctx, r.db, func(tx pgx.Tx) error {
+		for _, s := range registroGeneracion(r.tabla, dialectoPostgres, TenantFrom(ctx), generation, ahora()) {
+			if _, err := tx.Exec(ctx, comentar(ctx, s.query), s.args...); err != nil {
+				return fmt.Errorf("error recording items history: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *pgItems) Purge(ctx context.Context, before time.Time, batch int) (int64, error) {
+	if r.ttl.Load() {
+		return 0, nil
+	}
+	if err := r.schema.asegurar(ctx); err != nil {
+		return 0, err
+	}
+	return purgarItems(ctx, pgExec(r.db), r.tabla, dialectoPostgres, TenantFrom(ctx), before, batch)
+}
+
+func (r *pgItems) ListAsOf(ctx context.Context, asOf AsOf) ([]Item, error) {
+	s := consultaAsOf(r.tabla, dialectoPostgres, TenantFrom(ctx), asOf, r.asOf)
+	return r.listar(ctx, s.query, s.args...)
+}
+
+// listar ejecuta una consulta de solo lectura que devuelve itemColumns.
+func (r *pgItems) listar(ctx context.Context, query string, args ...interface{}) ([]Item, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.read.Query(ctx, comentar(ctx, query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []Item
+	for rows.Next() {
+		it, err := scanPgItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning item: %w", err)
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading items: %w", err)
+	}
+	return items, nil
+}
+
+func scanPgItem(row pgx.Row) (Item, error) {
+	var it Item
+	var targetFrom, targetTo decimalNulo
+	err := row.Scan(
+		&it.Ticker,
+		&targetFrom,
+		&targetTo,
+		&it.Company,
+		&it.Action,
+		&it.Brokerage,
+		&it.RatingFrom,
+		&it.RatingTo,
+		&it.Time,
+		&it.Version,
+	)
+	it.TargetFrom = targetFrom.ptr()
+	it.TargetTo = targetTo.ptr()
+	enUTC(&it.Time)
+	return it, err
+}
+
+// itemColumns son las columnas que se leen de items y de la tabla de últimas
+// valoraciones, en el orden en que se escanean.
+const itemColumns = `ticker, target_from, target_to, company, action, brokerage, rating_from, rating_to, time, version`
+
+// tablaLatest es la tabla resumen con la última valoración de cada ticker.
+func tablaLatest(items string) string {
+	return items + "_latest"
+}
+
+// refrescoLatest son las sentencias que rehacen la tabla resumen de un tenant
+// a partir de items; cada una recibe el tenant como único parámetro. Usan
+// funciones de ventana, disponibles en todos los backends.
+func refrescoLatest(items string, d *dialecto) []string {
+	latest := tablaLatest(items)
+	return []string{
+		`DELETE FROM ` + latest + ` WHERE tenant_id = ` + d.placeholder(1),
+		`INSERT INTO ` + latest + ` (tenant_id, ` + itemColumns + `)
+		SELECT tenant_id, ` + itemColumns + ` FROM (
+			SELECT tenant_id, ` + itemColumns + `,
+				row_number() OVER (PARTITION BY ticker ORDER BY time DESC, brokerage) AS rn
+			FROM ` + items + `
+			WHERE tenant_id = ` + d.placeholder(1) + `
+		) AS ranked
+		WHERE rn = 1`,
+	}
+}
+
+// itemsUpsert es el destino de los upserts de items, con la clave primaria de
+// la tabla como clave de conflicto. La tabla (Table) es configurable. La
+// versión se reescribe también en las filas que ya existían (ver
+// siguienteVersion).
+func itemsUpsert(table string) upsertSpec {
+	return upsertSpec{
+		Table:   table,
+		Columns: []string{"tenant_id", "ticker", "target_from", "target_to", "company", "action", "brokerage", "rating_from", "rating_to", "time", "raw", "version"},
+		Key:     []string{"tenant_id", "ticker", "brokerage", "time"},
+	}
+}
+
+// itemValues devuelve los valores de itemsUpsert para los items de tenant,
+// todos con la misma versión.
+func itemValues(tenant string, version int64) func(Item) []interface{} {
+	return func(it Item) []interface{} {
+		return []interface{}{
+			tenant,
+			it.Ticker,
+			valorDecimal(it.TargetFrom),
+			valorDecimal(it.TargetTo),
+			it.Company,
+			it.Action,
+			it.Brokerage,
+			it.RatingFrom,
+			it.RatingTo,
+			// En UTC para que los backends que guardan las fechas como texto
+			// puedan compararlas.
+			it.Time.UTC(),
+			rawValue(it.Raw),
+			version,
+		}
+	}
+}
+
+// rawValue pasa el JSON original como texto, o NULL si no lo hay.
+func rawValue(raw json.RawMessage) interface{} {
+	if raw == nil {
+		return nil
+	}
+	return string(raw)
+}
+
+func (r *pgItems) Upsert(ctx context.Context, items []Item) (int64, error) {
+	if len(items) == 0 {
+		return 0, nil
+	}
+	if err := r.schema.asegurar(ctx); err != nil {
+		return 0, err
+	}
+	tenant := TenantFrom(ctx)
+	var n int64
+	err := enTransaccion(ctx, r.db, func(tx pgx.Tx) error {
+		version, err := r.siguienteVersion(ctx, tx, tenant)
+		if err != nil {
+			return err
+		}
+		n, err = upsertLote(ctx, pgExec(tx), dialectoPostgres, itemsUpsert(r.tabla), items, itemValues(tenant, version))
+		return err
+	})
+	return n, err
+}
+
+func (r *pgItems) Replace(ctx context.Context, items []Item) (int64, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return 0, err
+	}
+
+	tenant := TenantFrom(ctx)
+	var n int64
+	err := enTransaccion(ctx, r.db, func(tx pgx.Tx) error {
+		// DELETE en lugar de TRUNCATE: TRUNCATE no es transaccional en
+		// CockroachDB y los lectores verían la tabla vacía. Solo se borran las
+		// filas del tenant. La versión se calcula antes de borrar para que no
+		// vuelva a empezar.
+		version, err := r.siguienteVersion(ctx, tx, tenant)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, comentar(ctx, `DELETE FROM `+r.tabla+` WHERE tenant_id = $1`), tenant); err != nil {
+			return fmt.Errorf("error deleting items: %w", err)
+		}
+		n, err = upsertLote(ctx, pgExec(tx), dialectoPostgres, itemsUpsert(r.tabla), items, itemValues(tenant, version))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// siguienteVersion es la versión de las filas que escribe una sincronización
+// del tenant dentro de tx.
+func (r *pgItems) siguienteVersion(ctx context.Context, tx pgx.Tx, tenant string) (int64, error) {
+	var actual int64
+	if err := tx.QueryRow(ctx, comentar(ctx, versionMaxima(r.tabla, dialectoPostgres)), tenant).Scan(&actual); err != nil {
+		return 0, fmt.Errorf("error querying items version: %w", err)
+	}
+	return siguienteVersion(actual, time.Now()), nil
+}
+
+func (r *pgItems) Update(ctx context.Context, key ItemKey, version int64, patch ItemPatch) (*Item, error) {
+	if err := patch.Validate(); err != nil {
+		return nil, err
+	}
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	tenant := TenantFrom(ctx)
+	var it Item
+	err := enTransaccion(ctx, r.db, func(tx pgx.Tx) error {
+		if query, args, ok := actualizacionItem(r.tabla, dialectoPostgres, tenant, key, version, patch); ok {
+			tag, err := tx.Exec(ctx, comentar(ctx, query), args...)
+			if err != nil {
+				return fmt.Errorf("error updating item: %w", err)
+			}
+			if tag.RowsAffected() == 1 {
+				version++
+			}
+		}
+
+		var err error
+		it, err = scanPgItem(tx.QueryRow(ctx, comentar(ctx, `
+			SELECT `+itemColumns+` FROM `+r.tabla+`
+			WHERE tenant_id = $1 AND ticker = $2 AND brokerage = $3 AND time = $4
+		`), tenant, key.Ticker, key.Brokerage, key.Time.UTC()))
+		if err == pgx.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error querying item: %w", err)
+		}
+		if it.Version != version {
+			return ErrVersionConflict
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+func (r *pgItems) Stats(ctx context.Context) (ItemStats, error) {
+	var st ItemStats
+	if err := r.schema.asegurar(ctx); err != nil {
+		return st, err
+	}
+	err := r.read.QueryRow(ctx, comentar(ctx, `
+		SELECT count(*), count(DISTINCT ticker), count(DISTINCT brokerage), max(time)
+		FROM `+r.tabla+r.asOf+` WHERE tenant_id = $1`), TenantFrom(ctx)).Scan(&st.Total, &st.Tickers, &st.Brokerages, &st.LatestTime)
+	if err != nil {
+		return st, fmt.Errorf("error querying item stats: %w", err)
+	}
+	enUTC(st.LatestTime)
+	return st, nil
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type pgRetries struct {
+	db     *pgxpool.Pool
+	schema *esquema
+}
+
+func (r *pgRetries) Enqueue(ctx context.Context, maxAttempts int, nextAttempt time.Time, lastErr string, staleBefore time.Time) (bool, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return false, err
+	}
+
+	var enqueued bool
+	err := conReintentos(ctx, func() error {
+		tag, err := r.db.Exec(ctx, comentar(ctx, `
+			INSERT INTO sync_retries (tenant_id, status, max_attempts, next_attempt_at, last_error)
+			SELECT $7::STRING, $1::STRING, $2::INT, $3::TIMESTAMPTZ, $4::STRING
+			WHERE NOT EXISTS (
+				SELECT 1 FROM sync_retries
+				WHERE tenant_id = $7 AND (status = $1 OR (status = $5 AND updated_at > $6))
+			)
+		`), RetryPending, maxAttempts, nextAttempt, lastErr, RetryRunning, staleBefore, TenantFrom(ctx))
+		enqueued = err == nil && tag.RowsAffected() > 0
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("error enqueuing sync retry: %w", err)
+	}
+	return enqueued, nil
+}
+
+func (r *pgRetries) Claim(ctx context.Context, staleBefore time.Time) (*SyncRetry, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	// Se reclama el reintento con un UPDATE condicional para que dos réplicas
+	// no ejecuten el mismo. Los que quedaron "running" por un proceso caído se
+	// vuelven a tomar pasado staleBefore.
+	var rt SyncRetry
+	err := conReintentos(ctx, func() error {
+		return r.db.QueryRow(ctx, comentar(ctx, `
+			UPDATE sync_retries
+			SET status = $1, attempt = attempt + 1, updated_at = now()
+			WHERE id = (
+				SELECT id FROM sync_retries
+				WHERE (status = $2 AND next_attempt_at <= now())
+				   OR (status = $1 AND updated_at <= $3)
+				ORDER BY next_attempt_at
+				LIMIT 1
+			)
+			RETURNING id, attempt, max_attempts, tenant_id
+		`), RetryRunning, RetryPending, staleBefore).Scan(&rt.ID, &rt.Attempt, &rt.MaxAttempts, &rt.Tenant)
+	})
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error claiming sync retry: %w", err)
+	}
+	return &rt, nil
+}
+
+func (r *pgRetries) Complete(ctx context.Context, id int64) error {
+	return r.update(ctx, id, `
+		UPDATE sync_retries SET status = $1, last_error = NULL, updated_at = now() WHERE id = $2
+	`, RetryDone, id)
+}
+
+func (r *pgRetries) Fail(ctx context.Context, id int64, lastErr string) error {
+	return r.update(ctx, id, `
+		UPDATE sync_retries SET status = $1, last_error = $2, updated_at = now() WHERE id = $3
+	`, RetryFailed, lastErr, id)
+}
+
+func (r *pgRetries) Reschedule(ctx context.Context, id int64, lastErr string, next time.Time) error {
+	return r.update(ctx, id, `
+		UPDATE sync_retries
+		SET status = $1, last_error = $2, next_attempt_at = $3, updated_at = now()
+		WHERE id = $4
+	`, RetryPending, lastErr, next, id)
+}
+
+func (r *pgRetries) Release(ctx context.Context, id int64) error {
+	return r.update(ctx, id, `
+		UPDATE sync_retries SET status = $1, attempt = attempt - 1, updated_at = now() WHERE id = $2
+	`, RetryPending, id)
+}
+
+func (r *pgRetries) update(ctx context.Context, id int64, sql string, args ...interface{}) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+	err := conReintentos(ctx, func() error {
+		_, err := r.db.Exec(ctx, comentar(ctx, sql), args...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error updating sync retry %d: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const savedFilterColumns = `id, name, query, sort_by, sort_order, created_at, updated_at`
+
+type pgSavedFilters struct {
+	db     *pgxpool.Pool
+	schema *esquema
+}
+
+func scanSavedFilter(row pgx.Row) (*SavedFilter, error) {
+	var f SavedFilter
+	if err := row.Scan(&f.ID, &f.Name, &f.Query, &f.SortBy, &f.SortOrder, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		return nil, err
+	}
+	enUTC(&f.CreatedAt)
+	enUTC(&f.UpdatedAt)
+	return &f, nil
+}
+
+func (r *pgSavedFilters) List(ctx context.Context, owner string) ([]SavedFilter, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, comentar(ctx, `SELECT `+savedFilterColumns+` FROM saved_filters WHERE tenant_id = $1 AND owner = $2 ORDER BY name`), TenantFrom(ctx), owner)
+	if err != nil {
+		return nil, fmt.Errorf("error querying saved filters: %w", err)
+	}
+	defer rows.Close()
+
+	out := []SavedFilter{}
+	for rows.Next() {
+		f, err := scanSavedFilter(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning saved filter: %w", err)
+		}
+		out = append(out, *f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating saved filters: %w", err)
+	}
+	return out, nil
+}
+
+func (r *pgSavedFilters) Create(ctx context.Context, owner string, f SavedFilter) (*SavedFilter, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	out, err := scanSavedFilter(r.db.QueryRow(ctx, comentar(ctx, `
+		INSERT INTO saved_filters (tenant_id, owner, name, query, sort_by, sort_order)
+		SELECT $1, $2, $3, $4, $5, $6
+		WHERE NOT EXISTS (SELECT 1 FROM saved_filters WHERE tenant_id = $1 AND owner = $2 AND name = $3)
+		RETURNING `+savedFilterColumns), TenantFrom(ctx), owner, f.Name, f.Query, f.SortBy, f.SortOrder))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("saved filter %q already exists: %w", f.Name, ErrConflict)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error inserting saved filter: %w", err)
+	}
+	return out, nil
+}
+
+func (r *pgSavedFilters) Update(ctx context.Context, owner string, id int64, f SavedFilter) (*SavedFilter, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	tenant := TenantFrom(ctx)
+	out, err := scanSavedFilter(r.db.QueryRow(ctx, comentar(ctx, `
+		UPDATE saved_filters SET name = $4, query = $5, sort_by = $6, sort_order = $7, updated_at = now()
+		WHERE id = $1 AND tenant_id = $2 AND owner = $3
+			AND NOT EXISTS (SELECT 1 FROM saved_filters WHERE tenant_id = $2 AND owner = $3 AND name = $4 AND id <> $1)
+		RETURNING `+savedFilterColumns), id, tenant, owner, f.Name, f.Query, f.SortBy, f.SortOrder))
+	if err == pgx.ErrNoRows {
+		// O no existe o el nombre ya lo tiene otro filtro
+		var existe bool
+		if err := r.db.QueryRow(ctx, comentar(ctx, `SELECT EXISTS (SELECT 1 FROM saved_filters WHERE id = $1 AND tenant_id = $2 AND owner = $3)`), id, tenant, owner).Scan(&existe); err != nil {
+			return nil, fmt.Errorf("error querying saved filter %d: %w", id, err)
+		}
+		if !existe {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("saved filter %q already exists: %w", f.Name, ErrConflict)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating saved filter %d: %w", id, err)
+	}
+	return out, nil
+}
+
+func (r *pgSavedFilters) Delete(ctx context.Context, owner string, id int64) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	tag, err := r.db.Exec(ctx, comentar(ctx, `DELETE FROM saved_filters WHERE id = $1 AND tenant_id = $2 AND owner = $3`), id, TenantFrom(ctx), owner)
+	if err != nil {
+		return fmt.Errorf("error deleting saved filter %d: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const syncRunColumns = `id, trigger, status, params, retry_of, items_fetched, items_inserted, error, checkpoint, stages, started_at, finished_at`
+
+type pgSyncRuns struct {
+	db     *pgxpool.Pool
+	schema *esquema
+}
+
+func (r *pgSyncRuns) Start(ctx context.Context, trigger string, params SyncParams, retryOf *int64) (int64, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err := conReintentos(ctx, func() error {
+		return r.db.QueryRow(ctx, comentar(ctx, `
+			INSERT INTO sync_runs (tenant_id, trigger, status, params, retry_of)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`), TenantFrom(ctx), trigger, RunRunning, params, retryOf).Scan(&id)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error inserting sync run: %w", err)
+	}
+	return id, nil
+}
+
+func (r *pgSyncRuns) Finish(ctx context.Context, id int64, res SyncRunResult) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	err := conReintentos(ctx, func() error {
+		_, err := r.db.Exec(ctx, comentar(ctx, `
+			UPDATE sync_runs
+			SET status = $1, items_fetched = $2, items_inserted = $3, error = $4, checkpoint = $5, stages = $6, finished_at = now()
+			WHERE id = $7
+		`), res.Status, res.ItemsFetched, res.ItemsInserted, res.Error, res.Checkpoint, etapasJSON(res.Stages), id)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error updating sync run: %w", err)
+	}
+	return nil
+}
+
+func (r *pgSyncRuns) Get(ctx context.Context, id int64) (*SyncRun, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	run, err := scanSyncRun(r.db.QueryRow(ctx, comentar(ctx, `SELECT `+syncRunColumns+` FROM sync_runs WHERE id = $1 AND tenant_id = $2`), id, TenantFrom(ctx)))
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying sync run: %w", err)
+	}
+	return run, nil
+}
+
+func (r *pgSyncRuns) List(ctx context.Context, limit int) ([]SyncRun, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, comentar(ctx, `SELECT `+syncRunColumns+` FROM sync_runs WHERE tenant_id = $1 ORDER BY id DESC LIMIT $2`), TenantFrom(ctx), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying sync runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []SyncRun{}
+	for rows.Next() {
+		run, err := scanSyncRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning sync run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading sync runs: %w", err)
+	}
+	return runs, nil
+}
+
+func (r *pgSyncRuns) Last(ctx context.Context, f SyncRunFilter) (*SyncRun, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	run, err := scanSyncRun(r.db.QueryRow(ctx, comentar(ctx, `
+		SELECT `+syncRunColumns+` FROM sync_runs
+		WHERE tenant_id = $1 AND ($2 = '' OR trigger = $2) AND ($3 = '' OR status = $3)
+		ORDER BY id DESC LIMIT 1
+	`), TenantFrom(ctx), f.Trigger, f.Status))
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying sync run: %w", err)
+	}
+	return run, nil
+}
+
+func scanSyncRun(row pgx.Row) (*SyncRun, error) {
+	var run SyncRun
+	err := row.Scan(
+		&run.ID, &run.Trigger, &run.Status, &run.Params, &run.RetryOf,
+		&run.ItemsFetched, &run.ItemsInserted, &run.Error, &run.Checkpoint, &run.Stages, &run.StartedAt, &run.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	enUTC(&run.StartedAt)
+	enUTC(run.FinishedAt)
+	return &run, nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ttlJobCron es cada cuánto pasa el job de row-level TTL de CockroachDB.
+const ttlJobCron = "@hourly"
+
+// expresionTTL es la ttl_expiration_expression de una retención: cada fila
+// caduca retention después de su time. Se redondea a segundos porque va en el
+// texto de la sentencia.
+func expresionTTL(retention time.Duration) string {
+	segundos := int64(retention / time.Second)
+	if segundos < 1 {
+		segundos = 1
+	}
+	return fmt.Sprintf("(time + INTERVAL '%d seconds')", segundos)
+}
+
+// SetTTL activa (o, con retention 0, quita) el row-level TTL de CockroachDB
+// en items y su histórico. No necesita licencia enterprise: un job del
+// cluster borra por lotes las filas caducadas cada ttlJobCron, y Purge deja
+// de lanzar los DELETE desde la aplicación. Si la tabla ya tiene la misma
+// expresión no se vuelve a cambiar el esquema, para que cada arranque no
+// lance una schema change.
+func (r *pgItems) SetTTL(ctx context.Context, retention time.Duration) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+	// La expresión va como literal de texto en la sentencia
+	expr := strings.ReplaceAll(expresionTTL(retention), "'", "''")
+	for _, tabla := range []string{r.tabla, tablaHistorico(r.tabla)} {
+		var actual string
+		err := r.db.QueryRow(ctx, `SELECT create_statement FROM [SHOW CREATE TABLE `+tabla+`]`).Scan(&actual)
+		if err != nil {
+			return fmt.Errorf("error reading the definition of %s: %w", tabla, err)
+		}
+		tiene := strings.Contains(actual, "ttl_expiration_expression")
+
+		var query string
+		switch {
+		case retention > 0 && tiene && strings.Contains(actual, expr):
+			continue
+		case retention > 0:
+			query = `ALTER TABLE ` + tabla + ` SET (ttl_expiration_expression = '` + expr + `', ttl_job_cron = '` + ttlJobCron + `')`
+		case tiene:
+			query = `ALTER TABLE ` + tabla + ` RESET (ttl)`
+		default:
+			continue
+		}
+		if _, err := r.db.Exec(ctx, query); err != nil {
+			return fmt.Errorf("error setting the row-level TTL of %s: %w", tabla, err)
+		}
+	}
+	r.ttl.Store(retention > 0)
+	return nil
+}
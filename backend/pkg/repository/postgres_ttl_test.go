@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpresionTTL(t *testing.T) {
+	tests := []struct {
+		retention time.Duration
+		want      string
+	}{
+		{30 * 24 * time.Hour, "(time + INTERVAL '2592000 seconds')"},
+		{90 * time.Minute, "(time + INTERVAL '5400 seconds')"},
+		// Por debajo del segundo no se queda en 0, que caducaría todo
+		{500 * time.Millisecond, "(time + INTERVAL '1 seconds')"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.retention.String(), func(t *testing.T) {
+			if got := expresionTTL(tt.retention); got != tt.want {
+				t.Errorf("expresionTTL(%s) = %q, want %q", tt.retention, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const userColumns = `id, email, name, role, tenant_id, created_at, last_login_at, password_hash`
+
+type pgUsers struct {
+	db     *pgxpool.Pool
+	schema *esquema
+}
+
+func scanUser(row pgx.Row) (*User, error) {
+	var u User
+	if err := row.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.Tenant, &u.CreatedAt, &u.LastLoginAt, &u.PasswordHash); err != nil {
+		return nil, err
+	}
+	enUTC(&u.CreatedAt)
+	enUTC(u.LastLoginAt)
+	return &u, nil
+}
+
+func (r *pgUsers) Create(ctx context.Context, u User) (*User, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	out, err := scanUser(r.db.QueryRow(ctx, comentar(ctx, `
+		INSERT INTO users (email, name, role, tenant_id, password_hash)
+		SELECT $1, $2, $3, $5, $4
+		WHERE NOT EXISTS (SELECT 1 FROM users WHERE email = $1)
+		RETURNING `+userColumns), u.Email, u.Name, u.Role, u.PasswordHash, u.Tenant))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("user %q already exists: %w", u.Email, ErrConflict)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error inserting user: %w", err)
+	}
+	return out, nil
+}
+
+func (r *pgUsers) FindByEmail(ctx context.Context, email string) (*User, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	u, err := scanUser(r.db.QueryRow(ctx, comentar(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1`), email))
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying user: %w", err)
+	}
+	return u, nil
+}
+
+func (r *pgUsers) RecordLogin(ctx context.Context, id int64) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	if _, err := r.db.Exec(ctx, comentar(ctx, `UPDATE users SET last_login_at = now() WHERE id = $1`), id); err != nil {
+		return fmt.Errorf("error updating user %d: %w", id, err)
+	}
+	return nil
+}
+
+type pgSessions struct {
+	db     *pgxpool.Pool
+	schema *esquema
+}
+
+func (r *pgSessions) Create(ctx context.Context, hash string, userID int64, expiresAt time.Time) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	err := conReintentos(ctx, func() error {
+		_, err := r.db.Exec(ctx, comentar(ctx, `INSERT INTO sessions (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`), hash, userID, expiresAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error inserting session: %w", err)
+	}
+	if _, err := r.db.Exec(ctx, comentar(ctx, `DELETE FROM sessions WHERE user_id = $1 AND expires_at < now()`), userID); err != nil {
+		return fmt.Errorf("error deleting expired sessions: %w", err)
+	}
+	return nil
+}
+
+func (r *pgSessions) Find(ctx context.Context, hash string, now time.Time) (*Session, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	var s Session
+	u := &s.User
+	err := r.db.QueryRow(ctx, comentar(ctx, `
+		SELECT u.id, u.email, u.name, u.role, u.tenant_id, u.created_at, u.last_login_at, u.password_hash, s.created_at, s.expires_at
+		FROM sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.revoked_at IS NULL AND s.expires_at > $2
+	`), hash, now).Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.Tenant, &u.CreatedAt, &u.LastLoginAt, &u.PasswordHash, &s.CreatedAt, &s.ExpiresAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying session: %w", err)
+	}
+	enUTC(&u.CreatedAt)
+	enUTC(u.LastLoginAt)
+	enUTC(&s.CreatedAt)
+	enUTC(&s.ExpiresAt)
+	return &s, nil
+}
+
+func (r *pgSessions) Revoke(ctx context.Context, hash string) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	tag, err := r.db.Exec(ctx, comentar(ctx, `UPDATE sessions SET revoked_at = now() WHERE token_hash = $1 AND revoked_at IS NULL`), hash)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"strings"
+)
+
+type claveComentario struct{}
+
+// WithQueryComment devuelve un contexto cuyas sentencias SQL llevan al final
+// el comentario /* tag */ (p. ej. "req:abc123"), para localizar en la consola
+// de CockroachDB o en el log de consultas lentas la petición que las lanzó.
+// Del tag se quitan los '*' y los caracteres de control, de modo que no puede
+// cerrar el comentario.
+//
+// Cada texto distinto es una sentencia distinta para la caché de sentencias
+// preparadas de pgx, así que con un tag por petición las consultas se
+// preparan cada vez.
+func WithQueryComment(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, claveComentario{}, tag)
+}
+
+// comentar añade a query el comentario del contexto, si tiene.
+func comentar(ctx context.Context, query string) string {
+	tag, _ := ctx.Value(claveComentario{}).(string)
+	tag = strings.Map(func(c rune) rune {
+		if c == '*' || c < ' ' || c == 0x7f {
+			return -1
+		}
+		return c
+	}, tag)
+	if tag == "" {
+		return query
+	}
+	return query + " /* " + tag + " */"
+}
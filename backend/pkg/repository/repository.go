@@ -0,0 +1,542 @@
+// Package repository concentra todo el acceso a la base de datos. Los handlers
+// y la sincronización trabajan contra las interfaces de este paquete, de modo
+// que se pueden probar con implementaciones falsas o cambiar de backend.
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"unicode/utf8"
+)
+
+// Errores de dominio de los repositorios. Se comprueban con errors.Is: los
+// demás errores son fallos internos (base de datos caída, consulta inválida).
+var (
+	// ErrNotFound se devuelve cuando el registro pedido no existe.
+	ErrNotFound = errors.New("not found")
+	// ErrValidation se devuelve, envuelto con el detalle, cuando los datos
+	// que se quieren escribir no son válidos.
+	ErrValidation = errors.New("validation failed")
+	// ErrConflict se devuelve cuando la operación choca con el estado actual
+	// del registro.
+	ErrConflict = errors.New("conflict")
+	// ErrVersionConflict es el ErrConflict de editar un registro que cambió
+	// desde la versión que tenía quien lo edita.
+	ErrVersionConflict = fmt.Errorf("version %w", ErrConflict)
+)
+
+// Item es una recomendación de un bróker sobre un ticker. Los precios objetivo
+// se guardan como NUMERIC y se exponen como números; Time está en UTC.
+//
+// Los precios y las valoraciones que la API no envía quedan en nil: NULL en
+// la base de datos y null en el JSON.
+type Item struct {
+	Ticker     string    `json:"ticker"`
+	TargetFrom *Decimal  `json:"target_from"`
+	TargetTo   *Decimal  `json:"target_to"`
+	Company    string    `json:"company"`
+	Action     string    `json:"action"`
+	Brokerage  string    `json:"brokerage"`
+	RatingFrom *string   `json:"rating_from"`
+	RatingTo   *string   `json:"rating_to"`
+	Time       time.Time `json:"time"`
+	// Version aumenta con cada edición manual (Update) y con cada
+	// sincronización que reescribe la fila; nunca vuelve a un valor anterior.
+	Version int64 `json:"version"`
+	// Raw es el JSON original del item en la API. Se guarda para poder
+	// reinterpretarlo más adelante sin volver a descargarlo; no se expone.
+	Raw json.RawMessage `json:"-"`
+}
+
+// ItemStats es un resumen del contenido de la tabla items.
+type ItemStats struct {
+	Total      int64      `json:"total"`
+	Tickers    int64      `json:"tickers"`
+	Brokerages int64      `json:"brokerages"`
+	LatestTime *time.Time `json:"latest_time,omitempty"`
+}
+
+// ItemRepository da acceso a los items sincronizados.
+type ItemRepository interface {
+	List(ctx context.Context) ([]Item, error)
+	// Upsert inserta los items o actualiza los que ya existen y devuelve
+	// cuántos se escribieron. Los duplicados dentro del lote cuentan una vez.
+	Upsert(ctx context.Context, items []Item) (int64, error)
+	// Replace sustituye todo el contenido por items de forma atómica: los
+	// lectores ven la tabla anterior hasta que se confirma la nueva.
+	Replace(ctx context.Context, items []Item) (int64, error)
+	Stats(ctx context.Context) (ItemStats, error)
+	// Latest devuelve la última valoración de cada ticker desde la tabla
+	// resumen, que se rehace con RefreshLatest al final de cada sincronización.
+	Latest(ctx context.Context) ([]Item, error)
+	RefreshLatest(ctx context.Context) error
+	// Update aplica patch al item key si sigue en la versión dada y devuelve
+	// el item actualizado. Devuelve ErrValidation si el patch no es válido
+	// (ver ItemPatch.Validate), ErrNotFound si no existe y ErrVersionConflict
+	// si otra edición lo cambió antes.
+	Update(ctx context.Context, key ItemKey, version int64, patch ItemPatch) (*Item, error)
+	// RecordGeneration guarda en el histórico el contenido actual de items
+	// como la generación dada; las filas que cambiaron o desaparecieron desde
+	// la anterior quedan superadas, no se borran.
+	RecordGeneration(ctx context.Context, generation int64) error
+	// ListAsOf devuelve los items tal y como estaban en asOf, según el
+	// histórico.
+	ListAsOf(ctx context.Context, asOf AsOf) ([]Item, error)
+	// Purge borra los items, y sus versiones en el histórico, con time
+	// anterior a before, en lotes de como mucho batch filas. Devuelve cuántas
+	// filas borró. Si el backend las borra con TTL (ver ItemTTL) no hace nada.
+	Purge(ctx context.Context, before time.Time, batch int) (int64, error)
+}
+
+// ItemKey identifica un item: es la clave primaria de la tabla.
+type ItemKey struct {
+	Ticker    string
+	Brokerage string
+	Time      time.Time
+}
+
+// ItemPatch son los campos de un item que se pueden editar a mano. Los nil no
+// se modifican.
+type ItemPatch struct {
+	TargetFrom *Decimal `json:"target_from"`
+	TargetTo   *Decimal `json:"target_to"`
+	Company    *string  `json:"company"`
+	Action     *string  `json:"action"`
+	RatingFrom *string  `json:"rating_from"`
+	RatingTo   *string  `json:"rating_to"`
+}
+
+// Validate comprueba que el patch deja el item en un estado válido: los
+// precios objetivo no pueden ser negativos. El error envuelve ErrValidation.
+func (p ItemPatch) Validate() error {
+	var errs []error
+	if p.TargetFrom != nil && p.TargetFrom.Sign() < 0 {
+		errs = append(errs, fmt.Errorf("target_from cannot be negative (%v)", *p.TargetFrom))
+	}
+	if p.TargetTo != nil && p.TargetTo.Sign() < 0 {
+		errs = append(errs, fmt.Errorf("target_to cannot be negative (%v)", *p.TargetTo))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrValidation, errors.Join(errs...))
+	}
+	return nil
+}
+
+// DailyStat es el resumen de las valoraciones de un día (UTC).
+type DailyStat struct {
+	Day            time.Time `json:"day"`
+	Total          int64     `json:"total"`
+	Upgrades       int64     `json:"upgrades"`
+	Downgrades     int64     `json:"downgrades"`
+	TargetsRaised  int64     `json:"targets_raised"`
+	TargetsLowered int64     `json:"targets_lowered"`
+	// AvgTargetChange es la variación media del precio objetivo en %, entre
+	// los items con precio de partida; nil si no hay ninguno.
+	AvgTargetChange *float64 `json:"avg_target_change"`
+}
+
+// DailyStatsRepository mantiene la tabla daily_stats.
+type DailyStatsRepository interface {
+	// Save escribe las estadísticas de los días dados y borra las de los días
+	// que no aparecen, que ya no tienen items.
+	Save(ctx context.Context, stats []DailyStat) error
+	// List devuelve los días desde since (incluido), en orden.
+	List(ctx context.Context, since time.Time) ([]DailyStat, error)
+}
+
+// ItemChange es un cambio en una fila de items recibido de la base de datos.
+type ItemChange struct {
+	// Tenant es el tenant de la fila; sirve para entregar el cambio solo a sus
+	// clientes.
+	Tenant string `json:"-"`
+	// Key es la clave primaria de la fila como array JSON.
+	Key json.RawMessage `json:"key"`
+	// After es la fila tras el cambio como objeto JSON, o nil si se borró.
+	After json.RawMessage `json:"after,omitempty"`
+}
+
+// ItemChangeFeed lo implementan los backends que pueden notificar cambios en
+// items hechos por cualquier proceso, no solo por esta instancia.
+type ItemChangeFeed interface {
+	// Watch llama a fn por cada cambio hasta que se cancele ctx o se corte
+	// el feed; quien lo llama se encarga de reconectar. Con cursor vacío
+	// empieza en el momento actual, sin recorrer las filas existentes, y si
+	// no reanuda desde cursor. Devuelve la última marca resuelta recibida
+	// (todos los cambios anteriores ya se han entregado), que es el cursor
+	// de la siguiente llamada, o el mismo cursor si no llegó ninguna.
+	Watch(ctx context.Context, cursor string, fn func(ItemChange)) (string, error)
+}
+
+// ItemTTL lo implementan los backends que pueden borrar por sí mismos los
+// items antiguos, sin que la aplicación lance los DELETE.
+type ItemTTL interface {
+	// SetTTL hace que la base de datos borre en segundo plano las filas de
+	// items y de su histórico con time anterior a ahora-retention; con 0 deja
+	// de hacerlo. Mientras está activo, ItemRepository.Purge no borra nada.
+	SetTTL(ctx context.Context, retention time.Duration) error
+}
+
+// Estados de una ejecución de sincronización.
+const (
+	RunRunning     = "running"
+	RunSuccess     = "success"
+	RunFailed      = "failed"
+	RunInterrupted = "interrupted"
+)
+
+// SyncParams son los parámetros con los que se lanzó una sincronización; se
+// guardan con la ejecución para poder repetirla tal cual.
+type SyncParams struct {
+	Source string `json:"source"`
+}
+
+// SyncCheckpoint es el punto alcanzado por una sincronización interrumpida.
+type SyncCheckpoint struct {
+	NextPage     string `json:"next_page,omitempty"`
+	PagesFetched int    `json:"pages_fetched"`
+	ItemsFetched int    `json:"items_fetched"`
+}
+
+// SyncRun es una ejecución de sincronización registrada en sync_runs.
+type SyncRun struct {
+	ID            int64           `json:"id"`
+	Trigger       string          `json:"trigger"`
+	Status        string          `json:"status"`
+	Params        SyncParams      `json:"params"`
+	RetryOf       *int64          `json:"retry_of,omitempty"`
+	ItemsFetched  int             `json:"items_fetched"`
+	ItemsInserted int64           `json:"items_inserted"`
+	Error         *string         `json:"error,omitempty"`
+	Checkpoint    *SyncCheckpoint `json:"checkpoint,omitempty"`
+	Stages        []SyncStage     `json:"stages,omitempty"`
+	StartedAt     time.Time       `json:"started_at"`
+	FinishedAt    *time.Time      `json:"finished_at,omitempty"`
+}
+
+// SyncRunResult es lo que se guarda al terminar una ejecución.
+type SyncRunResult struct {
+	Status        string
+	ItemsFetched  int
+	ItemsInserted int64
+	Error         *string
+	Checkpoint    *SyncCheckpoint
+	// Stages son los tiempos de cada etapa (ver StartStage).
+	Stages []SyncStage
+}
+
+// SyncRunFilter selecciona ejecuciones por trigger y estado; los campos
+// vacíos no filtran.
+type SyncRunFilter struct {
+	Trigger string
+	Status  string
+}
+
+// SyncRunRepository guarda el historial de sincronizaciones.
+type SyncRunRepository interface {
+	Start(ctx context.Context, trigger string, params SyncParams, retryOf *int64) (int64, error)
+	Finish(ctx context.Context, id int64, res SyncRunResult) error
+	// Get devuelve ErrNotFound si la ejecución no existe.
+	Get(ctx context.Context, id int64) (*SyncRun, error)
+	List(ctx context.Context, limit int) ([]SyncRun, error)
+	// Last devuelve la ejecución más reciente que cumple f, o ErrNotFound si
+	// no hay ninguna.
+	Last(ctx context.Context, f SyncRunFilter) (*SyncRun, error)
+}
+
+// Estados de un reintento en la cola.
+const (
+	RetryPending = "pending"
+	RetryRunning = "running"
+	RetryDone    = "done"
+	RetryFailed  = "failed"
+)
+
+// SyncRetry es un reintento reclamado de la cola.
+type SyncRetry struct {
+	ID          int64
+	Attempt     int
+	MaxAttempts int
+	// Tenant es el tenant cuya sincronización hay que reintentar.
+	Tenant string
+}
+
+// RetryRepository es la cola persistente de reintentos de sincronización.
+type RetryRepository interface {
+	// Enqueue añade un reintento pendiente para el tenant de ctx salvo que ya
+	// haya uno pendiente o en curso (los "running" anteriores a staleBefore no
+	// cuentan). Devuelve si se encoló.
+	Enqueue(ctx context.Context, maxAttempts int, nextAttempt time.Time, lastErr string, staleBefore time.Time) (bool, error)
+	// Claim reclama el siguiente reintento vencido de cualquier tenant, o uno
+	// "running" abandonado antes de staleBefore. Devuelve nil si no hay
+	// ninguno.
+	Claim(ctx context.Context, staleBefore time.Time) (*SyncRetry, error)
+	Complete(ctx context.Context, id int64) error
+	Fail(ctx context.Context, id int64, lastErr string) error
+	Reschedule(ctx context.Context, id int64, lastErr string, next time.Time) error
+	// Release devuelve el reintento a pendiente sin consumir el intento.
+	Release(ctx context.Context, id int64) error
+}
+
+// FeatureFlagRepository guarda los feature flags fijados en tiempo de
+// ejecución. Son de la instancia: no dependen del tenant de ctx.
+type FeatureFlagRepository interface {
+	// List devuelve el valor de cada flag fijado.
+	List(ctx context.Context) (map[string]bool, error)
+	Set(ctx context.Context, name string, enabled bool) error
+	// Delete quita el valor fijado de name; devuelve ErrNotFound si no lo
+	// tenía.
+	Delete(ctx context.Context, name string) error
+}
+
+// APIKey es una clave de la API guardada en la base de datos. De la clave
+// solo se guarda su hash (ver HashAPIKey) y su principio.
+type APIKey struct {
+	ID int64 `json:"id"`
+	// Name identifica a quien usa la clave (subject en los logs, cuotas); no
+	// se repite entre las claves no revocadas.
+	Name string `json:"name"`
+	// Role es el rol de quien usa la clave (viewer, analyst o admin).
+	Role string `json:"role"`
+	// Tenant es el tenant al que queda limitada la clave, también si es de
+	// rol admin.
+	Tenant string `json:"tenant"`
+	// Label es una descripción libre: para qué es, quién la custodia...
+	Label string `json:"label"`
+	// Prefix son los primeros caracteres de la clave, para reconocerla.
+	Prefix    string     `json:"prefix"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKeyPatch son los campos de una clave que se pueden cambiar. Los nil no
+// se modifican.
+type APIKeyPatch struct {
+	Label *string `json:"label"`
+	Role  *string `json:"role"`
+}
+
+// APIKeyRepository guarda las claves de la API. Son de la instancia: no
+// dependen del tenant de ctx.
+type APIKeyRepository interface {
+	// FindByHash devuelve la clave no revocada con ese hash, o ErrNotFound.
+	FindByHash(ctx context.Context, hash string) (*APIKey, error)
+	// Create guarda la clave k (Name, Role, Tenant, Label y Prefix) con su
+	// hash.
+	// Devuelve ErrConflict si ya hay una clave no revocada con ese nombre.
+	Create(ctx context.Context, k APIKey, hash string) (*APIKey, error)
+	// List devuelve todas las claves, también las revocadas, por id.
+	List(ctx context.Context) ([]APIKey, error)
+	// Get devuelve la clave id, revocada o no, o ErrNotFound.
+	Get(ctx context.Context, id int64) (*APIKey, error)
+	// Update aplica patch a la clave id y la devuelve. Devuelve ErrNotFound
+	// si no existe o está revocada.
+	Update(ctx context.Context, id int64, patch APIKeyPatch) (*APIKey, error)
+	// Rotate sustituye el hash (y el principio) de la clave id: la clave
+	// anterior deja de valer en el momento. Devuelve ErrNotFound si no existe
+	// o está revocada.
+	Rotate(ctx context.Context, id int64, hash, prefix string) (*APIKey, error)
+	// Revoke revoca la clave id; devuelve ErrNotFound si no existe o ya
+	// estaba revocada.
+	Revoke(ctx context.Context, id int64) error
+}
+
+// User es una cuenta de usuario. Son de la instancia: no dependen del tenant
+// de ctx.
+type User struct {
+	ID int64 `json:"id"`
+	// Email es el nombre con el que se inicia sesión, en minúsculas.
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	// Role es el rol del usuario (viewer, analyst o admin).
+	Role string `json:"role"`
+	// Tenant es el tenant al que queda limitado el usuario, como en
+	// APIKey.Tenant.
+	Tenant      string     `json:"tenant"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	// PasswordHash es el hash bcrypt de la contraseña; no se expone.
+	PasswordHash string `json:"-"`
+}
+
+// UserRepository guarda las cuentas de usuario.
+type UserRepository interface {
+	// Create guarda u (Email, Name, Role, Tenant y PasswordHash) y devuelve
+	// la cuenta creada. Devuelve ErrConflict si ya hay una con ese email.
+	Create(ctx context.Context, u User) (*User, error)
+	// FindByEmail devuelve la cuenta con ese email, o ErrNotFound.
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	// RecordLogin guarda la hora del último inicio de sesión de la cuenta id.
+	RecordLogin(ctx context.Context, id int64) error
+}
+
+// Session es una sesión de usuario. Del token solo se guarda su hash (ver
+// HashAPIKey).
+type Session struct {
+	User      User
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// SessionRepository guarda las sesiones de usuario.
+type SessionRepository interface {
+	// Create guarda una sesión del usuario userID que caduca en expiresAt, y
+	// borra las caducadas de ese usuario.
+	Create(ctx context.Context, hash string, userID int64, expiresAt time.Time) error
+	// Find devuelve la sesión con ese hash, con su usuario, si no está
+	// revocada ni caducada en now; si no, ErrNotFound.
+	Find(ctx context.Context, hash string, now time.Time) (*Session, error)
+	// Revoke revoca la sesión con ese hash; devuelve ErrNotFound si no existe
+	// o ya estaba revocada.
+	Revoke(ctx context.Context, hash string) error
+}
+
+// Ordenes válidos de un filtro guardado: los de la vista de items del
+// frontend.
+var (
+	SortFields = []string{"ticker", "company", "date", "target"}
+	SortOrders = []string{"asc", "desc"}
+)
+
+// SavedFilter es una búsqueda y un orden de la vista de items guardados con
+// un nombre.
+type SavedFilter struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	SortBy    string    `json:"sort_by"`
+	SortOrder string    `json:"sort_order"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate comprueba el nombre, la búsqueda y el orden. El error envuelve
+// ErrValidation.
+func (f SavedFilter) Validate() error {
+	var errs []error
+	if n := utf8.RuneCountInString(f.Name); n == 0 || n > 128 {
+		errs = append(errs, errors.New("name must have between 1 and 128 characters"))
+	}
+	if utf8.RuneCountInString(f.Query) > 255 {
+		errs = append(errs, errors.New("query must have at most 255 characters"))
+	}
+	if !slices.Contains(SortFields, f.SortBy) {
+		errs = append(errs, fmt.Errorf("sort_by must be one of %v", SortFields))
+	}
+	if !slices.Contains(SortOrders, f.SortOrder) {
+		errs = append(errs, fmt.Errorf("sort_order must be one of %v", SortOrders))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrValidation, errors.Join(errs...))
+	}
+	return nil
+}
+
+// SavedFilterRepository guarda los filtros de cada propietario (ver
+// identidad.propietario en el servidor) en el tenant de ctx.
+type SavedFilterRepository interface {
+	// List devuelve los filtros de owner por nombre.
+	List(ctx context.Context, owner string) ([]SavedFilter, error)
+	// Create guarda f (Name, Query, SortBy y SortOrder) y devuelve el filtro
+	// creado. Devuelve ErrConflict si owner ya tiene uno con ese nombre.
+	Create(ctx context.Context, owner string, f SavedFilter) (*SavedFilter, error)
+	// Update sustituye el nombre, la búsqueda y el orden del filtro id de
+	// owner. Devuelve ErrNotFound si no existe o es de otro, y ErrConflict
+	// si el nombre nuevo ya lo tiene otro de sus filtros.
+	Update(ctx context.Context, owner string, id int64, f SavedFilter) (*SavedFilter, error)
+	// Delete borra el filtro id de owner; devuelve ErrNotFound si no existe o
+	// es de otro.
+	Delete(ctx context.Context, owner string, id int64) error
+}
+
+// Acciones del registro de auditoría.
+const (
+	AuditAuthFailure  = "auth.failure"
+	AuditAPIKeyUsed   = "api_key.used"
+	AuditRoleDenied   = "role.denied"
+	AuditIPDenied     = "ip.denied"
+	AuditTenantDenied = "tenant.denied"
+	AuditCSRFDenied   = "csrf.denied"
+	AuditAdminAction  = "admin.action"
+	AuditRoleChanged  = "role.changed"
+	AuditLogin        = "auth.login"
+	AuditUserCreated  = "user.created"
+	AuditAuthLockout  = "auth.lockout"
+)
+
+// AuditEvent es un evento de seguridad del registro de auditoría. Los campos
+// que no aplican quedan vacíos.
+type AuditEvent struct {
+	ID   int64     `json:"id"`
+	Time time.Time `json:"time"`
+	// Tenant es el de la petición que originó el evento.
+	Tenant string `json:"tenant"`
+	Action string `json:"action"`
+	// Actor es quien hizo la petición: nombre de la clave, sub del JWT o
+	// usuario; en los fallos de autenticación, el que se intentó si se sabe.
+	Actor      string `json:"actor,omitempty"`
+	AuthMethod string `json:"auth_method,omitempty"`
+	IP         string `json:"ip,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+	// Target es la ruta afectada, p. ej. "POST /sync".
+	Target string `json:"target,omitempty"`
+	// Status es el código HTTP con el que se respondió; 0 si no aplica.
+	Status int    `json:"status,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// AuditFilter acota la consulta del registro de auditoría. Los campos vacíos
+// no filtran.
+type AuditFilter struct {
+	// Tenant deja solo los eventos de ese tenant; vacío no filtra.
+	Tenant string
+	Action string
+	Actor  string
+	Since  time.Time
+	Until  time.Time
+	// Before pagina hacia atrás: solo los eventos con id menor.
+	Before int64
+	Limit  int
+}
+
+// AuditLogRepository es el registro de auditoría. Solo se añaden eventos: no
+// hay forma de modificarlos ni de borrarlos. Es de la instancia: los eventos
+// llevan su tenant, pero List no filtra por el de ctx sino por f.Tenant.
+type AuditLogRepository interface {
+	Append(ctx context.Context, ev AuditEvent) error
+	// List devuelve los eventos que cumplen f, del más reciente al más
+	// antiguo.
+	List(ctx context.Context, f AuditFilter) ([]AuditEvent, error)
+}
+
+// Store agrupa los repositorios de un backend.
+type Store struct {
+	Items    ItemRepository
+	SyncRuns SyncRunRepository
+	Retries  RetryRepository
+	Daily    DailyStatsRepository
+	Flags    FeatureFlagRepository
+	APIKeys  APIKeyRepository
+	Audit    AuditLogRepository
+	Users    UserRepository
+	Sessions SessionRepository
+	Filters  SavedFilterRepository
+	// Changes es nil si el backend no soporta changefeeds (solo CockroachDB).
+	Changes ItemChangeFeed
+	// TTL es nil si el backend no soporta row-level TTL (solo CockroachDB).
+	TTL ItemTTL
+	// Ping comprueba que la base de datos principal responde.
+	Ping func(ctx context.Context) error
+	// Migrate aplica las migraciones pendientes, si no se aplicaron ya en
+	// este proceso (los repositorios lo hacen también en su primera
+	// operación). Espera a que termine otro proceso que esté migrando la
+	// misma base. Después no consulta la base de datos.
+	Migrate func(ctx context.Context) error
+	// Pools devuelve el estado de los pools de conexiones (principal y, si la
+	// hay, réplica de lectura).
+	Pools func() []PoolStats
+}
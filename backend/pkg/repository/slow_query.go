@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// SlowQuery describe una consulta que superó el umbral de consultas lentas.
+type SlowQuery struct {
+	// SQL es la sentencia normalizada: espacios colapsados y truncada.
+	SQL string
+	// Args resume los parámetros (cuántos y los primeros valores).
+	Args     string
+	Duration time.Duration
+}
+
+// Límites del texto de las consultas lentas, para que un upsert de miles de
+// filas no llene el log.
+const (
+	maxSQLLento   = 500
+	maxArgsLentos = 3
+	maxArgLento   = 40
+)
+
+// normalizarSQL colapsa los espacios de la sentencia y la trunca.
+func normalizarSQL(query string) string {
+	s := strings.Join(strings.Fields(query), " ")
+	if len(s) > maxSQLLento {
+		s = s[:maxSQLLento] + "..."
+	}
+	return s
+}
+
+// resumirArgs describe los parámetros sin volcarlos todos: el número y los
+// primeros valores, truncados.
+func resumirArgs(args []interface{}) string {
+	if len(args) == 0 {
+		return "sin parámetros"
+	}
+	parts := make([]string, 0, maxArgsLentos)
+	for i, a := range args {
+		if i == maxArgsLentos {
+			break
+		}
+		v := fmt.Sprintf("%v", valorArg(a))
+		if len(v) > maxArgLento {
+			v = v[:maxArgLento] + "..."
+		}
+		parts = append(parts, v)
+	}
+	s := fmt.Sprintf("%d parámetros: %s", len(args), strings.Join(parts, ", "))
+	if len(args) > maxArgsLentos {
+		s += ", ..."
+	}
+	return s
+}
+
+// valorArg desreferencia los punteros (los campos opcionales de Item) para
+// que el resumen muestre el valor y no la dirección.
+func valorArg(a interface{}) interface{} {
+	v := reflect.ValueOf(a)
+	if v.Kind() != reflect.Ptr {
+		return a
+	}
+	if v.IsNil() {
+		return "NULL"
+	}
+	return v.Elem().Interface()
+}
+
+// SlowQueryLogger es un pgx.Logger que llama a fn con las consultas que tardan
+// más que umbral. Requiere ConnConfig.LogLevel >= pgx.LogLevelInfo, que es el
+// nivel con el que pgx informa de la duración de cada consulta.
+func SlowQueryLogger(umbral time.Duration, fn func(SlowQuery)) pgx.Logger {
+	return pgx.LoggerFunc(func(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+		d, ok := data["time"].(time.Duration)
+		if !ok || d < umbral {
+			return
+		}
+		query, _ := data["sql"].(string)
+		args, _ := data["args"].([]interface{})
+		fn(SlowQuery{SQL: normalizarSQL(query), Args: resumirArgs(args), Duration: d})
+	})
+}
+
+// abrirSQL abre la base de datos de d. Con opts.SlowQuery las conexiones se
+// envuelven para medir cada consulta.
+func abrirSQL(d *dialecto, dsn string, opts Options) (*sql.DB, error) {
+	if opts.SlowQuery <= 0 || opts.OnSlowQuery == nil {
+		return sql.Open(d.driver, dsn)
+	}
+	// database/sql no expone los drivers registrados más que a través de un
+	// *sql.DB, que no abre conexiones hasta usarse.
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	db.Close()
+
+	var conector driver.Connector = dsnConector{dsn: dsn, drv: drv}
+	if dc, ok := drv.(driver.DriverContext); ok {
+		if conector, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+	return sql.OpenDB(&conectorLento{Connector: conector, umbral: opts.SlowQuery, fn: opts.OnSlowQuery}), nil
+}
+
+// conectorLento envuelve un driver.Connector de database/sql para medir las
+// consultas que pasan por ExecContext y QueryContext. En QueryContext se mide
+// hasta que llegan las primeras filas, no la lectura completa.
+type conectorLento struct {
+	driver.Connector
+	umbral time.Duration
+	fn     func(SlowQuery)
+}
+
+func (c *conectorLento) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &connLenta{Conn: conn, c: c}, nil
+}
+
+// dsnConector es el driver.Connector de los drivers que no implementan
+// driver.DriverContext.
+type dsnConector struct {
+	dsn string
+	drv driver.Driver
+}
+
+func (c dsnConector) Connect(context.Context) (driver.Conn, error) { return c.drv.Open(c.dsn) }
+func (c dsnConector) Driver() driver.Driver                        { return c.drv }
+
+// connLenta reenvía a la conexión del driver las interfaces opcionales que
+// implemente; las que no, responden driver.ErrSkip para que database/sql use
+// su camino genérico.
+type connLenta struct {
+	driver.Conn
+	c *conectorLento
+}
+
+func (l *connLenta) observar(query string, args []driver.NamedValue, start time.Time) {
+	d := time.Since(start)
+	if d < l.c.umbral {
+		return
+	}
+	vals := make([]interface{}, len(args))
+	for i, a := range args {
+		vals[i] = a.Value
+	}
+	l.c.fn(SlowQuery{SQL: normalizarSQL(query), Args: resumirArgs(vals), Duration: d})
+}
+
+func (l *connLenta) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := l.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := e.ExecContext(ctx, query, args)
+	l.observar(query, args, start)
+	return res, err
+}
+
+func (l *connLenta) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := l.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, query, args)
+	l.observar(query, args, start)
+	return rows, err
+}
+
+func (l *connLenta) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := l.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return l.Conn.Prepare(query)
+}
+
+func (l *connLenta) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := l.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return l.Conn.Begin()
+}
+
+func (l *connLenta) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := l.Conn.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (l *connLenta) ResetSession(ctx context.Context) error {
+	if r, ok := l.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (l *connLenta) IsValid() bool {
+	if v, ok := l.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
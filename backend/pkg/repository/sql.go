@@ -0,0 +1,273 @@
+package repository
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dialecto resume las diferencias de SQL entre los backends soportados. Las
+// consultas fijas de los repositorios de database/sql usan "?", que sirve
+// para todos ellos; placeholder se usa en el SQL que se genera.
+type dialecto struct {
+	nombre string
+	// driver es el nombre del driver de database/sql (vacío para pgx).
+	driver string
+
+	migraciones    fs.FS
+	dirMigraciones string
+	ddlMigraciones string
+
+	placeholder func(n int) string
+	// tipado, si no es nil, devuelve el placeholder n con un tipo explícito
+	// (ver parametroTipado).
+	tipado func(n int, tipo string) string
+	// igualNulo compara dos expresiones tratando NULL como un valor más.
+	igualNulo func(a, b string) string
+	// conflicto devuelve la cláusula de upsert que va tras VALUES.
+	conflicto func(spec upsertSpec) string
+	// borrarLote devuelve un DELETE de como mucho n filas de tabla que
+	// cumplen condicion.
+	borrarLote func(tabla, condicion string, n int) string
+	// maxConns limita las conexiones abiertas (0 = sin límite).
+	maxConns int
+	// conTLS devuelve el dsn modificado para conectar con cfg; nil si el
+	// backend no usa TLS.
+	conTLS func(dsn string, cfg *tls.Config) (string, error)
+}
+
+// dialectosSQL son los backends de database/sql disponibles en este binario.
+// Cada uno se registra desde su fichero, que puede depender de una build tag.
+var dialectosSQL = map[string]*dialecto{}
+
+func registrarDialecto(d *dialecto) {
+	dialectosSQL[d.nombre] = d
+}
+
+// Drivers devuelve los backends de database/sql compilados en el binario.
+func Drivers() []string {
+	out := make([]string, 0, len(dialectosSQL))
+	for name := range dialectosSQL {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Options son los ajustes opcionales de Open y NewPostgres.
+type Options struct {
+	// TLS, si no es nil, se usa en todas las conexiones en lugar de lo que
+	// indique el dsn.
+	TLS *tls.Config
+	// SlowQuery es el umbral a partir del cual se llama a OnSlowQuery con la
+	// consulta (0 = desactivado).
+	SlowQuery   time.Duration
+	OnSlowQuery func(SlowQuery)
+
+	// RLS activa el aislamiento de tenants con row-level security (solo
+	// NewPostgres; ver TenantBeforeAcquire).
+	RLS bool
+	// FollowerReads, si no es 0, hace que las lecturas de items y
+	// estadísticas usen AS OF SYSTEM TIME con ese retraso (solo CockroachDB).
+	FollowerReads time.Duration
+}
+
+// Open abre un backend de database/sql por nombre ("mysql", "sqlite"...) y devuelve
+// los repositorios y la función que cierra la conexión. readDSN, si no está
+// vacío, es una réplica a la que se mandan las lecturas de items.
+func Open(driver, dsn, readDSN string, t Tablas, opts Options) (*Store, func(), error) {
+	d, ok := dialectosSQL[driver]
+	if !ok {
+		return nil, nil, fmt.Errorf("database driver %q not available in this build (available: postgres %s)",
+			driver, strings.Join(Drivers(), " "))
+	}
+	if t.Schema != "" {
+		return nil, nil, fmt.Errorf("schema names are not supported by %s; set the database in the dsn", driver)
+	}
+	if opts.RLS || opts.FollowerReads != 0 {
+		return nil, nil, fmt.Errorf("row-level security and follower reads are not supported by %s", driver)
+	}
+	if tlsCfg := opts.TLS; tlsCfg != nil {
+		if d.conTLS == nil {
+			return nil, nil, fmt.Errorf("TLS options are not supported by %s", driver)
+		}
+		var err error
+		if dsn, err = d.conTLS(dsn, tlsCfg); err != nil {
+			return nil, nil, err
+		}
+		if readDSN != "" {
+			if readDSN, err = d.conTLS(readDSN, tlsCfg); err != nil {
+				return nil, nil, fmt.Errorf("read replica: %w", err)
+			}
+		}
+	}
+
+	db, err := abrirSQL(d, dsn, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening %s database: %w", driver, err)
+	}
+	if d.maxConns > 0 {
+		db.SetMaxOpenConns(d.maxConns)
+	}
+	read := db
+	if readDSN != "" {
+		if read, err = abrirSQL(d, readDSN, opts); err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("error opening %s read replica: %w", driver, err)
+		}
+	}
+
+	schema := &esquema{migrar: func(ctx context.Context) error {
+		return aplicarMigraciones(ctx, sqlMigrable{db}, d, t)
+	}}
+	store := &Store{
+		Items:    &sqlItems{db: db, read: read, d: d, schema: schema, tabla: t.Items},
+		SyncRuns: &sqlSyncRuns{db: db, d: d, schema: schema},
+		Retries:  &sqlRetries{db: db, d: d, schema: schema},
+		Daily:    &sqlDailyStats{db: db, read: read, d: d, schema: schema},
+		Flags:    &sqlFeatureFlags{db: db, d: d, schema: schema},
+		APIKeys:  &sqlAPIKeys{db: db, d: d, schema: schema},
+		Audit:    &sqlAuditLog{db: db, d: d, schema: schema},
+		Users:    &sqlUsers{db: db, d: d, schema: schema},
+		Sessions: &sqlSessions{db: db, d: d, schema: schema},
+		Filters:  &sqlSavedFilters{db: db, d: d, schema: schema},
+		Ping:     db.PingContext,
+		Migrate:  schema.asegurar,
+		Pools: func() []PoolStats {
+			out := []PoolStats{sqlPoolStats("primary", db)}
+			if read != db {
+				out = append(out, sqlPoolStats("replica", read))
+			}
+			return out
+		},
+	}
+	cerrar := func() {
+		db.Close()
+		if read != db {
+			read.Close()
+		}
+	}
+	return store, cerrar, nil
+}
+
+type sqlMigrable struct{ db *sql.DB }
+
+func (m sqlMigrable) exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	res, err := m.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (m sqlMigrable) transaccion(ctx context.Context, fn func(exec execFunc) error) error {
+	return enTransaccionSQL(ctx, m.db, func(tx *sql.Tx) error {
+		return fn(sqlExec(tx))
+	})
+}
+
+func (m sqlMigrable) versiones(ctx context.Context) (map[int64]bool, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]bool{}
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+// enTransaccionSQL ejecuta fn dentro de una transacción de database/sql.
+func enTransaccionSQL(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// Formatos en los que los drivers de database/sql devuelven fechas cuando no
+// las convierten ellos mismos (p. ej. el resultado de max() en SQLite).
+var formatosFecha = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	time.RFC3339Nano,
+	time.DateOnly,
+}
+
+// fechaSQL es un destino de Scan para fechas que acepta time.Time, texto o
+// bytes, y NULL.
+type fechaSQL struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (f *fechaSQL) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		f.Valid = false
+		return nil
+	case time.Time:
+		f.Time, f.Valid = v.UTC(), true
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("unsupported time value %T", src)
+	}
+	for _, layout := range formatosFecha {
+		if t, err := time.Parse(layout, s); err == nil {
+			f.Time, f.Valid = t.UTC(), true
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported time format %q", s)
+}
+
+// nullPtr convierte un valor sql.Null* en puntero: nil si era NULL.
+func nullPtr[T any](v T, valid bool) *T {
+	if !valid {
+		return nil
+	}
+	return &v
+}
+
+func (f fechaSQL) ptr() *time.Time {
+	if !f.Valid {
+		return nil
+	}
+	t := f.Time
+	return &t
+}
+
+// ahora es la hora que se guarda en las columnas de fecha. En los backends de
+// database/sql se pasa siempre desde Go, en UTC, para que todas las fechas
+// tengan el mismo formato y se puedan comparar.
+func ahora() time.Time {
+	return time.Now().UTC()
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type sqlAPIKeys struct {
+	db     *sql.DB
+	d      *dialecto
+	schema *esquema
+}
+
+func scanSQLAPIKey(row sqlRow) (*APIKey, error) {
+	var k APIKey
+	var createdAt, rotatedAt, revokedAt fechaSQL
+	if err := row.Scan(&k.ID, &k.Name, &k.Role, &k.Tenant, &k.Label, &k.Prefix, &createdAt, &rotatedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	k.CreatedAt = createdAt.Time
+	k.RotatedAt = rotatedAt.ptr()
+	k.RevokedAt = revokedAt.ptr()
+	return &k, nil
+}
+
+func (r *sqlAPIKeys) FindByHash(ctx context.Context, hash string) (*APIKey, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	k, err := scanSQLAPIKey(r.db.QueryRowContext(ctx, comentar(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL`), hash))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying api key: %w", err)
+	}
+	return k, nil
+}
+
+func (r *sqlAPIKeys) Get(ctx context.Context, id int64) (*APIKey, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+	return r.get(ctx, id)
+}
+
+// get es Get sin asegurar el esquema, tras una escritura.
+func (r *sqlAPIKeys) get(ctx context.Context, id int64) (*APIKey, error) {
+	k, err := scanSQLAPIKey(r.db.QueryRowContext(ctx, comentar(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`), id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying api key %d: %w", id, err)
+	}
+	return k, nil
+}
+
+func (r *sqlAPIKeys) Create(ctx context.Context, k APIKey, hash string) (*APIKey, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	var n int
+	if err := r.db.QueryRowContext(ctx, comentar(ctx, `SELECT COUNT(*) FROM api_keys WHERE name = ? AND revoked_at IS NULL`), k.Name).Scan(&n); err != nil {
+		return nil, fmt.Errorf("error querying api key: %w", err)
+	}
+	if n > 0 {
+		return nil, fmt.Errorf("api key %q already exists: %w", k.Name, ErrConflict)
+	}
+	res, err := r.db.ExecContext(ctx, comentar(ctx, `INSERT INTO api_keys (name, role, tenant_id, label, prefix, key_hash, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		k.Name, k.Role, k.Tenant, k.Label, k.Prefix, hash, ahora())
+	if err != nil {
+		return nil, fmt.Errorf("error inserting api key: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error reading api key id: %w", err)
+	}
+	return r.get(ctx, id)
+}
+
+func (r *sqlAPIKeys) List(ctx context.Context) ([]APIKey, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, comentar(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id`))
+	if err != nil {
+		return nil, fmt.Errorf("error querying api keys: %w", err)
+	}
+	defer rows.Close()
+
+	out := []APIKey{}
+	for rows.Next() {
+		k, err := scanSQLAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning api key: %w", err)
+		}
+		out = append(out, *k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading api keys: %w", err)
+	}
+	return out, nil
+}
+
+// actualizar ejecuta un UPDATE de la clave no revocada id (el último
+// argumento) y devuelve la clave tras el cambio.
+func (r *sqlAPIKeys) actualizar(ctx context.Context, id int64, set string, args ...interface{}) (*APIKey, error) {
+	res, err := r.db.ExecContext(ctx, comentar(ctx, `UPDATE api_keys SET `+set+` WHERE id = ? AND revoked_at IS NULL`), append(args, id)...)
+	if err != nil {
+		return nil, fmt.Errorf("error updating api key %d: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("error updating api key %d: %w", id, err)
+	} else if n == 0 {
+		return nil, ErrNotFound
+	}
+	return r.get(ctx, id)
+}
+
+func (r *sqlAPIKeys) Update(ctx context.Context, id int64, patch APIKeyPatch) (*APIKey, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+	return r.actualizar(ctx, id, `label = COALESCE(?, label), role = COALESCE(?, role)`, patch.Label, patch.Role)
+}
+
+func (r *sqlAPIKeys) Rotate(ctx context.Context, id int64, hash, prefix string) (*APIKey, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+	return r.actualizar(ctx, id, `key_hash = ?, prefix = ?, rotated_at = ?`, hash, prefix, ahora())
+}
+
+func (r *sqlAPIKeys) Revoke(ctx context.Context, id int64) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+	_, err := r.actualizar(ctx, id, `revoked_at = ?`, ahora())
+	return err
+}
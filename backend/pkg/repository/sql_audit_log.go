@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type sqlAuditLog struct {
+	db     *sql.DB
+	d      *dialecto
+	schema *esquema
+}
+
+func (r *sqlAuditLog) Append(ctx context.Context, ev AuditEvent) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	if _, err := r.db.ExecContext(ctx, comentar(ctx, auditInsert(r.d)), auditArgs(ev)...); err != nil {
+		return fmt.Errorf("error inserting audit event: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlAuditLog) List(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	query, args := auditSelect(r.d, f)
+	rows, err := r.db.QueryContext(ctx, comentar(ctx, query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit log: %w", err)
+	}
+	defer rows.Close()
+
+	out := []AuditEvent{}
+	for rows.Next() {
+		var ev AuditEvent
+		var createdAt fechaSQL
+		if err := rows.Scan(&ev.ID, &createdAt, &ev.Tenant, &ev.Action, &ev.Actor, &ev.AuthMethod, &ev.IP, &ev.RequestID, &ev.Target, &ev.Status, &ev.Detail); err != nil {
+			return nil, fmt.Errorf("error scanning audit event: %w", err)
+		}
+		ev.Time = createdAt.Time
+		out = append(out, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audit log: %w", err)
+	}
+	return out, nil
+}
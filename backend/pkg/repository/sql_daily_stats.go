@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type sqlDailyStats struct {
+	db     *sql.DB
+	read   *sql.DB
+	d      *dialecto
+	schema *esquema
+}
+
+func (r *sqlDailyStats) Save(ctx context.Context, stats []DailyStat) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	tenant := TenantFrom(ctx)
+	return enTransaccionSQL(ctx, r.db, func(tx *sql.Tx) error {
+		if _, err := upsertLote(ctx, sqlExec(tx), r.d, dailyStatsUpsert, stats, dailyStatValues(tenant)); err != nil {
+			return err
+		}
+
+		query := `DELETE FROM daily_stats WHERE tenant_id = ?`
+		args := []interface{}{tenant}
+		if len(stats) > 0 {
+			marks := make([]string, len(stats))
+			for i, s := range stats {
+				marks[i] = "?"
+				args = append(args, s.Day.UTC())
+			}
+			query += ` AND day NOT IN (` + strings.Join(marks, ", ") + `)`
+		}
+		if _, err := tx.ExecContext(ctx, comentar(ctx, query), args...); err != nil {
+			return fmt.Errorf("error pruning daily stats: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *sqlDailyStats) List(ctx context.Context, since time.Time) ([]DailyStat, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.read.QueryContext(ctx, comentar(ctx, `SELECT `+dailyStatsColumns+` FROM daily_stats WHERE tenant_id = ? AND day >= ? ORDER BY day`), TenantFrom(ctx), since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error querying daily stats: %w", err)
+	}
+	defer rows.Close()
+
+	out := []DailyStat{}
+	for rows.Next() {
+		var s DailyStat
+		var day fechaSQL
+		var avg sql.NullFloat64
+		if err := rows.Scan(&day, &s.Total, &s.Upgrades, &s.Downgrades, &s.TargetsRaised, &s.TargetsLowered, &avg); err != nil {
+			return nil, fmt.Errorf("error scanning daily stats: %w", err)
+		}
+		s.Day = day.Time
+		if avg.Valid {
+			s.AvgTargetChange = &avg.Float64
+		}
+		out = append(out, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading daily stats: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type sqlFeatureFlags struct {
+	db     *sql.DB
+	d      *dialecto
+	schema *esquema
+}
+
+func (r *sqlFeatureFlags) List(ctx context.Context) (map[string]bool, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, comentar(ctx, `SELECT name, enabled FROM feature_flags`))
+	if err != nil {
+		return nil, fmt.Errorf("error querying feature flags: %w", err)
+	}
+	defer rows.Close()
+
+	out := map[string]bool{}
+	for rows.Next() {
+		var name string
+		var enabled bool
+		if err := rows.Scan(&name, &enabled); err != nil {
+			return nil, fmt.Errorf("error scanning feature flag: %w", err)
+		}
+		out[name] = enabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading feature flags: %w", err)
+	}
+	return out, nil
+}
+
+func (r *sqlFeatureFlags) Set(ctx context.Context, name string, enabled bool) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	query, args := upsertSQL(r.d, featureFlagsUpsert, [][]interface{}{{name, enabled, ahora()}})
+	if _, err := r.db.ExecContext(ctx, comentar(ctx, query), args...); err != nil {
+		return fmt.Errorf("error setting feature flag %s: %w", name, err)
+	}
+	return nil
+}
+
+func (r *sqlFeatureFlags) Delete(ctx context.Context, name string) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	res, err := r.db.ExecContext(ctx, comentar(ctx, `DELETE FROM feature_flags WHERE name = ?`), name)
+	if err != nil {
+		return fmt.Errorf("error deleting feature flag %s: %w", name, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error deleting feature flag %s: %w", name, err)
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
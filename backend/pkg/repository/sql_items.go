@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type sqlItems struct {
+	db *sql.DB
+	// read es la réplica de lectura si la hay, si no el mismo db.
+	read   *sql.DB
+	d      *dialecto
+	schema *esquema
+	// tabla es el nombre configurado de la tabla de items.
+	tabla string
+}
+
+func (r *sqlItems) List(ctx context.Context) ([]Item, error) {
+	return r.listar(ctx, `SELECT `+itemColumns+` FROM `+r.tabla+` WHERE tenant_id = ?`, TenantFrom(ctx))
+}
+
+func (r *sqlItems) Latest(ctx context.Context) ([]Item, error) {
+	return r.listar(ctx, `SELECT `+itemColumns+` FROM `+tablaLatest(r.tabla)+` WHERE tenant_id = ? ORDER BY ticker`, TenantFrom(ctx))
+}
+
+func (r *sqlItems) RefreshLatest(ctx context.Context) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+	tenant := TenantFrom(ctx)
+	return enTransaccionSQL(ctx, r.db, func(tx *sql.Tx) error {
+		for _, stmt := range refrescoLatest(r.tabla, r.d) {
+			if _, err := tx.ExecContext(ctx, comentar(ctx, stmt), tenant); err != nil {
+				return fmt.Errorf("error refreshing latest ratings: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *sqlItems) RecordGeneration(ctx context.Context, generation int64) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+	return enTransaccionSQL(ctx, r.db, func(tx *sql.Tx) error {
+		for _, s := range registroGeneracion(r.tabla, r.d, TenantFrom(ctx), generation, ahora()) {
+			if _, err := tx.ExecContext(ctx, comentar(ctx, s.query), s.args...); err != nil {
+				return fmt.Errorf("error recording items history: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *sqlItems) Purge(ctx context.Context, before time.Time, batch int) (int64, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return 0, err
+	}
+	return purgarItems(ctx, sqlExec(r.db), r.tabla, r.d, TenantFrom(ctx), before, batch)
+}
+
+func (r *sqlItems) ListAsOf(ctx context.Context, asOf AsOf) ([]Item, error) {
+	s := consultaAsOf(r.tabla, r.d, TenantFrom(ctx), asOf, "")
+	return r.listar(ctx, s.query, s.args...)
+}
+
+// listar ejecuta una consulta de solo lectura que devuelve itemColumns.
+func (r *sqlItems) listar(ctx context.Context, query string, args ...interface{}) ([]Item, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.read.QueryContext(ctx, comentar(ctx, query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []Item
+	for rows.Next() {
+		it, err := scanSQLItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning item: %w", err)
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading items: %w", err)
+	}
+	return items, nil
+}
+
+func scanSQLItem(row sqlRow) (Item, error) {
+	var it Item
+	var targetFrom, targetTo decimalNulo
+	var ratingFrom, ratingTo sql.NullString
+	var t fechaSQL
+	if err := row.Scan(
+		&it.Ticker,
+		&targetFrom,
+		&targetTo,
+		&it.Company,
+		&it.Action,
+		&it.Brokerage,
+		&ratingFrom,
+		&ratingTo,
+		&t,
+		&it.Version,
+	); err != nil {
+		return it, err
+	}
+	it.TargetFrom = targetFrom.ptr()
+	it.TargetTo = targetTo.ptr()
+	it.RatingFrom = nullPtr(ratingFrom.String, ratingFrom.Valid)
+	it.RatingTo = nullPtr(ratingTo.String, ratingTo.Valid)
+	it.Time = t.Time
+	return it, nil
+}
+
+func (r *sqlItems) Update(ctx context.Context, key ItemKey, version int64, patch ItemPatch) (*Item, error) {
+	if err := patch.Validate(); err != nil {
+		return nil, err
+	}
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	tenant := TenantFrom(ctx)
+	var it Item
+	err := enTransaccionSQL(ctx, r.db, func(tx *sql.Tx) error {
+		if query, args, ok := actualizacionItem(r.tabla, r.d, tenant, key, version, patch); ok {
+			res, err := tx.ExecContext(ctx, comentar(ctx, query), args...)
+			if err != nil {
+				return fmt.Errorf("error updating item: %w", err)
+			}
+			if n, _ := res.RowsAffected(); n == 1 {
+				version++
+			}
+		}
+
+		var err error
+		it, err = scanSQLItem(tx.QueryRowContext(ctx, comentar(ctx, `
+			SELECT `+itemColumns+` FROM `+r.tabla+`
+			WHERE tenant_id = ? AND ticker = ? AND brokerage = ? AND time = ?
+		`), tenant, key.Ticker, key.Brokerage, key.Time.UTC()))
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error querying item: %w", err)
+		}
+		if it.Version != version {
+			return ErrVersionConflict
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+func (r *sqlItems) Upsert(ctx context.Context, items []Item) (int64, error) {
+	if len(items) == 0 {
+		return 0, nil
+	}
+	if err := r.schema.asegurar(ctx); err != nil {
+		return 0, err
+	}
+
+	tenant := TenantFrom(ctx)
+	var n int64
+	err := enTransaccionSQL(ctx, r.db, func(tx *sql.Tx) error {
+		version, err := r.siguienteVersion(ctx, tx, tenant)
+		if err != nil {
+			return err
+		}
+		n, err = upsertLote(ctx, sqlExec(tx), r.d, itemsUpsert(r.tabla), items, itemValues(tenant, version))
+		return err
+	})
+	return n, err
+}
+
+func (r *sqlItems) Replace(ctx context.Context, items []Item) (int64, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return 0, err
+	}
+
+	tenant := TenantFrom(ctx)
+	var n int64
+	err := enTransaccionSQL(ctx, r.db, func(tx *sql.Tx) error {
+		version, err := r.siguienteVersion(ctx, tx, tenant)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, comentar(ctx, `DELETE FROM `+r.tabla+` WHERE tenant_id = ?`), tenant); err != nil {
+			return fmt.Errorf("error deleting items: %w", err)
+		}
+		n, err = upsertLote(ctx, sqlExec(tx), r.d, itemsUpsert(r.tabla), items, itemValues(tenant, version))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// siguienteVersion es la versión de las filas que escribe una sincronización
+// del tenant dentro de tx (ver pgItems.siguienteVersion).
+func (r *sqlItems) siguienteVersion(ctx context.Context, tx *sql.Tx, tenant string) (int64, error) {
+	var actual int64
+	if err := tx.QueryRowContext(ctx, comentar(ctx, versionMaxima(r.tabla, r.d)), tenant).Scan(&actual); err != nil {
+		return 0, fmt.Errorf("error querying items version: %w", err)
+	}
+	return siguienteVersion(actual, time.Now()), nil
+}
+
+func (r *sqlItems) Stats(ctx context.Context) (ItemStats, error) {
+	var st ItemStats
+	if err := r.schema.asegurar(ctx); err != nil {
+		return st, err
+	}
+
+	var latest fechaSQL
+	err := r.read.QueryRowContext(ctx, comentar(ctx, `
+		SELECT count(*), count(DISTINCT ticker), count(DISTINCT brokerage), max(time)
+		FROM `+r.tabla+` WHERE tenant_id = ?`), TenantFrom(ctx)).Scan(&st.Total, &st.Tickers, &st.Brokerages, &latest)
+	if err != nil {
+		return st, fmt.Errorf("error querying item stats: %w", err)
+	}
+	st.LatestTime = latest.ptr()
+	return st, nil
+}
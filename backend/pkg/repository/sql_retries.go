@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type sqlRetries struct {
+	db     *sql.DB
+	d      *dialecto
+	schema *esquema
+}
+
+func (r *sqlRetries) Enqueue(ctx context.Context, maxAttempts int, nextAttempt time.Time, lastErr string, staleBefore time.Time) (bool, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return false, err
+	}
+
+	now := ahora()
+	tenant := TenantFrom(ctx)
+	res, err := r.db.ExecContext(ctx, comentar(ctx, `
+		INSERT INTO sync_retries (tenant_id, status, max_attempts, next_attempt_at, last_error, created_at, updated_at)
+		SELECT ?, ?, ?, ?, ?, ?, ? FROM (SELECT 1) AS uno
+		WHERE NOT EXISTS (
+			SELECT 1 FROM sync_retries
+			WHERE tenant_id = ? AND (status = ? OR (status = ? AND updated_at > ?))
+		)
+	`), tenant, RetryPending, maxAttempts, nextAttempt.UTC(), lastErr, now, now, tenant, RetryPending, RetryRunning, staleBefore.UTC())
+	if err != nil {
+		return false, fmt.Errorf("error enqueuing sync retry: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error enqueuing sync retry: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *sqlRetries) Claim(ctx context.Context, staleBefore time.Time) (*SyncRetry, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	// Sin UPDATE ... RETURNING común a todos los dialectos: se elige el
+	// candidato y se reclama con un UPDATE que repite la condición, de modo que
+	// si otro proceso se adelanta no se actualiza ninguna fila.
+	now := ahora()
+	stale := staleBefore.UTC()
+	var rt SyncRetry
+	err := enTransaccionSQL(ctx, r.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, comentar(ctx, `
+			SELECT id FROM sync_retries
+			WHERE (status = ? AND next_attempt_at <= ?) OR (status = ? AND updated_at <= ?)
+			ORDER BY next_attempt_at
+			LIMIT 1
+		`), RetryPending, now, RetryRunning, stale).Scan(&rt.ID)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, comentar(ctx, `
+			UPDATE sync_retries
+			SET status = ?, attempt = attempt + 1, updated_at = ?
+			WHERE id = ? AND ((status = ? AND next_attempt_at <= ?) OR (status = ? AND updated_at <= ?))
+		`), RetryRunning, now, rt.ID, RetryPending, now, RetryRunning, stale)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+
+		return tx.QueryRowContext(ctx, comentar(ctx, `SELECT attempt, max_attempts, tenant_id FROM sync_retries WHERE id = ?`), rt.ID).
+			Scan(&rt.Attempt, &rt.MaxAttempts, &rt.Tenant)
+	})
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error claiming sync retry: %w", err)
+	}
+	return &rt, nil
+}
+
+func (r *sqlRetries) Complete(ctx context.Context, id int64) error {
+	return r.update(ctx, id, `
+		UPDATE sync_retries SET status = ?, last_error = NULL, updated_at = ? WHERE id = ?
+	`, RetryDone, ahora(), id)
+}
+
+func (r *sqlRetries) Fail(ctx context.Context, id int64, lastErr string) error {
+	return r.update(ctx, id, `
+		UPDATE sync_retries SET status = ?, last_error = ?, updated_at = ? WHERE id = ?
+	`, RetryFailed, lastErr, ahora(), id)
+}
+
+func (r *sqlRetries) Reschedule(ctx context.Context, id int64, lastErr string, next time.Time) error {
+	return r.update(ctx, id, `
+		UPDATE sync_retries
+		SET status = ?, last_error = ?, next_attempt_at = ?, updated_at = ?
+		WHERE id = ?
+	`, RetryPending, lastErr, next.UTC(), ahora(), id)
+}
+
+func (r *sqlRetries) Release(ctx context.Context, id int64) error {
+	return r.update(ctx, id, `
+		UPDATE sync_retries SET status = ?, attempt = attempt - 1, updated_at = ? WHERE id = ?
+	`, RetryPending, ahora(), id)
+}
+
+func (r *sqlRetries) update(ctx context.Context, id int64, query string, args ...interface{}) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, comentar(ctx, query), args...); err != nil {
+		return fmt.Errorf("error updating sync retry %d: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type sqlSavedFilters struct {
+	db     *sql.DB
+	d      *dialecto
+	schema *esquema
+}
+
+func scanSQLSavedFilter(row sqlRow) (*SavedFilter, error) {
+	var f SavedFilter
+	var createdAt, updatedAt fechaSQL
+	if err := row.Scan(&f.ID, &f.Name, &f.Query, &f.SortBy, &f.SortOrder, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	f.CreatedAt = createdAt.Time
+	f.UpdatedAt = updatedAt.Time
+	return &f, nil
+}
+
+func (r *sqlSavedFilters) List(ctx context.Context, owner string) ([]SavedFilter, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, comentar(ctx, `SELECT `+savedFilterColumns+` FROM saved_filters WHERE tenant_id = ? AND owner = ? ORDER BY name`), TenantFrom(ctx), owner)
+	if err != nil {
+		return nil, fmt.Errorf("error querying saved filters: %w", err)
+	}
+	defer rows.Close()
+
+	out := []SavedFilter{}
+	for rows.Next() {
+		f, err := scanSQLSavedFilter(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning saved filter: %w", err)
+		}
+		out = append(out, *f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating saved filters: %w", err)
+	}
+	return out, nil
+}
+
+// nombreUsado dice si owner tiene otro filtro (distinto de id) llamado name.
+func (r *sqlSavedFilters) nombreUsado(ctx context.Context, owner, name string, id int64) (bool, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, comentar(ctx, `SELECT COUNT(*) FROM saved_filters WHERE tenant_id = ? AND owner = ? AND name = ? AND id <> ?`),
+		TenantFrom(ctx), owner, name, id).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("error querying saved filters: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *sqlSavedFilters) get(ctx context.Context, owner string, id int64) (*SavedFilter, error) {
+	f, err := scanSQLSavedFilter(r.db.QueryRowContext(ctx, comentar(ctx, `SELECT `+savedFilterColumns+` FROM saved_filters WHERE id = ? AND tenant_id = ? AND owner = ?`), id, TenantFrom(ctx), owner))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying saved filter %d: %w", id, err)
+	}
+	return f, nil
+}
+
+func (r *sqlSavedFilters) Create(ctx context.Context, owner string, f SavedFilter) (*SavedFilter, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	if usado, err := r.nombreUsado(ctx, owner, f.Name, 0); err != nil {
+		return nil, err
+	} else if usado {
+		return nil, fmt.Errorf("saved filter %q already exists: %w", f.Name, ErrConflict)
+	}
+	now := ahora()
+	res, err := r.db.ExecContext(ctx, comentar(ctx, `INSERT INTO saved_filters (tenant_id, owner, name, query, sort_by, sort_order, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		TenantFrom(ctx), owner, f.Name, f.Query, f.SortBy, f.SortOrder, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting saved filter: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error reading saved filter id: %w", err)
+	}
+	return r.get(ctx, owner, id)
+}
+
+func (r *sqlSavedFilters) Update(ctx context.Context, owner string, id int64, f SavedFilter) (*SavedFilter, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.get(ctx, owner, id); err != nil {
+		return nil, err
+	}
+	if usado, err := r.nombreUsado(ctx, owner, f.Name, id); err != nil {
+		return nil, err
+	} else if usado {
+		return nil, fmt.Errorf("saved filter %q already exists: %w", f.Name, ErrConflict)
+	}
+	if _, err := r.db.ExecContext(ctx, comentar(ctx, `UPDATE saved_filters SET name = ?, query = ?, sort_by = ?, sort_order = ?, updated_at = ? WHERE id = ? AND tenant_id = ? AND owner = ?`),
+		f.Name, f.Query, f.SortBy, f.SortOrder, ahora(), id, TenantFrom(ctx), owner); err != nil {
+		return nil, fmt.Errorf("error updating saved filter %d: %w", id, err)
+	}
+	return r.get(ctx, owner, id)
+}
+
+func (r *sqlSavedFilters) Delete(ctx context.Context, owner string, id int64) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	res, err := r.db.ExecContext(ctx, comentar(ctx, `DELETE FROM saved_filters WHERE id = ? AND tenant_id = ? AND owner = ?`), id, TenantFrom(ctx), owner)
+	if err != nil {
+		return fmt.Errorf("error deleting saved filter %d: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error deleting saved filter %d: %w", id, err)
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// sqlSyncRunColumns es syncRunColumns con trigger entre comillas invertidas:
+// es palabra reservada en MySQL (SQLite también acepta esa sintaxis).
+const sqlSyncRunColumns = "id, `trigger`, status, params, retry_of, items_fetched, items_inserted, error, checkpoint, stages, started_at, finished_at"
+
+type sqlSyncRuns struct {
+	db     *sql.DB
+	d      *dialecto
+	schema *esquema
+}
+
+func (r *sqlSyncRuns) Start(ctx context.Context, trigger string, params SyncParams, retryOf *int64) (int64, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return 0, err
+	}
+
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding sync params: %w", err)
+	}
+	res, err := r.db.ExecContext(ctx,
+		comentar(ctx, "INSERT INTO sync_runs (tenant_id, `trigger`, status, params, retry_of, started_at) VALUES (?, ?, ?, ?, ?, ?)"),
+		TenantFrom(ctx), trigger, RunRunning, string(rawParams), retryOf, ahora())
+	if err != nil {
+		return 0, fmt.Errorf("error inserting sync run: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error reading sync run id: %w", err)
+	}
+	return id, nil
+}
+
+func (r *sqlSyncRuns) Finish(ctx context.Context, id int64, res SyncRunResult) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	var checkpoint *string
+	if res.Checkpoint != nil {
+		raw, err := json.Marshal(res.Checkpoint)
+		if err != nil {
+			return fmt.Errorf("error encoding sync checkpoint: %w", err)
+		}
+		s := string(raw)
+		checkpoint = &s
+	}
+	_, err := r.db.ExecContext(ctx, comentar(ctx, `
+		UPDATE sync_runs
+		SET status = ?, items_fetched = ?, items_inserted = ?, error = ?, checkpoint = ?, stages = ?, finished_at = ?
+		WHERE id = ?
+	`), res.Status, res.ItemsFetched, res.ItemsInserted, res.Error, checkpoint, etapasJSON(res.Stages), ahora(), id)
+	if err != nil {
+		return fmt.Errorf("error updating sync run: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlSyncRuns) Get(ctx context.Context, id int64) (*SyncRun, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	run, err := scanSQLSyncRun(r.db.QueryRowContext(ctx, comentar(ctx, `SELECT `+sqlSyncRunColumns+` FROM sync_runs WHERE id = ? AND tenant_id = ?`), id, TenantFrom(ctx)))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying sync run: %w", err)
+	}
+	return run, nil
+}
+
+func (r *sqlSyncRuns) List(ctx context.Context, limit int) ([]SyncRun, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, comentar(ctx, `SELECT `+sqlSyncRunColumns+` FROM sync_runs WHERE tenant_id = ? ORDER BY id DESC LIMIT ?`), TenantFrom(ctx), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying sync runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []SyncRun{}
+	for rows.Next() {
+		run, err := scanSQLSyncRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning sync run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading sync runs: %w", err)
+	}
+	return runs, nil
+}
+
+func (r *sqlSyncRuns) Last(ctx context.Context, f SyncRunFilter) (*SyncRun, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	q := `SELECT ` + sqlSyncRunColumns + ` FROM sync_runs WHERE tenant_id = ?`
+	args := []interface{}{TenantFrom(ctx)}
+	if f.Trigger != "" {
+		q += " AND `trigger` = ?"
+		args = append(args, f.Trigger)
+	}
+	if f.Status != "" {
+		q += ` AND status = ?`
+		args = append(args, f.Status)
+	}
+	run, err := scanSQLSyncRun(r.db.QueryRowContext(ctx, comentar(ctx, q+` ORDER BY id DESC LIMIT 1`), args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying sync run: %w", err)
+	}
+	return run, nil
+}
+
+// sqlRow es lo común a *sql.Row y *sql.Rows.
+type sqlRow interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSQLSyncRun(row sqlRow) (*SyncRun, error) {
+	var run SyncRun
+	var params []byte
+	var checkpoint, stages []byte
+	var startedAt, finishedAt fechaSQL
+	err := row.Scan(
+		&run.ID, &run.Trigger, &run.Status, &params, &run.RetryOf,
+		&run.ItemsFetched, &run.ItemsInserted, &run.Error, &checkpoint, &stages, &startedAt, &finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(params, &run.Params); err != nil {
+		return nil, fmt.Errorf("error decoding sync params: %w", err)
+	}
+	if checkpoint != nil {
+		run.Checkpoint = &SyncCheckpoint{}
+		if err := json.Unmarshal(checkpoint, run.Checkpoint); err != nil {
+			return nil, fmt.Errorf("error decoding sync checkpoint: %w", err)
+		}
+	}
+	if stages != nil {
+		if err := json.Unmarshal(stages, &run.Stages); err != nil {
+			return nil, fmt.Errorf("error decoding sync stages: %w", err)
+		}
+	}
+	run.StartedAt = startedAt.Time
+	run.FinishedAt = finishedAt.ptr()
+	return &run, nil
+}
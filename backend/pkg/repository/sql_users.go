@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type sqlUsers struct {
+	db     *sql.DB
+	d      *dialecto
+	schema *esquema
+}
+
+func scanSQLUser(row sqlRow) (*User, error) {
+	var u User
+	var createdAt, lastLogin fechaSQL
+	if err := row.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.Tenant, &createdAt, &lastLogin, &u.PasswordHash); err != nil {
+		return nil, err
+	}
+	u.CreatedAt = createdAt.Time
+	u.LastLoginAt = lastLogin.ptr()
+	return &u, nil
+}
+
+func (r *sqlUsers) Create(ctx context.Context, u User) (*User, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.FindByEmail(ctx, u.Email); err == nil {
+		return nil, fmt.Errorf("user %q already exists: %w", u.Email, ErrConflict)
+	} else if err != ErrNotFound {
+		return nil, err
+	}
+	res, err := r.db.ExecContext(ctx, comentar(ctx, `INSERT INTO users (email, name, role, tenant_id, password_hash, created_at) VALUES (?, ?, ?, ?, ?, ?)`),
+		u.Email, u.Name, u.Role, u.Tenant, u.PasswordHash, ahora())
+	if err != nil {
+		return nil, fmt.Errorf("error inserting user: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error reading user id: %w", err)
+	}
+	out, err := scanSQLUser(r.db.QueryRowContext(ctx, comentar(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`), id))
+	if err != nil {
+		return nil, fmt.Errorf("error querying user: %w", err)
+	}
+	return out, nil
+}
+
+func (r *sqlUsers) FindByEmail(ctx context.Context, email string) (*User, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	u, err := scanSQLUser(r.db.QueryRowContext(ctx, comentar(ctx, `SELECT `+userColumns+` FROM users WHERE email = ?`), email))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying user: %w", err)
+	}
+	return u, nil
+}
+
+func (r *sqlUsers) RecordLogin(ctx context.Context, id int64) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	if _, err := r.db.ExecContext(ctx, comentar(ctx, `UPDATE users SET last_login_at = ? WHERE id = ?`), ahora(), id); err != nil {
+		return fmt.Errorf("error updating user %d: %w", id, err)
+	}
+	return nil
+}
+
+type sqlSessions struct {
+	db     *sql.DB
+	d      *dialecto
+	schema *esquema
+}
+
+func (r *sqlSessions) Create(ctx context.Context, hash string, userID int64, expiresAt time.Time) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	now := ahora()
+	if _, err := r.db.ExecContext(ctx, comentar(ctx, `INSERT INTO sessions (token_hash, user_id, created_at, expires_at) VALUES (?, ?, ?, ?)`), hash, userID, now, expiresAt.UTC()); err != nil {
+		return fmt.Errorf("error inserting session: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx, comentar(ctx, `DELETE FROM sessions WHERE user_id = ? AND expires_at < ?`), userID, now); err != nil {
+		return fmt.Errorf("error deleting expired sessions: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlSessions) Find(ctx context.Context, hash string, now time.Time) (*Session, error) {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return nil, err
+	}
+
+	var s Session
+	u := &s.User
+	var userCreated, lastLogin, createdAt, expiresAt fechaSQL
+	err := r.db.QueryRowContext(ctx, comentar(ctx, `
+		SELECT u.id, u.email, u.name, u.role, u.tenant_id, u.created_at, u.last_login_at, u.password_hash, s.created_at, s.expires_at
+		FROM sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = ? AND s.revoked_at IS NULL AND s.expires_at > ?
+	`), hash, now.UTC()).Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.Tenant, &userCreated, &lastLogin, &u.PasswordHash, &createdAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying session: %w", err)
+	}
+	u.CreatedAt = userCreated.Time
+	u.LastLoginAt = lastLogin.ptr()
+	s.CreatedAt = createdAt.Time
+	s.ExpiresAt = expiresAt.Time
+	return &s, nil
+}
+
+func (r *sqlSessions) Revoke(ctx context.Context, hash string) error {
+	if err := r.schema.asegurar(ctx); err != nil {
+		return err
+	}
+
+	res, err := r.db.ExecContext(ctx, comentar(ctx, `UPDATE sessions SET revoked_at = ? WHERE token_hash = ? AND revoked_at IS NULL`), ahora(), hash)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+//go:build sqlite
+
+package repository
+
+import (
+	"embed"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Backend SQLite para desarrollo local y CI, sin necesidad de un cluster de
+// CockroachDB. Se incluye compilando con -tags sqlite (requiere cgo) y se
+// selecciona con db_driver=sqlite y, por ejemplo, dsn=file:prueba.db.
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+func init() {
+	registrarDialecto(&dialecto{
+		nombre:         "sqlite",
+		driver:         "sqlite3",
+		migraciones:    sqliteMigrations,
+		dirMigraciones: "migrations/sqlite",
+		ddlMigraciones: `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version INTEGER PRIMARY KEY,
+				name TEXT NOT NULL,
+				applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)
+		`,
+		placeholder: func(int) string { return "?" },
+		igualNulo:   func(a, b string) string { return a + " IS " + b },
+		conflicto:   onConflictDoUpdate,
+		// DELETE ... LIMIT solo existe si SQLite se compila con
+		// SQLITE_ENABLE_UPDATE_DELETE_LIMIT; se limita por rowid.
+		borrarLote: func(tabla, condicion string, n int) string {
+			return fmt.Sprintf("DELETE FROM %[1]s WHERE rowid IN (SELECT rowid FROM %[1]s WHERE %[2]s LIMIT %[3]d)", tabla, condicion, n)
+		},
+		// SQLite admite un solo escritor; con una conexión se evitan los
+		// errores "database is locked".
+		maxConns: 1,
+	})
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"prueba/internal/tracing"
+	"sync"
+	"time"
+)
+
+// SyncStage es el tiempo que pasó una sincronización en una etapa. Las que se
+// repiten (cada página, cada lote del upsert) se acumulan: Count es cuántas
+// veces se ejecutó, Seconds el total y MaxSeconds la más lenta. Las etapas
+// que van dentro de otra llevan delante su nombre (fetch.validate).
+type SyncStage struct {
+	Name       string  `json:"name"`
+	Count      int     `json:"count"`
+	Seconds    float64 `json:"seconds"`
+	MaxSeconds float64 `json:"max_seconds"`
+}
+
+// SyncStages acumula las etapas de una sincronización, en el orden en que
+// empiezan por primera vez. Se comparte por el contexto (WithSyncStages).
+type SyncStages struct {
+	mu     sync.Mutex
+	etapas []SyncStage
+}
+
+type claveEtapas struct{}
+
+type claveEtapa struct{}
+
+// WithSyncStages devuelve ctx con las etapas en las que StartStage acumula
+// los tiempos.
+func WithSyncStages(ctx context.Context, s *SyncStages) context.Context {
+	return context.WithValue(ctx, claveEtapas{}, s)
+}
+
+// List devuelve una copia de las etapas acumuladas.
+func (s *SyncStages) List() []SyncStage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SyncStage(nil), s.etapas...)
+}
+
+// etapa devuelve la etapa nombre, que se crea si no existe: como se busca al
+// empezar cada una, el orden es el de inicio. Hay que llamarla con mu.
+func (s *SyncStages) etapa(nombre string) *SyncStage {
+	for i := range s.etapas {
+		if s.etapas[i].Name == nombre {
+			return &s.etapas[i]
+		}
+	}
+	s.etapas = append(s.etapas, SyncStage{Name: nombre})
+	return &s.etapas[len(s.etapas)-1]
+}
+
+func (s *SyncStages) empezar(nombre string) {
+	s.mu.Lock()
+	s.etapa(nombre)
+	s.mu.Unlock()
+}
+
+func (s *SyncStages) sumar(nombre string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.etapa(nombre)
+	e.Count++
+	e.Seconds += d.Seconds()
+	e.MaxSeconds = max(e.MaxSeconds, d.Seconds())
+}
+
+// Stage es una etapa en curso (ver StartStage). Un *Stage nil no hace nada.
+type Stage struct {
+	nombre string
+	inicio time.Time
+	span   *tracing.Span
+	etapas *SyncStages
+}
+
+// StartStage empieza la etapa name de la sincronización de ctx: abre el span
+// sync.<name> y, al terminar con End, suma su duración a las etapas de ctx
+// (WithSyncStages). El contexto devuelto lleva la etapa para que las que
+// empiecen dentro cuelguen de ella. Fuera de una sincronización (sin
+// WithSyncStages) no hace nada y devuelve ctx y un *Stage nil.
+func StartStage(ctx context.Context, name string) (context.Context, *Stage) {
+	etapas, _ := ctx.Value(claveEtapas{}).(*SyncStages)
+	if etapas == nil {
+		return ctx, nil
+	}
+	nombre := name
+	if padre, ok := ctx.Value(claveEtapa{}).(string); ok {
+		nombre = padre + "." + name
+	}
+	etapas.empezar(nombre)
+	ctx, span := tracing.Start(ctx, "sync."+name, tracing.KindInternal)
+	span.SetAttr("sync.stage", nombre)
+	ctx = context.WithValue(ctx, claveEtapa{}, nombre)
+	return ctx, &Stage{nombre: nombre, inicio: time.Now(), span: span, etapas: etapas}
+}
+
+// SetAttr añade un atributo al span de la etapa.
+func (s *Stage) SetAttr(key string, v any) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttr(key, v)
+}
+
+// End termina la etapa, marcándola como fallida si err no es nil, y devuelve
+// su duración.
+func (s *Stage) End(err error) time.Duration {
+	if s == nil {
+		return 0
+	}
+	d := time.Since(s.inicio)
+	s.span.SetError(err)
+	s.span.End()
+	s.etapas.sumar(s.nombre, d)
+	return d
+}
+
+// etapasJSON es el valor de la columna stages de sync_runs: las etapas en
+// JSON, o NULL si no hay (ejecuciones que no llegaron a empezar).
+func etapasJSON(etapas []SyncStage) *string {
+	if len(etapas) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(etapas)
+	if err != nil {
+		return nil
+	}
+	s := string(raw)
+	return &s
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Tablas son los nombres configurables del esquema, para que varias
+// instancias (p. ej. staging y prod) puedan compartir un mismo cluster.
+type Tablas struct {
+	// Schema es el esquema de PostgreSQL/CockroachDB donde viven todas las
+	// tablas (items, historial, reintentos y migraciones). Vacío usa el de la
+	// conexión. En MySQL y SQLite el esquema es la base de datos del dsn.
+	Schema string
+	// Items es el nombre de la tabla de items. Las migraciones se registran
+	// por esquema, así que para tener dos tablas de items distintas hay que
+	// usar también esquemas distintos.
+	Items string
+}
+
+// TablasPorDefecto son los nombres que se usaban antes de hacerlos
+// configurables.
+var TablasPorDefecto = Tablas{Items: "items"}
+
+var identificadorValido = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+// Validate comprueba que los nombres son identificadores simples: se
+// interpolan en el SQL, así que no se aceptan comillas ni puntos.
+func (t Tablas) Validate() error {
+	if t.Schema != "" && !identificadorValido.MatchString(t.Schema) {
+		return fmt.Errorf("invalid schema name %q", t.Schema)
+	}
+	if !identificadorValido.MatchString(t.Items) {
+		return fmt.Errorf("invalid items table name %q", t.Items)
+	}
+	return nil
+}
+
+// sustituir pone los nombres configurados en el SQL de una migración, donde
+// aparecen como {{items}}.
+func (t Tablas) sustituir(sql string) string {
+	return strings.ReplaceAll(sql, "{{items}}", t.Items)
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// TenantPorDefecto es el tenant de las peticiones que no indican ninguno y de
+// los datos anteriores al modelo multi-tenant.
+const TenantPorDefecto = "default"
+
+var tenantValido = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,62}$`)
+
+// ValidateTenant comprueba que id es un identificador de tenant válido.
+func ValidateTenant(id string) error {
+	if !tenantValido.MatchString(id) {
+		return fmt.Errorf("invalid tenant id %q", id)
+	}
+	return nil
+}
+
+type claveTenant struct{}
+
+// WithTenant devuelve un contexto cuyas operaciones de repositorio quedan
+// limitadas al tenant id: todas las lecturas y escrituras de items,
+// ejecuciones, reintentos y estadísticas filtran por él. id debe venir de la
+// identidad autenticada, nunca directamente del cliente: con row-level
+// security es también el de las políticas (ver TenantBeforeAcquire).
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, claveTenant{}, id)
+}
+
+// TenantFrom devuelve el tenant del contexto, o TenantPorDefecto si no tiene.
+func TenantFrom(ctx context.Context) string {
+	if id, ok := tenantFijado(ctx); ok {
+		return id
+	}
+	return TenantPorDefecto
+}
+
+// tenantFijado devuelve el tenant que se puso en ctx con WithTenant.
+func tenantFijado(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(claveTenant{}).(string)
+	return id, ok && id != ""
+}
+
+// TenantBeforeAcquire es un hook BeforeAcquire de pgxpool que fija la variable
+// de sesión app.tenant_id con el tenant del contexto de cada consulta, para
+// las políticas de row-level security. Si falla la conexión se descarta.
+//
+// El tenant es el que fijó WithTenant: el de la identidad de la petición
+// (el servidor no lo toma de la cabecera del cliente salvo para los
+// administradores) o el de la tarea en segundo plano. Sin él la variable
+// queda vacía y las políticas no dejan ver ninguna fila, en lugar de caer en
+// TenantPorDefecto como TenantFrom.
+//
+// Como la variable es de sesión, no sirve detrás de un pooler en modo
+// transacción (db_simple_protocol).
+func TenantBeforeAcquire(ctx context.Context, conn *pgx.Conn) bool {
+	tenant, _ := tenantFijado(ctx)
+	_, err := conn.Exec(ctx, `SELECT set_config('app.tenant_id', $1, false)`, tenant)
+	return err == nil
+}
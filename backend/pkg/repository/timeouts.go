@@ -0,0 +1,366 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts son los límites de duración de las operaciones de un Store (ver
+// WithTimeouts). 0 es sin límite.
+type Timeouts struct {
+	// Op es el de las operaciones puntuales: lecturas de los endpoints,
+	// ediciones, registro de ejecuciones, cola de reintentos...
+	Op time.Duration
+	// Bulk es el de las escrituras de la sincronización, que recorren la
+	// tabla entera (Upsert, Replace, RecordGeneration, RefreshLatest y
+	// Daily.Save).
+	Bulk time.Duration
+}
+
+// WithTimeouts devuelve una copia de s en la que cada operación se cancela
+// si no termina dentro de su límite, aunque quien la llama no haya puesto
+// ninguno al contexto; el error es entonces context.DeadlineExceeded. Si el
+// contexto ya tiene un plazo menor, manda ese. Changes no se limita (es un
+// flujo que dura mientras el proceso) ni Ping, que lleva el suyo.
+func WithTimeouts(s *Store, t Timeouts) *Store {
+	out := *s
+	out.Items = &itemsConLimite{ItemRepository: s.Items, t: t}
+	out.SyncRuns = &syncRunsConLimite{SyncRunRepository: s.SyncRuns, t: t}
+	out.Retries = &retriesConLimite{RetryRepository: s.Retries, t: t}
+	out.Daily = &dailyConLimite{DailyStatsRepository: s.Daily, t: t}
+	out.Flags = &flagsConLimite{FeatureFlagRepository: s.Flags, t: t}
+	out.APIKeys = &apiKeysConLimite{APIKeyRepository: s.APIKeys, t: t}
+	out.Audit = &auditConLimite{AuditLogRepository: s.Audit, t: t}
+	out.Users = &usersConLimite{UserRepository: s.Users, t: t}
+	out.Sessions = &sessionsConLimite{SessionRepository: s.Sessions, t: t}
+	out.Filters = &filtersConLimite{SavedFilterRepository: s.Filters, t: t}
+	return &out
+}
+
+// conLimite añade a ctx el plazo d, si d > 0.
+func conLimite(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+type itemsConLimite struct {
+	ItemRepository
+	t Timeouts
+}
+
+func (r *itemsConLimite) List(ctx context.Context) ([]Item, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.ItemRepository.List(ctx)
+}
+
+func (r *itemsConLimite) Upsert(ctx context.Context, items []Item) (int64, error) {
+	ctx, cancel := conLimite(ctx, r.t.Bulk)
+	defer cancel()
+	return r.ItemRepository.Upsert(ctx, items)
+}
+
+func (r *itemsConLimite) Replace(ctx context.Context, items []Item) (int64, error) {
+	ctx, cancel := conLimite(ctx, r.t.Bulk)
+	defer cancel()
+	return r.ItemRepository.Replace(ctx, items)
+}
+
+func (r *itemsConLimite) Stats(ctx context.Context) (ItemStats, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.ItemRepository.Stats(ctx)
+}
+
+func (r *itemsConLimite) Latest(ctx context.Context) ([]Item, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.ItemRepository.Latest(ctx)
+}
+
+func (r *itemsConLimite) RefreshLatest(ctx context.Context) error {
+	ctx, cancel := conLimite(ctx, r.t.Bulk)
+	defer cancel()
+	return r.ItemRepository.RefreshLatest(ctx)
+}
+
+func (r *itemsConLimite) Update(ctx context.Context, key ItemKey, version int64, patch ItemPatch) (*Item, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.ItemRepository.Update(ctx, key, version, patch)
+}
+
+func (r *itemsConLimite) RecordGeneration(ctx context.Context, generation int64) error {
+	ctx, cancel := conLimite(ctx, r.t.Bulk)
+	defer cancel()
+	return r.ItemRepository.RecordGeneration(ctx, generation)
+}
+
+func (r *itemsConLimite) Purge(ctx context.Context, before time.Time, batch int) (int64, error) {
+	ctx, cancel := conLimite(ctx, r.t.Bulk)
+	defer cancel()
+	return r.ItemRepository.Purge(ctx, before, batch)
+}
+
+func (r *itemsConLimite) ListAsOf(ctx context.Context, asOf AsOf) ([]Item, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.ItemRepository.ListAsOf(ctx, asOf)
+}
+
+type syncRunsConLimite struct {
+	SyncRunRepository
+	t Timeouts
+}
+
+func (r *syncRunsConLimite) Start(ctx context.Context, trigger string, params SyncParams, retryOf *int64) (int64, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.SyncRunRepository.Start(ctx, trigger, params, retryOf)
+}
+
+func (r *syncRunsConLimite) Finish(ctx context.Context, id int64, res SyncRunResult) error {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.SyncRunRepository.Finish(ctx, id, res)
+}
+
+func (r *syncRunsConLimite) Get(ctx context.Context, id int64) (*SyncRun, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.SyncRunRepository.Get(ctx, id)
+}
+
+func (r *syncRunsConLimite) List(ctx context.Context, limit int) ([]SyncRun, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.SyncRunRepository.List(ctx, limit)
+}
+
+func (r *syncRunsConLimite) Last(ctx context.Context, f SyncRunFilter) (*SyncRun, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.SyncRunRepository.Last(ctx, f)
+}
+
+type retriesConLimite struct {
+	RetryRepository
+	t Timeouts
+}
+
+func (r *retriesConLimite) Enqueue(ctx context.Context, maxAttempts int, nextAttempt time.Time, lastErr string, staleBefore time.Time) (bool, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.RetryRepository.Enqueue(ctx, maxAttempts, nextAttempt, lastErr, staleBefore)
+}
+
+func (r *retriesConLimite) Claim(ctx context.Context, staleBefore time.Time) (*SyncRetry, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.RetryRepository.Claim(ctx, staleBefore)
+}
+
+func (r *retriesConLimite) Complete(ctx context.Context, id int64) error {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.RetryRepository.Complete(ctx, id)
+}
+
+func (r *retriesConLimite) Fail(ctx context.Context, id int64, lastErr string) error {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.RetryRepository.Fail(ctx, id, lastErr)
+}
+
+func (r *retriesConLimite) Reschedule(ctx context.Context, id int64, lastErr string, next time.Time) error {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.RetryRepository.Reschedule(ctx, id, lastErr, next)
+}
+
+func (r *retriesConLimite) Release(ctx context.Context, id int64) error {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.RetryRepository.Release(ctx, id)
+}
+
+type dailyConLimite struct {
+	DailyStatsRepository
+	t Timeouts
+}
+
+func (r *dailyConLimite) Save(ctx context.Context, stats []DailyStat) error {
+	ctx, cancel := conLimite(ctx, r.t.Bulk)
+	defer cancel()
+	return r.DailyStatsRepository.Save(ctx, stats)
+}
+
+func (r *dailyConLimite) List(ctx context.Context, since time.Time) ([]DailyStat, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.DailyStatsRepository.List(ctx, since)
+}
+
+type flagsConLimite struct {
+	FeatureFlagRepository
+	t Timeouts
+}
+
+func (r *flagsConLimite) List(ctx context.Context) (map[string]bool, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.FeatureFlagRepository.List(ctx)
+}
+
+func (r *flagsConLimite) Set(ctx context.Context, name string, enabled bool) error {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.FeatureFlagRepository.Set(ctx, name, enabled)
+}
+
+func (r *flagsConLimite) Delete(ctx context.Context, name string) error {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.FeatureFlagRepository.Delete(ctx, name)
+}
+
+type apiKeysConLimite struct {
+	APIKeyRepository
+	t Timeouts
+}
+
+func (r *apiKeysConLimite) FindByHash(ctx context.Context, hash string) (*APIKey, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.APIKeyRepository.FindByHash(ctx, hash)
+}
+
+func (r *apiKeysConLimite) Create(ctx context.Context, k APIKey, hash string) (*APIKey, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.APIKeyRepository.Create(ctx, k, hash)
+}
+
+func (r *apiKeysConLimite) List(ctx context.Context) ([]APIKey, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.APIKeyRepository.List(ctx)
+}
+
+func (r *apiKeysConLimite) Get(ctx context.Context, id int64) (*APIKey, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.APIKeyRepository.Get(ctx, id)
+}
+
+func (r *apiKeysConLimite) Update(ctx context.Context, id int64, patch APIKeyPatch) (*APIKey, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.APIKeyRepository.Update(ctx, id, patch)
+}
+
+func (r *apiKeysConLimite) Rotate(ctx context.Context, id int64, hash, prefix string) (*APIKey, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.APIKeyRepository.Rotate(ctx, id, hash, prefix)
+}
+
+func (r *apiKeysConLimite) Revoke(ctx context.Context, id int64) error {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.APIKeyRepository.Revoke(ctx, id)
+}
+
+type auditConLimite struct {
+	AuditLogRepository
+	t Timeouts
+}
+
+func (r *auditConLimite) Append(ctx context.Context, ev AuditEvent) error {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.AuditLogRepository.Append(ctx, ev)
+}
+
+func (r *auditConLimite) List(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.AuditLogRepository.List(ctx, f)
+}
+
+type usersConLimite struct {
+	UserRepository
+	t Timeouts
+}
+
+func (r *usersConLimite) Create(ctx context.Context, u User) (*User, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.UserRepository.Create(ctx, u)
+}
+
+func (r *usersConLimite) FindByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.UserRepository.FindByEmail(ctx, email)
+}
+
+func (r *usersConLimite) RecordLogin(ctx context.Context, id int64) error {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.UserRepository.RecordLogin(ctx, id)
+}
+
+type sessionsConLimite struct {
+	SessionRepository
+	t Timeouts
+}
+
+func (r *sessionsConLimite) Create(ctx context.Context, hash string, userID int64, expiresAt time.Time) error {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.SessionRepository.Create(ctx, hash, userID, expiresAt)
+}
+
+func (r *sessionsConLimite) Find(ctx context.Context, hash string, now time.Time) (*Session, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.SessionRepository.Find(ctx, hash, now)
+}
+
+func (r *sessionsConLimite) Revoke(ctx context.Context, hash string) error {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.SessionRepository.Revoke(ctx, hash)
+}
+
+type filtersConLimite struct {
+	SavedFilterRepository
+	t Timeouts
+}
+
+func (r *filtersConLimite) List(ctx context.Context, owner string) ([]SavedFilter, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.SavedFilterRepository.List(ctx, owner)
+}
+
+func (r *filtersConLimite) Create(ctx context.Context, owner string, f SavedFilter) (*SavedFilter, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.SavedFilterRepository.Create(ctx, owner, f)
+}
+
+func (r *filtersConLimite) Update(ctx context.Context, owner string, id int64, f SavedFilter) (*SavedFilter, error) {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.SavedFilterRepository.Update(ctx, owner, id, f)
+}
+
+func (r *filtersConLimite) Delete(ctx context.Context, owner string, id int64) error {
+	ctx, cancel := conLimite(ctx, r.t.Op)
+	defer cancel()
+	return r.SavedFilterRepository.Delete(ctx, owner, id)
+}
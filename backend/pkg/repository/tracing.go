@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"prueba/internal/tracing"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// TracingLogger es un pgx.Logger que convierte cada consulta (Query, Exec,
+// SendBatch, CopyFrom) en un span hijo del span del ctx de la consulta, y
+// después pasa el mensaje a next (que puede ser nil). Como SlowQueryLogger,
+// requiere ConnConfig.LogLevel >= pgx.LogLevelInfo. pgx informa al terminar,
+// con la duración: el span se registra hacia atrás desde ese momento.
+func TracingLogger(next pgx.Logger) pgx.Logger {
+	return pgx.LoggerFunc(func(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+		if d, ok := data["time"].(time.Duration); ok {
+			query, _ := data["sql"].(string)
+			err, _ := data["err"].(error)
+			sql := normalizarSQL(query)
+			attrs := map[string]any{"db.system": "postgresql", "db.operation.name": msg}
+			if sql != "" {
+				attrs["db.query.text"] = sql
+			}
+			if t, ok := data["tableName"]; ok {
+				attrs["db.collection.name"] = fmt.Sprint(t)
+			}
+			if n, ok := filasConsulta(data); ok {
+				attrs["db.response.returned_rows"] = n
+			}
+			tracing.Record(ctx, nombreSpanSQL(msg, sql), tracing.KindClient, time.Now().Add(-d), d, attrs, err)
+		}
+		if next != nil {
+			next.Log(ctx, level, msg, data)
+		}
+	})
+}
+
+// nombreSpanSQL es el nombre del span de una consulta: la operación de SQL
+// (SELECT, INSERT...) o, sin sentencia, el mensaje de pgx (SendBatch,
+// CopyFrom).
+func nombreSpanSQL(msg, sql string) string {
+	if op, _, _ := strings.Cut(sql, " "); op != "" {
+		return "db " + strings.ToUpper(op)
+	}
+	return "db " + msg
+}
+
+// filasConsulta es el número de filas que informa pgx: leídas en Query,
+// afectadas en Exec y copiadas en CopyFrom.
+func filasConsulta(data map[string]interface{}) (int64, bool) {
+	switch n := data["rowCount"].(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	if tag, ok := data["commandTag"].(interface{ RowsAffected() int64 }); ok {
+		return tag.RowsAffected(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Reintentos ante errores de serialización (SQLSTATE 40001), que CockroachDB
+// devuelve cuando hay contención y que se resuelven repitiendo la transacción.
+const (
+	maxIntentosSerializacion = 5
+	esperaSerializacion      = 50 * time.Millisecond
+)
+
+// esReintentable indica si err es un error de serialización que se resuelve
+// repitiendo la transacción.
+func esReintentable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "40001"
+}
+
+// conReintentos ejecuta fn y la repite, con espera exponencial, mientras falle
+// por serialización. fn tiene que poder repetirse entera.
+func conReintentos(ctx context.Context, fn func() error) error {
+	wait := esperaSerializacion
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !esReintentable(err) || attempt == maxIntentosSerializacion {
+			return err
+		}
+		// Jitter para que las transacciones en conflicto no vuelvan a chocar.
+		sleep := wait/2 + rand.N(wait)
+		select {
+		case <-time.After(sleep):
+		case <-ctx.Done():
+			return err
+		}
+		wait *= 2
+	}
+}
+
+// enTransaccion ejecuta fn dentro de una transacción y la confirma, repitiendo
+// todo si CockroachDB pide reintento.
+func enTransaccion(ctx context.Context, db *pgxpool.Pool, fn func(tx pgx.Tx) error) error {
+	return conReintentos(ctx, func() error {
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %w", err)
+		}
+		defer tx.Rollback(ctx)
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("error committing transaction: %w", err)
+		}
+		return nil
+	})
+}
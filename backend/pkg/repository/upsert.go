@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgconn"
+)
+
+// Máximo de parámetros por sentencia en el protocolo de PostgreSQL.
+const maxParams = 65535
+
+// Filas por sentencia INSERT; se reduce si hay muchas columnas.
+const upsertBatchRows = 500
+
+// execer es lo común a un pool, una conexión y una transacción de pgx, para
+// que el upsert se pueda usar dentro o fuera de una transacción.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// sqlExecer es lo mismo para database/sql.
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// execFunc ejecuta una sentencia y devuelve las filas afectadas.
+type execFunc func(ctx context.Context, sql string, args ...interface{}) (int64, error)
+
+func pgExec(db execer) execFunc {
+	return func(ctx context.Context, sql string, args ...interface{}) (int64, error) {
+		tag, err := db.Exec(ctx, comentar(ctx, sql), args...)
+		if err != nil {
+			return 0, err
+		}
+		return tag.RowsAffected(), nil
+	}
+}
+
+func sqlExec(db sqlExecer) execFunc {
+	return func(ctx context.Context, query string, args ...interface{}) (int64, error) {
+		res, err := db.ExecContext(ctx, comentar(ctx, query), args...)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+}
+
+// upsertSpec describe la tabla destino de un upsert en lote.
+type upsertSpec struct {
+	Table   string
+	Columns []string
+	// Key son las columnas del ON CONFLICT; deben estar en Columns y tener un
+	// índice único. El resto de columnas se actualizan con el valor nuevo.
+	Key []string
+}
+
+// upsertLote inserta las filas en lotes de INSERT ... ON CONFLICT DO UPDATE (o
+// su equivalente en el dialecto) y devuelve cuántas se escribieron. values
+// debe devolver los valores en el orden de spec.Columns.
+//
+// Si el lote trae varias filas con la misma clave solo se escribe la última:
+// un mismo INSERT no puede actualizar dos veces la misma fila.
+func upsertLote[T any](ctx context.Context, exec execFunc, d *dialecto, spec upsertSpec, rows []T, values func(T) []interface{}) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	keyIdx := make([]int, len(spec.Key))
+	for i, k := range spec.Key {
+		keyIdx[i] = -1
+		for j, c := range spec.Columns {
+			if c == k {
+				keyIdx[i] = j
+			}
+		}
+		if keyIdx[i] < 0 {
+			return 0, fmt.Errorf("upsert key column %q not in columns", k)
+		}
+	}
+
+	// Deduplicar por clave conservando la última aparición.
+	vals := make([][]interface{}, 0, len(rows))
+	pos := make(map[string]int, len(rows))
+	for _, row := range rows {
+		v := values(row)
+		var key strings.Builder
+		for _, i := range keyIdx {
+			fmt.Fprintf(&key, "%v\xff", v[i])
+		}
+		if p, ok := pos[key.String()]; ok {
+			vals[p] = v
+			continue
+		}
+		pos[key.String()] = len(vals)
+		vals = append(vals, v)
+	}
+
+	batch := upsertBatchRows
+	if batch*len(spec.Columns) > maxParams {
+		batch = maxParams / len(spec.Columns)
+	}
+
+	// En una sincronización cada lote es una etapa (upsert_chunk)
+	var total int64
+	for start := 0; start < len(vals); start += batch {
+		end := min(start+batch, len(vals))
+		chunkCtx, etapa := StartStage(ctx, "upsert_chunk")
+		etapa.SetAttr("db.collection.name", spec.Table)
+		etapa.SetAttr("sync.chunk", start/batch+1)
+		etapa.SetAttr("sync.rows", end-start)
+		query, args := upsertSQL(d, spec, vals[start:end])
+		n, err := exec(chunkCtx, query, args...)
+		etapa.End(err)
+		if err != nil {
+			return total, fmt.Errorf("error upserting into %s: %w", spec.Table, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func upsertSQL(d *dialecto, spec upsertSpec, rows [][]interface{}) (string, []interface{}) {
+	var b strings.Builder
+	args := make([]interface{}, 0, len(rows)*len(spec.Columns))
+
+	fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES ", spec.Table, strings.Join(spec.Columns, ", "))
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for j, v := range row {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			args = append(args, v)
+			b.WriteString(d.placeholder(len(args)))
+		}
+		b.WriteString(")")
+	}
+	b.WriteString(" " + d.conflicto(spec))
+	return b.String(), args
+}
+
+// columnasActualizables son las columnas de spec que no forman parte de la clave.
+func columnasActualizables(spec upsertSpec) []string {
+	var out []string
+	for _, c := range spec.Columns {
+		if !contiene(spec.Key, c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// onConflictDoUpdate es la cláusula de upsert de PostgreSQL, CockroachDB y SQLite.
+func onConflictDoUpdate(spec upsertSpec) string {
+	cols := columnasActualizables(spec)
+	if len(cols) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(spec.Key, ", "))
+	}
+	set := make([]string, len(cols))
+	for i, c := range cols {
+		set[i] = fmt.Sprintf("%s = excluded.%s", c, c)
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(spec.Key, ", "), strings.Join(set, ", "))
+}
+
+func contiene(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
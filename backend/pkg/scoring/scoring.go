@@ -0,0 +1,183 @@
+// Package scoring es el algoritmo que puntúa las valoraciones de los
+// analistas para recomendar tickers.
+package scoring
+
+import (
+	"fmt"
+	"prueba/pkg/repository"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Recommendation es un ticker puntuado por el algoritmo de recomendación.
+type Recommendation struct {
+	Item    repository.Item `json:"item"`
+	Score   int             `json:"score"`
+	Reasons []string        `json:"reasons"`
+	Risk    string          `json:"risk"`
+}
+
+// ratingScore puntúa las valoraciones conocidas; las demás cuentan como 3.
+// Se busca por subcadena en este orden, así que "strong buy" va antes que "buy".
+var ratingScore = []struct {
+	rating string
+	score  int
+}{
+	{"strong buy", 5},
+	{"buy", 4},
+	{"outperform", 4},
+	{"hold", 3},
+	{"neutral", 3},
+	{"market perform", 3},
+	{"underperform", 2},
+	{"sell", 1},
+}
+
+// TargetChange es la variación porcentual del precio objetivo. ok es false si
+// falta alguno de los dos precios o el de partida no es positivo.
+func TargetChange(it repository.Item) (change float64, ok bool) {
+	if it.TargetFrom == nil || it.TargetTo == nil || it.TargetFrom.Sign() <= 0 {
+		return 0, false
+	}
+	from, to := it.TargetFrom.Float64(), it.TargetTo.Float64()
+	return (to - from) / from * 100, true
+}
+
+// deref devuelve el texto o "" si es nil.
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func puntuacionRating(rating string) int {
+	rating = strings.ToLower(rating)
+	for _, r := range ratingScore {
+		if strings.Contains(rating, r.rating) {
+			return r.score
+		}
+	}
+	return 3
+}
+
+// Weights son los puntos máximos de cada criterio de Score. Dentro de cada
+// criterio los tramos se reparten en la misma proporción que con
+// DefaultWeights.
+type Weights struct {
+	Upside  int `json:"upside"`
+	Action  int `json:"action"`
+	Rating  int `json:"rating"`
+	Recency int `json:"recency"`
+}
+
+// DefaultWeights son los pesos del algoritmo original del frontend.
+var DefaultWeights = Weights{Upside: 40, Action: 30, Rating: 30, Recency: 10}
+
+// Score es el algoritmo de recomendación que antes calculaba el
+// frontend (analyzeStocks en App.vue), con DefaultWeights: hasta 40 puntos
+// por potencial de subida, 30 por la acción del analista, 30 por la
+// valoración y 10 por actualidad.
+func Score(it repository.Item, now time.Time) Recommendation {
+	return DefaultWeights.Score(it, now)
+}
+
+// Score puntúa it con los pesos w.
+func (w Weights) Score(it repository.Item, now time.Time) Recommendation {
+	rec := Recommendation{Item: it, Reasons: []string{}}
+
+	// 1. Potencial de subida del precio objetivo (w.Upside máx.). Sin precio
+	// de partida no se puede calcular y no puntúa.
+	change, known := TargetChange(it)
+	if known && change > 0 {
+		switch {
+		case change > 20:
+			rec.Score += w.Upside
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("Excellent upside potential: %.1f%% increase", change))
+		case change > 10:
+			rec.Score += w.Upside * 3 / 4
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("Strong upside potential: %.1f%% increase", change))
+		case change > 5:
+			rec.Score += w.Upside / 2
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("Moderate upside potential: %.1f%% increase", change))
+		default:
+			rec.Score += w.Upside / 4
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("Slight upside potential: %.1f%% increase", change))
+		}
+	}
+
+	// 2. Tipo de acción (w.Action máx.)
+	action := strings.ToLower(it.Action)
+	if strings.Contains(action, "raised") {
+		rec.Score += w.Action
+		rec.Reasons = append(rec.Reasons, "Analysts raised price target")
+	} else if strings.Contains(action, "reiterated") {
+		rec.Score += w.Action / 2
+		rec.Reasons = append(rec.Reasons, "Analysts reaffirmed their position")
+	}
+
+	// 3. Valoración actual y mejora (w.Rating máx.: dos tercios por la
+	// valoración y uno por la mejora)
+	current := puntuacionRating(deref(it.RatingTo))
+	previous := puntuacionRating(deref(it.RatingFrom))
+	if current >= 4 {
+		rec.Score += w.Rating * 2 / 3
+		rec.Reasons = append(rec.Reasons, "Strong Buy/Outperform rating")
+	} else if current == 3 {
+		rec.Score += w.Rating / 3
+	}
+	if current > previous {
+		rec.Score += w.Rating / 3
+		rec.Reasons = append(rec.Reasons, "Rating upgraded")
+	}
+
+	// 4. Actualidad (w.Recency máx.)
+	days := int(now.Sub(it.Time).Hours() / 24)
+	if days <= 7 {
+		rec.Score += w.Recency
+		rec.Reasons = append(rec.Reasons, "Recent analyst update (within 7 days)")
+	} else if days <= 14 {
+		rec.Score += w.Recency / 2
+		rec.Reasons = append(rec.Reasons, "Recent analyst update (within 2 weeks)")
+	}
+
+	// 5. Nivel del precio objetivo (solo informativo)
+	if it.TargetTo != nil && it.TargetTo.Float64() > 100 {
+		rec.Reasons = append(rec.Reasons, "High-value stock target")
+	} else if it.TargetTo != nil && it.TargetTo.Float64() < 10 {
+		rec.Reasons = append(rec.Reasons, "Low-price entry opportunity")
+	}
+
+	// Riesgo
+	switch {
+	case !known || change > 30 || change < 0:
+		rec.Risk = "high"
+	case change > 15:
+		rec.Risk = "medium"
+	default:
+		rec.Risk = "low"
+	}
+	return rec
+}
+
+// Rank puntúa items con DefaultWeights y devuelve, de mayor a menor
+// puntuación, los que llegan a minScore; como mucho limit si es mayor que 0.
+func Rank(items []repository.Item, now time.Time, minScore, limit int) []Recommendation {
+	return DefaultWeights.Rank(items, now, minScore, limit)
+}
+
+// Rank es Rank con los pesos w.
+func (w Weights) Rank(items []repository.Item, now time.Time, minScore, limit int) []Recommendation {
+	recs := []Recommendation{}
+	for _, it := range items {
+		if rec := w.Score(it, now); rec.Score >= minScore {
+			recs = append(recs, rec)
+		}
+	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Score > recs[j].Score })
+	if limit > 0 && len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs
+}
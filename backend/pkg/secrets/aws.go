@@ -0,0 +1,142 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AWS lee secretos de AWS Secrets Manager y de SSM Parameter Store con las
+// credenciales del entorno, del rol de la cuenta de servicio en EKS o del rol
+// de la tarea en ECS (ver cadenaAWS).
+type AWS struct {
+	region string
+	// endpoint sustituye a los de AWS (LocalStack, endpoints privados); vacío
+	// es el del servicio en la región.
+	endpoint string
+	client   *http.Client
+	cadena   *cadenaAWS
+}
+
+// NewAWS crea el cliente para region. endpoint, si no está vacío, sustituye
+// a los endpoints de AWS de todos los servicios (también STS).
+func NewAWS(region, endpoint string) (*AWS, error) {
+	if region == "" {
+		return nil, errors.New("aws region is required")
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	client := &http.Client{Timeout: 10 * time.Second}
+	return &AWS{
+		region:   region,
+		endpoint: endpoint,
+		client:   client,
+		cadena:   &cadenaAWS{region: region, client: client, sts: endpoint},
+	}, nil
+}
+
+// Secret devuelve el secreto ref, que es una de:
+//
+//	sm:<nombre o ARN>[#campo]  un secreto de Secrets Manager; con campo, el
+//	                           secreto es un JSON y se devuelve ese campo
+//	ssm:<nombre>               un parámetro de Parameter Store (SecureString
+//	                           se descifra)
+//
+// Con un ARN se usa la región del ARN.
+func (a *AWS) Secret(ctx context.Context, ref string) (string, error) {
+	tipo, id, _ := strings.Cut(ref, ":")
+	if id == "" {
+		return "", fmt.Errorf("invalid aws reference %q: expected sm:<id>[#field] or ssm:<name>", ref)
+	}
+	switch tipo {
+	case "sm":
+		id, campo, _ := strings.Cut(id, "#")
+		var out struct {
+			SecretString string `json:"SecretString"`
+		}
+		if err := a.llamar(ctx, "secretsmanager", regionARN(id, a.region), "secretsmanager.GetSecretValue", map[string]any{"SecretId": id}, &out); err != nil {
+			return "", err
+		}
+		if campo == "" {
+			return out.SecretString, nil
+		}
+		var campos map[string]any
+		if err := json.Unmarshal([]byte(out.SecretString), &campos); err != nil {
+			return "", fmt.Errorf("secret %q is not a JSON object: %w", id, err)
+		}
+		s, ok := campos[campo].(string)
+		if !ok {
+			return "", fmt.Errorf("secret %q has no string field %q", id, campo)
+		}
+		return s, nil
+	case "ssm":
+		var out struct {
+			Parameter struct {
+				Value string `json:"Value"`
+			} `json:"Parameter"`
+		}
+		if err := a.llamar(ctx, "ssm", regionARN(id, a.region), "AmazonSSM.GetParameter", map[string]any{"Name": id, "WithDecryption": true}, &out); err != nil {
+			return "", err
+		}
+		return out.Parameter.Value, nil
+	default:
+		return "", fmt.Errorf("invalid aws reference %q: expected sm:<id>[#field] or ssm:<name>", ref)
+	}
+}
+
+// regionARN devuelve la región de id si es un ARN, y def si no.
+func regionARN(id, def string) string {
+	// arn:partition:service:region:account:resource
+	if partes := strings.SplitN(id, ":", 5); len(partes) == 5 && partes[0] == "arn" && partes[3] != "" {
+		return partes[3]
+	}
+	return def
+}
+
+// llamar hace una petición JSON 1.1 firmada a la operación target de service
+// y decodifica la respuesta en out.
+func (a *AWS) llamar(ctx context.Context, service, region, target string, in, out any) error {
+	cr, err := a.cadena.credenciales(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	endpoint := a.endpoint
+	if endpoint == "" {
+		endpoint = "https://" + service + "." + region + ".amazonaws.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating %s request: %w", service, err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	firmar(req, body, cr, service, region, time.Now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling %s: %w", service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		json.Unmarshal(b, &e)
+		return fmt.Errorf("%s %s returned status %d: %s %s", service, target, resp.StatusCode, e.Type, e.Message)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error parsing %s response: %w", service, err)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package secrets
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dirección de las credenciales del rol de la tarea en ECS.
+const ecsCredentialsHost = "http://169.254.170.2"
+
+// Antelación con la que se renuevan las credenciales temporales.
+const margenCredencialesAWS = 5 * time.Minute
+
+// credencialesAWS son las credenciales con las que se firman las
+// peticiones; token solo lo llevan las temporales.
+type credencialesAWS struct {
+	accessKey string
+	secretKey string
+	token     string
+	// expira es cero en las credenciales fijas.
+	expira time.Time
+}
+
+// cadenaAWS obtiene las credenciales como los SDK de AWS, en este orden: las
+// variables AWS_ACCESS_KEY_ID y AWS_SECRET_ACCESS_KEY (con
+// AWS_SESSION_TOKEN), el rol de la cuenta de servicio en EKS
+// (AWS_WEB_IDENTITY_TOKEN_FILE y AWS_ROLE_ARN) y el rol de la tarea en ECS
+// (AWS_CONTAINER_CREDENTIALS_*). Las temporales se guardan hasta poco antes
+// de que caduquen.
+type cadenaAWS struct {
+	region string
+	client *http.Client
+	// sts es el endpoint de STS; vacío es el de la región.
+	sts string
+
+	mu     sync.Mutex
+	actual *credencialesAWS
+}
+
+func (c *cadenaAWS) credenciales(ctx context.Context) (*credencialesAWS, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.actual != nil && (c.actual.expira.IsZero() || time.Until(c.actual.expira) > margenCredencialesAWS) {
+		return c.actual, nil
+	}
+
+	var cr *credencialesAWS
+	var err error
+	switch {
+	case os.Getenv("AWS_ACCESS_KEY_ID") != "":
+		cr = &credencialesAWS{
+			accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			token:     os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	case os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "":
+		cr, err = c.webIdentity(ctx)
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "":
+		cr, err = c.contenedor(ctx)
+	default:
+		err = errors.New("no AWS credentials found (environment, EKS web identity or ECS task role)")
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.actual = cr
+	return cr, nil
+}
+
+// webIdentity cambia el token de la cuenta de servicio de EKS por
+// credenciales del rol AWS_ROLE_ARN (AssumeRoleWithWebIdentity).
+func (c *cadenaAWS) webIdentity(ctx context.Context) (*credencialesAWS, error) {
+	token, err := os.ReadFile(os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading web identity token: %w", err)
+	}
+	sesion := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if sesion == "" {
+		sesion = "prueba"
+	}
+	q := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {os.Getenv("AWS_ROLE_ARN")},
+		"RoleSessionName":  {sesion},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	endpoint := c.sts
+	if endpoint == "" {
+		endpoint = "https://sts." + c.region + ".amazonaws.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", strings.NewReader(q.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("error creating STS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling STS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("STS AssumeRoleWithWebIdentity returned status %d: %s", resp.StatusCode, b)
+	}
+	var out struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("error parsing STS response: %w", err)
+	}
+	return &credencialesAWS{
+		accessKey: out.Credentials.AccessKeyID,
+		secretKey: out.Credentials.SecretAccessKey,
+		token:     out.Credentials.SessionToken,
+		expira:    out.Credentials.Expiration,
+	}, nil
+}
+
+// contenedor pide las credenciales del rol de la tarea al agente de ECS.
+func (c *cadenaAWS) contenedor(ctx context.Context) (*credencialesAWS, error) {
+	u := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if rel := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); rel != "" {
+		u = ecsCredentialsHost + rel
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating container credentials request: %w", err)
+	}
+	auth := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if f := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); f != "" {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("error reading container authorization token: %w", err)
+		}
+		auth = strings.TrimSpace(string(b))
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching container credentials: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("container credentials endpoint returned status %d", resp.StatusCode)
+	}
+	var out struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("error parsing container credentials: %w", err)
+	}
+	return &credencialesAWS{accessKey: out.AccessKeyID, secretKey: out.SecretAccessKey, token: out.Token, expira: out.Expiration}, nil
+}
+
+// firmar firma req con Signature Version 4 para service en region. body es
+// el cuerpo de req.
+func firmar(req *http.Request, body []byte, cr *credencialesAWS, service, region string, now time.Time) {
+	now = now.UTC()
+	fecha := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	if cr.token != "" {
+		req.Header.Set("X-Amz-Security-Token", cr.token)
+	}
+	req.Header.Set("Host", req.URL.Host)
+
+	nombres := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		nombres = append(nombres, strings.ToLower(k))
+	}
+	sort.Strings(nombres)
+	var cabeceras strings.Builder
+	for _, k := range nombres {
+		cabeceras.WriteString(k + ":" + strings.TrimSpace(req.Header.Get(k)) + "\n")
+	}
+	firmadas := strings.Join(nombres, ";")
+	suma := sha256.Sum256(body)
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonica := strings.Join([]string{req.Method, path, req.URL.RawQuery, cabeceras.String(), firmadas, hex.EncodeToString(suma[:])}, "\n")
+
+	ambito := fecha + "/" + region + "/" + service + "/aws4_request"
+	sumaCanonica := sha256.Sum256([]byte(canonica))
+	aFirmar := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + ambito + "\n" + hex.EncodeToString(sumaCanonica[:])
+
+	clave := []byte("AWS4" + cr.secretKey)
+	for _, p := range []string{fecha, region, service, "aws4_request"} {
+		clave = hmacSHA256(clave, p)
+	}
+	firma := hex.EncodeToString(hmacSHA256(clave, aFirmar))
+	req.Header.Del("Host")
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+cr.accessKey+"/"+ambito+", SignedHeaders="+firmadas+", Signature="+firma)
+}
+
+func hmacSHA256(clave []byte, s string) []byte {
+	h := hmac.New(sha256.New, clave)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
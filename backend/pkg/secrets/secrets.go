@@ -0,0 +1,13 @@
+// Package secrets lee la configuración sensible (dsn, token de la API
+// upstream) de un gestor de secretos en lugar de variables de entorno:
+// HashiCorp Vault o, en AWS, Secrets Manager y Parameter Store.
+package secrets
+
+import "context"
+
+// Provider es un gestor de secretos.
+type Provider interface {
+	// Secret devuelve el valor del secreto ref, con el formato de referencia
+	// de cada gestor (ver Vault.Secret y AWS.Secret).
+	Secret(ctx context.Context, ref string) (string, error)
+}
@@ -0,0 +1,355 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Valores por defecto de la autenticación de Kubernetes en Vault.
+const (
+	DefaultKubernetesMount     = "kubernetes"
+	DefaultKubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// Margen mínimo entre renovaciones, para no martillear Vault con TTL muy
+// cortos.
+const minRenovacion = 5 * time.Second
+
+// VaultConfig es la conexión y la autenticación con Vault. Con Token se usa
+// ese token; con KubernetesRole se inicia sesión con el token de la cuenta de
+// servicio del pod.
+type VaultConfig struct {
+	Addr      string
+	Namespace string
+
+	Token string
+
+	KubernetesRole      string
+	KubernetesMount     string
+	KubernetesTokenPath string
+}
+
+// Vault es un cliente mínimo de la API HTTP de HashiCorp Vault: inicio de
+// sesión, lectura de secretos (KV v1 y v2) y credenciales dinámicas de base
+// de datos, con renovación del token y de las leases (ver Run).
+type Vault struct {
+	cfg    VaultConfig
+	client *http.Client
+	// Logger recibe los avisos de la renovación; nil es slog.Default().
+	Logger *slog.Logger
+
+	mu        sync.Mutex
+	token     string
+	tokenTTL  time.Duration
+	renovable bool
+	creds     []*Credentials
+}
+
+// NewVault valida cfg y crea el cliente. No se conecta a Vault hasta
+// Login.
+func NewVault(cfg VaultConfig) (*Vault, error) {
+	u, err := url.Parse(cfg.Addr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid vault address %q: expected an http(s) URL", cfg.Addr)
+	}
+	cfg.Addr = strings.TrimSuffix(cfg.Addr, "/")
+	if cfg.Token == "" && cfg.KubernetesRole == "" {
+		return nil, errors.New("vault needs a token or a kubernetes role to authenticate")
+	}
+	if cfg.KubernetesMount == "" {
+		cfg.KubernetesMount = DefaultKubernetesMount
+	}
+	if cfg.KubernetesTokenPath == "" {
+		cfg.KubernetesTokenPath = DefaultKubernetesTokenPath
+	}
+	return &Vault{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// respuestaVault es el cuerpo de las respuestas de la API de Vault.
+type respuestaVault struct {
+	LeaseID       string         `json:"lease_id"`
+	LeaseDuration int            `json:"lease_duration"`
+	Renewable     bool           `json:"renewable"`
+	Data          map[string]any `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// pedir hace una petición a la API de Vault con el token de la sesión.
+func (v *Vault) pedir(ctx context.Context, method, path string, body any) (*respuestaVault, error) {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.cfg.Addr+"/v1/"+strings.TrimPrefix(path, "/"), rd)
+	if err != nil {
+		return nil, fmt.Errorf("error creating vault request: %w", err)
+	}
+	v.mu.Lock()
+	token := v.token
+	v.mu.Unlock()
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out respuestaVault
+	if resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil && resp.StatusCode == http.StatusOK {
+			return nil, fmt.Errorf("error parsing vault response: %w", err)
+		}
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("vault %s %s returned status %d: %s", method, path, resp.StatusCode, strings.Join(out.Errors, "; "))
+	}
+	return &out, nil
+}
+
+// Login inicia sesión en Vault. Con un token fijo comprueba que es válido y
+// averigua si se puede renovar.
+func (v *Vault) Login(ctx context.Context) error {
+	if v.cfg.KubernetesRole == "" {
+		v.mu.Lock()
+		v.token = v.cfg.Token
+		v.mu.Unlock()
+		resp, err := v.pedir(ctx, http.MethodGet, "auth/token/lookup-self", nil)
+		if err != nil {
+			return err
+		}
+		ttl, _ := resp.Data["ttl"].(float64)
+		renovable, _ := resp.Data["renewable"].(bool)
+		v.mu.Lock()
+		v.tokenTTL, v.renovable = time.Duration(ttl)*time.Second, renovable
+		v.mu.Unlock()
+		return nil
+	}
+
+	jwt, err := os.ReadFile(v.cfg.KubernetesTokenPath)
+	if err != nil {
+		return fmt.Errorf("error reading kubernetes service account token: %w", err)
+	}
+	resp, err := v.pedir(ctx, http.MethodPost, "auth/"+v.cfg.KubernetesMount+"/login", map[string]string{
+		"role": v.cfg.KubernetesRole,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return errors.New("vault kubernetes login returned no token")
+	}
+	v.mu.Lock()
+	v.token = resp.Auth.ClientToken
+	v.tokenTTL = time.Duration(resp.Auth.LeaseDuration) * time.Second
+	v.renovable = resp.Auth.Renewable
+	v.mu.Unlock()
+	return nil
+}
+
+// Secret devuelve el campo de un secreto, con ref de la forma ruta#campo
+// (p. ej. secret/data/prueba#dsn). En KV v2 la ruta lleva /data/.
+func (v *Vault) Secret(ctx context.Context, ref string) (string, error) {
+	path, campo, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || campo == "" {
+		return "", fmt.Errorf("invalid vault reference %q: expected path#field", ref)
+	}
+	resp, err := v.pedir(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return "", err
+	}
+	data := resp.Data
+	// KV v2 anida los valores en data.data junto a data.metadata
+	if interior, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = interior
+		}
+	}
+	s, ok := data[campo].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %q has no string field %q", path, campo)
+	}
+	return s, nil
+}
+
+// Credentials son credenciales dinámicas de base de datos de Vault. Run las
+// renueva y, cuando la lease llega a su TTL máximo, pide otras: Current
+// devuelve siempre las vigentes.
+type Credentials struct {
+	path string
+
+	mu       sync.Mutex
+	username string
+	password string
+	leaseID  string
+	ttl      time.Duration
+}
+
+// Current devuelve el usuario y la contraseña vigentes.
+func (c *Credentials) Current() (username, password string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.username, c.password
+}
+
+// TTL es la duración de la lease de las credenciales vigentes.
+func (c *Credentials) TTL() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttl
+}
+
+// DatabaseCredentials pide credenciales a un rol del motor de bases de datos
+// (p. ej. database/creds/prueba). Run las mantiene vigentes.
+func (v *Vault) DatabaseCredentials(ctx context.Context, path string) (*Credentials, error) {
+	c := &Credentials{path: path}
+	if err := v.pedirCredenciales(ctx, c); err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	v.creds = append(v.creds, c)
+	v.mu.Unlock()
+	return c, nil
+}
+
+func (v *Vault) pedirCredenciales(ctx context.Context, c *Credentials) error {
+	resp, err := v.pedir(ctx, http.MethodGet, c.path, nil)
+	if err != nil {
+		return err
+	}
+	user, _ := resp.Data["username"].(string)
+	pass, _ := resp.Data["password"].(string)
+	if user == "" || pass == "" {
+		return fmt.Errorf("vault %q returned no username or password", c.path)
+	}
+	c.mu.Lock()
+	c.username, c.password = user, pass
+	c.leaseID = resp.LeaseID
+	c.ttl = time.Duration(resp.LeaseDuration) * time.Second
+	c.mu.Unlock()
+	return nil
+}
+
+// renovarCredenciales renueva la lease de c. Si Vault ya no la alarga (llegó
+// a su TTL máximo) o la renovación falla, pide credenciales nuevas.
+func (v *Vault) renovarCredenciales(ctx context.Context, c *Credentials) error {
+	c.mu.Lock()
+	leaseID, ttl := c.leaseID, c.ttl
+	c.mu.Unlock()
+	if leaseID != "" {
+		resp, err := v.pedir(ctx, http.MethodPut, "sys/leases/renew", map[string]any{
+			"lease_id":  leaseID,
+			"increment": int(ttl.Seconds()),
+		})
+		if err == nil && time.Duration(resp.LeaseDuration)*time.Second >= ttl {
+			return nil
+		}
+		if err != nil {
+			v.log().Warn("No se pudo renovar la lease de las credenciales de base de datos, se piden otras", "path", c.path, "error", err)
+		}
+	}
+	return v.pedirCredenciales(ctx, c)
+}
+
+// renovarToken alarga el token de la sesión, o vuelve a iniciar sesión si no
+// es renovable (Kubernetes) o la renovación falla.
+func (v *Vault) renovarToken(ctx context.Context) error {
+	v.mu.Lock()
+	renovable := v.renovable
+	v.mu.Unlock()
+	if renovable {
+		resp, err := v.pedir(ctx, http.MethodPost, "auth/token/renew-self", map[string]any{})
+		if err == nil && resp.Auth != nil {
+			v.mu.Lock()
+			v.tokenTTL = time.Duration(resp.Auth.LeaseDuration) * time.Second
+			v.mu.Unlock()
+			return nil
+		}
+		if v.cfg.KubernetesRole == "" {
+			return err
+		}
+	}
+	if v.cfg.KubernetesRole == "" {
+		// Un token fijo no renovable no se puede alargar
+		return nil
+	}
+	return v.Login(ctx)
+}
+
+// proximaRenovacion es cuándo toca renovar: a dos tercios del TTL más corto
+// entre el token y las leases; 0 si nada caduca.
+func (v *Vault) proximaRenovacion() time.Duration {
+	v.mu.Lock()
+	ttl := v.tokenTTL
+	creds := v.creds
+	v.mu.Unlock()
+	for _, c := range creds {
+		if t := c.TTL(); t > 0 && (ttl == 0 || t < ttl) {
+			ttl = t
+		}
+	}
+	if ttl == 0 {
+		return 0
+	}
+	return max(ttl*2/3, minRenovacion)
+}
+
+// Run renueva el token y las credenciales dinámicas antes de que caduquen,
+// hasta que se cancele ctx. Los fallos se registran y se reintentan en la
+// siguiente vuelta.
+func (v *Vault) Run(ctx context.Context) {
+	for {
+		espera := v.proximaRenovacion()
+		if espera == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(espera):
+		}
+		if err := v.renovarToken(ctx); err != nil {
+			v.log().Error("Error renovando el token de Vault", "error", err)
+		}
+		v.mu.Lock()
+		creds := v.creds
+		v.mu.Unlock()
+		for _, c := range creds {
+			if err := v.renovarCredenciales(ctx, c); err != nil {
+				v.log().Error("Error renovando las credenciales de base de datos de Vault", "path", c.path, "error", err)
+			}
+		}
+	}
+}
+
+func (v *Vault) log() *slog.Logger {
+	if v.Logger != nil {
+		return v.Logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,60 @@
+package syncengine
+
+import (
+	"prueba/pkg/repository"
+	"prueba/pkg/scoring"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DailyStats agrupa los items por día (UTC). Las acciones de la API
+// son del estilo "upgraded by", "downgraded by", "target raised by"...
+func DailyStats(items []repository.Item) []repository.DailyStat {
+	type acumulado struct {
+		stat      repository.DailyStat
+		changeSum float64
+		changeN   int
+	}
+	porDia := map[time.Time]*acumulado{}
+
+	for _, it := range items {
+		t := it.Time.UTC()
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		acc, ok := porDia[day]
+		if !ok {
+			acc = &acumulado{stat: repository.DailyStat{Day: day}}
+			porDia[day] = acc
+		}
+
+		acc.stat.Total++
+		action := strings.ToLower(it.Action)
+		switch {
+		case strings.Contains(action, "upgraded"):
+			acc.stat.Upgrades++
+		case strings.Contains(action, "downgraded"):
+			acc.stat.Downgrades++
+		}
+		switch {
+		case strings.Contains(action, "raised"):
+			acc.stat.TargetsRaised++
+		case strings.Contains(action, "lowered"):
+			acc.stat.TargetsLowered++
+		}
+		if change, ok := scoring.TargetChange(it); ok {
+			acc.changeSum += change
+			acc.changeN++
+		}
+	}
+
+	out := make([]repository.DailyStat, 0, len(porDia))
+	for _, acc := range porDia {
+		if acc.changeN > 0 {
+			avg := acc.changeSum / float64(acc.changeN)
+			acc.stat.AvgTargetChange = &avg
+		}
+		out = append(out, acc.stat)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Day.Before(out[j].Day) })
+	return out
+}
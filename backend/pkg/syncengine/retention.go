@@ -0,0 +1,61 @@
+package syncengine
+
+import (
+	"context"
+	"prueba/pkg/repository"
+	"time"
+)
+
+// ApplyRetention descarta los items anteriores a now-retention y devuelve
+// los que quedan y el número de descartados. Lo que ya estaba guardado
+// fuera de la ventana (en el histórico, sobre todo) lo borra la etapa purge.
+func ApplyRetention(items []repository.Item, retention time.Duration, now time.Time) ([]repository.Item, int) {
+	if retention <= 0 {
+		return items, 0
+	}
+	corte := now.Add(-retention)
+	out := items[:0]
+	for _, it := range items {
+		if it.Time.Before(corte) {
+			continue
+		}
+		out = append(out, it)
+	}
+	return out, len(items) - len(out)
+}
+
+// DefaultPurgeBatch son las filas por sentencia al borrar los items fuera de
+// la retención si Engine.PurgeBatch es 0.
+const DefaultPurgeBatch = 1000
+
+// purgar borra de la base de datos los items del tenant, y su histórico,
+// anteriores a now-Retention. Los de items ya los quita Replace; los del
+// histórico solo se borran aquí, así que se hace en cada sincronización. Con
+// row-level TTL (repository.ItemTTL) los borra la base de datos y Purge no
+// hace nada.
+func (e *Engine) purgar(ctx context.Context, now time.Time) error {
+	lote := e.PurgeBatch
+	if lote <= 0 {
+		lote = DefaultPurgeBatch
+	}
+	corte := now.Add(-e.Retention)
+	n, err := e.Store.Items.Purge(ctx, corte, lote)
+	if n > 0 {
+		e.logger().InfoContext(ctx, "Items borrados por items_retention", "stage", StagePurge, "rows", n, "before", corte.Format(time.RFC3339))
+		if e.Hooks.ItemsPurged != nil {
+			e.Hooks.ItemsPurged(n)
+		}
+	}
+	return err
+}
+
+func (e *Engine) aplicarRetencion(ctx context.Context, items []repository.Item, now time.Time) []repository.Item {
+	items, n := ApplyRetention(items, e.Retention, now)
+	if n > 0 {
+		e.logger().InfoContext(ctx, "Items descartados por items_retention", "items", n, "before", now.Add(-e.Retention).Format(time.RFC3339))
+		if e.Hooks.ItemsExpired != nil {
+			e.Hooks.ItemsExpired(n)
+		}
+	}
+	return items
+}
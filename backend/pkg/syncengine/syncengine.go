@@ -0,0 +1,203 @@
+// Package syncengine es el refresco completo de los items: descarga todas las
+// páginas de la API upstream, reemplaza el contenido de la base de datos y
+// rehace las tablas resumen. No depende del servidor HTTP, así que otros
+// servicios pueden lanzar sincronizaciones con su propio Store.
+package syncengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"prueba/pkg/repository"
+	"prueba/pkg/upstream"
+	"time"
+)
+
+// Etapas de una sincronización, en el orden en que se ejecutan.
+const (
+	StageFetch         = "fetch"
+	StageReplace       = "replace"
+	StageHistory       = "history"
+	StagePurge         = "purge"
+	StageRefreshLatest = "refresh_latest"
+	StageDailyStats    = "daily_stats"
+)
+
+// Hooks son funciones opcionales con las que quien usa el motor observa la
+// sincronización (métricas, trazas...). Las que sean nil se ignoran.
+type Hooks struct {
+	// StageDone se llama al terminar cada etapa, haya ido bien o no.
+	StageDone func(stage string, d time.Duration)
+	// ItemsWritten se llama tras reemplazar los items con los escritos y los
+	// recibidos que no llegaron a escribirse.
+	ItemsWritten func(written, rejected int64)
+	// ItemsExpired se llama con los items descartados por la retención.
+	ItemsExpired func(n int)
+	// ItemsPurged se llama con las filas guardadas que se borraron por la
+	// retención.
+	ItemsPurged func(n int64)
+}
+
+// Engine ejecuta sincronizaciones contra Store con los items de Upstream.
+type Engine struct {
+	Store    *repository.Store
+	Upstream *upstream.Client
+	// Retention es la antigüedad máxima de los items que se guardan; 0 los
+	// guarda todos.
+	Retention time.Duration
+	// PurgeBatch son las filas por sentencia al borrar lo que queda fuera de
+	// Retention (0 = DefaultPurgeBatch).
+	PurgeBatch int
+	// Logger puede ser nil: se usa el logger por defecto de slog.
+	Logger *slog.Logger
+	Hooks  Hooks
+}
+
+// Result es lo que hizo una sincronización: los items insertados, el total
+// recibido de la API y el tiempo de cada etapa.
+type Result struct {
+	Inserted int64
+	Fetched  int
+	Stages   []repository.SyncStage
+}
+
+// ErrUpstreamUnavailable lo envuelve el error de Run cuando la API upstream no
+// responde o falla por su parte (es upstream.ErrUnavailable); la
+// sincronización se puede reintentar más tarde.
+var ErrUpstreamUnavailable = upstream.ErrUnavailable
+
+// Interrupted indica que la sincronización se canceló (p. ej. por un SIGTERM)
+// antes de empezar a escribir en la base de datos.
+type Interrupted struct {
+	Checkpoint repository.SyncCheckpoint
+}
+
+func (e *Interrupted) Error() string {
+	return fmt.Sprintf("sync interrupted after %d pages (%d items)", e.Checkpoint.PagesFetched, e.Checkpoint.ItemsFetched)
+}
+
+// Run hace el refresco completo: trae todas las páginas de la API y
+// reemplaza el contenido de la tabla items, y después actualiza las tablas
+// resumen (últimas valoraciones y estadísticas diarias). Los datos son los del
+// tenant de ctx (repository.WithTenant).
+//
+// generation es el id de la sync_run: el contenido resultante se guarda en el
+// histórico con esa generación para poder consultarlo después. Con
+// generation 0 (ejecución sin registrar) no se guarda.
+//
+// Cada etapa es un span (sync.fetch, sync.replace...) y su duración se
+// devuelve en Result.Stages, también si falla, junto con las de dentro:
+// fetch.fetch_page y fetch.validate por página y replace.upsert_chunk por
+// lote (ver repository.StartStage).
+//
+// La cancelación de ctx solo se respeta mientras se descargan páginas (error
+// *Interrupted): una vez que empieza la escritura en base de datos se termina.
+func (e *Engine) Run(ctx context.Context, params repository.SyncParams, generation int64) (res Result, err error) {
+	log := e.logger()
+	etapas := &repository.SyncStages{}
+	ctx = repository.WithSyncStages(ctx, etapas)
+	defer func() { res.Stages = etapas.List() }()
+
+	// Paso 1: Obtener TODOS los items desde la API
+	log.InfoContext(ctx, "Obteniendo items desde la API", "stage", StageFetch)
+	stageCtx, etapa := repository.StartStage(ctx, StageFetch)
+	fetched, cp, err := e.Upstream.FetchAll(stageCtx, params.Source)
+	e.terminar(StageFetch, etapa, err)
+	if ctx.Err() != nil {
+		return Result{Fetched: cp.ItemsFetched}, &Interrupted{Checkpoint: cp}
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("Error obteniendo items desde API: %w", err)
+	}
+	log.InfoContext(ctx, "Items obtenidos de la API", "stage", StageFetch, "items", len(fetched))
+	res = Result{Fetched: len(fetched)}
+
+	ctx = context.WithoutCancel(ctx)
+	fetched = e.aplicarRetencion(ctx, fetched, time.Now())
+
+	// Paso 2: Reemplazar el contenido de la tabla en una sola transacción, de
+	// modo que quien lea durante la sincronización vea los datos anteriores.
+	log.InfoContext(ctx, "Reemplazando items en una transacción", "stage", StageReplace)
+	stageCtx, etapa = repository.StartStage(ctx, StageReplace)
+	insertedCount, err := e.Store.Items.Replace(stageCtx, fetched)
+	e.terminar(StageReplace, etapa, err)
+	if err != nil {
+		e.escritos(0, int64(len(fetched)))
+		return res, fmt.Errorf("Error reemplazando items: %w", err)
+	}
+	e.escritos(insertedCount, int64(len(fetched))-insertedCount)
+	res.Inserted = insertedCount
+
+	// Las filas reemplazadas se conservan en el histórico
+	if generation != 0 {
+		stageCtx, etapa = repository.StartStage(ctx, StageHistory)
+		err = e.Store.Items.RecordGeneration(stageCtx, generation)
+		e.terminar(StageHistory, etapa, err)
+		if err != nil {
+			return res, fmt.Errorf("Error guardando el histórico de items: %w", err)
+		}
+	} else {
+		log.WarnContext(ctx, "Ejecución sin registrar: el histórico de items no se actualiza", "stage", StageHistory)
+	}
+
+	if e.Retention > 0 {
+		stageCtx, etapa = repository.StartStage(ctx, StagePurge)
+		err = e.purgar(stageCtx, time.Now())
+		e.terminar(StagePurge, etapa, err)
+		if err != nil {
+			return res, fmt.Errorf("Error borrando items fuera de la retención: %w", err)
+		}
+	}
+
+	// Paso 3: Rehacer la tabla resumen de últimas valoraciones
+	log.InfoContext(ctx, "Actualizando últimas valoraciones por ticker", "stage", StageRefreshLatest)
+	stageCtx, etapa = repository.StartStage(ctx, StageRefreshLatest)
+	err = e.Store.Items.RefreshLatest(stageCtx)
+	e.terminar(StageRefreshLatest, etapa, err)
+	if err != nil {
+		return res, fmt.Errorf("Error actualizando últimas valoraciones: %w", err)
+	}
+
+	// Paso 4: Actualizar el resumen diario con los días recibidos
+	log.InfoContext(ctx, "Actualizando estadísticas diarias", "stage", StageDailyStats)
+	stageCtx, etapa = repository.StartStage(ctx, StageDailyStats)
+	err = e.Store.Daily.Save(stageCtx, DailyStats(fetched))
+	e.terminar(StageDailyStats, etapa, err)
+	if err != nil {
+		return res, fmt.Errorf("Error actualizando estadísticas diarias: %w", err)
+	}
+
+	return res, nil
+}
+
+// IsInterrupted indica si err es (o envuelve) un *Interrupted y devuelve su
+// punto alcanzado.
+func IsInterrupted(err error) (repository.SyncCheckpoint, bool) {
+	var interrumpido *Interrupted
+	if errors.As(err, &interrumpido) {
+		return interrumpido.Checkpoint, true
+	}
+	return repository.SyncCheckpoint{}, false
+}
+
+func (e *Engine) logger() *slog.Logger {
+	if e.Logger != nil {
+		return e.Logger
+	}
+	return slog.Default()
+}
+
+// terminar cierra la etapa y avisa a Hooks.StageDone.
+func (e *Engine) terminar(stage string, etapa *repository.Stage, err error) {
+	d := etapa.End(err)
+	if e.Hooks.StageDone != nil {
+		e.Hooks.StageDone(stage, d)
+	}
+}
+
+func (e *Engine) escritos(written, rejected int64) {
+	if e.Hooks.ItemsWritten != nil {
+		e.Hooks.ItemsWritten(written, rejected)
+	}
+}
@@ -0,0 +1,300 @@
+// Package upstream es el cliente de la API de valoraciones de analistas de la
+// que se sincronizan los items.
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"prueba/pkg/repository"
+	"strings"
+	"time"
+)
+
+// ErrUnavailable se devuelve, envuelto, cuando la API no responde o responde
+// con un error suyo (5xx) o de límite de peticiones (429): el fallo no es de
+// la petición y puede resolverse reintentando.
+var ErrUnavailable = errors.New("upstream unavailable")
+
+// Response es una página de la API.
+type Response struct {
+	// Items se decodifican uno a uno para conservar el JSON original.
+	Items    []json.RawMessage `json:"items"`
+	NextPage string            `json:"next_page"`
+}
+
+// Item es un item tal y como lo devuelve la API: precios con formato
+// ("$1,234.50") y la hora en RFC3339.
+type Item struct {
+	Ticker     string `json:"ticker"`
+	TargetFrom string `json:"target_from"`
+	TargetTo   string `json:"target_to"`
+	Company    string `json:"company"`
+	Action     string `json:"action"`
+	Brokerage  string `json:"brokerage"`
+	RatingFrom string `json:"rating_from"`
+	RatingTo   string `json:"rating_to"`
+	Time       string `json:"time"`
+}
+
+// Hooks son funciones opcionales con las que quien usa el cliente observa la
+// descarga (métricas, trazas...). Las que sean nil se ignoran.
+type Hooks struct {
+	// PageFetched se llama tras cada petición de página con su duración, los
+	// items válidos recibidos y el error, si lo hubo.
+	PageFetched func(d time.Duration, items int, err error)
+	// ItemRejected se llama por cada item recibido que no se puede
+	// interpretar.
+	ItemRejected func(err error)
+}
+
+// Client descarga los items de la API. El valor cero sirve: usa
+// http.DefaultClient, sin token y con el logger por defecto de slog.
+type Client struct {
+	HTTP   *http.Client
+	Token  string
+	Logger *slog.Logger
+	Hooks  Hooks
+}
+
+// FetchPage descarga la página nextPage ("" es la primera) de source y
+// devuelve sus items y el token de la siguiente ("" si era la última). Los
+// items que no se pueden interpretar se descartan y se registran.
+func (c *Client) FetchPage(ctx context.Context, source, nextPage string) ([]repository.Item, string, error) {
+	return c.pagina(ctx, source, nextPage, 0)
+}
+
+// pagina es FetchPage con el número de página (desde 1; 0 si no se sabe) para
+// las etapas de la sincronización: fetch_page es la petición y validate la
+// interpretación de los items (ver repository.StartStage).
+func (c *Client) pagina(ctx context.Context, source, nextPage string, n int) (items []repository.Item, next string, err error) {
+	start := time.Now()
+	defer func() {
+		if c.Hooks.PageFetched != nil {
+			c.Hooks.PageFetched(time.Since(start), len(items), err)
+		}
+	}()
+
+	url := source
+	if nextPage != "" {
+		url = url + "?next_page=" + nextPage
+	}
+
+	fetchCtx, etapa := repository.StartStage(ctx, "fetch_page")
+	if n > 0 {
+		etapa.SetAttr("sync.page", n)
+	}
+	body, err := c.descargar(fetchCtx, url)
+	etapa.End(err)
+	if err != nil {
+		return nil, "", err
+	}
+
+	_, etapa = repository.StartStage(ctx, "validate")
+	if n > 0 {
+		etapa.SetAttr("sync.page", n)
+	}
+	items, next, err = c.interpretar(ctx, body)
+	etapa.SetAttr("sync.items", len(items))
+	etapa.End(err)
+	return items, next, err
+}
+
+// descargar hace la petición de una página y devuelve el cuerpo de la
+// respuesta si es un 200.
+func (c *Client) descargar(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Add("Authorization", c.Token)
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("error making request: %w", err)
+		}
+		return nil, fmt.Errorf("%w: error making request: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("%w: API returned status %d: %s", ErrUnavailable, resp.StatusCode, string(body))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// interpretar decodifica una página y convierte sus items; los que no se
+// pueden interpretar se descartan y se registran.
+func (c *Client) interpretar(ctx context.Context, body []byte) ([]repository.Item, string, error) {
+	var apiResponse Response
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, "", fmt.Errorf("error parsing response JSON: %w", err)
+	}
+
+	items := make([]repository.Item, 0, len(apiResponse.Items))
+	for _, raw := range apiResponse.Items {
+		var a Item
+		if err := json.Unmarshal(raw, &a); err != nil {
+			c.rechazar(ctx, "", err)
+			continue
+		}
+		it, err := ConvertItem(a, raw)
+		if err != nil {
+			c.rechazar(ctx, a.Ticker, err)
+			continue
+		}
+		items = append(items, it)
+	}
+	return items, apiResponse.NextPage, nil
+}
+
+// FetchAll recorre todas las páginas de source. Devuelve también el punto
+// alcanzado, que si el contexto se cancela entre páginas (error ctx.Err())
+// permite saber hasta dónde se llegó.
+func (c *Client) FetchAll(ctx context.Context, source string) ([]repository.Item, repository.SyncCheckpoint, error) {
+	var allItems []repository.Item
+	var cp repository.SyncCheckpoint
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, cp, err
+		}
+
+		items, np, err := c.pagina(ctx, source, cp.NextPage, cp.PagesFetched+1)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, cp, ctx.Err()
+			}
+			return nil, cp, err
+		}
+
+		allItems = append(allItems, items...)
+		cp.PagesFetched++
+		cp.ItemsFetched = len(allItems)
+
+		if np == "" {
+			break
+		}
+		cp.NextPage = np
+	}
+
+	return allItems, cp, nil
+}
+
+// Ping comprueba que la API responde: pide la primera página de source sin
+// leerla. Devuelve un error envuelto en ErrUnavailable si no responde o si
+// responde con un error suyo, y uno sin envolver si rechaza la petición
+// (token incorrecto...).
+func (c *Client) Ping(ctx context.Context, source string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", source, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Add("Authorization", c.Token)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: error making request: %w", ErrUnavailable, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: API returned status %d", ErrUnavailable, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) rechazar(ctx context.Context, ticker string, err error) {
+	l := c.Logger
+	if l == nil {
+		l = slog.Default()
+	}
+	if ticker != "" {
+		l = l.With("ticker", ticker)
+	}
+	l.WarnContext(ctx, "Item descartado", slog.Any("error", err))
+	if c.Hooks.ItemRejected != nil {
+		c.Hooks.ItemRejected(err)
+	}
+}
+
+// ConvertItem pasa un item de la API a su forma tipada, guardando raw como
+// su JSON original.
+func ConvertItem(a Item, raw json.RawMessage) (repository.Item, error) {
+	from, err := precioOpcional(a.TargetFrom)
+	if err != nil {
+		return repository.Item{}, fmt.Errorf("invalid target_from %q: %w", a.TargetFrom, err)
+	}
+	to, err := precioOpcional(a.TargetTo)
+	if err != nil {
+		return repository.Item{}, fmt.Errorf("invalid target_to %q: %w", a.TargetTo, err)
+	}
+	t, err := time.Parse(time.RFC3339Nano, a.Time)
+	if err != nil {
+		return repository.Item{}, fmt.Errorf("invalid time %q: %w", a.Time, err)
+	}
+	return repository.Item{
+		Ticker:     a.Ticker,
+		TargetFrom: from,
+		TargetTo:   to,
+		Company:    a.Company,
+		Action:     a.Action,
+		Brokerage:  a.Brokerage,
+		RatingFrom: textoOpcional(a.RatingFrom),
+		RatingTo:   textoOpcional(a.RatingTo),
+		Time:       t.UTC(),
+		Raw:        raw,
+	}, nil
+}
+
+// ParsePrice interpreta precios como "$1,234.50", sin pasar por float64.
+func ParsePrice(s string) (repository.Decimal, error) {
+	s = strings.NewReplacer("$", "", ",", "", " ", "").Replace(s)
+	return repository.ParseDecimal(s)
+}
+
+// precioOpcional es ParsePrice para campos que la API puede omitir: vacío
+// (o ausente) es nil, no un error.
+func precioOpcional(s string) (*repository.Decimal, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	v, err := ParsePrice(s)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// textoOpcional devuelve nil para los campos de texto vacíos o ausentes.
+func textoOpcional(s string) *string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	return &s
+}
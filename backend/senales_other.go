@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// Sin SIGUSR2 ni SIGHUP el relevo no está disponible y la configuración solo
+// se recarga con POST /admin/reload.
+var senalesRelevo, senalesRecarga []os.Signal
@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	// senalesRelevo son las señales que piden ceder el puerto a un proceso
+	// nuevo (server.Handover): SIGUSR2, como en nginx.
+	senalesRelevo = []os.Signal{syscall.SIGUSR2}
+	// senalesRecarga son las que piden recargar la configuración
+	// (server.Reload).
+	senalesRecarga = []os.Signal{syscall.SIGHUP}
+)
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// respuestaRegistrada envuelve el ResponseWriter para saber el código y el
+// tamaño de la respuesta. Mantiene Flush (lo necesitan los eventos SSE) y
+// Unwrap para http.ResponseController.
+type respuestaRegistrada struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *respuestaRegistrada) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *respuestaRegistrada) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *respuestaRegistrada) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *respuestaRegistrada) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// accessLogMiddleware registra cada petición al terminar: método, ruta,
+// código, latencia y tamaño de la respuesta, además del request_id que deja
+// en el contexto requestIDMiddleware. Los errores 5xx salen con nivel error.
+func accessLogMiddleware(l *slog.Logger) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := &respuestaRegistrada{ResponseWriter: w}
+			next.ServeHTTP(rw, r)
+
+			status := rw.status
+			if status == 0 {
+				// El handler no escribió nada: net/http responde 200
+				status = http.StatusOK
+			}
+			nivel := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				nivel = slog.LevelError
+			}
+			l.Log(r.Context(), nivel, "Petición HTTP",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", status,
+				"duration_ms", float64(time.Since(start).Microseconds())/1000,
+				"bytes", rw.bytes,
+				"remote_addr", r.RemoteAddr,
+			)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// servidorAdmin es el listener de administración (admin_addr), o nil si las
+// rutas de administración van en el listener principal.
+var servidorAdmin *http.Server
+
+// direccionAdmin lee admin_addr: la dirección del listener de los endpoints
+// de operación (gestión de sincronizaciones...), que así quedan fuera del
+// listener público al que llama el frontend. Debe llevar el host para que no
+// escuche por descuido en todas las interfaces: 127.0.0.1:9090 o la IP de la
+// red interna. Vacío es sin listener propio.
+func direccionAdmin() (string, error) {
+	v := os.Getenv("admin_addr")
+	if v == "" {
+		return "", nil
+	}
+	host, port, err := net.SplitHostPort(v)
+	if err != nil || host == "" || port == "" {
+		return "", fmt.Errorf("invalid admin_addr %q: expected host:port (e.g. 127.0.0.1:9090)", v)
+	}
+	return v, nil
+}
+
+// nuevoServidorAdmin crea el servidor del listener de administración con las
+// rutas de mux. Va en HTTP plano (solo escucha en local o en la red interna),
+// salvo con mtls, que lo pasa a HTTPS con certificado de cliente, y sin CORS
+// ni cabeceras para navegadores, que no lo usan. autenticar es el middleware
+// que identifica las peticiones (Server.autenticar) y tenant el que fija su
+// tenant (Server.tenantMiddleware).
+func nuevoServidorAdmin(cfg Config, mux *http.ServeMux, autenticar, tenant middleware) *http.Server {
+	comunes := encadenar(
+		requestIDMiddleware,
+		versionMiddleware,
+		metricasHTTPMiddleware,
+		trazasHTTPMiddleware,
+		idiomaMiddleware(cfg.DefaultLanguage),
+		accessLogMiddleware(logDe("admin")),
+		recuperarMiddleware,
+		limiteCuerpoMiddleware(int64(envInt("max_body_bytes", defaultMaxBodyBytes))),
+		comentarSQLMiddleware(),
+		autenticar,
+		tenant,
+	)
+	return &http.Server{
+		Addr:              cfg.AdminAddr,
+		Handler:           comunes.envolver(anotarRuta(mux)),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		TLSConfig:         tlsAdmin(cfg),
+		ErrorLog:          logErroresHTTP(logDe("admin")),
+	}
+}
+
+// tlsAdmin es la configuración TLS del listener de administración: la del
+// servidor con certificado de cliente si hay mtls, o nil (HTTP plano).
+func tlsAdmin(cfg Config) *tls.Config {
+	if cfg.MTLS == nil {
+		return nil
+	}
+	return cfg.MTLS.exigir(cfg.TLS)
+}
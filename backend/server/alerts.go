@@ -0,0 +1,285 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"prueba/internal/metrics"
+	"prueba/internal/redact"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Evento de los webhooks con el que se avisa de una alerta.
+const eventoAlerta = "alert.triggered"
+
+// Reglas de alerta: respuestas 5xx y sincronizaciones fallidas.
+const (
+	reglaHTTP5xx      = "http_5xx"
+	reglaSyncFallidas = "sync_failures"
+)
+
+// Ventana y tiempo mínimo entre dos avisos de la misma regla si no se
+// indican otros.
+const (
+	defaultAlertWindow   = 5 * time.Minute
+	defaultAlertCooldown = 15 * time.Minute
+)
+
+// Número de tramos en que se divide la ventana para contar: los eventos
+// salen de la cuenta en tramos de ventana/cubosVentana.
+const cubosVentana = 60
+
+var alertsFired = metrics.NewCounter("alerts_fired_total",
+	"Alertas de tasa de errores disparadas por regla.", "rule")
+
+// Alertas es la configuración de las alertas por tasa de errores (ver
+// alertasEntorno).
+type Alertas struct {
+	// HTTP5xx son las respuestas 5xx en la ventana que disparan la alerta;
+	// 0 la desactiva.
+	HTTP5xx int
+	// HTTP5xxRatio es además la fracción mínima de 5xx sobre el total de
+	// peticiones de la ventana; 0 no la exige.
+	HTTP5xxRatio float64
+	// SyncFailures son las sincronizaciones fallidas en la ventana que
+	// disparan la alerta; 0 la desactiva.
+	SyncFailures int
+	Window       time.Duration
+	Cooldown     time.Duration
+	// SlackURL es el incoming webhook de Slack al que se avisa, además de a
+	// los webhooks.
+	SlackURL string
+}
+
+// alertasEntorno lee la configuración de las alertas por tasa de errores,
+// para los despliegues sin un sistema de monitorización que las haga:
+// alert_http_5xx_threshold (respuestas 5xx, con alert_http_5xx_ratio
+// opcional: la fracción mínima sobre el total de peticiones) y
+// alert_sync_failures_threshold (sincronizaciones fallidas) en la ventana
+// alert_window. Cada regla avisa como mucho una vez cada alert_cooldown con
+// el evento alert.triggered de los webhooks y, con alert_slack_webhook_url,
+// con un mensaje en Slack.
+func alertasEntorno(webhooks []suscripcionWebhook) (Alertas, error) {
+	a := Alertas{Window: defaultAlertWindow, Cooldown: defaultAlertCooldown, SlackURL: os.Getenv("alert_slack_webhook_url")}
+	for _, v := range []struct {
+		nombre string
+		dest   *int
+	}{
+		{"alert_http_5xx_threshold", &a.HTTP5xx},
+		{"alert_sync_failures_threshold", &a.SyncFailures},
+	} {
+		s := os.Getenv(v.nombre)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return Alertas{}, fmt.Errorf("invalid %s %q: expected a non-negative number", v.nombre, s)
+		}
+		*v.dest = n
+	}
+	if v := os.Getenv("alert_http_5xx_ratio"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r < 0 || r > 1 {
+			return Alertas{}, fmt.Errorf("invalid alert_http_5xx_ratio %q: expected a number between 0 and 1", v)
+		}
+		a.HTTP5xxRatio = r
+	}
+	for _, v := range []struct {
+		nombre string
+		dest   *time.Duration
+	}{
+		{"alert_window", &a.Window},
+		{"alert_cooldown", &a.Cooldown},
+	} {
+		s := os.Getenv(v.nombre)
+		if s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return Alertas{}, fmt.Errorf("invalid %s %q: expected a positive duration", v.nombre, s)
+		}
+		*v.dest = d
+	}
+	if a.SlackURL != "" {
+		u, err := url.Parse(a.SlackURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return Alertas{}, fmt.Errorf("invalid alert_slack_webhook_url: expected an https URL")
+		}
+		// La URL del incoming webhook es la credencial
+		redact.Register(a.SlackURL)
+	}
+	if (a.HTTP5xx > 0 || a.SyncFailures > 0) && a.SlackURL == "" && len(webhooks) == 0 {
+		return Alertas{}, fmt.Errorf("alert thresholds require webhooks or alert_slack_webhook_url to deliver the alerts")
+	}
+	return a, nil
+}
+
+// alertasErrores cuenta los errores y avisa al superar los umbrales; nil si
+// no hay ninguna regla. Lo crea New.
+var alertasErrores *alertas
+
+// alertas lleva la cuenta de cada regla en su ventana y avisa por los
+// webhooks y Slack al superar el umbral. Un *alertas nil no cuenta nada.
+type alertas struct {
+	cfg      Alertas
+	webhooks *webhooks
+	slack    *http.Client
+
+	http5xx  *regla
+	syncFail *regla
+}
+
+// regla es una regla de alerta con la cuenta de su ventana.
+type regla struct {
+	nombre string
+	umbral int
+	ratio  float64
+
+	mu     sync.Mutex
+	cubos  [cubosVentana]cubo
+	ultima time.Time
+}
+
+// cubo es la cuenta de un tramo de la ventana que empieza en inicio.
+type cubo struct {
+	inicio  int64
+	total   int
+	errores int
+}
+
+// webhookAlerta son los datos del evento alert.triggered.
+type webhookAlerta struct {
+	Rule      string  `json:"rule"`
+	Errors    int     `json:"errors"`
+	Total     int     `json:"total"`
+	Threshold int     `json:"threshold"`
+	Ratio     float64 `json:"ratio,omitempty"`
+	Window    float64 `json:"window_seconds"`
+}
+
+func nuevasAlertas(cfg Alertas, wh *webhooks) *alertas {
+	if cfg.HTTP5xx == 0 && cfg.SyncFailures == 0 {
+		return nil
+	}
+	a := &alertas{cfg: cfg, webhooks: wh, slack: &http.Client{Timeout: envDuration("webhook_timeout", 10*time.Second)}}
+	if cfg.HTTP5xx > 0 {
+		a.http5xx = &regla{nombre: reglaHTTP5xx, umbral: cfg.HTTP5xx, ratio: cfg.HTTP5xxRatio}
+	}
+	if cfg.SyncFailures > 0 {
+		a.syncFail = &regla{nombre: reglaSyncFallidas, umbral: cfg.SyncFailures}
+	}
+	return a
+}
+
+// peticion cuenta una respuesta HTTP con su código.
+func (a *alertas) peticion(status int) {
+	if a == nil || a.http5xx == nil {
+		return
+	}
+	a.anotar(a.http5xx, status >= 500)
+}
+
+// sincronizacion cuenta una sincronización terminada.
+func (a *alertas) sincronizacion(fallida bool) {
+	if a == nil || a.syncFail == nil {
+		return
+	}
+	a.anotar(a.syncFail, fallida)
+}
+
+func (a *alertas) anotar(r *regla, fallo bool) {
+	errores, total, disparar := r.anotar(time.Now(), fallo, a.cfg.Window, a.cfg.Cooldown)
+	if !disparar {
+		return
+	}
+	alertsFired.Inc(r.nombre)
+	datos := webhookAlerta{
+		Rule:      r.nombre,
+		Errors:    errores,
+		Total:     total,
+		Threshold: r.umbral,
+		Ratio:     r.ratio,
+		Window:    a.cfg.Window.Seconds(),
+	}
+	logDe("alerts").Warn("Umbral de errores superado", "rule", r.nombre, "errors", errores, "total", total, "threshold", r.umbral, "window", a.cfg.Window)
+	a.webhooks.enviar(eventoAlerta, datos)
+	if a.cfg.SlackURL != "" {
+		go a.avisarSlack(datos)
+	}
+}
+
+// anotar cuenta un evento en el instante t y devuelve los errores y el total
+// de la ventana, y si hay que avisar: se supera el umbral y ha pasado el
+// cooldown desde el aviso anterior.
+func (r *regla) anotar(t time.Time, fallo bool, ventana, cooldown time.Duration) (int, int, bool) {
+	ancho := int64(ventana / cubosVentana)
+	if ancho <= 0 {
+		ancho = 1
+	}
+	inicio := t.UnixNano() / ancho * ancho
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := &r.cubos[(inicio/ancho)%cubosVentana]
+	if c.inicio != inicio {
+		*c = cubo{inicio: inicio}
+	}
+	c.total++
+	if fallo {
+		c.errores++
+	}
+	// Solo un fallo puede hacer que se supere el umbral
+	if !fallo {
+		return 0, 0, false
+	}
+
+	var errores, total int
+	desde := inicio - int64(ventana)
+	for _, c := range r.cubos {
+		if c.inicio > desde {
+			errores += c.errores
+			total += c.total
+		}
+	}
+	if errores < r.umbral || (r.ratio > 0 && float64(errores) < r.ratio*float64(total)) {
+		return errores, total, false
+	}
+	if !r.ultima.IsZero() && t.Sub(r.ultima) < cooldown {
+		return errores, total, false
+	}
+	r.ultima = t
+	return errores, total, true
+}
+
+// avisarSlack manda la alerta al incoming webhook de Slack. Es un solo
+// intento: si Slack no responde, el siguiente aviso llegará con la próxima
+// alerta.
+func (a *alertas) avisarSlack(d webhookAlerta) {
+	var texto string
+	switch d.Rule {
+	case reglaHTTP5xx:
+		texto = fmt.Sprintf(":rotating_light: %d respuestas 5xx de %d peticiones en los últimos %s (umbral %d)",
+			d.Errors, d.Total, a.cfg.Window, d.Threshold)
+	default:
+		texto = fmt.Sprintf(":rotating_light: %d sincronizaciones fallidas de %d en los últimos %s (umbral %d)",
+			d.Errors, d.Total, a.cfg.Window, d.Threshold)
+	}
+	cuerpo, _ := json.Marshal(map[string]string{"text": texto})
+	resp, err := a.slack.Post(a.cfg.SlackURL, "application/json", bytes.NewReader(cuerpo))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+	}
+	if err != nil {
+		logDe("alerts").Error("Error avisando a Slack", "rule", d.Rule, errAttr(err))
+	}
+}
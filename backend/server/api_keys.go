@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"prueba/internal/redact"
+	"prueba/pkg/repository"
+	"strings"
+)
+
+// apiKeyHeader es la cabecera con la clave de la API.
+const apiKeyHeader = "X-API-Key"
+
+// Longitud mínima de las claves de api_keys, para que no se puedan adivinar.
+const minAPIKey = 16
+
+// tenantPlataforma es el tenant de api_keys de los administradores de la
+// plataforma (ver identidad.Plataforma).
+const tenantPlataforma = "*"
+
+// claveEntorno es una clave de api_keys.
+type claveEntorno struct {
+	nombre     string
+	rol        string
+	tenant     string
+	plataforma bool
+}
+
+// clavesEntorno lee api_keys: claves de la API con su nombre y,
+// opcionalmente, su rol y su tenant, como
+// "frontend:clave:viewer:acme,cron:otra". Sin rol son admin y sin tenant son
+// del tenant por defecto. El tenant "*" (tenantPlataforma), solo con el rol
+// admin, es el de los administradores de la plataforma, que trabajan con
+// cualquier tenant indicándolo en X-Tenant-ID. Devuelve el hash de cada
+// clave (ver repository.HashAPIKey) con su nombre, rol y tenant. Las claves
+// de la tabla api_keys se aceptan además de estas.
+func clavesEntorno() (map[string]claveEntorno, error) {
+	out := map[string]claveEntorno{}
+	for _, v := range lista(os.Getenv("api_keys")) {
+		partes := strings.Split(v, ":")
+		for i := range partes {
+			partes[i] = strings.TrimSpace(partes[i])
+		}
+		if len(partes) < 2 || len(partes) > 4 || partes[0] == "" || partes[1] == "" {
+			return nil, fmt.Errorf("invalid api_keys: expected name:key, name:key:role or name:key:role:tenant entries separated by commas")
+		}
+		c := claveEntorno{nombre: partes[0], rol: rolAdmin, tenant: repository.TenantPorDefecto}
+		if len(partes) >= 3 {
+			if err := validarRol(partes[2]); err != nil {
+				return nil, fmt.Errorf("invalid api_keys: key %q: %w", c.nombre, err)
+			}
+			c.rol = partes[2]
+		}
+		if len(partes) == 4 && partes[3] == tenantPlataforma {
+			if c.rol != rolAdmin {
+				return nil, fmt.Errorf("invalid api_keys: key %q: tenant %q requires the %s role", c.nombre, tenantPlataforma, rolAdmin)
+			}
+			c.plataforma = true
+		} else if len(partes) == 4 {
+			if err := repository.ValidateTenant(partes[3]); err != nil {
+				return nil, fmt.Errorf("invalid api_keys: key %q: %w", c.nombre, err)
+			}
+			c.tenant = partes[3]
+		}
+		if len(partes[1]) < minAPIKey {
+			return nil, fmt.Errorf("invalid api_keys: key %q is shorter than %d characters", c.nombre, minAPIKey)
+		}
+		redact.Register(partes[1])
+		out[repository.HashAPIKey(partes[1])] = c
+	}
+	return out, nil
+}
+
+// clavesAPI valida las claves de la API contra las de api_keys y las de la
+// base de datos.
+type clavesAPI struct {
+	entorno map[string]claveEntorno
+	repo    repository.APIKeyRepository
+}
+
+// identificar devuelve la identidad de la clave, o repository.ErrNotFound si
+// no es válida.
+func (c *clavesAPI) identificar(ctx context.Context, clave string) (*identidad, error) {
+	hash := repository.HashAPIKey(clave)
+	for h, k := range c.entorno {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			return &identidad{Sujeto: k.nombre, Metodo: metodoAPIKey, Roles: []string{k.rol}, Tenant: k.tenant, Plataforma: k.plataforma}, nil
+		}
+	}
+	if c.repo == nil {
+		return nil, repository.ErrNotFound
+	}
+	k, err := c.repo.FindByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return &identidad{Sujeto: k.Name, Metodo: metodoAPIKey, Roles: []string{k.Role}, Tenant: k.Tenant}, nil
+}
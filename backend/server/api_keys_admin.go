@@ -0,0 +1,272 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"prueba/pkg/repository"
+	"regexp"
+	"strconv"
+)
+
+// Las claves que se crean son apiKeyPrefix seguido de 32 bytes aleatorios en
+// base64url; se guardan los primeros apiKeyShownPrefix caracteres para
+// reconocerlas.
+const (
+	apiKeyPrefix      = "ak_"
+	apiKeyShownPrefix = 10
+)
+
+// nombreClaveValido son los nombres de clave aceptados: sin ":" ni ",", que
+// separan los campos de api_keys y api_key_quotas.
+var nombreClaveValido = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.@-]{0,63}$`)
+
+// claveCreada es la respuesta de crear o rotar una clave: la única vez que se
+// devuelve la clave en claro.
+type claveCreada struct {
+	repository.APIKey
+	Key string `json:"key"`
+}
+
+// nuevaClaveAPI genera una clave aleatoria y devuelve la clave, su hash y su
+// principio.
+func nuevaClaveAPI() (clave, hash, prefijo string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	clave = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return clave, repository.HashAPIKey(clave), clave[:apiKeyShownPrefix], nil
+}
+
+// idClave lee el {id} de la ruta; responde 400 si no es válido.
+func idClave(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		errorHTTP(w, r, http.StatusBadRequest, msgAPIKeyIDInvalid)
+		return 0, false
+	}
+	return id, true
+}
+
+// claveDelTenant indica si la clave k es del tenant de la petición. Las de
+// otros tenants no se muestran ni se pueden modificar: un admin de un tenant
+// solo gestiona las suyas, y los de la plataforma eligen el tenant con
+// X-Tenant-ID.
+func claveDelTenant(r *http.Request, k *repository.APIKey) bool {
+	return k.Tenant == repository.TenantFrom(r.Context())
+}
+
+// claveDeLaPeticion devuelve la clave id si es del tenant de la petición;
+// si no, responde 404 como si no existiera.
+func (s *Server) claveDeLaPeticion(w http.ResponseWriter, r *http.Request, id int64) (*repository.APIKey, bool) {
+	k, err := s.store.APIKeys.Get(r.Context(), id)
+	if err == nil && !claveDelTenant(r, k) {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		responderErrorClave(w, r, id, err)
+		return nil, false
+	}
+	return k, true
+}
+
+// responderErrorClave responde al error de una operación sobre la clave id.
+func responderErrorClave(w http.ResponseWriter, r *http.Request, id int64, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		errorHTTP(w, r, http.StatusNotFound, msgAPIKeyNotFound, id)
+		return
+	}
+	responderError(w, r, msgAPIKeyError, err)
+}
+
+// listarClaves es GET /admin/api-keys: las claves de la base de datos del
+// tenant de la petición, también las revocadas (las de api_keys no
+// aparecen). Nunca incluye las claves, solo su principio.
+func (s *Server) listarClaves() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		todas, err := s.store.APIKeys.List(r.Context())
+		if err != nil {
+			responderError(w, r, msgAPIKeyError, err)
+			return
+		}
+		claves := []repository.APIKey{}
+		for _, k := range todas {
+			if claveDelTenant(r, &k) {
+				claves = append(claves, k)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(struct {
+			Keys []repository.APIKey `json:"keys"`
+		}{Keys: claves})
+	}
+}
+
+// crearClave es POST /admin/api-keys con {"name", "role", "tenant", "label"}:
+// crea una clave (rol viewer y el tenant de la petición si no se indican) y
+// la devuelve en claro en "key", la única vez; de ella solo se guarda el
+// hash. Un tenant distinto del de la petición se rechaza con 403.
+func (s *Server) crearClave() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name   string `json:"name"`
+			Role   string `json:"role"`
+			Tenant string `json:"tenant"`
+			Label  string `json:"label"`
+		}
+		if !decodificarJSON(w, r, &body) {
+			return
+		}
+		if body.Role == "" {
+			body.Role = rolViewer
+		}
+		tenant := repository.TenantFrom(r.Context())
+		if body.Tenant == "" {
+			body.Tenant = tenant
+		}
+		if body.Tenant != tenant {
+			errorHTTP(w, r, http.StatusForbidden, msgTenantForbidden, body.Tenant)
+			return
+		}
+		err := s.validarNuevaClave(body.Name, body.Role)
+		if err == nil {
+			err = repository.ValidateTenant(body.Tenant)
+		}
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgAPIKeyInvalid, err)
+			return
+		}
+
+		clave, hash, prefijo, err := nuevaClaveAPI()
+		if err != nil {
+			responderError(w, r, msgAPIKeyError, err)
+			return
+		}
+		k, err := s.store.APIKeys.Create(r.Context(), repository.APIKey{Name: body.Name, Role: body.Role, Tenant: body.Tenant, Label: body.Label, Prefix: prefijo}, hash)
+		if errors.Is(err, repository.ErrConflict) {
+			errorHTTP(w, r, http.StatusConflict, msgAPIKeyExists, body.Name)
+			return
+		}
+		if err != nil {
+			responderError(w, r, msgAPIKeyError, err)
+			return
+		}
+		s.log.InfoContext(r.Context(), "Clave de la API creada", "key_id", k.ID, "name", k.Name, "role", k.Role, "tenant", k.Tenant)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(claveCreada{APIKey: *k, Key: clave})
+	}
+}
+
+// validarNuevaClave comprueba el nombre y el rol de una clave nueva. Los
+// nombres de api_keys no se pueden repetir: serían la misma identidad.
+func (s *Server) validarNuevaClave(nombre, rol string) error {
+	if !nombreClaveValido.MatchString(nombre) {
+		return fmt.Errorf("name %q must be 1-64 letters, digits or _.@- characters", nombre)
+	}
+	for _, c := range s.cfg.APIKeys {
+		if c.nombre == nombre {
+			return fmt.Errorf("name %q is already used by a key in api_keys", nombre)
+		}
+	}
+	return validarRol(rol)
+}
+
+// editarClave es PATCH /admin/api-keys/{id} con {"label", "role"}: cambia la
+// etiqueta o el rol de una clave no revocada. Los cambios de rol quedan en el
+// registro de auditoría.
+func (s *Server) editarClave() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := idClave(w, r)
+		if !ok {
+			return
+		}
+		var patch repository.APIKeyPatch
+		if !decodificarJSON(w, r, &patch) {
+			return
+		}
+		if patch.Role != nil {
+			if err := validarRol(*patch.Role); err != nil {
+				errorHTTP(w, r, http.StatusBadRequest, msgAPIKeyInvalid, err)
+				return
+			}
+		}
+
+		antes, ok := s.claveDeLaPeticion(w, r, id)
+		if !ok {
+			return
+		}
+		k, err := s.store.APIKeys.Update(r.Context(), id, patch)
+		if err != nil {
+			responderErrorClave(w, r, id, err)
+			return
+		}
+		if k.Role != antes.Role {
+			s.log.InfoContext(r.Context(), "Rol de la clave de la API cambiado", "key_id", k.ID, "name", k.Name, "from", antes.Role, "to", k.Role)
+			s.auditoria.registrar(r, repository.AuditEvent{
+				Action: repository.AuditRoleChanged,
+				Detail: fmt.Sprintf("api key %q: %s -> %s", k.Name, antes.Role, k.Role),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(k)
+	}
+}
+
+// rotarClave es POST /admin/api-keys/{id}/rotate: genera otra clave con el
+// mismo nombre y rol y la devuelve en claro; la anterior deja de valer en el
+// momento.
+func (s *Server) rotarClave() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := idClave(w, r)
+		if !ok {
+			return
+		}
+		if _, ok := s.claveDeLaPeticion(w, r, id); !ok {
+			return
+		}
+		clave, hash, prefijo, err := nuevaClaveAPI()
+		if err != nil {
+			responderError(w, r, msgAPIKeyError, err)
+			return
+		}
+		k, err := s.store.APIKeys.Rotate(r.Context(), id, hash, prefijo)
+		if err != nil {
+			responderErrorClave(w, r, id, err)
+			return
+		}
+		s.log.InfoContext(r.Context(), "Clave de la API rotada", "key_id", k.ID, "name", k.Name)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(claveCreada{APIKey: *k, Key: clave})
+	}
+}
+
+// revocarClave es DELETE /admin/api-keys/{id}: la clave deja de aceptarse,
+// pero se conserva (GET /admin/api-keys la muestra con revoked_at).
+func (s *Server) revocarClave() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := idClave(w, r)
+		if !ok {
+			return
+		}
+		if _, ok := s.claveDeLaPeticion(w, r, id); !ok {
+			return
+		}
+		if err := s.store.APIKeys.Revoke(r.Context(), id); err != nil {
+			responderErrorClave(w, r, id, err)
+			return
+		}
+		s.log.InfoContext(r.Context(), "Clave de la API revocada", "key_id", id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
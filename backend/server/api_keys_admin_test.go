@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"prueba/pkg/repository"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// clavesPrueba es un APIKeyRepository en memoria.
+type clavesPrueba struct {
+	repository.APIKeyRepository
+
+	mu     sync.Mutex
+	claves []repository.APIKey
+}
+
+func (f *clavesPrueba) List(ctx context.Context) ([]repository.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]repository.APIKey(nil), f.claves...), nil
+}
+
+func (f *clavesPrueba) Get(ctx context.Context, id int64) (*repository.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, k := range f.claves {
+		if k.ID == id {
+			return &k, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (f *clavesPrueba) Create(ctx context.Context, k repository.APIKey, hash string) (*repository.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	k.ID = int64(len(f.claves) + 1)
+	f.claves = append(f.claves, k)
+	return &k, nil
+}
+
+func (f *clavesPrueba) Update(ctx context.Context, id int64, patch repository.APIKeyPatch) (*repository.APIKey, error) {
+	return f.Get(ctx, id)
+}
+
+func (f *clavesPrueba) Rotate(ctx context.Context, id int64, hash, prefix string) (*repository.APIKey, error) {
+	return f.Get(ctx, id)
+}
+
+func (f *clavesPrueba) Revoke(ctx context.Context, id int64) error {
+	_, err := f.Get(ctx, id)
+	return err
+}
+
+func TestAdministracionClavesPorTenant(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		handler    func(s *Server) http.HandlerFunc
+		wantStatus int
+		// wantTenant es el tenant de la clave creada.
+		wantTenant string
+	}{
+		{"crear sin tenant usa el de la petición", http.MethodPost, "/admin/api-keys", `{"name":"nueva"}`, (*Server).crearClave, http.StatusCreated, "acme"},
+		{"crear en el propio tenant", http.MethodPost, "/admin/api-keys", `{"name":"nueva","tenant":"acme"}`, (*Server).crearClave, http.StatusCreated, "acme"},
+		{"crear en otro tenant", http.MethodPost, "/admin/api-keys", `{"name":"nueva","tenant":"globex"}`, (*Server).crearClave, http.StatusForbidden, ""},
+		{"editar una clave de otro tenant", http.MethodPatch, "/admin/api-keys/2", `{"label":"mía"}`, (*Server).editarClave, http.StatusNotFound, ""},
+		{"rotar una clave de otro tenant", http.MethodPost, "/admin/api-keys/2/rotate", "", (*Server).rotarClave, http.StatusNotFound, ""},
+		{"revocar una clave de otro tenant", http.MethodDelete, "/admin/api-keys/2", "", (*Server).revocarClave, http.StatusNotFound, ""},
+		{"revocar una clave propia", http.MethodDelete, "/admin/api-keys/1", "", (*Server).revocarClave, http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claves := &clavesPrueba{claves: []repository.APIKey{
+				{ID: 1, Name: "acme-front", Role: rolViewer, Tenant: "acme"},
+				{ID: 2, Name: "globex-front", Role: rolViewer, Tenant: "globex"},
+			}}
+			s := &Server{
+				store: &repository.Store{APIKeys: claves},
+				log:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			mux := http.NewServeMux()
+			mux.Handle("POST /admin/api-keys", s.crearClave())
+			mux.Handle("PATCH /admin/api-keys/{id}", s.editarClave())
+			mux.Handle("POST /admin/api-keys/{id}/rotate", s.rotarClave())
+			mux.Handle("DELETE /admin/api-keys/{id}", s.revocarClave())
+
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r = r.WithContext(repository.WithTenant(r.Context(), "acme"))
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantTenant == "" {
+				return
+			}
+			var k claveCreada
+			if err := json.NewDecoder(w.Body).Decode(&k); err != nil {
+				t.Fatal(err)
+			}
+			if k.Tenant != tt.wantTenant {
+				t.Errorf("tenant = %q, want %q", k.Tenant, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestListarClavesPorTenant(t *testing.T) {
+	claves := &clavesPrueba{claves: []repository.APIKey{
+		{ID: 1, Name: "acme-front", Tenant: "acme"},
+		{ID: 2, Name: "globex-front", Tenant: "globex"},
+		{ID: 3, Name: "acme-cron", Tenant: "acme"},
+	}}
+	s := &Server{store: &repository.Store{APIKeys: claves}}
+
+	tests := []struct {
+		tenant string
+		want   []string
+	}{
+		{"acme", []string{"acme-front", "acme-cron"}},
+		{"globex", []string{"globex-front"}},
+		{repository.TenantPorDefecto, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tenant, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin/api-keys", nil)
+			r = r.WithContext(repository.WithTenant(r.Context(), tt.tenant))
+			w := httptest.NewRecorder()
+			s.listarClaves().ServeHTTP(w, r)
+
+			var body struct {
+				Keys []repository.APIKey `json:"keys"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, k := range body.Keys {
+				got = append(got, k.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("keys = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClavesEntornoPlataforma(t *testing.T) {
+	tests := []struct {
+		name           string
+		apiKeys        string
+		wantErr        bool
+		wantPlataforma bool
+		wantTenant     string
+	}{
+		{"admin de un tenant", "root:clave-0123456789abcdef:admin:acme", false, false, "acme"},
+		{"admin sin tenant", "root:clave-0123456789abcdef", false, false, repository.TenantPorDefecto},
+		{"admin de la plataforma", "ops:clave-0123456789abcdef:admin:*", false, true, repository.TenantPorDefecto},
+		{"viewer de la plataforma", "ops:clave-0123456789abcdef:viewer:*", true, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("api_keys", tt.apiKeys)
+			claves, err := clavesEntorno()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clavesEntorno() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			id, err := (&clavesAPI{entorno: claves}).identificar(context.Background(), "clave-0123456789abcdef")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id.Plataforma != tt.wantPlataforma || id.Tenant != tt.wantTenant {
+				t.Errorf("identidad = %+v, want Plataforma %v and tenant %q", id, tt.wantPlataforma, tt.wantTenant)
+			}
+		})
+	}
+}
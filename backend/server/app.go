@@ -0,0 +1,115 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"prueba/pkg/repository"
+	"prueba/pkg/syncengine"
+	"prueba/pkg/upstream"
+	"time"
+)
+
+// Server reúne las dependencias de los handlers HTTP y de la sincronización:
+// la configuración, los repositorios sobre el pool de conexiones, el motor de
+// sincronización con el cliente de la API upstream y el logger. Los handlers
+// son métodos suyos, así que se pueden montar con dependencias falsas.
+type Server struct {
+	cfg    Config
+	store  *repository.Store
+	engine *syncengine.Engine
+	// log es el logger de los handlers y logSync el de la sincronización
+	// (atributo component).
+	log     *slog.Logger
+	logSync *slog.Logger
+	// flags son los feature flags (ver featureFlags).
+	flags *featureFlags
+	// cache es la caché de respuestas de lectura; nil si está desactivada.
+	cache *cacheRespuestas
+	// claves son las claves de la API aceptadas (ver autenticar).
+	claves *clavesAPI
+	// cuotas cuenta y limita las peticiones de cada clave de la API.
+	cuotas *cuotasAPI
+	// auditoria es el registro de auditoría de seguridad; nil con
+	// audit_log=false.
+	auditoria *auditoria
+	// webhooks envía los webhooks firmados; nil sin destinos.
+	webhooks *webhooks
+	// latido avisa a heartbeat_url tras las sincronizaciones programadas;
+	// nil sin URL.
+	latido *latido
+	// bloqueos bloquea las cuentas con fallos seguidos en el inicio de
+	// sesión y en Basic auth; nil si está desactivado.
+	bloqueos *bloqueos
+	// upstream es la última comprobación de la API upstream de GET /status.
+	upstream *alcanceUpstream
+	// programador valida las credenciales del scheduler externo (POST
+	// /sync/scheduled), que además elige el tenant que sincroniza.
+	programador *schedulerAuth
+}
+
+// NewServer crea el Server con sus dependencias. client y logger pueden ser
+// nil: se usan http.DefaultClient y el logger por defecto de slog.
+func NewServer(cfg Config, store *repository.Store, client *http.Client, logger *slog.Logger) *Server {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logSync := componente(logger, "sync")
+	return &Server{
+		cfg:   cfg,
+		store: store,
+		engine: &syncengine.Engine{
+			Store: store,
+			Upstream: &upstream.Client{
+				HTTP:   client,
+				Token:  cfg.UpstreamToken,
+				Logger: logSync,
+				Hooks:  hooksUpstream,
+			},
+			Retention:  retencionItems(),
+			PurgeBatch: loteBorradoItems(),
+			Logger:     logSync,
+			Hooks:      hooksSync,
+		},
+		log:         componente(logger, "api"),
+		logSync:     logSync,
+		flags:       nuevosFeatureFlags(store.Flags),
+		cache:       nuevaCacheRespuestas(cfg.Redis),
+		claves:      &clavesAPI{entorno: cfg.APIKeys, repo: store.APIKeys},
+		cuotas:      nuevasCuotasAPI(cfg.Quotas, cfg.Redis),
+		auditoria:   nuevaAuditoria(store.Audit, cfg.TrustedProxies),
+		webhooks:    nuevosWebhooks(cfg.Webhooks),
+		latido:      nuevoLatido(cfg.HeartbeatURL),
+		bloqueos:    nuevosBloqueos(cfg.Lockout),
+		upstream:    &alcanceUpstream{},
+		programador: cargarSchedulerAuth(),
+	}
+}
+
+// hooksUpstream y hooksSync llevan a las métricas lo que ocurre durante la
+// sincronización.
+var (
+	hooksUpstream = upstream.Hooks{
+		PageFetched: func(d time.Duration, items int, err error) {
+			syncPageDuration.Observe(d.Seconds())
+			if err == nil {
+				syncPagesFetched.Inc()
+				syncItemsFetched.Add(float64(items))
+			}
+		},
+		ItemRejected: func(error) { syncItemsRejected.Inc() },
+	}
+	hooksSync = syncengine.Hooks{
+		StageDone: func(stage string, d time.Duration) {
+			syncStageDuration.Observe(d.Seconds(), stage)
+		},
+		ItemsWritten: func(written, rejected int64) {
+			syncItemsUpserted.Add(float64(written))
+			syncItemsRejected.Add(float64(rejected))
+		},
+		ItemsExpired: func(n int) { syncItemsExpired.Add(float64(n)) },
+		ItemsPurged:  func(n int64) { syncItemsPurged.Add(float64(n)) },
+	}
+)
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"prueba/internal/metrics"
+	"prueba/pkg/repository"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Eventos que esperan en cola a escribirse en el registro de auditoría.
+const auditQueueSize = 1024
+
+// Eventos que devuelve GET /admin/audit si no se indica ?limit=, y máximo.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+var auditErrors = metrics.NewCounter("audit_log_errors_total",
+	"Eventos de auditoría que no se pudieron guardar en la base de datos (quedan en los logs).")
+
+// auditoria guarda los eventos de seguridad en el registro de auditoría
+// (audit_log) y los deja también en los logs (component=audit). Se escriben
+// en segundo plano para no retrasar las peticiones; si la cola se llena, en
+// el momento, así que no se pierde ninguno. Un *auditoria nil no registra
+// nada (audit_log=false).
+type auditoria struct {
+	repo    repository.AuditLogRepository
+	proxies []netip.Prefix
+	cola    chan repository.AuditEvent
+	hecho   chan struct{}
+
+	// intervaloUso es cada cuánto se registra como mucho el uso de una misma
+	// clave de la API (audit_key_usage_interval).
+	intervaloUso time.Duration
+	mu           sync.Mutex
+	usoClaves    map[string]time.Time
+}
+
+// nuevaAuditoria crea el registro de auditoría sobre repo si audit_log no es
+// false, y arranca su escritor. proxies son los de trusted_proxies, para
+// saber la IP del cliente.
+func nuevaAuditoria(repo repository.AuditLogRepository, proxies []netip.Prefix) *auditoria {
+	if on, err := strconv.ParseBool(os.Getenv("audit_log")); err == nil && !on {
+		return nil
+	}
+	a := &auditoria{
+		repo:         repo,
+		proxies:      proxies,
+		cola:         make(chan repository.AuditEvent, auditQueueSize),
+		hecho:        make(chan struct{}),
+		intervaloUso: envDuration("audit_key_usage_interval", time.Minute),
+		usoClaves:    map[string]time.Time{},
+	}
+	go a.escribir()
+	return a
+}
+
+// escribir guarda los eventos de la cola hasta que cerrar la cierra.
+func (a *auditoria) escribir() {
+	defer close(a.hecho)
+	for ev := range a.cola {
+		a.guardar(ev)
+	}
+}
+
+func (a *auditoria) guardar(ev repository.AuditEvent) {
+	if err := a.repo.Append(context.Background(), ev); err != nil {
+		auditErrors.Inc()
+		logDe("audit").Error("Error guardando el evento de auditoría", "action", ev.Action, "request_id", ev.RequestID, errAttr(err))
+	}
+}
+
+// cerrar espera a que se escriban los eventos en cola. Va en cierres: nadie
+// registra ya eventos cuando se llama.
+func (a *auditoria) cerrar() {
+	if a == nil {
+		return
+	}
+	close(a.cola)
+	<-a.hecho
+}
+
+// registrar completa ev con los datos de la petición (hora, tenant, IP,
+// request_id, ruta y, si no los trae, la identidad) y lo guarda.
+func (a *auditoria) registrar(r *http.Request, ev repository.AuditEvent) {
+	if a == nil {
+		return
+	}
+	ctx := r.Context()
+	ev.Time = time.Now().UTC()
+	ev.Tenant = repository.TenantFrom(ctx)
+	if ip := ipCliente(r, a.proxies); ip.IsValid() {
+		ev.IP = ip.String()
+	}
+	ev.RequestID = RequestIDFrom(ctx)
+	if ev.Target == "" {
+		ev.Target = r.Method + " " + r.URL.Path
+	}
+	if id := identidadDe(ctx); id != nil && ev.Actor == "" {
+		ev.Actor, ev.AuthMethod = id.Sujeto, id.Metodo
+	}
+	logDe("audit").InfoContext(ctx, "Evento de auditoría",
+		"action", ev.Action,
+		"actor", ev.Actor,
+		"auth_method", ev.AuthMethod,
+		"ip", ev.IP,
+		"target", ev.Target,
+		"status", ev.Status,
+		"detail", ev.Detail,
+	)
+	select {
+	case a.cola <- ev:
+	default:
+		a.guardar(ev)
+	}
+}
+
+// usoClave registra el uso de la clave de la API de id, como mucho una vez
+// por intervaloUso y clave.
+func (a *auditoria) usoClave(r *http.Request, id *identidad) {
+	if a == nil {
+		return
+	}
+	ahora := time.Now()
+	a.mu.Lock()
+	ultimo, ok := a.usoClaves[id.Sujeto]
+	registrar := !ok || ahora.Sub(ultimo) >= a.intervaloUso
+	if registrar {
+		a.usoClaves[id.Sujeto] = ahora
+	}
+	a.mu.Unlock()
+	if registrar {
+		a.registrar(r, repository.AuditEvent{Action: repository.AuditAPIKeyUsed})
+	}
+}
+
+// acciones registra las peticiones que cambian algo (todas salvo GET y HEAD)
+// al terminar, con el código con el que se respondieron. Va tras la
+// autorización: los intentos denegados los registran requerirRol y
+// permitirIPs.
+func (a *auditoria) acciones() middleware {
+	if a == nil {
+		return nil
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rw := &respuestaRegistrada{ResponseWriter: w}
+			next.ServeHTTP(rw, r)
+			status := rw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			a.registrar(r, repository.AuditEvent{Action: repository.AuditAdminAction, Status: status})
+		})
+	}
+}
+
+// listarAuditoria es GET /admin/audit: los eventos del registro de
+// auditoría del tenant de la petición, del más reciente al más antiguo. Filtros opcionales: ?action=,
+// ?actor=, ?since= y ?until= (RFC 3339); ?before=<id> pagina y ?limit=
+// (hasta 1000) limita.
+func (s *Server) listarAuditoria() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := filtroAuditoria(r)
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgInvalidParam, err)
+			return
+		}
+		loc, err := zonaPeticion(r)
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgInvalidParam, err)
+			return
+		}
+		eventos, err := s.store.Audit.List(r.Context(), f)
+		if err != nil {
+			responderError(w, r, msgAuditError, err)
+			return
+		}
+		for i := range eventos {
+			fechaEnZona(&eventos[i].Time, loc)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(struct {
+			Events []repository.AuditEvent `json:"events"`
+		}{Events: eventos})
+	}
+}
+
+func filtroAuditoria(r *http.Request) (repository.AuditFilter, error) {
+	q := r.URL.Query()
+	f := repository.AuditFilter{Tenant: repository.TenantFrom(r.Context()), Action: q.Get("action"), Actor: q.Get("actor")}
+	var err error
+	if f.Limit, err = queryInt(r, "limit", defaultAuditLimit); err != nil {
+		return f, err
+	}
+	if f.Limit == 0 || f.Limit > maxAuditLimit {
+		return f, fmt.Errorf("invalid limit: must be between 1 and %d", maxAuditLimit)
+	}
+	before, err := queryInt(r, "before", 0)
+	if err != nil {
+		return f, err
+	}
+	f.Before = int64(before)
+	for _, p := range []struct {
+		nombre string
+		t      *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := q.Get(p.nombre); v != "" {
+			if *p.t, err = time.Parse(time.RFC3339, v); err != nil {
+				return f, fmt.Errorf("invalid %s %q: expected an RFC 3339 time", p.nombre, v)
+			}
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"prueba/pkg/repository"
+	"strings"
+)
+
+// Modos de api_key_auth: qué rutas exigen identificarse.
+const (
+	// authOff no exige credenciales en ninguna ruta (por defecto en
+	// development).
+	authOff = "off"
+	// authSync las exige en las escrituras (sincronizaciones, ediciones) y la
+	// administración (por defecto).
+	authSync = "sync"
+	// authAll las exige también en las lecturas.
+	authAll = "all"
+)
+
+// Métodos con los que se identifica una petición.
+const (
+	metodoAPIKey = "api_key"
+	metodoJWT    = "jwt"
+	metodoBasic  = "basic"
+	// metodoSession es un token de sesión de POST /auth/login y
+	// metodoPassword el propio inicio de sesión (en la auditoría).
+	metodoSession  = "session"
+	metodoPassword = "password"
+	// metodoMTLS es un certificado de cliente (ver ClientesMTLS).
+	metodoMTLS = "mtls"
+)
+
+// identidad es quien hace una petición autenticada.
+type identidad struct {
+	// Sujeto es el nombre de la clave de la API, el sub del JWT o el usuario.
+	Sujeto string
+	// Metodo es cómo se autenticó (metodoAPIKey, metodoJWT, metodoBasic,
+	// metodoSession o metodoMTLS).
+	Metodo string
+	// Roles son los roles del JWT (ver jwt_roles_claim) o el de la clave de
+	// la API (ver rbac.go).
+	Roles []string
+	// Usuario es el id de la cuenta de usuario con sesiones; 0 con el resto
+	// de métodos.
+	Usuario int64
+	// Tenant es el tenant al que está limitada: el de la clave de la API,
+	// el usuario, el claim del JWT (jwt_tenant_claim) o el cliente de
+	// mtls_clients, y el tenant por defecto si no indican ninguno. Ver
+	// tenantMiddleware.
+	Tenant string
+	// Plataforma indica un administrador de toda la instancia (una clave de
+	// api_keys con tenant "*"): es el único que elige tenant con
+	// X-Tenant-ID. Los admin de un tenant solo ven el suyo.
+	Plataforma bool
+}
+
+type claveIdentidad struct{}
+
+// identidadDe devuelve la identidad de la petición de ctx, o nil si es
+// anónima.
+func identidadDe(ctx context.Context) *identidad {
+	id, _ := ctx.Value(claveIdentidad{}).(*identidad)
+	return id
+}
+
+// modoAutenticacion lee api_key_auth (off, sync o all). Sin definir es off en
+// development, para el frontend de Vite, y sync en el resto.
+func modoAutenticacion(perfil string) (string, error) {
+	switch v := os.Getenv("api_key_auth"); v {
+	case "":
+		if perfil == ProfileDevelopment {
+			return authOff, nil
+		}
+		return authSync, nil
+	case authOff, authSync, authAll:
+		return v, nil
+	default:
+		return "", fmt.Errorf("invalid api_key_auth %q (valid: %s, %s, %s)", v, authOff, authSync, authAll)
+	}
+}
+
+// autenticar identifica la petición si trae credenciales y pone la
+// identidad en su contexto (y en los logs, como subject). Unas credenciales
+// inválidas se rechazan con 401 aunque la ruta no las exija; sin ninguna la
+// petición sigue como anónima y son requerirIdentidad, requerirRol y los
+// modos de api_key_auth los que deciden.
+//
+// Se aceptan claves de la API (X-API-Key), tokens de sesión de POST
+// /auth/login y JWT de usuario del issuer configurado (Authorization:
+// Bearer), con basic_auth_users, usuario y
+// contraseña (Authorization: Basic) y, con mtls, el certificado de cliente
+// de la conexión, que solo cuenta si no viene otra credencial; la clave
+// tiene prioridad si viene con otra credencial. Los rechazos y el uso de las claves quedan en el registro
+// de auditoría; los fallos seguidos de Basic auth bloquean temporalmente al
+// usuario (ver bloqueos).
+func (s *Server) autenticar(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var id *identidad
+		var err error
+		if clave := r.Header.Get(apiKeyHeader); clave != "" {
+			id, err = s.claves.identificar(r.Context(), clave)
+			if errors.Is(err, repository.ErrNotFound) {
+				logDe("auth").WarnContext(r.Context(), "Clave de la API rechazada")
+				authFailures.Inc(metodoAPIKey)
+				s.auditoria.registrar(r, repository.AuditEvent{Action: repository.AuditAuthFailure, AuthMethod: metodoAPIKey, Status: http.StatusUnauthorized})
+				errorHTTP(w, r, http.StatusUnauthorized, msgUnauthorized)
+				return
+			}
+		} else if token := bearerToken(r); strings.HasPrefix(token, sessionTokenPrefix) {
+			id, err = s.identificarSesion(r.Context(), token)
+			if errors.Is(err, repository.ErrNotFound) {
+				logDe("auth").WarnContext(r.Context(), "Token de sesión rechazado")
+				authFailures.Inc(metodoSession)
+				s.auditoria.registrar(r, repository.AuditEvent{Action: repository.AuditAuthFailure, AuthMethod: metodoSession, Status: http.StatusUnauthorized})
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				errorHTTP(w, r, http.StatusUnauthorized, msgUnauthorized)
+				return
+			}
+		} else if token != "" && s.cfg.JWT != nil && s.cfg.JWT.propio(token) {
+			id, err = s.cfg.JWT.identificar(r.Context(), token)
+			if errors.Is(err, errJWTInvalid) {
+				logDe("auth").WarnContext(r.Context(), "Token JWT rechazado", errAttr(err))
+				authFailures.Inc(metodoJWT)
+				s.auditoria.registrar(r, repository.AuditEvent{Action: repository.AuditAuthFailure, AuthMethod: metodoJWT, Status: http.StatusUnauthorized, Detail: err.Error()})
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				errorHTTP(w, r, http.StatusUnauthorized, msgUnauthorized)
+				return
+			}
+		} else if usuario, clave, ok := r.BasicAuth(); ok && s.cfg.BasicAuth != nil {
+			if s.rechazarBloqueada(w, r, metodoBasic, usuario) {
+				return
+			}
+			if id = s.cfg.BasicAuth.identificar(usuario, clave); id == nil {
+				logDe("auth").WarnContext(r.Context(), "Usuario o contraseña incorrectos", "user", usuario)
+				s.anotarFallo(r, metodoBasic, usuario)
+				s.auditoria.registrar(r, repository.AuditEvent{Action: repository.AuditAuthFailure, Actor: usuario, AuthMethod: metodoBasic, Status: http.StatusUnauthorized})
+				w.Header().Set("WWW-Authenticate", `Basic realm="api", charset="UTF-8"`)
+				errorHTTP(w, r, http.StatusUnauthorized, msgUnauthorized)
+				return
+			}
+			s.bloqueos.exito(metodoBasic, usuario)
+		} else if id = s.cfg.MTLS.identificar(r); id == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			responderError(w, r, msgAuthError, err)
+			return
+		}
+		if id.Tenant == "" {
+			id.Tenant = repository.TenantPorDefecto
+		}
+		// El tenant de la identidad mientras tenantMiddleware no compruebe
+		// X-Tenant-ID, para la auditoría del uso de la clave
+		ctx := context.WithValue(r.Context(), claveIdentidad{}, id)
+		ctx = repository.WithTenant(ctx, id.Tenant)
+		ctx = conLog(ctx, "subject", id.Sujeto)
+		r = r.WithContext(ctx)
+		if id.Metodo == metodoAPIKey {
+			s.auditoria.usoClave(r, id)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requerirIdentidad responde 401 a las peticiones anónimas.
+func requerirIdentidad(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identidadDe(r.Context()) == nil {
+			errorHTTP(w, r, http.StatusUnauthorized, msgUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
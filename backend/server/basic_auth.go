@@ -0,0 +1,94 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"prueba/pkg/repository"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Rol de los usuarios de basic_auth_users que no indican otro.
+const defaultBasicAuthRole = rolViewer
+
+// usuarioBasic es un usuario de basic_auth_users.
+type usuarioBasic struct {
+	hash   []byte
+	rol    string
+	tenant string
+}
+
+// autenticacionBasic valida usuario y contraseña (Authorization: Basic) contra
+// basic_auth_users, para instalaciones internas sin proveedor de identidad.
+// Las contraseñas se configuran con su hash bcrypt; como comprobar un hash
+// bcrypt es lento a propósito, se recuerda el SHA-256 de la última contraseña
+// correcta de cada usuario para no repetirlo en cada petición.
+type autenticacionBasic struct {
+	usuarios map[string]usuarioBasic
+
+	mu         sync.Mutex
+	verificada map[string][32]byte
+}
+
+// basicDesdeEntorno lee basic_auth_users: usuarios con el hash bcrypt de su
+// contraseña y, opcionalmente, su rol y su tenant, como
+// "ana:$2y$10$...:admin,luis:$2y$...:viewer:acme". Sin rol son viewer y sin
+// tenant del tenant por defecto. El hash se puede generar con htpasswd -nbB usuario
+// contraseña. Sin basic_auth_users devuelve nil.
+func basicDesdeEntorno() (*autenticacionBasic, error) {
+	v := lista(os.Getenv("basic_auth_users"))
+	if len(v) == 0 {
+		return nil, nil
+	}
+	a := &autenticacionBasic{usuarios: map[string]usuarioBasic{}, verificada: map[string][32]byte{}}
+	for _, e := range v {
+		partes := strings.Split(e, ":")
+		if len(partes) < 2 || len(partes) > 4 || partes[0] == "" {
+			return nil, fmt.Errorf("invalid basic_auth_users: expected user:bcrypt-hash, user:bcrypt-hash:role or user:bcrypt-hash:role:tenant entries separated by commas")
+		}
+		u := usuarioBasic{hash: []byte(partes[1]), rol: defaultBasicAuthRole, tenant: repository.TenantPorDefecto}
+		if _, err := bcrypt.Cost(u.hash); err != nil {
+			return nil, fmt.Errorf("invalid basic_auth_users: user %q: password must be a bcrypt hash: %w", partes[0], err)
+		}
+		if len(partes) >= 3 {
+			if err := validarRol(partes[2]); err != nil {
+				return nil, fmt.Errorf("invalid basic_auth_users: user %q: %w", partes[0], err)
+			}
+			u.rol = partes[2]
+		}
+		if len(partes) == 4 {
+			if err := repository.ValidateTenant(partes[3]); err != nil {
+				return nil, fmt.Errorf("invalid basic_auth_users: user %q: %w", partes[0], err)
+			}
+			u.tenant = partes[3]
+		}
+		a.usuarios[partes[0]] = u
+	}
+	return a, nil
+}
+
+// identificar devuelve la identidad del usuario, o nil si el usuario no
+// existe o la contraseña no es la suya.
+func (a *autenticacionBasic) identificar(usuario, clave string) *identidad {
+	u, ok := a.usuarios[usuario]
+	if !ok {
+		return nil
+	}
+	suma := sha256.Sum256([]byte(clave))
+	a.mu.Lock()
+	anterior, ok := a.verificada[usuario]
+	a.mu.Unlock()
+	if !ok || subtle.ConstantTimeCompare(anterior[:], suma[:]) != 1 {
+		if bcrypt.CompareHashAndPassword(u.hash, []byte(clave)) != nil {
+			return nil
+		}
+		a.mu.Lock()
+		a.verificada[usuario] = suma
+		a.mu.Unlock()
+	}
+	return &identidad{Sujeto: usuario, Metodo: metodoBasic, Roles: []string{u.rol}, Tenant: u.tenant}
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// defaultMaxBodyBytes es el tamaño máximo por defecto del cuerpo de las
+// peticiones (max_body_bytes). Los PATCH de items son de unos cientos de
+// bytes; el límite solo evita que un cuerpo enorme agote la memoria.
+const defaultMaxBodyBytes = 1 << 20
+
+// limiteCuerpoMiddleware limita el cuerpo de todas las peticiones a max
+// bytes. Si el Content-Length ya lo supera se responde 413 sin leer nada; si
+// no, el cuerpo se corta al llegar al límite y el handler recibe un
+// *http.MaxBytesError al leerlo (ver decodificarJSON).
+func limiteCuerpoMiddleware(max int64) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > max {
+				errorHTTP(w, r, http.StatusRequestEntityTooLarge, msgBodyTooLarge, max)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// decodificarJSON lee el cuerpo JSON de r en v. Si no se puede responde 413
+// (cuerpo por encima del límite) o 400 y devuelve false.
+func decodificarJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		errorHTTP(w, r, http.StatusRequestEntityTooLarge, msgBodyTooLarge, tooLarge.Limit)
+		return false
+	case err != nil:
+		errorHTTP(w, r, http.StatusBadRequest, msgInvalidJSON, err)
+		return false
+	}
+	return true
+}
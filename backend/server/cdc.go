@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"os"
+	"prueba/internal/metrics"
+	"prueba/pkg/repository"
+	"strconv"
+	"time"
+)
+
+// Espera entre reconexiones del changefeed, creciente hasta cdcMaxBackoff.
+const (
+	cdcBackoff    = time.Second
+	cdcMaxBackoff = time.Minute
+)
+
+// cdcIntentosCursor son las reconexiones seguidas que pueden fallar sin que
+// avance el cursor antes de descartarlo y seguir desde el momento actual (el
+// cursor puede haber caducado por el gc.ttlseconds de la tabla).
+const cdcIntentosCursor = 3
+
+// defaultCDCWindow es cuánto se agrupan los cambios de cada tenant antes de
+// invalidar su caché y avisar a sus clientes (cdc_coalesce_window).
+const defaultCDCWindow = time.Second
+
+var cdcChanges = metrics.NewCounter("cdc_changes_total",
+	"Cambios recibidos del changefeed de items por operación.", "op")
+
+// iniciarCDC consume el changefeed de items y publica los cambios en el hub
+// de eventos, de modo que los clientes en tiempo real se enteran también de
+// las filas escritas por otros servicios. Los cambios invalidan además las
+// respuestas del tenant en caché. Se activa con cdc_enabled=true.
+//
+// Al reconectar se reanuda desde la última marca resuelta en lugar de volver
+// a empezar, y los cambios de cada tenant se agrupan durante
+// cdc_coalesce_window: una sincronización que reescribe miles de filas
+// invalida la caché una vez, no una por fila.
+func iniciarCDC(ctx context.Context, feed repository.ItemChangeFeed, hub *eventHub, cache *cacheRespuestas) {
+	if on, _ := strconv.ParseBool(os.Getenv("cdc_enabled")); !on {
+		return
+	}
+	if feed == nil {
+		logDe("cdc").Warn("cdc_enabled ignorado: el backend de base de datos no soporta changefeeds")
+		return
+	}
+
+	cambios := make(chan repository.ItemChange, sseBuffer)
+	go agruparCambios(ctx, cambios, envDuration("cdc_coalesce_window", defaultCDCWindow), hub, cache)
+
+	go func() {
+		wait := cdcBackoff
+		cursor := ""
+		fallos := 0
+		for {
+			start := time.Now()
+			siguiente, err := feed.Watch(ctx, cursor, func(c repository.ItemChange) {
+				op := "upsert"
+				if c.After == nil {
+					op = "delete"
+				}
+				cdcChanges.Inc(op)
+				select {
+				case cambios <- c:
+				case <-ctx.Done():
+				}
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			if siguiente != cursor {
+				cursor, fallos = siguiente, 0
+			} else if cursor != "" {
+				if fallos++; fallos >= cdcIntentosCursor {
+					logDe("cdc").Warn("Descartado el cursor del changefeed: se pueden haber perdido cambios",
+						"cursor", cursor, errAttr(err))
+					cursor, fallos = "", 0
+				}
+			}
+			// Si el feed estuvo un rato funcionando se vuelve al backoff inicial.
+			if time.Since(start) > cdcMaxBackoff {
+				wait = cdcBackoff
+			}
+			logDe("cdc").Warn("Changefeed de items interrumpido, reconectando", "wait", wait, "cursor", cursor, errAttr(err))
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+			wait = min(wait*2, cdcMaxBackoff)
+		}
+	}()
+}
+
+// cambiosTenant son los cambios de un tenant pendientes de publicar, uno por
+// clave (el último) y en el orden en que llegaron.
+type cambiosTenant struct {
+	cambios  []repository.ItemChange
+	porClave map[string]int
+	// desbordado indica que hubo más cambios de los que caben en el buffer de
+	// un cliente: en lugar de publicarlos se le pide que recargue.
+	desbordado bool
+}
+
+func (p *cambiosTenant) agregar(c repository.ItemChange) {
+	if p.desbordado {
+		return
+	}
+	if i, ok := p.porClave[string(c.Key)]; ok {
+		p.cambios[i] = c
+		return
+	}
+	if len(p.cambios) == sseBuffer {
+		p.desbordado, p.cambios, p.porClave = true, nil, nil
+		return
+	}
+	p.porClave[string(c.Key)] = len(p.cambios)
+	p.cambios = append(p.cambios, c)
+}
+
+// agruparCambios acumula los cambios que llegan por cambios y cada ventana
+// invalida una vez la caché de cada tenant con cambios y publica sus eventos.
+func agruparCambios(ctx context.Context, cambios <-chan repository.ItemChange, ventana time.Duration, hub *eventHub, cache *cacheRespuestas) {
+	pendientes := map[string]*cambiosTenant{}
+	tick := time.NewTicker(ventana)
+	defer tick.Stop()
+	for {
+		select {
+		case c := <-cambios:
+			p := pendientes[c.Tenant]
+			if p == nil {
+				p = &cambiosTenant{porClave: map[string]int{}}
+				pendientes[c.Tenant] = p
+			}
+			p.agregar(c)
+		case <-tick.C:
+			for tenant, p := range pendientes {
+				publicarCambios(tenant, p, hub, cache)
+			}
+			clear(pendientes)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func publicarCambios(tenant string, p *cambiosTenant, hub *eventHub, cache *cacheRespuestas) {
+	cache.invalidar(tenant)
+	if p.desbordado {
+		hub.Publicar(evento{Tenant: tenant, Tipo: "items", Datos: struct {
+			Op string `json:"op"`
+		}{"reload"}})
+		return
+	}
+	for _, c := range p.cambios {
+		op := "upsert"
+		if c.After == nil {
+			op = "delete"
+		}
+		hub.Publicar(evento{Tenant: tenant, Tipo: "item", Datos: struct {
+			Op string `json:"op"`
+			repository.ItemChange
+		}{op, c}})
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"prueba/pkg/repository"
+	"testing"
+)
+
+func TestCambiosTenant(t *testing.T) {
+	cambio := func(clave string, after string) repository.ItemChange {
+		c := repository.ItemChange{Tenant: "acme", Key: json.RawMessage(`["acme","` + clave + `"]`)}
+		if after != "" {
+			c.After = json.RawMessage(after)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name        string
+		cambios     []repository.ItemChange
+		wantCambios []string
+	}{
+		{"uno", []repository.ItemChange{cambio("A", `{"v":1}`)}, []string{`{"v":1}`}},
+		{"la misma fila se queda con el último", []repository.ItemChange{
+			cambio("A", `{"v":1}`), cambio("B", `{"v":1}`), cambio("A", `{"v":2}`),
+		}, []string{`{"v":2}`, `{"v":1}`}},
+		{"borrado tras el cambio", []repository.ItemChange{
+			cambio("A", `{"v":1}`), cambio("A", ""),
+		}, []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &cambiosTenant{porClave: map[string]int{}}
+			for _, c := range tt.cambios {
+				p.agregar(c)
+			}
+			if p.desbordado {
+				t.Fatal("desbordado = true, want false")
+			}
+			if len(p.cambios) != len(tt.wantCambios) {
+				t.Fatalf("got %d changes, want %d", len(p.cambios), len(tt.wantCambios))
+			}
+			for i, c := range p.cambios {
+				if string(c.After) != tt.wantCambios[i] {
+					t.Errorf("change %d = %s, want %s", i, c.After, tt.wantCambios[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCambiosTenantDesbordado(t *testing.T) {
+	p := &cambiosTenant{porClave: map[string]int{}}
+	for i := range sseBuffer + 1 {
+		p.agregar(repository.ItemChange{Tenant: "acme", Key: json.RawMessage(fmt.Sprintf(`["acme","%d"]`, i))})
+	}
+	if !p.desbordado || len(p.cambios) != 0 {
+		t.Errorf("desbordado = %v with %d changes, want a reload instead of the changes", p.desbordado, len(p.cambios))
+	}
+}
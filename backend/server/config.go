@@ -0,0 +1,440 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"prueba/internal/logfile"
+	"prueba/internal/sentry"
+	"prueba/internal/tracing"
+	"prueba/pkg/cache"
+	"prueba/pkg/repository"
+	"prueba/pkg/scoring"
+	"prueba/pkg/secrets"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Valores por defecto de la configuración.
+const (
+	defaultPort            = "8080"
+	defaultShutdownTimeout = 30 * time.Second
+
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 60 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+)
+
+// Config es la configuración de la aplicación. LoadConfig la lee del entorno
+// al arrancar y la valida entera, de modo que un despliegue mal configurado
+// falla con la lista de lo que falta en lugar de con errores en la primera
+// petición.
+//
+// Los ajustes finos con valor por defecto (reintentos, timeouts, métricas...)
+// los lee cada componente con envInt/envDuration.
+type Config struct {
+	// Profile es el perfil de entorno (APP_ENV, ver LoadEnv); fija los
+	// valores por defecto de LogLevel y de los orígenes CORS.
+	Profile string
+	// LogLevel es el nivel de log (log_level): debug, info, warn o error.
+	LogLevel string
+	// LogFormat es el formato de los logs (log_format): json o text.
+	LogFormat string
+	// LogFile es el fichero de log con rotación (log_file, ver
+	// ficheroLogEntorno); nil escribe en la salida de error.
+	LogFile *logfile.Config
+	// LogSampling es el muestreo de los logs de debug
+	// (log_debug_sample_*, ver muestreoLogEntorno).
+	LogSampling MuestreoLog
+
+	// Port es el puerto HTTP (portback).
+	Port string
+	// ShutdownTimeout es la espera máxima al apagar (shutdown_timeout).
+	ShutdownTimeout time.Duration
+	// Timeouts del http.Server (http_read_header_timeout, http_read_timeout,
+	// http_write_timeout, http_idle_timeout); 0 es sin límite. Las respuestas
+	// de larga duración (eventos, sincronización) se saltan los de lectura y
+	// escritura con sinDeadline.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// TLS es el certificado con el que el servidor termina HTTPS (tls_cert y
+	// tls_key, o tls_cert_dir; ver tlsHTTP), o los de autocert. nil es HTTP
+	// plano.
+	TLS *tls.Config
+	// MTLS exige certificado de cliente en el listener de administración o
+	// en todos (mtls, ver mtlsEntorno); nil no lo pide.
+	MTLS *ClientesMTLS
+	// Autocert pide los certificados a Let's Encrypt (autocert_*, ver
+	// autocertHTTP); AutocertHTTPAddr es el listener opcional del reto
+	// HTTP-01.
+	Autocert         *autocert.Manager
+	AutocertHTTPAddr string
+	// ReusePort abre los listeners TCP con SO_REUSEPORT (reuse_port, ver
+	// Handover).
+	ReusePort bool
+	// UnixSocket es el socket Unix en el que se escucha además del puerto
+	// (unix_socket, ver socketUnix), con permisos UnixSocketMode.
+	UnixSocket     string
+	UnixSocketMode fs.FileMode
+	// AdminAddr es el listener de administración (admin_addr, ver
+	// direccionAdmin); vacío sirve esas rutas en el principal.
+	AdminAddr string
+	// Pprof monta los endpoints de profiling en el listener de
+	// administración (pprof, ver pprofEntorno).
+	Pprof bool
+	// Protocols son los protocolos del servidor principal (http2, h2c; ver
+	// protocolosHTTP).
+	Protocols *http.Protocols
+
+	// DBDriver es el backend de base de datos (db_driver); vacío es
+	// CockroachDB/PostgreSQL.
+	DBDriver string
+	// DSN es la conexión principal (dsn) y ReadDSN la réplica de lectura
+	// opcional (dsn_read).
+	DSN     string
+	ReadDSN string
+	// Tablas son el esquema y la tabla de items (db_schema, items_table).
+	Tablas repository.Tablas
+	// DBTLSMode y DBTLS vienen de db_tls_* (ver tlsBD).
+	DBTLSMode string
+	DBTLS     *tls.Config
+	// TenantIsolation es el modo de tenant_isolation.
+	TenantIsolation string
+
+	// UpstreamURL y UpstreamToken son la API de la que se sincronizan los
+	// items (url, token).
+	UpstreamURL   string
+	UpstreamToken string
+	// ReadyUpstream hace que GET /readyz compruebe también la API upstream
+	// (readyz_upstream, ver readyUpstreamEntorno).
+	ReadyUpstream bool
+	// MetricsToken es el token Bearer que exige GET /metrics (metrics_token,
+	// ver tokenMetricas); vacío no exige ninguno.
+	MetricsToken string
+	// DefaultLanguage es el idioma de los mensajes de la API si la petición no
+	// pide uno soportado con Accept-Language (default_language: es o en).
+	DefaultLanguage string
+	// CORS son los orígenes del frontend a los que se permite llamar a la API
+	// (cors_*, ver corsDesdeEntorno). En development el origen es por defecto
+	// el servidor de Vite.
+	CORS CORS
+	// RecommendationWeights son los pesos de la puntuación de
+	// /recommendations (recommendation_weights, ver pesosRecomendacion).
+	RecommendationWeights scoring.Weights
+	// FeatureFlags son los flags que fija feature_flags (ver flagsEntorno);
+	// los que no aparecen toman el valor del perfil.
+	FeatureFlags map[string]bool
+	// MaintenanceMode bloquea las escrituras (maintenance_mode, ver
+	// bloquearEnMantenimiento).
+	MaintenanceMode bool
+	// AuthMode es el modo de api_key_auth (off, sync o all; ver
+	// modoAutenticacion) y APIKeys las claves de api_keys por hash (ver
+	// clavesEntorno).
+	AuthMode string
+	APIKeys  map[string]claveEntorno
+	// JWT valida los tokens de usuario (jwt_*, ver jwtDesdeEntorno); nil si
+	// no se aceptan.
+	JWT *autenticacionJWT
+	// AdminAllowedCIDRs son las redes desde las que se aceptan las
+	// sincronizaciones y la administración (admin_allowed_cidrs, ver
+	// permitirIPs); vacío es desde cualquiera. TrustedProxies son los
+	// balanceadores cuyo X-Forwarded-For se cree (trusted_proxies, ver
+	// ipCliente); el de las conexiones por UnixSocket se cree siempre.
+	AdminAllowedCIDRs []netip.Prefix
+	TrustedProxies    []netip.Prefix
+	// Users es la configuración de las cuentas de usuario (user_registration,
+	// session_ttl).
+	Users Usuarios
+	// Lockout es el bloqueo de cuentas por fallos seguidos
+	// (auth_lockout_*, ver bloqueos).
+	Lockout Bloqueo
+	// CSRF exige el token CSRF en las escrituras (csrf_protection, ver
+	// protegerCSRF y csrfMiddleware).
+	CSRF bool
+	// Sentry es la configuración del envío de errores a Sentry (sentry_dsn,
+	// ver sentryEntorno); nil lo desactiva.
+	Sentry *sentry.Config
+	// Tracing es la configuración de las trazas de OpenTelemetry
+	// (otel_exporter_otlp_endpoint, ver trazasEntorno); nil las desactiva.
+	Tracing *tracing.Config
+	// Metrics es el envío de métricas a StatsD o DogStatsD (metrics_exporter,
+	// ver exportacionEntorno); nil deja solo GET /metrics.
+	Metrics *ExportacionMetricas
+	// Webhooks son los destinos de los webhooks firmados (webhooks, ver
+	// webhooksEntorno).
+	Webhooks []suscripcionWebhook
+	// Alerts son las alertas por tasa de errores (alert_*, ver
+	// alertasEntorno).
+	Alerts Alertas
+	// HeartbeatURL es la URL a la que se avisa tras cada sincronización
+	// programada correcta (heartbeat_url, ver heartbeatEntorno).
+	HeartbeatURL string
+	// Quotas son las cuotas de las claves de la API (api_key_quota*, ver
+	// cuotasEntorno).
+	Quotas Cuotas
+	// BasicAuth son los usuarios de basic_auth_users (ver
+	// basicDesdeEntorno); nil si no se acepta Basic.
+	BasicAuth *autenticacionBasic
+	// Redis es la caché compartida por las réplicas (redis_url, ver
+	// redisDesdeEntorno); nil guarda las respuestas en memoria.
+	Redis *cache.Redis
+	// SecretsProvider y Secrets son el gestor de secretos de
+	// secrets_provider (ver proveedorSecretos); Secrets es nil si los
+	// secretos vienen del entorno. New resuelve con él las referencias de
+	// dsn, dsn_read y token (resolverSecretos) y deja en DBCredentials las
+	// credenciales dinámicas de Vault, si las hay.
+	SecretsProvider string
+	Secrets         secrets.Provider
+	DBCredentials   *secrets.Credentials
+}
+
+// Addr es la dirección en la que escucha el servidor HTTP.
+func (c Config) Addr() string {
+	return ":" + c.Port
+}
+
+// LoadConfig lee y valida la configuración del entorno. Devuelve todos los
+// problemas encontrados a la vez: primero las variables obligatorias que
+// faltan (dsn, url) y después los valores inválidos.
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		Profile:         perfilActual(),
+		LogLevel:        os.Getenv("log_level"),
+		LogFormat:       os.Getenv("log_format"),
+		Port:            os.Getenv("portback"),
+		ShutdownTimeout: defaultShutdownTimeout,
+		DBDriver:        os.Getenv("db_driver"),
+		DSN:             os.Getenv("dsn"),
+		ReadDSN:         os.Getenv("dsn_read"),
+		Tablas:          repository.TablasPorDefecto,
+		UpstreamURL:     os.Getenv("url"),
+		UpstreamToken:   os.Getenv("token"),
+		MetricsToken:    os.Getenv("metrics_token"),
+	}
+
+	def := defaultsPerfil(cfg.Profile)
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = def.logLevel
+	}
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = def.logFormat
+	}
+
+	var missing []string
+	if cfg.DSN == "" {
+		missing = append(missing, "dsn")
+	}
+	if cfg.UpstreamURL == "" {
+		missing = append(missing, "url")
+	}
+	var errs []error
+	if len(missing) > 0 {
+		errs = append(errs, fmt.Errorf("missing required variables: %s", strings.Join(missing, ", ")))
+	}
+
+	switch cfg.LogLevel {
+	case logDebug, logInfo, logWarn, logError:
+	default:
+		errs = append(errs, fmt.Errorf("invalid log_level %q: expected debug, info, warn or error", cfg.LogLevel))
+	}
+	if cfg.LogFormat != logFormatJSON && cfg.LogFormat != logFormatText {
+		errs = append(errs, fmt.Errorf("invalid log_format %q: expected json or text", cfg.LogFormat))
+	}
+	if cfg.Port == "" {
+		cfg.Port = defaultPort
+	} else if n, err := strconv.Atoi(cfg.Port); err != nil || n <= 0 || n > 65535 {
+		errs = append(errs, fmt.Errorf("invalid portback %q", cfg.Port))
+	}
+	if v := os.Getenv("shutdown_timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("invalid shutdown_timeout %q", v))
+		}
+		cfg.ShutdownTimeout = d
+	}
+	timeoutHTTP := func(key string, def time.Duration) time.Duration {
+		v := os.Getenv(key)
+		if v == "" {
+			return def
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			errs = append(errs, fmt.Errorf("invalid %s %q", key, v))
+		}
+		return d
+	}
+	cfg.ReadHeaderTimeout = timeoutHTTP("http_read_header_timeout", defaultReadHeaderTimeout)
+	cfg.ReadTimeout = timeoutHTTP("http_read_timeout", defaultReadTimeout)
+	cfg.WriteTimeout = timeoutHTTP("http_write_timeout", defaultWriteTimeout)
+	cfg.IdleTimeout = timeoutHTTP("http_idle_timeout", defaultIdleTimeout)
+	if cfg.UpstreamURL != "" {
+		if u, err := url.Parse(cfg.UpstreamURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid url %q: expected an http(s) URL", cfg.UpstreamURL))
+		}
+	}
+
+	cfg.Tablas.Schema = os.Getenv("db_schema")
+	if v := os.Getenv("items_table"); v != "" {
+		cfg.Tablas.Items = v
+	}
+	if err := cfg.Tablas.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	var err error
+	if cfg.LogFile, err = ficheroLogEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.LogSampling, err = muestreoLogEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.DefaultLanguage, err = idiomaPorDefecto(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.CORS, err = corsDesdeEntorno(def.corsOrigin); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.RecommendationWeights, err = pesosRecomendacion(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.FeatureFlags, err = flagsEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.MaintenanceMode, err = modoMantenimiento(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.AuthMode, err = modoAutenticacion(cfg.Profile); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.APIKeys, err = clavesEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.JWT, err = jwtDesdeEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Quotas, err = cuotasEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Users, err = usuariosEntorno(cfg.Profile); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Lockout, err = bloqueoEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.ReadyUpstream, err = readyUpstreamEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Webhooks, err = webhooksEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Alerts, err = alertasEntorno(cfg.Webhooks); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.HeartbeatURL, err = heartbeatEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Sentry, err = sentryEntorno(cfg.Profile); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Tracing, err = trazasEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Metrics, err = exportacionEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.AdminAllowedCIDRs, err = prefijosEntorno("admin_allowed_cidrs"); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.TrustedProxies, err = prefijosEntorno("trusted_proxies"); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.BasicAuth, err = basicDesdeEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Redis, err = redisDesdeEntorno(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.SecretsProvider, cfg.Secrets, err = proveedorSecretos(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, validarSecretos(cfg)...)
+	if cfg.TLS, err = tlsHTTP(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Autocert, cfg.AutocertHTTPAddr, err = autocertHTTP(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Autocert != nil {
+		if cfg.TLS != nil {
+			errs = append(errs, errors.New("autocert_domains cannot be combined with tls_cert, tls_key or tls_cert_dir"))
+		}
+		cfg.TLS = tlsAutocert(cfg.Autocert)
+	}
+	if cfg.ReusePort, err = reutilizarPuerto(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.UnixSocket, cfg.UnixSocketMode, err = socketUnix(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.AdminAddr, err = direccionAdmin(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Pprof, err = pprofEntorno(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.MTLS, err = mtlsEntorno(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.MTLS != nil && cfg.MTLS.Alcance == mtlsAll {
+		cfg.TLS = cfg.MTLS.exigir(cfg.TLS)
+	}
+	if cfg.CSRF, err = protegerCSRF(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Protocols, err = protocolosHTTP(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.DBTLSMode, cfg.DBTLS, err = tlsBD(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.TenantIsolation, err = aislamientoTenants(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.TenantIsolation == aislamientoRLS && cfg.DBDriver != "" && cfg.DBDriver != "postgres" {
+		errs = append(errs, fmt.Errorf("tenant_isolation=rls is not supported by %s", cfg.DBDriver))
+	}
+	// Con api_key_auth=off el tenant lo elige la cabecera del cliente (ver
+	// tenantMiddleware): las políticas no aislarían nada
+	if cfg.TenantIsolation == aislamientoRLS && cfg.AuthMode == authOff {
+		errs = append(errs, errors.New("tenant_isolation=rls requires api_key_auth=sync or all: the tenant must come from an authenticated identity"))
+	}
+
+	if len(errs) > 0 {
+		return cfg, fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return cfg, nil
+}
+
+// Scheme es el esquema de las URLs del servidor: https si termina TLS.
+func (c Config) Scheme() string {
+	if c.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// rls indica si el aislamiento de tenants es por row-level security.
+func (c Config) rls() bool {
+	return c.TenantIsolation == aislamientoRLS
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Valores por defecto de la política CORS.
+var (
+	defaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	defaultCORSHeaders = []string{"Content-Type", "Authorization", "If-Match", "Accept-Language", tenantHeader, requestIDHeader, apiKeyHeader, csrfHeader}
+)
+
+const defaultCORSMaxAge = 10 * time.Minute
+
+// CORS es la política CORS de la API.
+type CORS struct {
+	// Origins son los orígenes permitidos (cors_origins, separados por
+	// comas). "*" permite cualquiera (modo desarrollo) y
+	// "https://*.example.com" cualquier subdominio de example.com.
+	Origins []string
+	// Methods y Headers son los métodos y cabeceras que se permiten en las
+	// peticiones preflight (cors_methods, cors_headers).
+	Methods []string
+	Headers []string
+	// Credentials permite enviar cookies y cabeceras de autenticación
+	// (cors_credentials). No se admite con "*" ni con un comodín sobre un
+	// dominio de primer nivel: cualquier web podría leer con las
+	// credenciales del usuario, incluido el token de GET /auth/csrf.
+	Credentials bool
+	// MaxAge es lo que el navegador puede cachear la respuesta preflight
+	// (cors_max_age); 0 no la manda.
+	MaxAge time.Duration
+}
+
+// corsDesdeEntorno lee la política CORS de cors_*. Si cors_origins está
+// vacío se usa urlfront y, si tampoco está, defOrigin (el del perfil).
+func corsDesdeEntorno(defOrigin string) (CORS, error) {
+	c := CORS{
+		Origins: lista(os.Getenv("cors_origins")),
+		Methods: defaultCORSMethods,
+		Headers: defaultCORSHeaders,
+		MaxAge:  defaultCORSMaxAge,
+	}
+	if len(c.Origins) == 0 {
+		c.Origins = lista(os.Getenv("urlfront"))
+	}
+	if len(c.Origins) == 0 {
+		c.Origins = lista(defOrigin)
+	}
+	for _, o := range c.Origins {
+		if err := validarOrigen(o); err != nil {
+			return c, err
+		}
+	}
+
+	if v := lista(os.Getenv("cors_methods")); len(v) > 0 {
+		c.Methods = v
+		for i, m := range c.Methods {
+			c.Methods[i] = strings.ToUpper(m)
+		}
+	}
+	if v := lista(os.Getenv("cors_headers")); len(v) > 0 {
+		c.Headers = v
+	}
+	if v := os.Getenv("cors_credentials"); v != "" {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid cors_credentials %q", v)
+		}
+		c.Credentials = on
+	}
+	if c.Credentials {
+		for _, o := range c.Origins {
+			if err := validarOrigenConCredenciales(o); err != nil {
+				return c, err
+			}
+		}
+	}
+	if v := os.Getenv("cors_max_age"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return c, fmt.Errorf("invalid cors_max_age %q", v)
+		}
+		c.MaxAge = d
+	}
+	return c, nil
+}
+
+// lista parte una lista separada por comas, sin elementos vacíos.
+func lista(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// validarOrigen comprueba que o sea "*" o un origen scheme://host[:puerto],
+// con "*." opcional al principio del host.
+func validarOrigen(o string) error {
+	if o == "*" {
+		return nil
+	}
+	u, err := url.Parse(strings.Replace(o, "://*.", "://comodin.", 1))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return fmt.Errorf("invalid CORS origin %q: expected scheme://host[:port]", o)
+	}
+	return nil
+}
+
+// validarOrigenConCredenciales comprueba que o no permita orígenes
+// arbitrarios con cors_credentials=true: ni "*" ni "https://*.com".
+func validarOrigenConCredenciales(o string) error {
+	if o == "*" {
+		return fmt.Errorf("cors_origins=* cannot be combined with cors_credentials=true: list the allowed origins")
+	}
+	if _, dominio, ok := strings.Cut(o, "://*."); ok && !strings.Contains(strings.TrimSuffix(dominio, "/"), ".") {
+		return fmt.Errorf("invalid CORS origin %q with cors_credentials=true: the wildcard must be under a registered domain", o)
+	}
+	return nil
+}
+
+// permitido indica si el origen de la petición está en la lista.
+func (c CORS) permitido(origin string) bool {
+	for _, o := range c.Origins {
+		o = strings.TrimSuffix(o, "/")
+		switch {
+		case o == "*", strings.EqualFold(o, origin):
+			return true
+		case strings.Contains(o, "://*."):
+			// https://*.example.com: mismo esquema y el host termina en
+			// .example.com
+			scheme, dominio, _ := strings.Cut(o, "://*")
+			rest, ok := strings.CutPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://")
+			if ok && strings.HasSuffix(rest, strings.ToLower(dominio)) && len(rest) > len(dominio) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// corsMiddleware aplica la política en vigor de actual (que Reload puede
+// cambiar): si el Origin de la petición está permitido se devuelve tal cual
+// en Access-Control-Allow-Origin (nunca "*", para que funcione también con
+// credenciales). Las peticiones preflight (OPTIONS) se responden aquí sin
+// llegar al mux.
+func corsMiddleware(actual *atomic.Pointer[CORS]) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := actual.Load()
+			w.Header().Add("Vary", "Origin")
+
+			origin := r.Header.Get("Origin")
+			if origin != "" && c.permitido(origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				if c.Credentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+				w.Header().Set("Access-Control-Expose-Headers", "ETag, Retry-After, "+requestIDHeader+", "+versionHeader)
+
+				if r.Method == http.MethodOptions {
+					w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.Methods, ", "))
+					w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.Headers, ", "))
+					if c.MaxAge > 0 {
+						w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+					}
+				}
+			}
+
+			// Peticiones preflight (OPTIONS)
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCorsDesdeEntorno(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     string
+		credentials string
+		wantErr     string
+	}{
+		{"origen concreto", "https://app.example.com", "", ""},
+		{"comodín sin credenciales", "*", "", ""},
+		{"comodín con credenciales", "*", "true", "cannot be combined"},
+		{"subdominios con credenciales", "https://*.example.com", "true", ""},
+		{"dominio de primer nivel con credenciales", "https://*.com", "true", "registered domain"},
+		{"dominio de primer nivel sin credenciales", "https://*.com", "false", ""},
+		{"lista con un comodín", "https://app.example.com, *", "true", "cannot be combined"},
+		{"sin esquema", "app.example.com", "", "invalid CORS origin"},
+		{"con ruta", "https://app.example.com/api", "", "invalid CORS origin"},
+		{"cors_credentials no válido", "https://app.example.com", "quizá", "invalid cors_credentials"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("cors_origins", tt.origins)
+			t.Setenv("cors_credentials", tt.credentials)
+			_, err := corsDesdeEntorno("")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("corsDesdeEntorno() = %v, want no error", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("corsDesdeEntorno() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCorsMiddlewarePreflight(t *testing.T) {
+	c := &CORS{
+		Origins:     []string{"https://*.example.com"},
+		Methods:     defaultCORSMethods,
+		Headers:     defaultCORSHeaders,
+		Credentials: true,
+		MaxAge:      defaultCORSMaxAge,
+	}
+	var actual atomic.Pointer[CORS]
+	actual.Store(c)
+	h := corsMiddleware(&actual)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the preflight request reached the handler")
+	}))
+
+	tests := []struct {
+		name       string
+		origin     string
+		method     string
+		wantOrigin string
+	}{
+		{"PUT desde un subdominio", "https://app.example.com", "PUT", "https://app.example.com"},
+		{"DELETE desde un subdominio", "https://app.example.com", "DELETE", "https://app.example.com"},
+		{"otro esquema", "http://app.example.com", "PUT", ""},
+		{"otro dominio", "https://example.com.evil.io", "DELETE", ""},
+		{"el dominio sin subdominio", "https://example.com", "PUT", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodOptions, "/items", nil)
+			r.Header.Set("Origin", tt.origin)
+			r.Header.Set("Access-Control-Request-Method", tt.method)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if tt.wantOrigin == "" {
+				return
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, tt.method) {
+				t.Errorf("Access-Control-Allow-Methods = %q, want it to include %s", got, tt.method)
+			}
+		})
+	}
+}
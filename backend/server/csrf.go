@@ -0,0 +1,99 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"prueba/pkg/repository"
+	"strconv"
+	"strings"
+)
+
+// Cookie y cabecera del token CSRF (double-submit cookie).
+const (
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// protegerCSRF indica si las peticiones que cambian datos exigen el token
+// CSRF (csrf_protection). Por defecto solo cuando el navegador puede mandar
+// credenciales sin que las ponga el frontend: con cors_credentials=true
+// (cookies), con basic_auth_users (el navegador recuerda el usuario) o con
+// mtls=all (el certificado de cliente del navegador).
+func protegerCSRF(cfg Config) (bool, error) {
+	v := os.Getenv("csrf_protection")
+	if v == "" {
+		return cfg.CORS.Credentials || cfg.BasicAuth != nil || (cfg.MTLS != nil && cfg.MTLS.Alcance == mtlsAll), nil
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid csrf_protection %q", v)
+	}
+	return on, nil
+}
+
+// csrfMiddleware exige en POST, PUT, PATCH y DELETE que la cabecera
+// X-CSRF-Token coincida con la cookie csrf_token (ver getAuthCSRF): otra web
+// puede hacer que el navegador mande la cookie, pero no leerla para ponerla
+// en la cabecera. Las peticiones con X-API-Key o Authorization: Bearer no lo
+// necesitan, porque esas cabeceras nunca las pone el navegador por su
+// cuenta. Con activo a false devuelve nil. Los rechazos quedan en el registro
+// de auditoría.
+func csrfMiddleware(activo bool, audit *auditoria) middleware {
+	if !activo {
+		return nil
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.Header.Get(apiKeyHeader) != "" || strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			c, err := r.Cookie(csrfCookie)
+			token := r.Header.Get(csrfHeader)
+			if err != nil || c.Value == "" || token == "" || subtle.ConstantTimeCompare([]byte(c.Value), []byte(token)) != 1 {
+				logDe("auth").WarnContext(r.Context(), "Petición sin token CSRF válido", "method", r.Method, "path", r.URL.Path, "origin", r.Header.Get("Origin"))
+				audit.registrar(r, repository.AuditEvent{Action: repository.AuditCSRFDenied, Status: http.StatusForbidden})
+				errorHTTP(w, r, http.StatusForbidden, msgCSRFInvalid)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// getAuthCSRF devuelve un token CSRF nuevo y lo deja en la cookie
+// csrf_token (HttpOnly y SameSite=Strict). El frontend lo manda después en
+// la cabecera X-CSRF-Token de sus escrituras. seguro añade Secure a la
+// cookie (fuera de development).
+func getAuthCSRF(seguro bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			errorHTTP(w, r, http.StatusInternalServerError, msgInternalError)
+			return
+		}
+		token := base64.RawURLEncoding.EncodeToString(b)
+		http.SetCookie(w, &http.Cookie{
+			Name:     csrfCookie,
+			Value:    token,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   seguro,
+			SameSite: http.SameSiteStrictMode,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]string{"token": token})
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"prueba/pkg/repository"
+	"time"
+)
+
+// Días que devuelve GET /item/daily si no se indica ?days=.
+const defaultDailyDays = 30
+
+// getItemDaily devuelve el resumen diario de los últimos ?days= días.
+func (s *Server) getItemDaily() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		days, err := queryInt(r, "days", defaultDailyDays)
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgInvalidParam, err)
+			return
+		}
+
+		since := time.Now().UTC().AddDate(0, 0, -days)
+		stats, err := s.store.Daily.List(r.Context(), since)
+		if err != nil {
+			responderError(w, r, msgDailyError, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Days []repository.DailyStat `json:"days"`
+		}{
+			Days: stats,
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"prueba/internal/metrics"
+	"prueba/pkg/repository"
+	"time"
+)
+
+// defaultPoolMetricsInterval es cada cuánto se muestrea el estado de los pools
+// de conexiones si no se indica db_pool_metrics_interval.
+const defaultPoolMetricsInterval = 15 * time.Second
+
+// Métricas de los pools de conexiones, por pool ("primary" o "replica").
+var (
+	dbPoolMaxConns = metrics.NewGauge("db_pool_max_connections",
+		"Conexiones máximas del pool.", "pool")
+	dbPoolTotalConns = metrics.NewGauge("db_pool_total_connections",
+		"Conexiones abiertas del pool.", "pool")
+	dbPoolIdleConns = metrics.NewGauge("db_pool_idle_connections",
+		"Conexiones abiertas sin usar.", "pool")
+	dbPoolInUseConns = metrics.NewGauge("db_pool_in_use_connections",
+		"Conexiones en uso.", "pool")
+	dbPoolAcquires = metrics.NewCounter("db_pool_acquires_total",
+		"Adquisiciones de conexión (en database/sql, solo las que esperaron).", "pool")
+	dbPoolAcquireWait = metrics.NewCounter("db_pool_acquire_wait_seconds_total",
+		"Tiempo total esperando una conexión del pool.", "pool")
+)
+
+// iniciarMetricasPool muestrea periódicamente el estado de los pools para que
+// la saturación se vea en las métricas antes de convertirse en errores 500.
+func iniciarMetricasPool(ctx context.Context, store *repository.Store) {
+	intervalo := envDuration("db_pool_metrics_interval", defaultPoolMetricsInterval)
+	if store.Pools == nil || intervalo <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(intervalo)
+		defer ticker.Stop()
+
+		// Los acumulados del pool se pasan a los contadores como diferencias
+		// con la muestra anterior.
+		previo := map[string]repository.PoolStats{}
+		for {
+			for _, st := range store.Pools() {
+				registrarPool(st, previo[st.Pool])
+				previo[st.Pool] = st
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func registrarPool(st, previo repository.PoolStats) {
+	dbPoolMaxConns.Set(float64(st.Max), st.Pool)
+	dbPoolTotalConns.Set(float64(st.Total), st.Pool)
+	dbPoolIdleConns.Set(float64(st.Idle), st.Pool)
+	dbPoolInUseConns.Set(float64(st.InUse), st.Pool)
+	dbPoolAcquires.Add(float64(st.AcquireCount-previo.AcquireCount), st.Pool)
+	dbPoolAcquireWait.Add((st.AcquireWait - previo.AcquireWait).Seconds(), st.Pool)
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"prueba/pkg/repository"
+	"strconv"
+)
+
+// comentariosSQL lee db_query_comments: con true las sentencias SQL de cada
+// petición llevan su id como comentario (/* req:<id> */), para rastrear desde
+// la consola de CockroachDB la llamada que lanzó una consulta lenta. Está
+// apagado por defecto porque impide reutilizar las sentencias preparadas de
+// pgx entre peticiones.
+func comentariosSQL() bool {
+	on, _ := strconv.ParseBool(os.Getenv("db_query_comments"))
+	return on
+}
+
+// comentarSQLMiddleware etiqueta las sentencias SQL de la petición con su id.
+// Va dentro de requestIDMiddleware. Con db_query_comments apagado es nil.
+func comentarSQLMiddleware() middleware {
+	if !comentariosSQL() {
+		return nil
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := repository.WithQueryComment(r.Context(), "req:"+RequestIDFrom(r.Context()))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"prueba/internal/metrics"
+	"prueba/pkg/repository"
+	"time"
+)
+
+var dbSlowQueries = metrics.NewCounter("db_slow_queries_total",
+	"Consultas a la base de datos que superaron db_slow_query.")
+
+// umbralConsultaLenta es la duración a partir de la cual una consulta se
+// registra como lenta (db_slow_query, p. ej. "500ms"). 0 lo desactiva.
+func umbralConsultaLenta() time.Duration {
+	return envDuration("db_slow_query", 0)
+}
+
+// registrarConsultaLenta deja en el log la sentencia normalizada y un resumen
+// de sus parámetros, para localizar los índices que faltan.
+func registrarConsultaLenta(q repository.SlowQuery) {
+	dbSlowQueries.Inc()
+	logDe("db").Warn("Consulta lenta", "duration", q.Duration, "sql", q.SQL, "args", q.Args)
+}
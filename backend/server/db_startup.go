@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"prueba/pkg/repository"
+	"time"
+)
+
+// Valores por defecto de la comprobación de la base de datos al arrancar.
+const (
+	defaultConnectAttempts   = 5
+	defaultConnectBackoff    = time.Second
+	defaultConnectMaxBackoff = 30 * time.Second
+	connectPingTimeout       = 5 * time.Second
+)
+
+// esperarBaseDatos comprueba que la base de datos responde antes de empezar a
+// servir, reintentando con backoff exponencial (db_connect_attempts,
+// db_connect_backoff). Así un dsn incorrecto se detecta al arrancar y no con
+// la primera petición.
+func esperarBaseDatos(ctx context.Context, store *repository.Store) error {
+	cfg := retryConfig{
+		maxAttempts: envInt("db_connect_attempts", defaultConnectAttempts),
+		backoff:     envDuration("db_connect_backoff", defaultConnectBackoff),
+		maxBackoff:  defaultConnectMaxBackoff,
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, connectPingTimeout)
+		err = store.Ping(pingCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt >= cfg.maxAttempts {
+			break
+		}
+		wait := cfg.siguienteEspera(attempt)
+		logDe("db").Warn("Base de datos no disponible, reintentando", "attempt", attempt, "max_attempts", cfg.maxAttempts, "wait", wait, errAttr(err))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("database not reachable after %d attempts: %w", cfg.maxAttempts, err)
+}
+
+// migrarBaseDatos aplica las migraciones pendientes antes de empezar a
+// servir, en lugar de con la primera operación sobre la base de datos. Si hay
+// varios procesos arrancando, uno migra y el resto espera (ver
+// repository.Store.Migrate).
+func migrarBaseDatos(ctx context.Context, store *repository.Store) error {
+	inicio := time.Now()
+	if err := store.Migrate(ctx); err != nil {
+		return fmt.Errorf("error applying database migrations: %w", err)
+	}
+	logDe("db").Info("Migraciones aplicadas", "duration", time.Since(inicio))
+	return nil
+}
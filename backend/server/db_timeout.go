@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"prueba/pkg/repository"
+	"strconv"
+	"time"
+)
+
+// Límites por defecto de cada operación con la base de datos (ver
+// timeoutsOperaciones).
+const (
+	defaultDBOpTimeout   = 15 * time.Second
+	defaultDBBulkTimeout = 10 * time.Minute
+)
+
+// timeoutsOperaciones lee db_op_timeout, el tiempo máximo de cada operación
+// puntual con la base de datos (lecturas de los endpoints, ediciones, cola de
+// reintentos...), y db_bulk_timeout, el de las escrituras de la
+// sincronización. A diferencia de db_statement_timeout se aplican en el
+// cliente a todo lo que hace la operación (transacción y reintentos
+// incluidos) y en todos los backends, también fuera de las peticiones HTTP.
+func timeoutsOperaciones() repository.Timeouts {
+	return repository.Timeouts{
+		Op:   envDuration("db_op_timeout", defaultDBOpTimeout),
+		Bulk: envDuration("db_bulk_timeout", defaultDBBulkTimeout),
+	}
+}
+
+// timeoutConsultas es el tiempo máximo de cada consulta a la base de datos
+// (db_statement_timeout, p. ej. "10s"). 0 deja las consultas sin límite.
+func timeoutConsultas() time.Duration {
+	return envDuration("db_statement_timeout", 0)
+}
+
+// statementTimeoutParam es el valor del parámetro de sesión statement_timeout
+// (en milisegundos) que se manda al abrir cada conexión de pgx.
+func statementTimeoutParam(d time.Duration) string {
+	return strconv.FormatInt(d.Milliseconds(), 10)
+}
+
+// conDeadline limita el contexto de la petición a d, de modo que las
+// consultas que lance el handler se cancelen con cualquier backend. Con d = 0
+// devuelve nil (la cadena lo salta).
+func conDeadline(d time.Duration) middleware {
+	if d <= 0 {
+		return nil
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// retrasoFollowerReads es el desfase admitido en las lecturas de los
+// endpoints (db_follower_reads, p. ej. "10s"): con CockroachDB se leen con AS
+// OF SYSTEM TIME y las puede servir la réplica más cercana en lugar del
+// leaseholder. 0 lee siempre los datos actuales.
+func retrasoFollowerReads() time.Duration {
+	return envDuration("db_follower_reads", 0)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Modos de db_tls_mode, con el mismo significado que sslmode en libpq.
+const (
+	tlsDisable    = "disable"
+	tlsRequire    = "require"
+	tlsVerifyCA   = "verify-ca"
+	tlsVerifyFull = "verify-full"
+)
+
+// tlsBD arma la configuración TLS de la base de datos a partir de
+// db_tls_mode, db_tls_root_cert, db_tls_cert y db_tls_key. Si db_tls_mode está
+// vacío devuelve modo "" y se respeta lo que diga el dsn. Con "disable" el
+// *tls.Config es nil.
+//
+// En verify-full el ServerName lo completa cada driver con el host al que
+// conecta.
+func tlsBD() (string, *tls.Config, error) {
+	modo := os.Getenv("db_tls_mode")
+	rootCert := os.Getenv("db_tls_root_cert")
+	cert := os.Getenv("db_tls_cert")
+	key := os.Getenv("db_tls_key")
+
+	switch modo {
+	case "":
+		if rootCert != "" || cert != "" || key != "" {
+			return "", nil, errors.New("db_tls_root_cert, db_tls_cert and db_tls_key require db_tls_mode")
+		}
+		return "", nil, nil
+	case tlsDisable:
+		return modo, nil, nil
+	case tlsRequire, tlsVerifyCA, tlsVerifyFull:
+	default:
+		return "", nil, fmt.Errorf("invalid db_tls_mode %q (valid: %s, %s, %s, %s)",
+			modo, tlsDisable, tlsRequire, tlsVerifyCA, tlsVerifyFull)
+	}
+	if (cert == "") != (key == "") {
+		return "", nil, errors.New("db_tls_cert and db_tls_key must be set together")
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cert != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return "", nil, fmt.Errorf("error loading database client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+
+	var roots *x509.CertPool
+	if rootCert != "" {
+		pem, err := os.ReadFile(rootCert)
+		if err != nil {
+			return "", nil, fmt.Errorf("error reading db_tls_root_cert: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return "", nil, fmt.Errorf("no certificates found in db_tls_root_cert %s", rootCert)
+		}
+		cfg.RootCAs = roots
+	} else if modo == tlsVerifyCA {
+		return "", nil, errors.New("db_tls_mode=verify-ca requires db_tls_root_cert")
+	}
+
+	switch modo {
+	case tlsRequire:
+		// Cifrado sin verificar el certificado del servidor.
+		cfg.InsecureSkipVerify = true
+	case tlsVerifyCA:
+		// Se verifica la cadena contra la CA pero no el nombre del host, así
+		// que la verificación estándar se sustituye por una propia.
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = verificarCadena(roots)
+	}
+	return modo, cfg, nil
+}
+
+// verificarCadena comprueba que el certificado del servidor lo firma una de
+// las CAs de roots, sin mirar el nombre del host.
+func verificarCadena(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server presented no certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			c, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("error parsing server certificate: %w", err)
+			}
+			certs[i] = c
+		}
+		opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+		for _, c := range certs[1:] {
+			opts.Intermediates.AddCert(c)
+		}
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
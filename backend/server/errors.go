@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"prueba/pkg/repository"
+	"prueba/pkg/syncengine"
+)
+
+// estadoError traduce a un código HTTP los errores de dominio de los
+// repositorios y de la sincronización; es el único punto en que se hace. El
+// resto de errores son fallos internos (500).
+func estadoError(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, repository.ErrVersionConflict):
+		// La versión de If-Match ya no es la actual
+		return http.StatusPreconditionFailed
+	case errors.Is(err, repository.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, syncengine.ErrUpstreamUnavailable):
+		return http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded):
+		// Venció db_op_timeout o el plazo de la petición
+		return http.StatusGatewayTimeout
+	}
+	if _, ok := syncengine.IsInterrupted(err); ok {
+		// El servidor se está apagando; la sincronización se reintenta
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// responderError responde al error err de un repositorio o de la
+// sincronización con el mensaje clave y el código de estadoError. El mensaje
+// recibe err como argumento si lo usa.
+func responderError(w http.ResponseWriter, r *http.Request, clave string, err error) {
+	errorHTTP(w, r, estadoError(err), clave, err)
+}
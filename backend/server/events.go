@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"prueba/internal/metrics"
+	"prueba/pkg/repository"
+	"sync"
+	"time"
+)
+
+// Intervalo de los comentarios de keep-alive en las conexiones SSE, para que
+// proxies y balanceadores no las corten por inactividad.
+const sseHeartbeat = 15 * time.Second
+
+// Eventos que se guardan por suscriptor antes de empezar a descartar.
+const sseBuffer = 64
+
+var sseDropped = metrics.NewCounter("sse_events_dropped_total",
+	"Eventos descartados porque el cliente no los leía a tiempo.")
+
+// evento es un mensaje para los clientes en tiempo real de un tenant.
+type evento struct {
+	Tenant string
+	Tipo   string
+	Datos  any
+}
+
+// eventHub reparte eventos entre los clientes conectados de cada tenant. Si
+// un cliente no lee a tiempo se le descartan eventos en lugar de bloquear al
+// resto.
+type eventHub struct {
+	mu sync.Mutex
+	// subs guarda el tenant de cada suscriptor.
+	subs    map[chan evento]string
+	cerrado bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: map[chan evento]string{}}
+}
+
+// eventos es el hub global del proceso.
+var eventos = newEventHub()
+
+// Suscribir devuelve un canal con los eventos del tenant publicados a partir
+// de ahora; se cierra al llamar a Cancelar o al cerrar el hub.
+func (h *eventHub) Suscribir(tenant string) chan evento {
+	ch := make(chan evento, sseBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cerrado {
+		close(ch)
+		return ch
+	}
+	h.subs[ch] = tenant
+	return ch
+}
+
+func (h *eventHub) Cancelar(ch chan evento) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+func (h *eventHub) Publicar(ev evento) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch, tenant := range h.subs {
+		if tenant != ev.Tenant {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+			sseDropped.Inc()
+		}
+	}
+}
+
+// Cerrar desconecta a todos los clientes; se usa al apagar el servidor, ya
+// que http.Server.Shutdown no corta las peticiones de larga duración.
+func (h *eventHub) Cerrar() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cerrado = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// streamEventos sirve los eventos como Server-Sent Events.
+func streamEventos(hub *eventHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			errorHTTP(w, r, http.StatusInternalServerError, msgStreamingUnsupp)
+			return
+		}
+
+		sinDeadline(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ch := hub.Suscribir(repository.TenantFrom(r.Context()))
+		defer hub.Cancelar(ch)
+
+		heartbeat := time.NewTicker(sseHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+				flusher.Flush()
+			case ev, ok := <-ch:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(ev.Datos)
+				if err != nil {
+					logDe("events").ErrorContext(r.Context(), "Error codificando evento", "event", ev.Tipo, errAttr(err))
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Tipo, data)
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"prueba/pkg/repository"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Feature flags: funcionalidades experimentales que se despliegan apagadas y
+// se encienden por entorno (feature_flags) o en caliente desde la API de
+// administración (PUT /admin/flags/{name}).
+const (
+	// flagRecommendations publica GET /recommendations.
+	flagRecommendations = "recommendations"
+)
+
+// flagsConocidos son los flags que admiten feature_flags y /admin/flags.
+var flagsConocidos = []string{flagRecommendations}
+
+// Cada cuánto se vuelven a leer de la base de datos los flags fijados.
+const defaultFeatureFlagsRefresh = 10 * time.Second
+
+// Origen del valor de un flag en GET /admin/flags.
+const (
+	origenDefecto = "default"
+	origenEntorno = "env"
+	origenBD      = "db"
+)
+
+// flagsEntorno lee feature_flags: los flags encendidos como
+// "recommendations,otro", o con valor explícito ("otro=false"). Devuelve solo
+// los que aparecen; el resto toman el valor del perfil (ver perfil.flags).
+func flagsEntorno() (map[string]bool, error) {
+	out := map[string]bool{}
+	v := os.Getenv("feature_flags")
+	for _, par := range lista(v) {
+		nombre, valor, conValor := strings.Cut(par, "=")
+		nombre = strings.TrimSpace(nombre)
+		on := true
+		if conValor {
+			var err error
+			if on, err = strconv.ParseBool(strings.TrimSpace(valor)); err != nil {
+				return nil, fmt.Errorf("invalid feature_flags %q: expected name or name=true|false", v)
+			}
+		}
+		if !slices.Contains(flagsConocidos, nombre) {
+			return nil, fmt.Errorf("invalid feature_flags: unknown flag %q (known: %s)", nombre, strings.Join(flagsConocidos, ", "))
+		}
+		out[nombre] = on
+	}
+	return out, nil
+}
+
+// featureFlags resuelve el valor de los flags: el fijado en la base de datos
+// si lo hay, si no el de feature_flags (enVigor.flags) y si no el del perfil.
+// Los fijados se guardan en memoria durante refresh para no consultar la base
+// de datos en cada petición; con varias réplicas un cambio tarda como mucho
+// eso en verse en todas.
+type featureFlags struct {
+	repo    repository.FeatureFlagRepository
+	refresh time.Duration
+
+	mu      sync.Mutex
+	fijados map[string]bool
+	leidos  time.Time
+	// enCurso es la lectura de la base de datos en marcha; solo se lanza una
+	// aunque la necesiten varias peticiones a la vez.
+	enCurso *lecturaFlags
+}
+
+// lecturaFlags es una lectura de los flags en curso. hecho se cierra al
+// terminar.
+type lecturaFlags struct {
+	hecho chan struct{}
+}
+
+func nuevosFeatureFlags(repo repository.FeatureFlagRepository) *featureFlags {
+	return &featureFlags{repo: repo, refresh: envDuration("feature_flags_refresh", defaultFeatureFlagsRefresh)}
+}
+
+// valores devuelve los flags fijados en la base de datos. Pasado refresh se
+// vuelven a leer sin bloquear: mientras tanto se sirven los últimos leídos.
+// Solo se espera a la lectura si no hay ninguno que servir (la primera vez y
+// tras invalidar).
+func (f *featureFlags) valores(ctx context.Context) map[string]bool {
+	f.mu.Lock()
+	if f.repo == nil || time.Since(f.leidos) < f.refresh {
+		defer f.mu.Unlock()
+		return f.fijados
+	}
+	d := f.enCurso
+	if d == nil {
+		d = &lecturaFlags{hecho: make(chan struct{})}
+		f.enCurso = d
+		// La lectura no depende de la petición que la lanza: la esperan
+		// también otras
+		go f.leer(context.WithoutCancel(ctx), d)
+	}
+	esperar := f.leidos.IsZero()
+	fijados := f.fijados
+	f.mu.Unlock()
+	if !esperar {
+		return fijados
+	}
+
+	select {
+	case <-d.hecho:
+	case <-ctx.Done():
+		return fijados
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fijados
+}
+
+// leer hace la lectura d y guarda los flags. Si no se pueden leer se siguen
+// usando los últimos leídos.
+func (f *featureFlags) leer(ctx context.Context, d *lecturaFlags) {
+	defer close(d.hecho)
+	fijados, err := f.repo.List(ctx)
+	if err != nil {
+		logDe("flags").WarnContext(ctx, "Error leyendo los feature flags, se usan los últimos leídos", errAttr(err))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// Tras invalidar, lo leído puede ser anterior al cambio: lo descarta y
+	// la siguiente consulta lanza otra lectura
+	if f.enCurso != d {
+		return
+	}
+	f.enCurso = nil
+	if err == nil {
+		f.fijados = fijados
+	}
+	// También tras un error, para no consultar en cada petición
+	f.leidos = time.Now()
+}
+
+// invalidar hace que la próxima consulta vuelva a leer la base de datos.
+func (f *featureFlags) invalidar() {
+	f.mu.Lock()
+	f.leidos = time.Time{}
+	f.enCurso = nil
+	f.mu.Unlock()
+}
+
+// valor devuelve si el flag está encendido y de dónde sale el valor.
+func (f *featureFlags) valor(ctx context.Context, nombre string) (bool, string) {
+	if on, ok := f.valores(ctx)[nombre]; ok {
+		return on, origenBD
+	}
+	if p := enVigor.flags.Load(); p != nil {
+		if on, ok := (*p)[nombre]; ok {
+			return on, origenEntorno
+		}
+	}
+	if nombre == flagMantenimiento {
+		return false, origenDefecto
+	}
+	return defaultsPerfil(perfilActual()).flags, origenDefecto
+}
+
+// activo indica si el flag nombre está encendido.
+func (f *featureFlags) activo(ctx context.Context, nombre string) bool {
+	on, _ := f.valor(ctx, nombre)
+	return on
+}
+
+// requerir sirve las rutas solo con el flag nombre encendido. Apagado
+// responde como a una ruta que no existe, para que no se note que está
+// desplegada.
+func (f *featureFlags) requerir(nombre string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !f.activo(r.Context(), nombre) {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// estadoFlag es un flag en las respuestas de /admin/flags.
+type estadoFlag struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Source  string `json:"source"`
+}
+
+func (f *featureFlags) estado(ctx context.Context, nombre string) estadoFlag {
+	on, origen := f.valor(ctx, nombre)
+	return estadoFlag{Name: nombre, Enabled: on, Source: origen}
+}
+
+// listarFlags es GET /admin/flags: el valor de cada flag y su origen.
+func (s *Server) listarFlags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nombres := slices.Clone(flagsConocidos)
+		sort.Strings(nombres)
+		out := make([]estadoFlag, len(nombres))
+		for i, n := range nombres {
+			out[i] = s.flags.estado(r.Context(), n)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Flags []estadoFlag `json:"flags"`
+		}{
+			Flags: out,
+		})
+	}
+}
+
+// fijarFlag es PUT /admin/flags/{name} con {"enabled": bool}: fija el valor
+// en la base de datos, por encima del del entorno.
+func (s *Server) fijarFlag() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nombre := r.PathValue("name")
+		if !slices.Contains(flagsConocidos, nombre) {
+			errorHTTP(w, r, http.StatusNotFound, msgFlagUnknown, nombre)
+			return
+		}
+		var body struct {
+			Enabled *bool `json:"enabled"`
+		}
+		if !decodificarJSON(w, r, &body) {
+			return
+		}
+		if body.Enabled == nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgFlagEnabledReq)
+			return
+		}
+
+		if err := s.store.Flags.Set(r.Context(), nombre, *body.Enabled); err != nil {
+			responderError(w, r, msgFlagError, err)
+			return
+		}
+		s.flags.invalidar()
+		s.log.InfoContext(r.Context(), "Feature flag fijado", "flag", nombre, "enabled", *body.Enabled)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.flags.estado(r.Context(), nombre))
+	}
+}
+
+// borrarFlag es DELETE /admin/flags/{name}: quita el valor fijado y el flag
+// vuelve al del entorno.
+func (s *Server) borrarFlag() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nombre := r.PathValue("name")
+		if !slices.Contains(flagsConocidos, nombre) {
+			errorHTTP(w, r, http.StatusNotFound, msgFlagUnknown, nombre)
+			return
+		}
+
+		err := s.store.Flags.Delete(r.Context(), nombre)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			responderError(w, r, msgFlagError, err)
+			return
+		}
+		s.flags.invalidar()
+		s.log.InfoContext(r.Context(), "Feature flag devuelto al valor del entorno", "flag", nombre)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.flags.estado(r.Context(), nombre))
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"prueba/pkg/repository"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flagsPrueba es un FeatureFlagRepository cuyo List espera a que se le dé
+// paso por continuar.
+type flagsPrueba struct {
+	repository.FeatureFlagRepository
+
+	lecturas  atomic.Int32
+	continuar chan map[string]bool
+}
+
+func (f *flagsPrueba) List(ctx context.Context) (map[string]bool, error) {
+	f.lecturas.Add(1)
+	return <-f.continuar, nil
+}
+
+func TestFeatureFlagsSirveLosUltimosMientrasLee(t *testing.T) {
+	repo := &flagsPrueba{continuar: make(chan map[string]bool, 1)}
+	f := &featureFlags{repo: repo, refresh: time.Minute}
+
+	// La primera vez no hay nada que servir: espera a la lectura
+	repo.continuar <- map[string]bool{"beta": true}
+	if got := f.valores(context.Background()); !got["beta"] {
+		t.Fatalf("valores() = %v, want beta on", got)
+	}
+
+	// Caducados, se sirven los anteriores sin esperar a una base de datos
+	// lenta, y solo se lanza una lectura
+	f.mu.Lock()
+	f.leidos = time.Now().Add(-2 * time.Minute)
+	f.mu.Unlock()
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := f.valores(context.Background()); !got["beta"] {
+				t.Errorf("valores() = %v, want the previous values", got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Al terminar la lectura se sirven los nuevos
+	repo.continuar <- map[string]bool{"beta": false}
+	for deadline := time.Now().Add(time.Second); f.valores(context.Background())["beta"]; {
+		if time.Now().After(deadline) {
+			t.Fatal("new values not served after the read finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := repo.lecturas.Load(); n != 2 {
+		t.Errorf("List called %d times, want 2", n)
+	}
+}
+
+func TestFeatureFlagsPrimeraLecturaCancelada(t *testing.T) {
+	repo := &flagsPrueba{continuar: make(chan map[string]bool)}
+	f := &featureFlags{repo: repo, refresh: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := f.valores(ctx); got != nil {
+		t.Errorf("valores() = %v, want nil", got)
+	}
+
+	// La lectura sigue aunque la petición que la lanzó ya no espere
+	repo.continuar <- map[string]bool{"beta": true}
+	if got := f.valores(context.Background()); !got["beta"] {
+		t.Errorf("valores() = %v, want beta on", got)
+	}
+	if n := repo.lecturas.Load(); n != 1 {
+		t.Errorf("List called %d times, want 1", n)
+	}
+}
@@ -4,289 +4,156 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
-	"os"
-
-	"github.com/jackc/pgx/v4"
+	"prueba/internal/tracing"
+	"prueba/pkg/repository"
+	"prueba/pkg/syncengine"
 )
 
-type Item struct {
-	Ticker     string `json:"ticker"`
-	TargetFrom string `json:"target_from"`
-	TargetTo   string `json:"target_to"`
-	Company    string `json:"company"`
-	Action     string `json:"action"`
-	Brokerage  string `json:"brokerage"`
-	RatingFrom string `json:"rating_from"`
-	RatingTo   string `json:"rating_to"`
-	Time       string `json:"time"`
-}
-
-type APIResponse struct {
-	Items    []Item `json:"items"`
-	NextPage string `json:"next_page"`
-}
-
 func index(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		fmt.Fprintf(w, "Method not allowed")
-		return
-	}
-	fmt.Fprintf(w, "Hello there %s", "visitor")
+	fmt.Fprint(w, mensaje(r, msgGreeting, "visitor"))
 }
 
-func getItem(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	log.Println("Obteniendo items desde base de datos")
-	dsn := os.Getenv("dsn")
-	ctx := context.Background()
-
-	conn, err := pgx.Connect(ctx, dsn)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error connecting to database: %v", err), http.StatusInternalServerError)
-		return
-	}
-	defer conn.Close(ctx)
-
-	// 👇 OJO: si la columna time es TIMESTAMPTZ, la casteo a texto para que
-	// encaje con el campo Time string del struct.
-	rows, err := conn.Query(ctx, `
-		SELECT
-			ticker,
-			target_from,
-			target_to,
-			company,
-			action,
-			brokerage,
-			rating_from,
-			rating_to,
-			time::text AS time
-		FROM items
-	`)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error obteniendo items: %v", err), http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
+func (s *Server) getItem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.log.DebugContext(r.Context(), "Obteniendo items desde base de datos")
 
-	var items []Item
-
-	for rows.Next() {
-		var it Item
-		if err := rows.Scan(
-			&it.Ticker,
-			&it.TargetFrom,
-			&it.TargetTo,
-			&it.Company,
-			&it.Action,
-			&it.Brokerage,
-			&it.RatingFrom,
-			&it.RatingTo,
-			&it.Time,
-		); err != nil {
-			http.Error(w, fmt.Sprintf("Error leyendo fila: %v", err), http.StatusInternalServerError)
+		loc, err := zonaPeticion(r)
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgInvalidParam, err)
 			return
 		}
-		items = append(items, it)
-	}
-
-	if err := rows.Err(); err != nil {
-		http.Error(w, fmt.Sprintf("Error finalizando lectura: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(struct {
-		Items []Item `json:"items"`
-	}{
-		Items: items,
-	}); err != nil {
-		http.Error(w, fmt.Sprintf("Error codificando respuesta: %v", err), http.StatusInternalServerError)
-		return
-	}
-}
-
-func obteneritemsDesdeAPI(nextPage string) ([]Item, string, error) {
-	client := &http.Client{}
-
-	url := os.Getenv("url")
-	if nextPage != "" {
-		url = url + "?next_page=" + nextPage
-	}
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, "", fmt.Errorf("error creating request: %w", err)
-	}
-
-	token := os.Getenv("token")
-	req.Header.Add("Authorization", token)
-	req.Header.Add("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, "", fmt.Errorf("error making request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, "", fmt.Errorf("error reading response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, "", fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
-	}
 
-	var apiResponse APIResponse
-	if err := json.Unmarshal(body, &apiResponse); err != nil {
-		return nil, "", fmt.Errorf("error parsing response JSON: %w", err)
-	}
-
-	return apiResponse.Items, apiResponse.NextPage, nil
-}
-
-func obtenerTodosLosItems() ([]Item, error) {
-	var allItems []Item
-	nextPage := ""
-
-	for {
-		items, np, err := obteneritemsDesdeAPI(nextPage)
+		// Con as_of se reconstruye el contenido de una generación o fecha
+		// pasada a partir del histórico. La lectura y la serialización van
+		// en spans separados para ver en las trazas dónde se va el tiempo.
+		var list []repository.Item
+		if v := r.URL.Query().Get("as_of"); v != "" {
+			asOf, perr := parsearAsOf(v)
+			if perr != nil {
+				errorHTTP(w, r, http.StatusBadRequest, msgInvalidParam, perr)
+				return
+			}
+			ctx, span := tracing.Start(r.Context(), "items.list_as_of", tracing.KindInternal)
+			list, err = s.store.Items.ListAsOf(ctx, asOf)
+			span.SetError(err)
+			span.End()
+		} else {
+			ctx, span := tracing.Start(r.Context(), "items.list", tracing.KindInternal)
+			list, err = s.store.Items.List(ctx)
+			span.SetError(err)
+			span.End()
+		}
 		if err != nil {
-			return nil, err
+			responderError(w, r, msgItemsError, err)
+			return
 		}
-
-		allItems = append(allItems, items...)
-
-		if np == "" {
-			break
+		itemsEnZona(list, loc)
+
+		_, span := tracing.Start(r.Context(), "items.encode", tracing.KindInternal)
+		span.SetAttr("items", len(list))
+		defer span.End()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(struct {
+			Items []repository.Item `json:"items"`
+		}{
+			Items: list,
+		}); err != nil {
+			span.SetError(err)
+			errorHTTP(w, r, http.StatusInternalServerError, msgEncodeError, err)
+			return
 		}
-		nextPage = np
 	}
-
-	return allItems, nil
 }
 
-func insertarItemsLote(ctx context.Context, conn *pgx.Conn, items []Item) (int64, error) {
-	if len(items) == 0 {
-		return 0, nil
-	}
-
-	rows := make([][]interface{}, 0, len(items))
+// getItemStats devuelve un resumen de los items almacenados.
+func (s *Server) getItemStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := zonaPeticion(r)
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgInvalidParam, err)
+			return
+		}
+		stats, err := s.store.Items.Stats(r.Context())
+		if err != nil {
+			responderError(w, r, msgStatsError, err)
+			return
+		}
+		fechaEnZona(stats.LatestTime, loc)
 
-	for _, it := range items {
-		rows = append(rows, []interface{}{
-			it.Ticker,
-			it.TargetFrom,
-			it.TargetTo,
-			it.Company,
-			it.Action,
-			it.Brokerage,
-			it.RatingFrom,
-			it.RatingTo,
-			it.Time, // CockroachDB acepta RFC3339 como TIMESTAMPTZ
-		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
 	}
-
-	// Insertar todo el lote con COPY
-	n, err := conn.CopyFrom(
-		ctx,
-		pgx.Identifier{"items"},
-		[]string{"ticker", "target_from", "target_to", "company", "action", "brokerage", "rating_from", "rating_to", "time"},
-		pgx.CopyFromRows(rows),
-	)
-
-	return n, err
 }
 
-func sincItems(w http.ResponseWriter, r *http.Request) {
-	log.Println("=== Iniciando sincronización de items ===")
-
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		fmt.Fprintf(w, "Method not allowed")
-		return
-	}
-
-	// Paso 1: Obtener TODOS los items desde la API
-	log.Println("Paso 1: Obteniendo items desde la API (todas las páginas)...")
-	items, err := obtenerTodosLosItems()
-	if err != nil {
-		log.Printf("Error obteniendo items desde API: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Error obteniendo items desde API: %v", err)
-		return
+func (s *Server) sincItems() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.logSync.InfoContext(r.Context(), "Iniciando sincronización de items", "trigger", triggerManual)
+		s.responderSync(w, r, triggerManual)
 	}
-	log.Printf("Paso 1: Se encontraron %d items para sincronizar", len(items))
+}
 
-	// Paso 2: Conectar a la base de datos
-	log.Println("Paso 2: Conectando a la base de datos...")
-	dsn := os.Getenv("dsn")
-	ctx := context.Background()
-	conn, err := pgx.Connect(ctx, dsn)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Error connecting to database: %v", err)
-		return
+// sincItemsProgramado es la sincronización lanzada por el scheduler externo
+// (Cloud Scheduler, cron); la autenticación la hace requireScheduler.
+func (s *Server) sincItemsProgramado() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.logSync.InfoContext(r.Context(), "Iniciando sincronización de items", "trigger", triggerScheduler)
+		s.responderSync(w, r, triggerScheduler)
 	}
-	defer conn.Close(ctx)
+}
 
-	// Paso 3: Crear tabla si no existe
-	log.Println("Paso 3: Verificando/creando tabla items...")
-	_, err = conn.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS items (
-			ticker STRING,
-			target_from STRING,
-			target_to STRING,
-			company STRING,
-			action STRING,
-			brokerage STRING,
-			rating_from STRING,
-			rating_to STRING,
-			time TIMESTAMP,
-			PRIMARY KEY (ticker, time)
-		)
-	`)
-	if err != nil {
-		log.Printf("Error creating table: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Error creating table: %v", err)
+// responderSync lanza (o se une a) una sincronización del tenant de la
+// petición y escribe la respuesta.
+func (s *Server) responderSync(w http.ResponseWriter, r *http.Request, trigger string) {
+	// La respuesta espera a que termine la sincronización, que puede durar
+	// más que http_write_timeout
+	sinDeadline(w)
+	tenant := repository.TenantFrom(r.Context())
+	// La sincronización no depende de la petición, pero sus logs llevan el id
+	// de la que la lanzó y sus spans van en su traza
+	ctx := conLog(repository.WithTenant(syncBaseCtx, tenant), "request_id", RequestIDFrom(r.Context()))
+	ctx = tracing.ContextWithSpan(ctx, tracing.FromContext(r.Context()))
+	res, coalesced := s.coordinarSync(ctx, trigger, s.paramsPorDefecto(), nil)
+	if res.Err != nil {
+		s.logSync.ErrorContext(r.Context(), "Error en sincronización", "run_id", res.RunID, errAttr(res.Err))
+		// Si falla, se encola un reintento para que el sistema se recupere solo.
+		// Si nos unimos a una ejecución ajena, ya la encoló quien la lanzó.
+		if !coalesced {
+			// Se encola aunque el cliente ya se haya desconectado
+			if qerr := encolarReintento(context.WithoutCancel(r.Context()), s.store.Retries, res.Err); qerr != nil {
+				s.logSync.ErrorContext(r.Context(), "Error encolando reintento de sincronización", errAttr(qerr))
+			}
+		}
+		responderError(w, r, msgSyncError, res.Err)
 		return
 	}
 
-	// Paso 4: Limpiar tabla (si tu intención es un full refresh)
-	log.Println("Paso 4: Limpiando tabla items (TRUNCATE)...")
-	_, err = conn.Exec(ctx, `TRUNCATE TABLE items`)
-	if err != nil {
-		log.Printf("Error truncating table: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Error truncating table: %v", err)
-		return
+	// El monitor externo sabe que el scheduler sigue sincronizando. También
+	// si la petición se unió a otra sincronización: los datos están al día
+	if trigger == triggerScheduler {
+		s.latido.enviar(fmt.Sprintf("run_id=%d inserted=%d total=%d coalesced=%t", res.RunID, res.Inserted, res.Total, coalesced))
 	}
 
-	// Paso 5: Insertar items
-	log.Println("Paso 5: Insertando items...")
-
-	log.Println("Paso 5: Insertando items en lote...")
-
-	insertedCount, err := insertarItemsLote(ctx, conn, items)
-
-	if err != nil {
-		log.Printf("Error insertando lote: %v", err)
-		http.Error(w, fmt.Sprintf("Error insertando lote: %v", err), http.StatusInternalServerError)
-		return
+	// Paso 4: Respuesta
+	if coalesced {
+		s.logSync.InfoContext(r.Context(), "Solicitud unida a la sincronización en curso", "run_id", res.RunID)
+	} else {
+		s.logSync.InfoContext(r.Context(), "Sincronización completada", "run_id", res.RunID, "inserted", res.Inserted, "total", res.Total)
 	}
-
-	// Paso 6: Respuesta
-	log.Printf("=== Sincronización completada: %d/%d items insertados ===", insertedCount, len(items))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"message": "Sincronización completada", "items_synced": %d}`, insertedCount)
+	json.NewEncoder(w).Encode(struct {
+		Message     string `json:"message"`
+		ItemsSynced int64  `json:"items_synced"`
+		RunID       int64  `json:"run_id"`
+		Coalesced   bool   `json:"coalesced"`
+	}{mensaje(r, msgSyncCompleted), res.Inserted, res.RunID, coalesced})
+}
+
+// ejecutarSync hace el refresco completo del tenant de ctx con el motor de
+// sincronización (ver syncengine.Engine.Run). Devuelve los items insertados,
+// el total recibido de la API y el tiempo de cada etapa.
+func (s *Server) ejecutarSync(ctx context.Context, params repository.SyncParams, generation int64) (syncengine.Result, error) {
+	return s.engine.Run(ctx, params, generation)
 }
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// reutilizarPuerto lee reuse_port: con true los listeners TCP se abren con
+// SO_REUSEPORT, de modo que al desplegar el proceso nuevo puede escuchar en
+// el mismo puerto mientras el anterior termina lo que tiene en curso (ver
+// Handover).
+func reutilizarPuerto() (bool, error) {
+	v := os.Getenv("reuse_port")
+	if v == "" {
+		return false, nil
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.New("invalid reuse_port: expected true or false")
+	}
+	if on && !reusePortSoportado {
+		return false, errors.New("reuse_port is not supported on this platform")
+	}
+	return on, nil
+}
+
+// escucharTCP abre el listener TCP de addr, con SO_REUSEPORT si reuse.
+func escucharTCP(addr string, reuse bool) (net.Listener, error) {
+	var lc net.ListenConfig
+	if reuse {
+		lc.Control = controlReusePort
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// servirTCP escucha en srv.Addr (ver escucharTCP) y sirve srv hasta que se
+// apague, en HTTPS si conTLS.
+func servirTCP(srv *http.Server, reuse, conTLS bool) error {
+	ln, err := escucharTCP(srv.Addr, reuse)
+	if err != nil {
+		return err
+	}
+	if conTLS {
+		// Los certificados ya están en TLSConfig
+		return srv.ServeTLS(ln, "", "")
+	}
+	return srv.Serve(ln)
+}
+
+var (
+	// sinTrabajosNuevos se cierra al apagar para que los procesos en segundo
+	// plano (cola de reintentos) dejen de empezar trabajo nuevo.
+	sinTrabajosNuevos = make(chan struct{})
+	pararTrabajos     sync.Once
+)
+
+// Handover cede el puerto a otro proceso (despliegue sin cortes, con
+// reuse_port): deja de aceptar conexiones y espera a que terminen las
+// peticiones HTTP y las sincronizaciones en curso, que a diferencia de
+// Shutdown no se interrumpen. Si ctx vence antes, las sincronizaciones que
+// queden se interrumpen como en Shutdown y el proceso nuevo las reintenta.
+func Handover(ctx context.Context, srv *http.Server) error {
+	return apagar(ctx, srv, false)
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"prueba/internal/redact"
+	"strconv"
+	"time"
+)
+
+// Tiempo máximo de cada comprobación de GET /readyz: menos que el timeout
+// habitual de las sondas de Kubernetes (1 s por defecto, que suele subirse).
+const timeoutComprobacion = 2 * time.Second
+
+// Resultado de cada comprobación y estado global de /healthz y /readyz.
+const (
+	saludOK           = "ok"
+	saludError        = "error"
+	saludNoDisponible = "unavailable"
+)
+
+// readyUpstreamEntorno lee readyz_upstream: si GET /readyz comprueba
+// también que responde la API upstream. Por defecto no: sin ella se siguen
+// sirviendo los items guardados, y que se caiga no debe sacar los pods del
+// balanceador.
+func readyUpstreamEntorno() (bool, error) {
+	v := os.Getenv("readyz_upstream")
+	if v == "" {
+		return false, nil
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid readyz_upstream %q", v)
+	}
+	return on, nil
+}
+
+// estadoSalud es la respuesta de /healthz y /readyz. Checks tiene el
+// resultado de cada comprobación: "ok" o "error: <motivo>".
+type estadoSalud struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func responderSalud(w http.ResponseWriter, status int, e estadoSalud) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// getHealthz es GET /healthz, la sonda de liveness: el proceso está vivo y
+// atiende peticiones. No mira dependencias, para que una caída de la base de
+// datos no haga que Kubernetes reinicie todos los pods.
+func getHealthz(w http.ResponseWriter, r *http.Request) {
+	responderSalud(w, http.StatusOK, estadoSalud{Status: saludOK})
+}
+
+// getReadyz es GET /readyz, la sonda de readiness: 200 si el proceso puede
+// atender tráfico (la base de datos responde y tiene las migraciones
+// aplicadas y, con readyz_upstream, la API upstream responde) y 503 si no o
+// si se está apagando.
+func (s *Server) getReadyz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-sinTrabajosNuevos:
+			responderSalud(w, http.StatusServiceUnavailable, estadoSalud{Status: saludNoDisponible, Checks: map[string]string{"shutdown": "in progress"}})
+			return
+		default:
+		}
+
+		checks := map[string]string{}
+		ok := true
+		comprobar := func(nombre string, f func(ctx context.Context) error) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeoutComprobacion)
+			defer cancel()
+			if err := f(ctx); err != nil {
+				logDe("health").WarnContext(r.Context(), "Comprobación de readiness fallida", "check", nombre, errAttr(err))
+				checks[nombre] = saludError + ": " + redact.String(err.Error())
+				ok = false
+				return
+			}
+			checks[nombre] = saludOK
+		}
+		comprobar("database", s.store.Ping)
+		// Sin base de datos no se pueden comprobar las migraciones
+		if ok {
+			comprobar("migrations", s.store.Migrate)
+		}
+		if s.cfg.ReadyUpstream {
+			comprobar("upstream", func(ctx context.Context) error {
+				return s.engine.Upstream.Ping(ctx, s.cfg.UpstreamURL)
+			})
+		}
+
+		if !ok {
+			responderSalud(w, http.StatusServiceUnavailable, estadoSalud{Status: saludNoDisponible, Checks: checks})
+			return
+		}
+		responderSalud(w, http.StatusOK, estadoSalud{Status: saludOK, Checks: checks})
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// HealthcheckURL es la URL de GET /readyz del servidor de este mismo proceso
+// o contenedor: 127.0.0.1 en el puerto de portback (que el flag -port del
+// subcomando healthcheck sustituye, como en el servidor), con https si hay un
+// certificado configurado (tls_cert, tls_cert_dir o autocert_domains). Solo
+// mira esas variables, para que la sonda no tenga que cargar toda la
+// configuración en cada ejecución.
+func HealthcheckURL() string {
+	port := os.Getenv("portback")
+	if port == "" {
+		port = defaultPort
+	}
+	scheme := "http"
+	if os.Getenv("tls_cert") != "" || os.Getenv("tls_cert_dir") != "" || os.Getenv("autocert_domains") != "" {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort("127.0.0.1", port) + "/readyz"
+}
+
+// Healthcheck hace GET destino (ver HealthcheckURL) y devuelve un error si no
+// responde 200, con las comprobaciones que fallaron. Es la sonda del
+// subcomando healthcheck, para el HEALTHCHECK de Docker o ECS sin tener que
+// instalar curl en la imagen. El certificado no se verifica si destino es
+// una dirección local: no estará emitido para 127.0.0.1. Si certFile y
+// keyFile no están vacíos se presenta ese certificado de cliente (mtls).
+func Healthcheck(ctx context.Context, destino, certFile, keyFile string) error {
+	u, err := url.Parse(destino)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid healthcheck URL %q: expected an http(s) URL", destino)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{}
+	if ip := net.ParseIP(u.Hostname()); u.Hostname() == "localhost" || (ip != nil && ip.IsLoopback()) {
+		transport.TLSClientConfig.InsecureSkipVerify = true
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("error loading client certificate: %w", err)
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	client := &http.Client{Transport: transport}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, destino, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var e estadoSalud
+	if json.NewDecoder(resp.Body).Decode(&e) != nil || len(e.Checks) == 0 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var fallos []string
+	for nombre, res := range e.Checks {
+		if res != saludOK {
+			fallos = append(fallos, nombre+": "+res)
+		}
+	}
+	sort.Strings(fallos)
+	return fmt.Errorf("unexpected status %d (%s)", resp.StatusCode, strings.Join(fallos, "; "))
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"prueba/internal/metrics"
+	"prueba/internal/redact"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Intentos de cada latido y espera antes del primer reintento (se dobla en
+// cada uno).
+const (
+	heartbeatAttempts = 3
+	heartbeatBackoff  = 2 * time.Second
+)
+
+var heartbeatPings = metrics.NewCounter("heartbeat_pings_total",
+	"Latidos enviados a heartbeat_url por resultado (ok, error).", "status")
+
+// heartbeatEntorno lee heartbeat_url: la URL a la que se avisa tras cada
+// sincronización programada que termina bien, al estilo de healthchecks.io o
+// de los push monitors de Uptime Kuma. El monitor externo alerta si deja de
+// recibir avisos, así que una sincronización que no se lanza o que falla se
+// detecta aunque el proceso esté caído. La URL suele llevar un identificador
+// secreto: se quita de los logs (ver redact).
+func heartbeatEntorno() (string, error) {
+	v := os.Getenv("heartbeat_url")
+	if v == "" {
+		return "", nil
+	}
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid heartbeat_url: expected an http(s) URL")
+	}
+	redact.Register(v)
+	return v, nil
+}
+
+// latido avisa a heartbeat_url en segundo plano, con reintentos. Un *latido
+// nil no avisa (sin heartbeat_url).
+type latido struct {
+	url    string
+	client *http.Client
+
+	// ctx se cancela al cerrar para abandonar los reintentos pendientes.
+	ctx      context.Context
+	cancelar context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// nuevoLatido devuelve nil sin URL. Cada petición tiene como mucho
+// heartbeat_timeout (10s por defecto).
+func nuevoLatido(destino string) *latido {
+	if destino == "" {
+		return nil
+	}
+	ctx, cancelar := context.WithCancel(context.Background())
+	return &latido{
+		url:      destino,
+		client:   &http.Client{Timeout: envDuration("heartbeat_timeout", 10*time.Second)},
+		ctx:      ctx,
+		cancelar: cancelar,
+	}
+}
+
+// enviar avisa sin esperar a la respuesta. detalle va en el cuerpo: los
+// monitores como healthchecks.io lo guardan con cada aviso.
+func (l *latido) enviar(detalle string) {
+	if l == nil {
+		return
+	}
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		log := logDe("heartbeat")
+		espera := heartbeatBackoff
+		var err error
+		for intento := 1; intento <= heartbeatAttempts; intento++ {
+			if err = l.ping(detalle); err == nil {
+				heartbeatPings.Inc("ok")
+				log.Debug("Latido enviado", "attempt", intento)
+				return
+			}
+			log.Warn("Error enviando el latido", "attempt", intento, errAttr(err))
+			if intento == heartbeatAttempts {
+				break
+			}
+			select {
+			case <-time.After(espera):
+				espera *= 2
+			case <-l.ctx.Done():
+				heartbeatPings.Inc("error")
+				return
+			}
+		}
+		heartbeatPings.Inc("error")
+		log.Error("Latido no enviado", errAttr(err))
+	}()
+}
+
+func (l *latido) ping(detalle string) error {
+	req, err := http.NewRequest(http.MethodPost, l.url, strings.NewReader(detalle))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// cerrar espera a los avisos en curso y abandona los reintentos pendientes.
+// Va en cierres.
+func (l *latido) cerrar() {
+	if l == nil {
+		return
+	}
+	l.cancelar()
+	l.wg.Wait()
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// protocolosHTTP lee http2 y h2c, los protocolos del servidor principal.
+//
+// Con http2 (true por defecto) las conexiones HTTPS negocian HTTP/2 por ALPN,
+// de modo que las peticiones en paralelo del dashboard comparten una
+// conexión. Con h2c=true también se acepta HTTP/2 sin cifrar en los listeners
+// en claro (el puerto sin TLS y unix_socket): es para detrás de un
+// balanceador o proxy de confianza que termina TLS y habla HTTP/2 con el
+// backend (Envoy, Cloud Run...). Solo con conocimiento previo, sin
+// "Upgrade: h2c". HTTP/1.1 sigue disponible siempre.
+func protocolosHTTP() (*http.Protocols, error) {
+	leer := func(key string, def bool) (bool, error) {
+		v := os.Getenv(key)
+		if v == "" {
+			return def, nil
+		}
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			return def, fmt.Errorf("invalid %s %q: expected true or false", key, v)
+		}
+		return on, nil
+	}
+	h2, err := leer("http2", true)
+	if err != nil {
+		return nil, err
+	}
+	h2c, err := leer("h2c", false)
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(http.Protocols)
+	p.SetHTTP1(true)
+	p.SetHTTP2(h2)
+	p.SetUnencryptedHTTP2(h2c)
+	return p, nil
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// autocertHTTP configura los certificados automáticos de Let's Encrypt (ACME)
+// a partir de:
+//
+//   - autocert_domains: dominios para los que se piden certificados,
+//     separados por comas; solo se atienden peticiones TLS a esos nombres;
+//   - autocert_cache_dir: directorio donde se guardan los certificados y la
+//     cuenta, para no pedirlos de nuevo en cada arranque (obligatorio: Let's
+//     Encrypt limita las emisiones por dominio);
+//   - autocert_email: contacto opcional para los avisos de caducidad.
+//
+// El reto TLS-ALPN-01 se resuelve en el propio puerto HTTPS, que para ello
+// debe ser accesible desde Internet en el 443. Con autocert_http_addr (p. ej.
+// ":80") se atiende además el reto HTTP-01 y el resto de peticiones HTTP se
+// redirigen a HTTPS.
+//
+// Sin autocert_domains devuelve nil.
+func autocertHTTP() (*autocert.Manager, string, error) {
+	var dominios []string
+	for _, d := range strings.Split(os.Getenv("autocert_domains"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			dominios = append(dominios, d)
+		}
+	}
+	cache := os.Getenv("autocert_cache_dir")
+	addr := os.Getenv("autocert_http_addr")
+	if len(dominios) == 0 {
+		if cache != "" || addr != "" {
+			return nil, "", errors.New("autocert_cache_dir and autocert_http_addr require autocert_domains")
+		}
+		return nil, "", nil
+	}
+	if cache == "" {
+		return nil, "", errors.New("autocert_domains requires autocert_cache_dir")
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(dominios...),
+		Cache:      autocert.DirCache(cache),
+		Email:      os.Getenv("autocert_email"),
+	}, addr, nil
+}
+
+// tlsAutocert es la configuración TLS del servidor con los certificados de m.
+func tlsAutocert(m *autocert.Manager) *tls.Config {
+	cfg := m.TLSConfig()
+	cfg.MinVersion = tls.VersionTLS12
+	return cfg
+}
+
+// servidorRetoACME es el servidor HTTP plano de autocert_http_addr: responde
+// al reto HTTP-01 y redirige lo demás a HTTPS.
+func servidorRetoACME(m *autocert.Manager, addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           m.HTTPHandler(nil),
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Nombres de los ficheros que se buscan en tls_cert_dir (los de un secret
+// kubernetes.io/tls).
+const (
+	tlsDirCert = "tls.crt"
+	tlsDirKey  = "tls.key"
+)
+
+// tlsHTTP arma la configuración TLS del servidor HTTP a partir de tls_cert y
+// tls_key, o de tls_cert_dir con los ficheros tls.crt y tls.key. Si no hay
+// ninguno devuelve nil y el servidor escucha en HTTP plano (p. ej. detrás de
+// un balanceador que termina TLS).
+func tlsHTTP() (*tls.Config, error) {
+	cert := os.Getenv("tls_cert")
+	key := os.Getenv("tls_key")
+	if dir := os.Getenv("tls_cert_dir"); dir != "" {
+		if cert != "" || key != "" {
+			return nil, errors.New("tls_cert_dir cannot be combined with tls_cert and tls_key")
+		}
+		cert = filepath.Join(dir, tlsDirCert)
+		key = filepath.Join(dir, tlsDirKey)
+	}
+	if cert == "" && key == "" {
+		return nil, nil
+	}
+	if cert == "" || key == "" {
+		return nil, errors.New("tls_cert and tls_key must be set together")
+	}
+
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("error loading server certificate: %w", err)
+	}
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{pair},
+	}, nil
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// defaultUnixSocketMode deja el socket al usuario y al grupo del proceso, que
+// suele compartir con el proxy inverso.
+const defaultUnixSocketMode fs.FileMode = 0o660
+
+// socketUnix lee unix_socket, la ruta de un socket Unix en el que escuchar
+// además del puerto TCP (para un proxy inverso en la misma máquina), y
+// unix_socket_mode, sus permisos en octal. Sin unix_socket devuelve "".
+func socketUnix() (string, fs.FileMode, error) {
+	path := os.Getenv("unix_socket")
+	if path == "" {
+		return "", 0, nil
+	}
+	mode := defaultUnixSocketMode
+	if v := os.Getenv("unix_socket_mode"); v != "" {
+		n, err := strconv.ParseUint(v, 8, 32)
+		if err != nil || n > 0o777 {
+			return "", 0, fmt.Errorf("invalid unix_socket_mode %q: expected octal permissions (e.g. 660)", v)
+		}
+		mode = fs.FileMode(n)
+	}
+	return path, mode, nil
+}
+
+// escucharUnix abre el socket Unix path con permisos mode. Si quedó el socket
+// de una ejecución anterior que no se cerró bien lo borra; cualquier otro
+// fichero en esa ruta es un error. El socket se borra al cerrar el listener.
+func escucharUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("unix_socket %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("error removing stale socket: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error checking unix_socket: %w", err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on unix socket: %w", err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("error setting unix socket permissions: %w", err)
+	}
+	return ln, nil
+}
+
+// servirUnix sirve srv también en el socket Unix de cfg, en segundo plano;
+// srv.Shutdown lo cierra junto con el listener TCP. Con reuse_port el socket
+// no se borra al cerrar, porque en un Handover ya es el del proceso nuevo.
+func servirUnix(srv *http.Server, cfg Config) error {
+	ln, err := escucharUnix(cfg.UnixSocket, cfg.UnixSocketMode)
+	if err != nil {
+		return err
+	}
+	if cfg.ReusePort {
+		ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	}
+	go func() {
+		logDe("http").Info("Escuchando en socket Unix", "path", cfg.UnixSocket, "mode", fmt.Sprintf("%#o", cfg.UnixSocketMode))
+		var err error
+		if cfg.TLS != nil {
+			err = srv.ServeTLS(ln, "", "")
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logDe("http").Error("Error en el socket Unix", errAttr(err))
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"prueba/internal/redact"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Idiomas de los mensajes de la API.
+const (
+	idiomaES = "es"
+	idiomaEN = "en"
+)
+
+// Claves de los mensajes de la API.
+const (
+	msgInternalError      = "internal_error"
+	msgBodyTooLarge       = "body_too_large"
+	msgInvalidJSON        = "invalid_json"
+	msgInvalidParam       = "invalid_param"
+	msgInvalidTenant      = "invalid_tenant"
+	msgTooManyRequests    = "too_many_requests"
+	msgStreamingUnsupp    = "streaming_unsupported"
+	msgUnauthorized       = "unauthorized"
+	msgForbidden          = "forbidden"
+	msgTenantForbidden    = "tenant_forbidden"
+	msgIPForbidden        = "ip_forbidden"
+	msgCSRFInvalid        = "csrf_invalid"
+	msgSchedulerOff       = "scheduler_not_configured"
+	msgAuthError          = "auth_error"
+	msgQuotaExceeded      = "quota_exceeded"
+	msgQuotaAPIKeyOnly    = "quota_api_key_only"
+	msgQuotaError         = "quota_error"
+	msgItemsError         = "items_error"
+	msgStatsError         = "stats_error"
+	msgStatusError        = "status_error"
+	msgLatestError        = "latest_error"
+	msgDailyError         = "daily_error"
+	msgAuditError         = "audit_error"
+	msgUserError          = "user_error"
+	msgUserInvalid        = "user_invalid"
+	msgUserExists         = "user_exists"
+	msgLoginFailed        = "login_failed"
+	msgNotASession        = "not_a_session"
+	msgRegistrationClosed = "registration_closed"
+	msgAccountLocked      = "account_locked"
+	msgFilterError        = "filter_error"
+	msgFilterInvalid      = "filter_invalid"
+	msgFilterIDInvalid    = "filter_id_invalid"
+	msgFilterNotFound     = "filter_not_found"
+	msgFilterExists       = "filter_exists"
+	msgFilterLimit        = "filter_limit"
+	msgAPIKeyError        = "api_key_error"
+	msgAPIKeyNotFound     = "api_key_not_found"
+	msgAPIKeyIDInvalid    = "api_key_id_invalid"
+	msgAPIKeyInvalid      = "api_key_invalid"
+	msgAPIKeyExists       = "api_key_exists"
+	msgEncodeError        = "encode_error"
+	msgItemKeyRequired    = "item_key_required"
+	msgIfMatchRequired    = "if_match_required"
+	msgIfMatchInvalid     = "if_match_invalid"
+	msgItemNotFound       = "item_not_found"
+	msgItemConflict       = "item_conflict"
+	msgItemInvalid        = "item_invalid"
+	msgItemUpdateError    = "item_update_error"
+	msgSyncCompleted      = "sync_completed"
+	msgSyncError          = "sync_error"
+	msgHistoryError       = "history_error"
+	msgRunIDInvalid       = "run_id_invalid"
+	msgRunNotFound        = "run_not_found"
+	msgRunError           = "run_error"
+	msgRunNotRetryable    = "run_not_retryable"
+	msgConfigReloaded     = "config_reloaded"
+	msgReloadError        = "reload_error"
+	msgFlagUnknown        = "flag_unknown"
+	msgFlagEnabledReq     = "flag_enabled_required"
+	msgFlagError          = "flag_error"
+	msgLogLevelInvalid    = "log_level_invalid"
+	msgLogDurationInvalid = "log_duration_invalid"
+	msgMaintenance        = "maintenance"
+	msgTimeout            = "timeout"
+	msgGreeting           = "greeting"
+)
+
+// mensajes es el catálogo de mensajes de la API por clave e idioma, con los
+// verbos de fmt de sus argumentos. Todas las claves deben estar en todos los
+// idiomas.
+var mensajes = map[string]map[string]string{
+	msgInternalError:      {idiomaES: "Error interno del servidor", idiomaEN: "Internal server error"},
+	msgBodyTooLarge:       {idiomaES: "Cuerpo de la petición demasiado grande (máximo %d bytes)", idiomaEN: "Request body too large (max %d bytes)"},
+	msgInvalidJSON:        {idiomaES: "Cuerpo JSON inválido: %v", idiomaEN: "Invalid JSON body: %v"},
+	msgInvalidParam:       {idiomaES: "Parámetro inválido: %v", idiomaEN: "Invalid parameter: %v"},
+	msgInvalidTenant:      {idiomaES: "Cabecera %s inválida", idiomaEN: "Invalid %s header"},
+	msgTooManyRequests:    {idiomaES: "Demasiadas peticiones", idiomaEN: "Too many requests"},
+	msgStreamingUnsupp:    {idiomaES: "Streaming no soportado", idiomaEN: "Streaming not supported"},
+	msgUnauthorized:       {idiomaES: "No autorizado", idiomaEN: "Unauthorized"},
+	msgCSRFInvalid:        {idiomaES: "Falta el token CSRF o no es válido", idiomaEN: "Missing or invalid CSRF token"},
+	msgIPForbidden:        {idiomaES: "Operación no permitida desde esta dirección IP", idiomaEN: "Operation not allowed from this IP address"},
+	msgForbidden:          {idiomaES: "No tienes permiso para esta operación", idiomaEN: "You do not have permission for this operation"},
+	msgTenantForbidden:    {idiomaES: "No tienes acceso al tenant %s", idiomaEN: "You do not have access to tenant %s"},
+	msgSchedulerOff:       {idiomaES: "Disparador del scheduler no configurado", idiomaEN: "Scheduler trigger not configured"},
+	msgAuthError:          {idiomaES: "Error comprobando las credenciales: %v", idiomaEN: "Error checking credentials: %v"},
+	msgQuotaExceeded:      {idiomaES: "Cuota de la clave de la API agotada (%s)", idiomaEN: "API key quota exceeded (%s)"},
+	msgQuotaAPIKeyOnly:    {idiomaES: "Las cuotas solo se aplican a las claves de la API", idiomaEN: "Quotas only apply to API keys"},
+	msgQuotaError:         {idiomaES: "Error consultando la cuota: %v", idiomaEN: "Error reading the quota: %v"},
+	msgItemsError:         {idiomaES: "Error obteniendo items: %v", idiomaEN: "Error fetching items: %v"},
+	msgStatsError:         {idiomaES: "Error obteniendo estadísticas: %v", idiomaEN: "Error fetching stats: %v"},
+	msgStatusError:        {idiomaES: "Error obteniendo el estado del servicio: %v", idiomaEN: "Error fetching service status: %v"},
+	msgLatestError:        {idiomaES: "Error obteniendo últimas valoraciones: %v", idiomaEN: "Error fetching latest ratings: %v"},
+	msgAPIKeyError:        {idiomaES: "Error con las claves de la API: %v", idiomaEN: "API key error: %v"},
+	msgAPIKeyNotFound:     {idiomaES: "No existe la clave de la API %d o está revocada", idiomaEN: "API key %d does not exist or is revoked"},
+	msgAPIKeyIDInvalid:    {idiomaES: "Id de clave de la API inválido", idiomaEN: "Invalid API key id"},
+	msgAPIKeyInvalid:      {idiomaES: "Clave de la API inválida: %v", idiomaEN: "Invalid API key: %v"},
+	msgAPIKeyExists:       {idiomaES: "Ya hay una clave de la API llamada %s", idiomaEN: "An API key named %s already exists"},
+	msgUserError:          {idiomaES: "Error con las cuentas de usuario: %v", idiomaEN: "User account error: %v"},
+	msgUserInvalid:        {idiomaES: "Datos de usuario inválidos: %v", idiomaEN: "Invalid user data: %v"},
+	msgUserExists:         {idiomaES: "Ya hay una cuenta con ese email", idiomaEN: "An account with that email already exists"},
+	msgLoginFailed:        {idiomaES: "Email o contraseña incorrectos", idiomaEN: "Incorrect email or password"},
+	msgNotASession:        {idiomaES: "La petición no se hizo con un token de sesión", idiomaEN: "The request was not made with a session token"},
+	msgRegistrationClosed: {idiomaES: "El registro de usuarios está desactivado", idiomaEN: "User registration is disabled"},
+	msgAccountLocked:      {idiomaES: "Demasiados intentos fallidos; vuelve a intentarlo en %d s", idiomaEN: "Too many failed attempts; try again in %d s"},
+	msgFilterError:        {idiomaES: "Error con los filtros guardados: %v", idiomaEN: "Saved filter error: %v"},
+	msgFilterInvalid:      {idiomaES: "Filtro inválido: %v", idiomaEN: "Invalid filter: %v"},
+	msgFilterIDInvalid:    {idiomaES: "Id de filtro inválido", idiomaEN: "Invalid filter id"},
+	msgFilterNotFound:     {idiomaES: "No existe el filtro %d", idiomaEN: "Filter %d not found"},
+	msgFilterExists:       {idiomaES: "Ya tienes un filtro llamado %s", idiomaEN: "You already have a filter named %s"},
+	msgFilterLimit:        {idiomaES: "No se pueden guardar más de %d filtros", idiomaEN: "No more than %d filters can be saved"},
+	msgAuditError:         {idiomaES: "Error consultando el registro de auditoría: %v", idiomaEN: "Error querying the audit log: %v"},
+	msgDailyError:         {idiomaES: "Error obteniendo estadísticas diarias: %v", idiomaEN: "Error fetching daily stats: %v"},
+	msgEncodeError:        {idiomaES: "Error codificando respuesta: %v", idiomaEN: "Error encoding response: %v"},
+	msgItemKeyRequired:    {idiomaES: "ticker y time (RFC 3339) son obligatorios", idiomaEN: "ticker and time (RFC 3339) are required"},
+	msgIfMatchRequired:    {idiomaES: "La cabecera If-Match con la versión del item es obligatoria", idiomaEN: "If-Match header with the item version is required"},
+	msgIfMatchInvalid:     {idiomaES: "Cabecera If-Match inválida", idiomaEN: "Invalid If-Match header"},
+	msgItemNotFound:       {idiomaES: "Item no encontrado", idiomaEN: "Item not found"},
+	msgItemConflict:       {idiomaES: "Otra persona modificó el item; vuelve a cargarlo e inténtalo de nuevo", idiomaEN: "Item was modified by someone else; reload it and try again"},
+	msgItemInvalid:        {idiomaES: "Edición inválida: %v", idiomaEN: "Invalid edit: %v"},
+	msgItemUpdateError:    {idiomaES: "Error actualizando item: %v", idiomaEN: "Error updating item: %v"},
+	msgSyncCompleted:      {idiomaES: "Sincronización completada", idiomaEN: "Sync completed"},
+	msgSyncError:          {idiomaES: "Error en la sincronización: %v", idiomaEN: "Sync failed: %v"},
+	msgHistoryError:       {idiomaES: "Error obteniendo historial: %v", idiomaEN: "Error fetching sync history: %v"},
+	msgRunIDInvalid:       {idiomaES: "Id de ejecución inválido", idiomaEN: "Invalid sync run id"},
+	msgRunNotFound:        {idiomaES: "Ejecución no encontrada", idiomaEN: "Sync run not found"},
+	msgRunError:           {idiomaES: "Error obteniendo ejecución: %v", idiomaEN: "Error fetching sync run: %v"},
+	msgRunNotRetryable:    {idiomaES: "Solo se pueden reintentar ejecuciones fallidas o interrumpidas (estado: %s)", idiomaEN: "Only failed or interrupted runs can be retried (status: %s)"},
+	msgConfigReloaded:     {idiomaES: "Configuración recargada", idiomaEN: "Configuration reloaded"},
+	msgReloadError:        {idiomaES: "Configuración no recargada: %v", idiomaEN: "Configuration not reloaded: %v"},
+	msgFlagUnknown:        {idiomaES: "Feature flag desconocido: %s", idiomaEN: "Unknown feature flag: %s"},
+	msgFlagEnabledReq:     {idiomaES: "Falta enabled (true o false)", idiomaEN: "Missing enabled (true or false)"},
+	msgFlagError:          {idiomaES: "Error guardando el feature flag: %v", idiomaEN: "Error saving feature flag: %v"},
+	msgLogLevelInvalid:    {idiomaES: "Nivel de log inválido %q (válidos: debug, info, warn, error)", idiomaEN: "Invalid log level %q (valid: debug, info, warn, error)"},
+	msgLogDurationInvalid: {idiomaES: "Duración inválida %q (por ejemplo 30m; máximo 24h)", idiomaEN: "Invalid duration %q (e.g. 30m; max 24h)"},
+	msgMaintenance:        {idiomaES: "Estamos haciendo tareas de mantenimiento. Los datos se pueden consultar, pero no modificar; inténtalo de nuevo en unos minutos.", idiomaEN: "We are performing maintenance. Data can be viewed but not modified; please try again in a few minutes."},
+	msgTimeout:            {idiomaES: "La petición ha tardado demasiado; inténtalo de nuevo más tarde", idiomaEN: "The request took too long; please try again later"},
+	msgGreeting:           {idiomaES: "Hola, %s", idiomaEN: "Hello there %s"},
+}
+
+// idiomaPorDefecto lee default_language: el idioma de los mensajes cuando
+// Accept-Language no pide ninguno soportado. Por defecto español.
+func idiomaPorDefecto() (string, error) {
+	switch v := os.Getenv("default_language"); v {
+	case "":
+		return idiomaES, nil
+	case idiomaES, idiomaEN:
+		return v, nil
+	default:
+		return "", fmt.Errorf("invalid default_language %q (valid: %s, %s)", v, idiomaES, idiomaEN)
+	}
+}
+
+type claveIdioma struct{}
+
+// idiomaMiddleware elige el idioma de los mensajes de cada petición según su
+// Accept-Language (con def si no pide ninguno soportado) y lo deja en el
+// contexto.
+func idiomaMiddleware(def string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lang := elegirIdioma(r.Header.Get("Accept-Language"), def)
+			w.Header().Add("Vary", "Accept-Language")
+			w.Header().Set("Content-Language", lang)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claveIdioma{}, lang)))
+		})
+	}
+}
+
+// elegirIdioma devuelve el idioma soportado con más peso (q) de
+// Accept-Language, o def. "es-ES" cuenta como "es".
+func elegirIdioma(accept, def string) string {
+	type opcion struct {
+		lang string
+		q    float64
+	}
+	var opciones []opcion
+	for _, parte := range strings.Split(accept, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(parte), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if (base == idiomaES || base == idiomaEN) && q > 0 {
+			opciones = append(opciones, opcion{base, q})
+		}
+	}
+	if len(opciones) == 0 {
+		return def
+	}
+	sort.SliceStable(opciones, func(i, j int) bool { return opciones[i].q > opciones[j].q })
+	return opciones[0].lang
+}
+
+// mensaje traduce la clave al idioma de la petición (ver idiomaMiddleware).
+func mensaje(r *http.Request, clave string, args ...any) string {
+	lang, _ := r.Context().Value(claveIdioma{}).(string)
+	texto, ok := mensajes[clave][lang]
+	if !ok {
+		texto = mensajes[clave][idiomaES]
+	}
+	// Los argumentos sobran si el texto no los usa (p. ej. el error en un
+	// mensaje específico, ver responderError)
+	if len(args) == 0 || !strings.Contains(texto, "%") {
+		return texto
+	}
+	return fmt.Sprintf(texto, args...)
+}
+
+// errorHTTP responde con el mensaje de error traducido, como http.Error.
+// Los 5xx con un error entre args se envían a Sentry, salvo los de
+// sincronización, que ya envía ejecutarSyncRegistrado.
+func errorHTTP(w http.ResponseWriter, r *http.Request, status int, clave string, args ...any) {
+	if status >= http.StatusInternalServerError && clave != msgSyncError {
+		for _, a := range args {
+			if err, ok := a.(error); ok {
+				reportarErrorHTTP(r, status, err)
+				break
+			}
+		}
+	}
+	http.Error(w, mensaje(r, clave, sinSecretos(args)...), status)
+}
+
+// sinSecretos quita los secretos (ver redact) de los argumentos de los
+// mensajes de error: los errores de la base de datos o de la API upstream
+// pueden llevar el dsn o el token.
+func sinSecretos(args []any) []any {
+	out := make([]any, len(args))
+	for i, a := range args {
+		out[i] = redact.Value(a)
+	}
+	return out
+}
+
+// errorJSON responde con el error como JSON, {"error": codigo, "message":
+// mensaje traducido}, para los errores que el frontend trata aparte
+// (mantenimiento, tiempo agotado): codigo no depende del idioma.
+func errorJSON(w http.ResponseWriter, r *http.Request, status int, codigo, clave string, args ...any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}{
+		Error:   codigo,
+		Message: mensaje(r, clave, sinSecretos(args)...),
+	})
+}
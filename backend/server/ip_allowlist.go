@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"prueba/pkg/repository"
+	"strings"
+)
+
+// prefijosEntorno lee la variable key como lista de CIDR separados por
+// comas; una IP suelta es su /32 (o /128).
+func prefijosEntorno(key string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, v := range lista(os.Getenv(key)) {
+		if !strings.Contains(v, "/") {
+			ip, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s entry %q: expected an IP or CIDR", key, v)
+			}
+			out = append(out, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q: expected an IP or CIDR", key, v)
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+func contiene(prefijos []netip.Prefix, ip netip.Addr) bool {
+	for _, p := range prefijos {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipCliente es la IP del cliente de r. Si la conexión viene de uno de los
+// proxies de confianza (trusted_proxies), es la última de X-Forwarded-For
+// que no es de un proxy de confianza: las anteriores las puede haber puesto
+// el propio cliente. Las conexiones por el socket Unix (unix_socket) son
+// siempre de un proxy de confianza: no tienen IP y solo puede abrirlas quien
+// tenga permiso sobre el socket. Devuelve una IP no válida si no se puede
+// determinar.
+func ipCliente(r *http.Request, proxies []netip.Prefix) netip.Addr {
+	var ip netip.Addr
+	if !desdeSocketUnix(r) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if ip, err = netip.ParseAddr(host); err != nil {
+			return netip.Addr{}
+		}
+		ip = ip.Unmap()
+		if !contiene(proxies, ip) {
+			return ip
+		}
+	}
+	saltos := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(saltos) - 1; i >= 0; i-- {
+		s := strings.TrimSpace(saltos[i])
+		if s == "" {
+			continue
+		}
+		salto, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Addr{}
+		}
+		ip = salto.Unmap()
+		if !contiene(proxies, ip) {
+			return ip
+		}
+	}
+	// Todos los saltos son proxies de confianza: el cliente es el primero
+	return ip
+}
+
+// desdeSocketUnix indica si r llegó por el socket Unix.
+func desdeSocketUnix(r *http.Request) bool {
+	local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && local.Network() == "unix"
+}
+
+// permitirIPs responde 403 a las peticiones cuya IP de cliente (ver
+// ipCliente) no está en permitidas. Con permitidas vacía devuelve nil (sin
+// restricción). Es una defensa más junto a la autenticación, no en su lugar.
+// Los rechazos quedan en el registro de auditoría.
+func permitirIPs(permitidas, proxies []netip.Prefix, audit *auditoria) middleware {
+	if len(permitidas) == 0 {
+		return nil
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ipCliente(r, proxies)
+			if !ip.IsValid() || !contiene(permitidas, ip) {
+				logDe("auth").WarnContext(r.Context(), "Petición de administración desde una IP no permitida", "ip", ip.String(), "remote_addr", r.RemoteAddr)
+				audit.registrar(r, repository.AuditEvent{Action: repository.AuditIPDenied, Status: http.StatusForbidden})
+				errorHTTP(w, r, http.StatusForbidden, msgIPForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIPCliente(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name    string
+		remote  string
+		xff     []string
+		proxies []netip.Prefix
+		want    string
+	}{
+		{"sin proxies", "203.0.113.7:4000", nil, nil, "203.0.113.7"},
+		{"sin proxies ignora XFF", "203.0.113.7:4000", []string{"198.51.100.1"}, nil, "203.0.113.7"},
+		{"conexión directa que no es de un proxy", "203.0.113.7:4000", []string{"198.51.100.1"}, proxies, "203.0.113.7"},
+		{"detrás de un proxy", "10.0.0.2:4000", []string{"198.51.100.1"}, proxies, "198.51.100.1"},
+		{"entrada inventada a la izquierda", "10.0.0.2:4000", []string{"1.2.3.4, 198.51.100.1"}, proxies, "198.51.100.1"},
+		{"varios proxies de confianza", "10.0.0.2:4000", []string{"198.51.100.1, 10.0.0.9"}, proxies, "198.51.100.1"},
+		{"varias cabeceras", "10.0.0.2:4000", []string{"1.2.3.4", "198.51.100.1"}, proxies, "198.51.100.1"},
+		{"todos son proxies", "10.0.0.2:4000", []string{"10.0.0.5, 10.0.0.9"}, proxies, "10.0.0.5"},
+		{"proxy sin XFF", "10.0.0.2:4000", nil, proxies, "10.0.0.2"},
+		{"IPv4 en IPv6", "[::ffff:203.0.113.7]:4000", nil, nil, "203.0.113.7"},
+		{"XFF no válido", "10.0.0.2:4000", []string{"no-es-una-ip"}, proxies, "invalid IP"},
+		{"RemoteAddr no válido", "pipe", nil, nil, "invalid IP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := ipCliente(r, tt.proxies).String(); got != tt.want {
+				t.Errorf("ipCliente() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPClienteSocketUnix(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name    string
+		remote  string
+		xff     string
+		proxies []netip.Prefix
+		want    string
+	}{
+		{"sin trusted_proxies", "@", "198.51.100.1", nil, "198.51.100.1"},
+		{"RemoteAddr vacío", "", "198.51.100.1", nil, "198.51.100.1"},
+		{"entrada inventada a la izquierda", "@", "1.2.3.4, 198.51.100.1", nil, "198.51.100.1"},
+		{"tras otro proxy de confianza", "@", "198.51.100.1, 10.0.0.9", proxies, "198.51.100.1"},
+		{"sin XFF", "@", "", nil, "invalid IP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := peticionSocketUnix(tt.remote, tt.xff)
+			if got := ipCliente(r, tt.proxies).String(); got != tt.want {
+				t.Errorf("ipCliente() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermitirIPsSocketUnix(t *testing.T) {
+	permitidas := []netip.Prefix{netip.MustParsePrefix("198.51.100.0/24")}
+	h := permitirIPs(permitidas, nil, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		xff  string
+		want int
+	}{
+		{"198.51.100.1", http.StatusOK},
+		{"203.0.113.7", http.StatusForbidden},
+		{"", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.xff, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, peticionSocketUnix("@", tt.xff))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+// peticionSocketUnix es una petición como las que llegan por unix_socket.
+func peticionSocketUnix(remote, xff string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = remote
+	if xff != "" {
+		r.Header.Set("X-Forwarded-For", xff)
+	}
+	local := &net.UnixAddr{Name: "/run/app.sock", Net: "unix"}
+	return r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, local))
+}
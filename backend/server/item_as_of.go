@@ -0,0 +1,24 @@
+package server
+
+import (
+	"fmt"
+	"prueba/pkg/repository"
+	"strconv"
+	"time"
+)
+
+// parsearAsOf interpreta el parámetro as_of de GET /item: un número es una
+// generación (el run_id de una sincronización) y si no, una fecha RFC 3339.
+func parsearAsOf(s string) (repository.AsOf, error) {
+	if gen, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if gen <= 0 {
+			return repository.AsOf{}, fmt.Errorf("invalid as_of generation %d", gen)
+		}
+		return repository.AsOf{Generation: gen}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return repository.AsOf{}, fmt.Errorf("invalid as_of %q: expected a generation or an RFC 3339 time", s)
+	}
+	return repository.AsOf{Time: t}, nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"prueba/pkg/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// patchItem edita a mano un item, identificado por ?ticker=&brokerage=&time=
+// (RFC 3339). Exige If-Match con la versión que el cliente leyó (el campo
+// version, o el ETag de una edición anterior) para que dos ediciones
+// simultáneas no se pisen: si la fila cambió entretanto responde 412.
+//
+// La sincronización reescribe las filas con los datos de la API, así que las
+// ediciones duran hasta la siguiente. Como también sube la versión, un
+// If-Match leído antes de sincronizar responde 412 en lugar de editar encima
+// de los datos nuevos.
+func (s *Server) patchItem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		t, err := time.Parse(time.RFC3339Nano, q.Get("time"))
+		if q.Get("ticker") == "" || err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgItemKeyRequired)
+			return
+		}
+		key := repository.ItemKey{Ticker: q.Get("ticker"), Brokerage: q.Get("brokerage"), Time: t}
+
+		ifMatch := r.Header.Get("If-Match")
+		if ifMatch == "" {
+			errorHTTP(w, r, http.StatusPreconditionRequired, msgIfMatchRequired)
+			return
+		}
+		version, err := parsearVersion(ifMatch)
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgIfMatchInvalid)
+			return
+		}
+
+		loc, err := zonaPeticion(r)
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgInvalidParam, err)
+			return
+		}
+
+		var patch repository.ItemPatch
+		if !decodificarJSON(w, r, &patch) {
+			return
+		}
+
+		it, err := s.store.Items.Update(r.Context(), key, version, patch)
+		if err != nil {
+			clave := msgItemUpdateError
+			switch {
+			case errors.Is(err, repository.ErrNotFound):
+				clave = msgItemNotFound
+			case errors.Is(err, repository.ErrConflict):
+				clave = msgItemConflict
+			case errors.Is(err, repository.ErrValidation):
+				clave = msgItemInvalid
+			}
+			responderError(w, r, clave, err)
+			return
+		}
+		s.log.InfoContext(r.Context(), "Item editado", "ticker", it.Ticker, "brokerage", it.Brokerage, "version", it.Version)
+
+		// La tabla resumen se rehace para que /item/latest refleje la edición.
+		if err := s.store.Items.RefreshLatest(r.Context()); err != nil {
+			s.log.ErrorContext(r.Context(), "Error actualizando últimas valoraciones tras editar", errAttr(err))
+		}
+		s.cache.invalidar(repository.TenantFrom(r.Context()))
+
+		it.Time = it.Time.In(loc)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etagVersion(it.Version))
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(it); err != nil {
+			s.log.ErrorContext(r.Context(), "Error codificando respuesta", errAttr(err))
+		}
+	}
+}
+
+// etagVersion es el ETag de una versión de item: la versión entre comillas.
+func etagVersion(v int64) string {
+	return strconv.Quote(strconv.FormatInt(v, 10))
+}
+
+// parsearVersion lee la versión de un If-Match: "3", 3 o W/"3".
+func parsearVersion(h string) (int64, error) {
+	h = strings.TrimPrefix(strings.TrimSpace(h), "W/")
+	return strconv.ParseInt(strings.Trim(h, `"`), 10, 64)
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"prueba/pkg/repository"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// itemsPrueba es un ItemRepository en memoria con lo que usa patchItem: las
+// versiones se comprueban como en los de verdad.
+type itemsPrueba struct {
+	repository.ItemRepository
+
+	mu    sync.Mutex
+	items map[repository.ItemKey]repository.Item
+}
+
+func (f *itemsPrueba) Update(ctx context.Context, key repository.ItemKey, version int64, patch repository.ItemPatch) (*repository.Item, error) {
+	if err := patch.Validate(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	it, ok := f.items[key]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	if it.Version != version {
+		return nil, repository.ErrVersionConflict
+	}
+	if patch.TargetTo != nil {
+		it.TargetTo = patch.TargetTo
+	}
+	if patch.Company != nil {
+		it.Company = *patch.Company
+	}
+	it.Version++
+	f.items[key] = it
+	return &it, nil
+}
+
+func (f *itemsPrueba) RefreshLatest(ctx context.Context) error { return nil }
+
+// sincronizar simula una sincronización que reescribe el item: sube la
+// versión como Upsert.
+func (f *itemsPrueba) sincronizar(key repository.ItemKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	it := f.items[key]
+	it.Version = max(it.Version+1, time.Now().UnixMicro())
+	f.items[key] = it
+}
+
+func TestPatchItem(t *testing.T) {
+	key := repository.ItemKey{Ticker: "ACME", Brokerage: "Broker", Time: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	query := url.Values{"ticker": {key.Ticker}, "brokerage": {key.Brokerage}, "time": {key.Time.Format(time.RFC3339)}}.Encode()
+
+	tests := []struct {
+		name string
+		// antes se ejecuta sobre el repositorio antes de la petición.
+		antes      func(f *itemsPrueba)
+		query      string
+		ifMatch    string
+		body       string
+		wantStatus int
+		wantETag   string
+	}{
+		{"versión actual", nil, query, `"3"`, `{"company":"Acme Corp"}`, http.StatusOK, `"4"`},
+		{"versión sin comillas", nil, query, `3`, `{"company":"Acme Corp"}`, http.StatusOK, `"4"`},
+		{"ETag débil", nil, query, `W/"3"`, `{"company":"Acme Corp"}`, http.StatusOK, `"4"`},
+		{"versión antigua", nil, query, `"2"`, `{"company":"Acme Corp"}`, http.StatusPreconditionFailed, ""},
+		{"versión leída antes de sincronizar", func(f *itemsPrueba) { f.sincronizar(key) }, query, `"3"`, `{"company":"Acme Corp"}`, http.StatusPreconditionFailed, ""},
+		{"sin If-Match", nil, query, "", `{"company":"Acme Corp"}`, http.StatusPreconditionRequired, ""},
+		{"If-Match no válido", nil, query, `"tres"`, `{"company":"Acme Corp"}`, http.StatusBadRequest, ""},
+		{"precio negativo", nil, query, `"3"`, `{"target_to":-1}`, http.StatusBadRequest, ""},
+		{"item que no existe", nil, strings.Replace(query, "ACME", "NOPE", 1), `"3"`, `{"company":"Acme Corp"}`, http.StatusNotFound, ""},
+		{"sin clave", nil, "ticker=ACME", `"3"`, `{"company":"Acme Corp"}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := &itemsPrueba{items: map[repository.ItemKey]repository.Item{
+				key: {Ticker: key.Ticker, Brokerage: key.Brokerage, Time: key.Time, Company: "Acme", Version: 3},
+			}}
+			if tt.antes != nil {
+				tt.antes(items)
+			}
+			s := &Server{
+				store: &repository.Store{Items: items},
+				log:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			r := httptest.NewRequest(http.MethodPatch, "/item?"+tt.query, strings.NewReader(tt.body))
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+			w := httptest.NewRecorder()
+			s.patchItem().ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("ETag = %q, want %q", got, tt.wantETag)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var it repository.Item
+			if err := json.NewDecoder(w.Body).Decode(&it); err != nil {
+				t.Fatal(err)
+			}
+			if it.Company != "Acme Corp" || etagVersion(it.Version) != tt.wantETag {
+				t.Errorf("item = %+v, want the edited company and version %s", it, tt.wantETag)
+			}
+		})
+	}
+}
+
+func TestPatchItemMismaVersion(t *testing.T) {
+	key := repository.ItemKey{Ticker: "ACME", Time: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	items := &itemsPrueba{items: map[repository.ItemKey]repository.Item{key: {Ticker: key.Ticker, Time: key.Time, Version: 1}}}
+	s := &Server{store: &repository.Store{Items: items}, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	query := url.Values{"ticker": {key.Ticker}, "time": {key.Time.Format(time.RFC3339)}}.Encode()
+
+	// Dos clientes leyeron la versión 1: solo puede editar uno
+	var ok, conflicto int
+	for _, company := range []string{"Uno", "Dos"} {
+		r := httptest.NewRequest(http.MethodPatch, "/item?"+query, strings.NewReader(`{"company":"`+company+`"}`))
+		r.Header.Set("If-Match", `"1"`)
+		w := httptest.NewRecorder()
+		s.patchItem().ServeHTTP(w, r)
+		switch w.Code {
+		case http.StatusOK:
+			ok++
+		case http.StatusPreconditionFailed:
+			conflicto++
+		default:
+			t.Fatalf("status = %d (%s)", w.Code, w.Body)
+		}
+	}
+	if ok != 1 || conflicto != 1 {
+		t.Errorf("got %d edits and %d conflicts, want 1 and 1", ok, conflicto)
+	}
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Margen aceptado entre relojes al validar exp/nbf.
+const jwtLeeway = time.Minute
+
+// Tiempo durante el que se reutilizan las claves descargadas del JWKS.
+const jwksCacheTTL = time.Hour
+
+// Intervalo mínimo entre descargas del JWKS: los tokens con un kid
+// desconocido (falsificados, por ejemplo) no provocan una descarga cada uno.
+const jwksMinRefresh = 30 * time.Second
+
+var errJWTInvalid = errors.New("invalid token")
+
+// jwtClaims son los claims de un JWT ya verificado.
+type jwtClaims map[string]any
+
+func (c jwtClaims) str(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+func (c jwtClaims) time(name string) (time.Time, bool) {
+	n, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(n), 0), true
+}
+
+// audiences devuelve el claim aud, que puede venir como string o como lista.
+func (c jwtClaims) audiences() []string {
+	switch v := c["aud"].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func (c jwtClaims) hasAudience(aud string) bool {
+	for _, a := range c.audiences() {
+		if a == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// jwksVerifier verifica JWT firmados con RS256 contra las claves publicadas en
+// un endpoint JWKS, cacheándolas y refrescándolas si aparece un kid nuevo o
+// caducan. Si la descarga falla se siguen usando las últimas claves buenas.
+type jwksVerifier struct {
+	url    string
+	client *http.Client
+	// urlDe, si no es nil, da la URL del JWKS en lugar de url (descubrimiento
+	// OIDC).
+	urlDe func(ctx context.Context) (string, error)
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	// intentoAt es la última descarga, haya ido bien o no; no se repite
+	// antes de jwksMinRefresh.
+	intentoAt time.Time
+	// enCurso es la descarga en marcha, que esperan todas las peticiones
+	// que la necesitan.
+	enCurso *descargaJWKS
+}
+
+// descargaJWKS es una descarga del JWKS en curso. hecho se cierra al
+// terminar; err es su resultado.
+type descargaJWKS struct {
+	hecho chan struct{}
+	err   error
+}
+
+func newJWKSVerifier(url string) *jwksVerifier {
+	return &jwksVerifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Verify comprueba la firma y la vigencia (exp/nbf) del token y devuelve sus
+// claims. La validación de iss/aud queda a cargo de quien lo llama.
+func (v *jwksVerifier) Verify(ctx context.Context, token string) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errJWTInvalid
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported alg %q", errJWTInvalid, header.Alg)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", errJWTInvalid)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("%w: bad signature", errJWTInvalid)
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	exp, ok := claims.time("exp")
+	if !ok || now.After(exp.Add(jwtLeeway)) {
+		return nil, fmt.Errorf("%w: expired", errJWTInvalid)
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Add(jwtLeeway).Before(nbf) {
+		return nil, fmt.Errorf("%w: not yet valid", errJWTInvalid)
+	}
+	return claims, nil
+}
+
+// key devuelve la clave kid. Si no está o las claves caducaron, descarga el
+// JWKS fuera del mutex (una sola descarga a la vez, como mucho una cada
+// jwksMinRefresh); mientras tanto, y si falla, vale la clave que ya se tenía.
+func (v *jwksVerifier) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	k, ok := v.keys[kid]
+	if ok && time.Since(v.fetchedAt) < jwksCacheTTL {
+		v.mu.Unlock()
+		return k, nil
+	}
+	d := v.enCurso
+	if d == nil {
+		if time.Since(v.intentoAt) < jwksMinRefresh {
+			v.mu.Unlock()
+			return claveJWKS(k, ok, kid)
+		}
+		d = &descargaJWKS{hecho: make(chan struct{})}
+		v.enCurso = d
+		v.intentoAt = time.Now()
+		// La descarga no depende de la petición que la lanza: la esperan
+		// también otras
+		go v.descargar(context.WithoutCancel(ctx), d)
+	}
+	v.mu.Unlock()
+
+	select {
+	case <-d.hecho:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	v.mu.Lock()
+	k, ok = v.keys[kid]
+	v.mu.Unlock()
+	if !ok && d.err != nil {
+		return nil, d.err
+	}
+	return claveJWKS(k, ok, kid)
+}
+
+// claveJWKS es el resultado de buscar kid en las claves: la clave o el error
+// de kid desconocido.
+func claveJWKS(k *rsa.PublicKey, ok bool, kid string) (*rsa.PublicKey, error) {
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id %q", errJWTInvalid, kid)
+	}
+	return k, nil
+}
+
+// descargar hace la descarga d y, si va bien, sustituye las claves.
+func (v *jwksVerifier) descargar(ctx context.Context, d *descargaJWKS) {
+	keys, err := v.refresh(ctx)
+	if err != nil {
+		logDe("auth").WarnContext(ctx, "Error descargando el JWKS; se mantienen las claves anteriores", errAttr(err))
+	}
+
+	v.mu.Lock()
+	if err == nil {
+		v.keys = keys
+		v.fetchedAt = time.Now()
+	}
+	d.err = err
+	v.enCurso = nil
+	v.mu.Unlock()
+	close(d.hecho)
+}
+
+// refresh descarga el JWKS y devuelve sus claves RSA. No toca el estado de v.
+func (v *jwksVerifier) refresh(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	url := v.url
+	if v.urlDe != nil {
+		var err error
+		if url, err = v.urlDe(ctx); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating JWKS request: %w", err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("error parsing JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	// Un JWKS sin claves utilizables no sustituye al anterior
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS has no usable RSA keys")
+	}
+	return keys, nil
+}
+
+func decodeJWTPart(part string, dst any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: bad encoding", errJWTInvalid)
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return fmt.Errorf("%w: bad JSON", errJWTInvalid)
+	}
+	return nil
+}
+
+// bearerToken extrae el token de un header "Authorization: Bearer ...".
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"prueba/pkg/repository"
+	"strings"
+)
+
+// Claims con los roles y el tenant del usuario si jwt_roles_claim y
+// jwt_tenant_claim no dicen otros.
+const (
+	defaultJWTRolesClaim  = "roles"
+	defaultJWTTenantClaim = "tenant"
+)
+
+// autenticacionJWT valida los JWT de los usuarios (Authorization: Bearer)
+// firmados por el proveedor de identidad de jwt_issuer con las claves de
+// jwt_jwks_url, o las que publica oidc_issuer. Es independiente de
+// schedulerAuth, que valida los tokens del scheduler.
+type autenticacionJWT struct {
+	verifier *jwksVerifier
+	issuers  []string
+	audience string
+	// claimRoles es el claim con los roles; admite rutas con puntos para
+	// claims anidados, como realm_access.roles de Keycloak.
+	claimRoles string
+	// claimTenant es el claim con el tenant del usuario, también con puntos.
+	claimTenant string
+}
+
+// jwtDesdeEntorno lee la configuración de los JWT de usuario: oidc_issuer,
+// el proveedor OIDC cuyo JWKS se descubre (ver descubrimientoOIDC), o
+// jwt_jwks_url y jwt_issuer (uno o varios separados por comas) para
+// configurarlo a mano; jwt_issuer tiene prioridad sobre oidc_issuer. Además
+// jwt_audience (opcional), jwt_roles_claim y jwt_tenant_claim. Sin
+// oidc_issuer ni jwt_jwks_url devuelve nil: los JWT no se aceptan.
+func jwtDesdeEntorno() (*autenticacionJWT, error) {
+	jwksURL := os.Getenv("jwt_jwks_url")
+	oidc := os.Getenv("oidc_issuer")
+	if jwksURL == "" && oidc == "" {
+		return nil, nil
+	}
+	a := &autenticacionJWT{
+		issuers:     lista(os.Getenv("jwt_issuer")),
+		audience:    os.Getenv("jwt_audience"),
+		claimRoles:  os.Getenv("jwt_roles_claim"),
+		claimTenant: os.Getenv("jwt_tenant_claim"),
+	}
+	switch {
+	case jwksURL != "":
+		if u, err := url.Parse(jwksURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid jwt_jwks_url %q: expected an http(s) URL", jwksURL)
+		}
+		if len(a.issuers) == 0 {
+			if oidc == "" {
+				return nil, errors.New("jwt_issuer is required when jwt_jwks_url is set")
+			}
+			a.issuers = []string{oidc}
+		}
+		a.verifier = newJWKSVerifier(jwksURL)
+	default:
+		if u, err := url.Parse(oidc); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid oidc_issuer %q: expected an http(s) URL", oidc)
+		}
+		if len(a.issuers) == 0 {
+			a.issuers = []string{oidc}
+		}
+		a.verifier = newJWKSVerifier("")
+		a.verifier.urlDe = nuevoDescubrimientoOIDC(oidc).jwks
+	}
+	if a.claimRoles == "" {
+		a.claimRoles = defaultJWTRolesClaim
+	}
+	if a.claimTenant == "" {
+		a.claimTenant = defaultJWTTenantClaim
+	}
+	if a.audience == "" {
+		logDe("auth").Warn("jwt_audience no definido: se aceptarán tokens del issuer emitidos para cualquier audiencia")
+	}
+	return a, nil
+}
+
+// propio indica si el token lo emitió uno de los issuers configurados, sin
+// verificarlo todavía. Los de otros emisores (como el token OIDC del
+// scheduler) no son credenciales de usuario y se dejan pasar.
+func (a *autenticacionJWT) propio(token string) bool {
+	partes := strings.Split(token, ".")
+	if len(partes) != 3 {
+		return false
+	}
+	var claims jwtClaims
+	if err := decodeJWTPart(partes[1], &claims); err != nil {
+		return false
+	}
+	return a.issuerValido(claims.str("iss"))
+}
+
+func (a *autenticacionJWT) issuerValido(iss string) bool {
+	for _, i := range a.issuers {
+		if iss == i {
+			return true
+		}
+	}
+	return false
+}
+
+// identificar verifica el token y devuelve la identidad de su sub con sus
+// roles y su tenant; sin el claim del tenant es el tenant por defecto. Un
+// token inválido devuelve un error que envuelve errJWTInvalid.
+func (a *autenticacionJWT) identificar(ctx context.Context, token string) (*identidad, error) {
+	claims, err := a.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !a.issuerValido(claims.str("iss")) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", errJWTInvalid, claims.str("iss"))
+	}
+	if a.audience != "" && !claims.hasAudience(a.audience) {
+		return nil, fmt.Errorf("%w: unexpected audience %v", errJWTInvalid, claims.audiences())
+	}
+	sub := claims.str("sub")
+	if sub == "" {
+		return nil, fmt.Errorf("%w: missing sub", errJWTInvalid)
+	}
+	tenant := repository.TenantPorDefecto
+	if v, ok := claims.ruta(a.claimTenant).(string); ok && v != "" {
+		if err := repository.ValidateTenant(v); err != nil {
+			return nil, fmt.Errorf("%w: %v", errJWTInvalid, err)
+		}
+		tenant = v
+	}
+	return &identidad{Sujeto: sub, Metodo: metodoJWT, Roles: claims.roles(a.claimRoles), Tenant: tenant}, nil
+}
+
+// ruta devuelve el claim ruta, con puntos para claims anidados, o nil si no
+// está.
+func (c jwtClaims) ruta(ruta string) any {
+	var v any = map[string]any(c)
+	for _, nombre := range strings.Split(ruta, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[nombre]
+	}
+	return v
+}
+
+// roles devuelve el claim ruta (con puntos para claims anidados) como lista
+// de roles. Acepta una lista de strings o un string separado por espacios o
+// comas, como el claim scope.
+func (c jwtClaims) roles(ruta string) []string {
+	switch v := c.ruta(ruta).(type) {
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' })
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, r := range v {
+			if s, ok := r.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
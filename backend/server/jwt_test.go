@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jwksPrueba es un endpoint JWKS de prueba que cuenta las descargas.
+type jwksPrueba struct {
+	*httptest.Server
+	descargas atomic.Int32
+	// estado es el código con el que responde; 0 es 200.
+	estado atomic.Int32
+	// espera retrasa cada respuesta.
+	espera time.Duration
+}
+
+func nuevoJWKSPrueba(t *testing.T, claves map[string]*rsa.PrivateKey) *jwksPrueba {
+	t.Helper()
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, k := range claves {
+		set.Keys = append(set.Keys, map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		})
+	}
+	j := &jwksPrueba{}
+	j.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		j.descargas.Add(1)
+		time.Sleep(j.espera)
+		if s := j.estado.Load(); s != 0 {
+			w.WriteHeader(int(s))
+			return
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(j.Close)
+	return j
+}
+
+func claveRSA(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// firmarJWT devuelve un JWT RS256 con la cabecera y los claims dados.
+func firmarJWT(t *testing.T, k *rsa.PrivateKey, header, claims map[string]any) string {
+	t.Helper()
+	parte := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	firmado := parte(header) + "." + parte(claims)
+	digest := sha256.Sum256([]byte(firmado))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return firmado + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWKSVerifierVerify(t *testing.T) {
+	k, otra := claveRSA(t), claveRSA(t)
+	jwks := nuevoJWKSPrueba(t, map[string]*rsa.PrivateKey{"k1": k})
+	v := newJWKSVerifier(jwks.URL)
+
+	ahora := time.Now()
+	vigente := map[string]any{"sub": "scheduler", "exp": ahora.Add(time.Hour).Unix()}
+	rs256 := map[string]any{"alg": "RS256", "kid": "k1"}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"válido", firmarJWT(t, k, rs256, vigente), false},
+		{"firmado con otra clave", firmarJWT(t, otra, rs256, vigente), true},
+		{"kid desconocido", firmarJWT(t, k, map[string]any{"alg": "RS256", "kid": "k2"}, vigente), true},
+		{"alg none", firmarJWT(t, k, map[string]any{"alg": "none", "kid": "k1"}, vigente), true},
+		{"caducado", firmarJWT(t, k, rs256, map[string]any{"exp": ahora.Add(-time.Hour).Unix()}), true},
+		{"dentro del margen de exp", firmarJWT(t, k, rs256, map[string]any{"exp": ahora.Add(-jwtLeeway / 2).Unix()}), false},
+		{"sin exp", firmarJWT(t, k, rs256, map[string]any{"sub": "scheduler"}), true},
+		{"todavía no válido", firmarJWT(t, k, rs256, map[string]any{"exp": ahora.Add(2 * time.Hour).Unix(), "nbf": ahora.Add(time.Hour).Unix()}), true},
+		{"mal formado", "no.es-un-jwt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errJWTInvalid) {
+				t.Errorf("Verify() error = %v, want errJWTInvalid", err)
+			}
+		})
+	}
+	// El kid desconocido no provoca otra descarga antes de jwksMinRefresh
+	if n := jwks.descargas.Load(); n != 1 {
+		t.Errorf("JWKS downloads = %d, want 1", n)
+	}
+}
+
+func TestJWKSVerifierUnaDescarga(t *testing.T) {
+	k := claveRSA(t)
+	jwks := nuevoJWKSPrueba(t, map[string]*rsa.PrivateKey{"k1": k})
+	jwks.espera = 50 * time.Millisecond
+	v := newJWKSVerifier(jwks.URL)
+	token := firmarJWT(t, k, map[string]any{"alg": "RS256", "kid": "k1"}, map[string]any{"exp": time.Now().Add(time.Hour).Unix()})
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.Verify(context.Background(), token); err != nil {
+				t.Errorf("Verify() = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := jwks.descargas.Load(); n != 1 {
+		t.Errorf("JWKS downloads = %d, want 1", n)
+	}
+}
+
+func TestJWKSVerifierUltimasClaves(t *testing.T) {
+	k := claveRSA(t)
+	token := firmarJWT(t, k, map[string]any{"alg": "RS256", "kid": "k1"}, map[string]any{"exp": time.Now().Add(time.Hour).Unix()})
+
+	tests := []struct {
+		name string
+		// caducadas indica si las claves descargadas ya pasaron jwksCacheTTL.
+		caducadas bool
+		// intento es cuánto hace del último intento de descarga.
+		intento       time.Duration
+		estado        int
+		wantDescargas int32
+	}{
+		{"claves vigentes no se descargan", false, time.Hour, http.StatusInternalServerError, 1},
+		{"caducadas y el JWKS falla", true, time.Hour, http.StatusInternalServerError, 2},
+		{"caducadas y el JWKS no responde 200", true, time.Hour, http.StatusNotFound, 2},
+		{"caducadas dentro del intervalo mínimo", true, 0, http.StatusInternalServerError, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwks := nuevoJWKSPrueba(t, map[string]*rsa.PrivateKey{"k1": k})
+			v := newJWKSVerifier(jwks.URL)
+			if _, err := v.Verify(context.Background(), token); err != nil {
+				t.Fatalf("first Verify() = %v", err)
+			}
+
+			jwks.estado.Store(int32(tt.estado))
+			v.mu.Lock()
+			if tt.caducadas {
+				v.fetchedAt = time.Now().Add(-2 * jwksCacheTTL)
+			}
+			v.intentoAt = time.Now().Add(-tt.intento)
+			v.mu.Unlock()
+
+			if _, err := v.Verify(context.Background(), token); err != nil {
+				t.Errorf("Verify() with the last good keys = %v", err)
+			}
+			if n := jwks.descargas.Load(); n != tt.wantDescargas {
+				t.Errorf("JWKS downloads = %d, want %d", n, tt.wantDescargas)
+			}
+		})
+	}
+}
+
+func TestJWKSVerifierSinClaves(t *testing.T) {
+	k := claveRSA(t)
+	jwks := nuevoJWKSPrueba(t, map[string]*rsa.PrivateKey{"k1": k})
+	vacio := nuevoJWKSPrueba(t, nil)
+	v := newJWKSVerifier(jwks.URL)
+	token := firmarJWT(t, k, map[string]any{"alg": "RS256", "kid": "k1"}, map[string]any{"exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+
+	// Un JWKS vacío no sustituye a las claves buenas
+	v.mu.Lock()
+	v.url = vacio.URL
+	v.fetchedAt = time.Time{}
+	v.intentoAt = time.Time{}
+	v.mu.Unlock()
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Errorf("Verify() after an empty JWKS = %v", err)
+	}
+	if n := vacio.descargas.Load(); n != 1 {
+		t.Errorf("empty JWKS downloads = %d, want 1", n)
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"prueba/internal/metrics"
+	"prueba/pkg/repository"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Valores por defecto del bloqueo de cuentas: tras 5 fallos seguidos la
+// cuenta se bloquea 1 minuto, y cada fallo más dobla el bloqueo hasta 1 hora.
+// Se recuerdan como mucho 10000 cuentas con fallos.
+const (
+	defaultLockoutThreshold  = 5
+	defaultLockoutDuration   = time.Minute
+	defaultLockoutMax        = time.Hour
+	defaultLockoutMaxEntries = 10000
+)
+
+var (
+	authFailures = metrics.NewCounter("auth_failures_total",
+		"Credenciales rechazadas por método de autenticación.", "method")
+	authLockouts = metrics.NewCounter("auth_lockouts_total",
+		"Cuentas bloqueadas temporalmente por fallos seguidos, por método.", "method")
+	authLockedRejected = metrics.NewCounter("auth_locked_rejected_total",
+		"Intentos rechazados sin comprobarlos por estar la cuenta bloqueada, por método.", "method")
+	authLockoutEvicted = metrics.NewCounter("auth_lockout_evicted_total",
+		"Cuentas con fallos olvidadas antes de tiempo por estar llena la tabla de bloqueos.")
+)
+
+// Bloqueo es la política de bloqueo de cuentas por fallos seguidos en el
+// inicio de sesión y en Basic auth.
+type Bloqueo struct {
+	// Umbral son los fallos seguidos que bloquean la cuenta
+	// (auth_lockout_threshold); 0 no bloquea.
+	Umbral int
+	// Duracion es el primer bloqueo (auth_lockout_duration); cada fallo más
+	// lo dobla hasta Maximo (auth_lockout_max).
+	Duracion time.Duration
+	Maximo   time.Duration
+	// Entradas son las cuentas con fallos que se recuerdan como mucho
+	// (auth_lockout_max_entries): los fallos con usuarios inventados no
+	// pueden hacer crecer la memoria sin límite. Con la tabla llena se
+	// olvida la cuenta no bloqueada con el fallo más antiguo.
+	Entradas int
+}
+
+// bloqueoEntorno lee auth_lockout_threshold, auth_lockout_duration,
+// auth_lockout_max y auth_lockout_max_entries.
+func bloqueoEntorno() (Bloqueo, error) {
+	b := Bloqueo{
+		Umbral:   defaultLockoutThreshold,
+		Duracion: envDuration("auth_lockout_duration", defaultLockoutDuration),
+		Maximo:   envDuration("auth_lockout_max", defaultLockoutMax),
+		Entradas: envInt("auth_lockout_max_entries", defaultLockoutMaxEntries),
+	}
+	if v := os.Getenv("auth_lockout_threshold"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return b, fmt.Errorf("invalid auth_lockout_threshold %q: expected a non-negative integer", v)
+		}
+		b.Umbral = n
+	}
+	if b.Maximo < b.Duracion {
+		return b, fmt.Errorf("invalid auth_lockout_max %s: must not be less than auth_lockout_duration %s", b.Maximo, b.Duracion)
+	}
+	return b, nil
+}
+
+// fallosCuenta son los fallos seguidos de una cuenta.
+type fallosCuenta struct {
+	fallos int
+	ultimo time.Time
+	hasta  time.Time
+}
+
+// bloqueos cuenta los fallos seguidos de cada cuenta (método y usuario,
+// existan o no) y las bloquea temporalmente, para frenar la prueba masiva de
+// contraseñas. Son de cada proceso. Un *bloqueos nil no bloquea nada.
+type bloqueos struct {
+	politica Bloqueo
+
+	mu       sync.Mutex
+	cuentas  map[string]*fallosCuenta
+	limpieza time.Time
+}
+
+func nuevosBloqueos(p Bloqueo) *bloqueos {
+	if p.Umbral == 0 {
+		return nil
+	}
+	if p.Entradas <= 0 {
+		p.Entradas = defaultLockoutMaxEntries
+	}
+	return &bloqueos{politica: p, cuentas: map[string]*fallosCuenta{}}
+}
+
+func claveBloqueo(metodo, usuario string) string {
+	return metodo + ":" + strings.ToLower(usuario)
+}
+
+// bloqueada devuelve lo que le queda de bloqueo a la cuenta, o 0.
+func (b *bloqueos) bloqueada(metodo, usuario string, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.cuentas[claveBloqueo(metodo, usuario)]; ok && now.Before(c.hasta) {
+		return c.hasta.Sub(now)
+	}
+	return 0
+}
+
+// fallo anota un fallo de la cuenta y, si llega al umbral, la bloquea;
+// devuelve la duración del bloqueo, o 0.
+func (b *bloqueos) fallo(metodo, usuario string, now time.Time) time.Duration {
+	authFailures.Inc(metodo)
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limpiar(now)
+	k := claveBloqueo(metodo, usuario)
+	c, ok := b.cuentas[k]
+	if !ok {
+		if len(b.cuentas) >= b.politica.Entradas && !b.hacerSitio(now) {
+			// Todas bloqueadas: no se anota hasta que caduque alguna.
+			return 0
+		}
+		c = &fallosCuenta{}
+		b.cuentas[k] = c
+	}
+	c.fallos++
+	c.ultimo = now
+	if c.fallos < b.politica.Umbral {
+		return 0
+	}
+	d := time.Duration(float64(b.politica.Duracion) * math.Pow(2, float64(c.fallos-b.politica.Umbral)))
+	if d > b.politica.Maximo || d <= 0 {
+		d = b.politica.Maximo
+	}
+	c.hasta = now.Add(d)
+	authLockouts.Inc(metodo)
+	return d
+}
+
+// exito olvida los fallos de la cuenta.
+func (b *bloqueos) exito(metodo, usuario string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.cuentas, claveBloqueo(metodo, usuario))
+}
+
+// limpiar olvida, como mucho una vez por minuto, las cuentas sin fallos en
+// el último bloqueo máximo que no siguen bloqueadas.
+func (b *bloqueos) limpiar(now time.Time) {
+	if now.Sub(b.limpieza) < time.Minute {
+		return
+	}
+	b.limpieza = now
+	for k, c := range b.cuentas {
+		if now.Sub(c.ultimo) > b.politica.Maximo && !now.Before(c.hasta) {
+			delete(b.cuentas, k)
+		}
+	}
+}
+
+// hacerSitio olvida la cuenta no bloqueada con el fallo más antiguo para
+// anotar otra con la tabla llena; devuelve false si todas están bloqueadas.
+func (b *bloqueos) hacerSitio(now time.Time) bool {
+	var viejo string
+	var ultimo time.Time
+	for k, c := range b.cuentas {
+		if now.Before(c.hasta) {
+			continue
+		}
+		if viejo == "" || c.ultimo.Before(ultimo) {
+			viejo, ultimo = k, c.ultimo
+		}
+	}
+	if viejo == "" {
+		return false
+	}
+	delete(b.cuentas, viejo)
+	authLockoutEvicted.Inc()
+	return true
+}
+
+// rechazarBloqueada responde 429 con Retry-After si la cuenta está
+// bloqueada, sin comprobar la contraseña, y devuelve true.
+func (s *Server) rechazarBloqueada(w http.ResponseWriter, r *http.Request, metodo, usuario string) bool {
+	restante := s.bloqueos.bloqueada(metodo, usuario, time.Now())
+	if restante <= 0 {
+		return false
+	}
+	authLockedRejected.Inc(metodo)
+	segundos := int(math.Ceil(restante.Seconds()))
+	logDe("auth").WarnContext(r.Context(), "Intento sobre una cuenta bloqueada", "user", usuario, "method", metodo)
+	s.auditoria.registrar(r, repository.AuditEvent{Action: repository.AuditAuthFailure, Actor: usuario, AuthMethod: metodo, Status: http.StatusTooManyRequests, Detail: "account locked"})
+	w.Header().Set("Retry-After", strconv.Itoa(segundos))
+	errorHTTP(w, r, http.StatusTooManyRequests, msgAccountLocked, segundos)
+	return true
+}
+
+// anotarFallo anota el fallo de la cuenta y, si queda bloqueada, lo deja en
+// los logs y en el registro de auditoría.
+func (s *Server) anotarFallo(r *http.Request, metodo, usuario string) {
+	if d := s.bloqueos.fallo(metodo, usuario, time.Now()); d > 0 {
+		logDe("auth").WarnContext(r.Context(), "Cuenta bloqueada temporalmente por fallos seguidos", "user", usuario, "method", metodo, "duration", d.String())
+		s.auditoria.registrar(r, repository.AuditEvent{Action: repository.AuditAuthLockout, Actor: usuario, AuthMethod: metodo, Detail: "locked for " + d.String()})
+	}
+}
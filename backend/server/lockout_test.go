@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBloqueos(t *testing.T) {
+	politica := Bloqueo{Umbral: 3, Duracion: time.Minute, Maximo: 4 * time.Minute, Entradas: 100}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		pasos func(b *bloqueos)
+		// consulta es el instante en que se mira si "ana" está bloqueada.
+		consulta time.Duration
+		want     time.Duration
+	}{
+		{"por debajo del umbral", func(b *bloqueos) {
+			b.fallo(metodoPassword, "ana", now)
+			b.fallo(metodoPassword, "ana", now)
+		}, 0, 0},
+		{"al llegar al umbral", func(b *bloqueos) {
+			for range 3 {
+				b.fallo(metodoPassword, "ana", now)
+			}
+		}, 0, time.Minute},
+		{"cada fallo más dobla el bloqueo", func(b *bloqueos) {
+			for range 4 {
+				b.fallo(metodoPassword, "ana", now)
+			}
+		}, 0, 2 * time.Minute},
+		{"hasta el máximo", func(b *bloqueos) {
+			for range 10 {
+				b.fallo(metodoPassword, "ana", now)
+			}
+		}, 0, 4 * time.Minute},
+		{"el bloqueo caduca", func(b *bloqueos) {
+			for range 3 {
+				b.fallo(metodoPassword, "ana", now)
+			}
+		}, time.Minute, 0},
+		{"sin distinguir mayúsculas", func(b *bloqueos) {
+			for range 3 {
+				b.fallo(metodoPassword, "ANA", now)
+			}
+		}, 0, time.Minute},
+		{"un acierto olvida los fallos", func(b *bloqueos) {
+			b.fallo(metodoPassword, "ana", now)
+			b.fallo(metodoPassword, "ana", now)
+			b.exito(metodoPassword, "ana")
+			b.fallo(metodoPassword, "ana", now)
+		}, 0, 0},
+		{"cada método por separado", func(b *bloqueos) {
+			for range 3 {
+				b.fallo(metodoBasic, "ana", now)
+			}
+		}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := nuevosBloqueos(politica)
+			tt.pasos(b)
+			if got := b.bloqueada(metodoPassword, "ana", now.Add(tt.consulta)); got != tt.want {
+				t.Errorf("bloqueada() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBloqueosNil(t *testing.T) {
+	b := nuevosBloqueos(Bloqueo{Umbral: 0})
+	if b != nil {
+		t.Fatal("nuevosBloqueos with Umbral 0 should disable the lockout")
+	}
+	if d := b.fallo(metodoPassword, "ana", time.Now()); d != 0 {
+		t.Errorf("fallo() = %s, want 0", d)
+	}
+	if d := b.bloqueada(metodoPassword, "ana", time.Now()); d != 0 {
+		t.Errorf("bloqueada() = %s, want 0", d)
+	}
+}
+
+func TestBloqueosEntradas(t *testing.T) {
+	b := nuevosBloqueos(Bloqueo{Umbral: 2, Duracion: time.Minute, Maximo: time.Hour, Entradas: 3})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// "ana" queda bloqueada y no se olvida aunque se llene la tabla
+	b.fallo(metodoPassword, "ana", now)
+	b.fallo(metodoPassword, "ana", now)
+	for i := range 50 {
+		b.fallo(metodoPassword, fmt.Sprintf("inventado%d", i), now.Add(time.Duration(i)*time.Second))
+	}
+
+	if n := len(b.cuentas); n > 3 {
+		t.Errorf("len(cuentas) = %d, want at most 3", n)
+	}
+	if d := b.bloqueada(metodoPassword, "ana", now); d != time.Minute {
+		t.Errorf("bloqueada(ana) = %s, want %s", d, time.Minute)
+	}
+	// Se olvidan las más antiguas, no las últimas
+	if _, ok := b.cuentas[claveBloqueo(metodoPassword, "inventado49")]; !ok {
+		t.Error("the most recent account was evicted")
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Duración por defecto y máxima de un cambio de nivel de log desde la API:
+// el nivel vuelve solo al de log_level para que un debug olvidado no llene
+// los logs.
+const (
+	defaultLogLevelTTL = time.Hour
+	maxLogLevelTTL     = 24 * time.Hour
+)
+
+// nivelTemporal es el nivel de log que se fija desde PUT /admin/log-level,
+// por encima de log_level hasta que vence. Es de este proceso: en cada
+// réplica hay que cambiarlo por separado (o por su admin_addr).
+type nivelTemporal struct {
+	mu          sync.Mutex
+	configurado string
+	temporal    string
+	hasta       time.Time
+	timer       *time.Timer
+}
+
+var ajusteNivelLog = &nivelTemporal{configurado: logInfo}
+
+// estadoNivelLog es la respuesta de /admin/log-level: el nivel en vigor, el
+// de log_level y, si hay uno temporal, hasta cuándo dura.
+type estadoNivelLog struct {
+	Level      string     `json:"level"`
+	Configured string     `json:"configured"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// configurar cambia el nivel de log_level (al arrancar y en Reload). Si hay
+// un nivel temporal sigue en vigor hasta que venza.
+func (n *nivelTemporal) configurar(nivel string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.configurado = nivel
+	if n.temporal == "" {
+		nivelLog.Set(nivelSlog(nivel))
+	}
+}
+
+// fijar pone nivel durante d.
+func (n *nivelTemporal) fijar(nivel string, d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.timer != nil {
+		n.timer.Stop()
+	}
+	hasta := time.Now().Add(d).UTC()
+	n.temporal, n.hasta = nivel, hasta
+	nivelLog.Set(nivelSlog(nivel))
+	n.timer = time.AfterFunc(d, func() { n.vencer(hasta) })
+}
+
+// vencer quita el nivel temporal que vencía en hasta, si no se ha cambiado
+// por otro desde entonces.
+func (n *nivelTemporal) vencer(hasta time.Time) {
+	n.mu.Lock()
+	if n.temporal == "" || !n.hasta.Equal(hasta) {
+		n.mu.Unlock()
+		return
+	}
+	n.temporal, n.hasta, n.timer = "", time.Time{}, nil
+	nivelLog.Set(nivelSlog(n.configurado))
+	nivel := n.configurado
+	n.mu.Unlock()
+	logDe("log").Info("Nivel de log temporal vencido", "level", nivel)
+}
+
+// quitar vuelve al nivel de log_level. Devuelve false si no había uno
+// temporal.
+func (n *nivelTemporal) quitar() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.temporal == "" {
+		return false
+	}
+	if n.timer != nil {
+		n.timer.Stop()
+	}
+	n.temporal, n.hasta, n.timer = "", time.Time{}, nil
+	nivelLog.Set(nivelSlog(n.configurado))
+	return true
+}
+
+func (n *nivelTemporal) estado() estadoNivelLog {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	e := estadoNivelLog{Level: n.configurado, Configured: n.configurado}
+	if n.temporal != "" {
+		hasta := n.hasta
+		e.Level, e.ExpiresAt = n.temporal, &hasta
+	}
+	return e
+}
+
+func responderNivelLog(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(ajusteNivelLog.estado())
+}
+
+// verNivelLog es GET /admin/log-level.
+func verNivelLog() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responderNivelLog(w)
+	}
+}
+
+// fijarNivelLog es PUT /admin/log-level con {"level": "debug", "duration":
+// "30m"}: cambia el nivel de log de este proceso sin reiniciar, durante
+// duration (por defecto una hora, máximo 24). Para depurar un incidente sin
+// desplegar con otro log_level.
+func (s *Server) fijarNivelLog() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Level    string `json:"level"`
+			Duration string `json:"duration"`
+		}
+		if !decodificarJSON(w, r, &body) {
+			return
+		}
+		switch body.Level {
+		case logDebug, logInfo, logWarn, logError:
+		default:
+			errorHTTP(w, r, http.StatusBadRequest, msgLogLevelInvalid, body.Level)
+			return
+		}
+		d := defaultLogLevelTTL
+		if body.Duration != "" {
+			v, err := time.ParseDuration(body.Duration)
+			if err != nil || v <= 0 || v > maxLogLevelTTL {
+				errorHTTP(w, r, http.StatusBadRequest, msgLogDurationInvalid, body.Duration)
+				return
+			}
+			d = v
+		}
+
+		ajusteNivelLog.fijar(body.Level, d)
+		s.log.WarnContext(r.Context(), "Nivel de log cambiado desde la API", "level", body.Level, "duration", d)
+		responderNivelLog(w)
+	}
+}
+
+// quitarNivelLog es DELETE /admin/log-level: vuelve al nivel de log_level.
+func (s *Server) quitarNivelLog() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ajusteNivelLog.quitar() {
+			s.log.InfoContext(r.Context(), "Nivel de log devuelto al de log_level", "level", ajusteNivelLog.estado().Level)
+		}
+		responderNivelLog(w)
+	}
+}
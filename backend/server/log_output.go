@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"prueba/internal/logfile"
+	"prueba/internal/metrics"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rotación del fichero de log si no se indica otra: cada 100 MB,
+// conservando los 7 últimos.
+const (
+	defaultLogFileMaxSizeMB  = 100
+	defaultLogFileMaxBackups = 7
+)
+
+var logRecordsSampled = metrics.NewCounter("log_records_sampled_total",
+	"Registros de log de debug descartados por el muestreo (log_debug_sample_*).")
+
+// ficheroLogEntorno lee log_file: con él los logs van a ese fichero en lugar
+// de a la salida de error, para las máquinas sin un colector que la
+// recoja. El fichero se rota al pasar de log_file_max_size_mb megas y, con
+// log_file_max_age, al cumplir esa antigüedad (24h para uno por día); se
+// conservan log_file_max_backups ficheros rotados (0 todos). Sin log_file
+// devuelve nil.
+func ficheroLogEntorno() (*logfile.Config, error) {
+	path := os.Getenv("log_file")
+	if path == "" {
+		return nil, nil
+	}
+	cfg := &logfile.Config{Path: path, MaxSize: defaultLogFileMaxSizeMB << 20, MaxBackups: defaultLogFileMaxBackups}
+	if v := os.Getenv("log_file_max_size_mb"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid log_file_max_size_mb %q: expected a number of megabytes (0 disables it)", v)
+		}
+		cfg.MaxSize = int64(n) << 20
+	}
+	if v := os.Getenv("log_file_max_age"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid log_file_max_age %q: expected a duration (0 disables it)", v)
+		}
+		cfg.MaxAge = d
+	}
+	if v := os.Getenv("log_file_max_backups"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid log_file_max_backups %q: expected a number (0 keeps all)", v)
+		}
+		cfg.MaxBackups = n
+	}
+	return cfg, nil
+}
+
+// MuestreoLog es el muestreo de los logs de debug (ver muestreoLogEntorno).
+type MuestreoLog struct {
+	// Primeros son los registros de cada mensaje que se escriben en cada
+	// segundo; 0 desactiva el muestreo.
+	Primeros int
+	// Cada es, pasados los primeros, cada cuántos se escribe uno; 0 descarta
+	// el resto.
+	Cada int
+}
+
+// muestreoLogEntorno lee log_debug_sample_first y log_debug_sample_every:
+// con log_level=debug en producción, de cada mensaje de debug se escriben
+// los primeros log_debug_sample_first de cada segundo y después uno de cada
+// log_debug_sample_every. Los de info y superiores no se muestrean nunca.
+func muestreoLogEntorno() (MuestreoLog, error) {
+	var m MuestreoLog
+	for _, v := range []struct {
+		nombre string
+		dest   *int
+	}{
+		{"log_debug_sample_first", &m.Primeros},
+		{"log_debug_sample_every", &m.Cada},
+	} {
+		s := os.Getenv(v.nombre)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return MuestreoLog{}, fmt.Errorf("invalid %s %q: expected a non-negative number", v.nombre, s)
+		}
+		*v.dest = n
+	}
+	if m.Cada > 0 && m.Primeros == 0 {
+		return MuestreoLog{}, fmt.Errorf("log_debug_sample_every requires log_debug_sample_first")
+	}
+	return m, nil
+}
+
+// handlerMuestreo descarta parte de los registros de debug repetidos (ver
+// MuestreoLog). Los registros se agrupan por mensaje, que en este código es
+// un texto fijo; las cuentas se comparten entre los handlers derivados con
+// WithAttrs.
+type handlerMuestreo struct {
+	slog.Handler
+	m       MuestreoLog
+	cuentas *cuentasMuestreo
+}
+
+type cuentasMuestreo struct {
+	mu      sync.Mutex
+	segundo int64
+	n       map[string]int
+}
+
+func nuevoHandlerMuestreo(h slog.Handler, m MuestreoLog) slog.Handler {
+	if m.Primeros <= 0 {
+		return h
+	}
+	return handlerMuestreo{Handler: h, m: m, cuentas: &cuentasMuestreo{n: map[string]int{}}}
+}
+
+func (h handlerMuestreo) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelInfo && !h.cuentas.escribir(r.Message, r.Time.Unix(), h.m) {
+		logRecordsSampled.Inc()
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h handlerMuestreo) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return handlerMuestreo{h.Handler.WithAttrs(attrs), h.m, h.cuentas}
+}
+
+func (h handlerMuestreo) WithGroup(name string) slog.Handler {
+	return handlerMuestreo{h.Handler.WithGroup(name), h.m, h.cuentas}
+}
+
+// escribir cuenta un registro de mensaje en el segundo dado y dice si se
+// escribe.
+func (c *cuentasMuestreo) escribir(mensaje string, segundo int64, m MuestreoLog) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if segundo != c.segundo {
+		c.segundo = segundo
+		clear(c.n)
+	}
+	c.n[mensaje]++
+	n := c.n[mensaje]
+	if n <= m.Primeros {
+		return true
+	}
+	return m.Cada > 0 && (n-m.Primeros)%m.Cada == 0
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"prueba/internal/logfile"
+	"prueba/internal/redact"
+)
+
+// Formatos de log_format.
+const (
+	logFormatJSON = "json"
+	logFormatText = "text"
+)
+
+// nivelLog es el nivel mínimo de los logs (log_level).
+var nivelLog = new(slog.LevelVar)
+
+// NewLogger crea el logger estructurado de la aplicación según cfg: JSON
+// (log_format=json, por defecto en producción) para el agregador de logs o
+// texto para leerlo en la terminal, con el nivel de log_level. Cada registro
+// lleva además los atributos que se hayan añadido al contexto con conLog
+// (request_id, run_id...). Los secretos se quitan de los mensajes y los
+// atributos (ver redact).
+//
+// Con log_file los logs van a un fichero que se rota (ver
+// ficheroLogEntorno) y con log_debug_sample_* se descarta parte de los de
+// debug (ver muestreoLogEntorno).
+//
+// El logger se instala como el de slog y el del paquete log, de modo que los
+// mensajes de las librerías salen en el mismo formato.
+func NewLogger(cfg Config) (*slog.Logger, error) {
+	nivelLog.Set(nivelSlog(cfg.LogLevel))
+	var salida io.Writer = os.Stderr
+	if cfg.LogFile != nil {
+		f, err := logfile.Open(*cfg.LogFile)
+		if err != nil {
+			return nil, err
+		}
+		salida = f
+	}
+	h := nuevoHandlerMuestreo(redact.Handler{Handler: nuevoHandler(salida, cfg.LogFormat)}, cfg.LogSampling)
+	logger := slog.New(handlerContexto{h})
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+func nuevoHandler(w io.Writer, formato string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: nivelLog}
+	if formato == logFormatText {
+		return slog.NewTextHandler(w, opts)
+	}
+	return slog.NewJSONHandler(w, opts)
+}
+
+// nivelSlog traduce log_level (ya validado en LoadConfig) a slog.
+func nivelSlog(nivel string) slog.Level {
+	switch nivel {
+	case logDebug:
+		return slog.LevelDebug
+	case logWarn:
+		return slog.LevelWarn
+	case logError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// logErroresHTTP es el ErrorLog del http.Server (conexiones cortadas,
+// handshakes TLS fallidos...), con nivel warn.
+func logErroresHTTP(l *slog.Logger) *log.Logger {
+	return slog.NewLogLogger(componente(l, "http").Handler(), slog.LevelWarn)
+}
+
+// logDe es el logger del componente nombre para el código que no cuelga de
+// un Server.
+func logDe(nombre string) *slog.Logger {
+	return componente(slog.Default(), nombre)
+}
+
+// componente devuelve el logger de una parte de la aplicación (sync, http,
+// cdc...), que se identifica con el atributo component.
+func componente(l *slog.Logger, nombre string) *slog.Logger {
+	return l.With("component", nombre)
+}
+
+// errAttr es el atributo con el que se registran los errores.
+func errAttr(err error) slog.Attr {
+	return slog.Any("error", err)
+}
+
+type claveLog struct{}
+
+// conLog devuelve ctx con los atributos args (pares clave, valor) añadidos a
+// los que ya tuviera; los logs que se emitan con ese contexto los incluyen.
+func conLog(ctx context.Context, args ...any) context.Context {
+	prev, _ := ctx.Value(claveLog{}).([]slog.Attr)
+	attrs := append([]slog.Attr(nil), prev...)
+	for i := 0; i+1 < len(args); i += 2 {
+		attrs = append(attrs, slog.Any(args[i].(string), args[i+1]))
+	}
+	return context.WithValue(ctx, claveLog{}, attrs)
+}
+
+// handlerContexto añade a cada registro los atributos del contexto (conLog).
+type handlerContexto struct{ slog.Handler }
+
+func (h handlerContexto) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(claveLog{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h handlerContexto) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return handlerContexto{h.Handler.WithAttrs(attrs)}
+}
+
+func (h handlerContexto) WithGroup(name string) slog.Handler {
+	return handlerContexto{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"prueba/pkg/repository"
+	"strconv"
+	"time"
+)
+
+// flagMantenimiento es la fila de feature_flags con el modo mantenimiento
+// activado desde la API, para que lo vean todas las réplicas. No es un
+// feature flag: no aparece en /admin/flags y no lo enciende el perfil.
+const flagMantenimiento = "maintenance"
+
+// Retry-After de las respuestas en mantenimiento.
+const defaultMaintenanceRetryAfter = 5 * time.Minute
+
+// modoMantenimiento lee maintenance_mode: con true se arranca en
+// mantenimiento (ver bloquearEnMantenimiento).
+func modoMantenimiento() (bool, error) {
+	v := os.Getenv("maintenance_mode")
+	if v == "" {
+		return false, nil
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid maintenance_mode %q: expected true or false", v)
+	}
+	return on, nil
+}
+
+// enMantenimiento indica si el modo mantenimiento está activo.
+func (s *Server) enMantenimiento(ctx context.Context) bool {
+	return s.flags.activo(ctx, flagMantenimiento)
+}
+
+// bloquearEnMantenimiento responde 503 a las escrituras (sincronizaciones,
+// ediciones) mientras dure el mantenimiento, p. ej. durante una migración del
+// esquema; las lecturas siguen funcionando. El cuerpo es JSON (ver
+// errorJSON) para que el frontend pueda mostrar el mensaje.
+func (s *Server) bloquearEnMantenimiento(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.enMantenimiento(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		retry := envDuration("maintenance_retry_after", defaultMaintenanceRetryAfter)
+		w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())))
+		errorJSON(w, r, http.StatusServiceUnavailable, "maintenance", msgMaintenance)
+	})
+}
+
+// verMantenimiento es GET /admin/maintenance.
+func (s *Server) verMantenimiento() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.flags.estado(r.Context(), flagMantenimiento))
+	}
+}
+
+// fijarMantenimiento es PUT /admin/maintenance con {"enabled": bool}: activa
+// o desactiva el mantenimiento en todas las réplicas, por encima de
+// maintenance_mode.
+func (s *Server) fijarMantenimiento() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Enabled *bool `json:"enabled"`
+		}
+		if !decodificarJSON(w, r, &body) {
+			return
+		}
+		if body.Enabled == nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgFlagEnabledReq)
+			return
+		}
+
+		if err := s.store.Flags.Set(r.Context(), flagMantenimiento, *body.Enabled); err != nil {
+			responderError(w, r, msgFlagError, err)
+			return
+		}
+		s.flags.invalidar()
+		if *body.Enabled {
+			s.log.WarnContext(r.Context(), "Modo mantenimiento activado: escrituras bloqueadas")
+		} else {
+			s.log.InfoContext(r.Context(), "Modo mantenimiento desactivado")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.flags.estado(r.Context(), flagMantenimiento))
+	}
+}
+
+// quitarMantenimiento es DELETE /admin/maintenance: el mantenimiento vuelve a
+// depender de maintenance_mode.
+func (s *Server) quitarMantenimiento() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.store.Flags.Delete(r.Context(), flagMantenimiento)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			responderError(w, r, msgFlagError, err)
+			return
+		}
+		s.flags.invalidar()
+		s.log.InfoContext(r.Context(), "Modo mantenimiento devuelto al valor del entorno")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.flags.estado(r.Context(), flagMantenimiento))
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"prueba/pkg/repository"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// filtrosPrueba es un SavedFilterRepository sin filtros que acepta los
+// cambios.
+type filtrosPrueba struct {
+	repository.SavedFilterRepository
+}
+
+func (filtrosPrueba) List(ctx context.Context, owner string) ([]repository.SavedFilter, error) {
+	return nil, nil
+}
+
+func (filtrosPrueba) Create(ctx context.Context, owner string, f repository.SavedFilter) (*repository.SavedFilter, error) {
+	f.ID = 1
+	return &f, nil
+}
+
+func (filtrosPrueba) Delete(ctx context.Context, owner string, id int64) error {
+	return nil
+}
+
+// usuariosPrueba es un UserRepository con una sola cuenta.
+type usuariosPrueba struct {
+	repository.UserRepository
+	u repository.User
+}
+
+func (f usuariosPrueba) FindByEmail(ctx context.Context, email string) (*repository.User, error) {
+	if email != f.u.Email {
+		return nil, repository.ErrNotFound
+	}
+	return &f.u, nil
+}
+
+func (usuariosPrueba) RecordLogin(ctx context.Context, id int64) error {
+	return nil
+}
+
+// sesionesPrueba es un SessionRepository que acepta las sesiones nuevas.
+type sesionesPrueba struct {
+	repository.SessionRepository
+}
+
+func (sesionesPrueba) Create(ctx context.Context, hash string, userID int64, expiresAt time.Time) error {
+	return nil
+}
+
+// servidorEnMantenimiento es un Server con las rutas de la API y el modo
+// mantenimiento activo (o no).
+func servidorEnMantenimiento(t *testing.T, store *repository.Store, activo bool) http.Handler {
+	t.Helper()
+	// Sin registro de auditoría, que necesitaría un AuditLogRepository
+	t.Setenv("audit_log", "false")
+	s := NewServer(Config{}, store, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	s.flags.fijados = map[string]bool{flagMantenimiento: activo}
+	mux, _ := s.routes(false)
+	return mux
+}
+
+func TestFiltrosEnMantenimiento(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		activo     bool
+		wantStatus int
+	}{
+		{"listar", http.MethodGet, "/me/filters", "", true, http.StatusOK},
+		{"crear", http.MethodPost, "/me/filters", `{"name":"míos"}`, true, http.StatusServiceUnavailable},
+		{"editar", http.MethodPut, "/me/filters/1", `{"name":"míos"}`, true, http.StatusServiceUnavailable},
+		{"borrar", http.MethodDelete, "/me/filters/1", "", true, http.StatusServiceUnavailable},
+		{"crear fuera de mantenimiento", http.MethodPost, "/me/filters", `{"name":"míos"}`, false, http.StatusCreated},
+		{"borrar fuera de mantenimiento", http.MethodDelete, "/me/filters/1", "", false, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := servidorEnMantenimiento(t, &repository.Store{Filters: filtrosPrueba{}}, tt.activo)
+
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r = r.WithContext(context.WithValue(r.Context(), claveIdentidad{}, &identidad{Sujeto: "ana", Roles: []string{rolViewer}}))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
+
+func TestAccesoEnMantenimiento(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("contraseña-larga"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &repository.Store{
+		Users:    usuariosPrueba{u: repository.User{ID: 1, Email: "ana@example.com", Role: rolViewer, PasswordHash: string(hash)}},
+		Sessions: sesionesPrueba{},
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"iniciar sesión", "/auth/login", `{"email":"ana@example.com","password":"contraseña-larga"}`, http.StatusOK},
+		{"contraseña incorrecta", "/auth/login", `{"email":"ana@example.com","password":"otra"}`, http.StatusUnauthorized},
+		{"registrarse", "/auth/register", `{"email":"luis@example.com","password":"contraseña-larga"}`, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := servidorEnMantenimiento(t, store, true)
+
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"prueba/internal/metrics"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// rutaSinPatron es la ruta de las métricas de las peticiones que no
+// corresponden a ninguna (404, 405), para no crear una serie por URL.
+const rutaSinPatron = "unmatched"
+
+var (
+	httpRequests = metrics.NewCounter("http_requests_total",
+		"Peticiones HTTP por ruta, método y código de respuesta.", "route", "method", "status")
+	httpDuration = metrics.NewHistogram("http_request_duration_seconds",
+		"Duración de las peticiones HTTP por ruta y método.",
+		[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}, "route", "method")
+
+	itemsTotal = metrics.NewGauge("items",
+		"Items guardados por tenant, tras la última sincronización.", "tenant")
+	itemsTickers = metrics.NewGauge("items_tickers",
+		"Tickers distintos por tenant, tras la última sincronización.", "tenant")
+
+	goGoroutines = metrics.NewGauge("go_goroutines",
+		"Goroutines en ejecución.")
+	goHeapAlloc = metrics.NewGauge("go_memstats_heap_alloc_bytes",
+		"Memoria del heap en uso.")
+	goSys = metrics.NewGauge("go_memstats_sys_bytes",
+		"Memoria obtenida del sistema operativo.")
+	goGCCycles = metrics.NewGauge("go_gc_cycles_total",
+		"Ciclos del recolector de basura completados.")
+	processStart = metrics.NewGauge("process_start_time_seconds",
+		"Hora de arranque del proceso (segundos desde 1970).")
+)
+
+var inicioProceso = time.Now()
+
+type claveRuta struct{}
+
+// metricasHTTPMiddleware cuenta las peticiones y mide su duración por ruta
+// (el patrón del mux, p. ej. "GET /sync/history/{id}/retry"), método y
+// código. La ruta la anota anotarRuta, que va justo alrededor del mux.
+func metricasHTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ruta := new(string)
+		rw := &respuestaRegistrada{ResponseWriter: w}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), claveRuta{}, ruta)))
+
+		status := rw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if *ruta == "" {
+			*ruta = rutaSinPatron
+		}
+		httpRequests.Inc(*ruta, r.Method, strconv.Itoa(status))
+		httpDuration.ObserveSince(start, *ruta, r.Method)
+		alertasErrores.peticion(status)
+	})
+}
+
+// anotarRuta pasa a metricasHTTPMiddleware el patrón con el que el mux
+// atendió la petición.
+func anotarRuta(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		if ruta, ok := r.Context().Value(claveRuta{}).(*string); ok {
+			*ruta = r.Pattern
+		}
+	})
+}
+
+// actualizarMetricasItems pone en las métricas los items del tenant de ctx.
+func (s *Server) actualizarMetricasItems(ctx context.Context, tenant string) {
+	st, err := s.store.Items.Stats(ctx)
+	if err != nil {
+		s.logSync.WarnContext(ctx, "No se pudieron leer las estadísticas de items para las métricas", errAttr(err))
+		return
+	}
+	itemsTotal.Set(float64(st.Total), tenant)
+	itemsTickers.Set(float64(st.Tickers), tenant)
+}
+
+// tokenMetricas exige Authorization: Bearer token en GET /metrics
+// (metrics_token, en Prometheus authorization.credentials). Sin token
+// devuelve nil: las métricas quedan protegidas solo por admin_addr y
+// admin_allowed_cidrs.
+func tokenMetricas(token string) middleware {
+	if token == "" {
+		return nil
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				errorHTTP(w, r, http.StatusUnauthorized, msgUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// getMetrics es GET /metrics: todas las métricas del proceso en el formato
+// de Prometheus (peticiones, sincronizaciones, pools de conexiones, items...)
+// más las del runtime de Go.
+func getMetrics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actualizarMetricasRuntime()
+
+		w.Header().Set("Content-Type", metrics.ContentType)
+		w.Header().Set("Cache-Control", "no-store")
+		if err := metrics.Default.WritePrometheus(w); err != nil {
+			logDe("http").WarnContext(r.Context(), "Error escribiendo las métricas", errAttr(err))
+		}
+	}
+}
+
+// actualizarMetricasRuntime pone en las métricas el estado del runtime de Go;
+// se llama antes de cada exportación.
+func actualizarMetricasRuntime() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	goGoroutines.Set(float64(runtime.NumGoroutine()))
+	goHeapAlloc.Set(float64(m.HeapAlloc))
+	goSys.Set(float64(m.Sys))
+	goGCCycles.Set(float64(m.NumGC))
+	processStart.Set(float64(inicioProceso.Unix()))
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// middleware envuelve un handler con un comportamiento común (CORS, logs,
+// autenticación, límites...).
+type middleware func(http.Handler) http.Handler
+
+// cadena es una lista de middlewares que se aplican en orden: el primero es
+// el más externo. Los nil se saltan, de modo que un middleware desactivado
+// por configuración puede devolver nil.
+type cadena []middleware
+
+// encadenar crea una cadena con mws.
+func encadenar(mws ...middleware) cadena {
+	return cadena(mws)
+}
+
+// con devuelve una cadena nueva con mws añadidos al final (más internos que
+// los de c), sin modificar c. Sirve para montar grupos de rutas a partir de
+// una cadena común.
+func (c cadena) con(mws ...middleware) cadena {
+	out := make(cadena, 0, len(c)+len(mws))
+	return append(append(out, c...), mws...)
+}
+
+// envolver aplica la cadena a h.
+func (c cadena) envolver(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i] != nil {
+			h = c[i](h)
+		}
+	}
+	return h
+}
+
+// envolverFunc es envolver para un http.HandlerFunc.
+func (c cadena) envolverFunc(h http.HandlerFunc) http.Handler {
+	return c.envolver(h)
+}
+
+// recuperarMiddleware convierte un panic en un handler en una respuesta 500 y
+// lo registra con la traza, en lugar de cortar la conexión sin más.
+// http.ErrAbortHandler se deja pasar: es la forma de abortar una respuesta a
+// propósito.
+func recuperarMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			logDe("http").ErrorContext(r.Context(), "Panic en el handler",
+				"panic", fmt.Sprint(v), "stack", string(debug.Stack()))
+			reportarPanic(r, v)
+			errorHTTP(w, r, http.StatusInternalServerError, msgInternalError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"prueba/pkg/repository"
+	"strings"
+)
+
+// Dónde se exige certificado de cliente (mtls).
+const (
+	mtlsOff   = "off"
+	mtlsAdmin = "admin"
+	mtlsAll   = "all"
+)
+
+// Rol de los clientes con certificado válido que no están en mtls_clients.
+const defaultMTLSRole = rolViewer
+
+// ClientesMTLS es la autenticación con certificado de cliente (TLS mutuo).
+type ClientesMTLS struct {
+	// Alcance es dónde se exige el certificado: mtlsAdmin en el listener de
+	// administración o mtlsAll en todos.
+	Alcance string
+	// CAs son las autoridades que firman los certificados de cliente
+	// (mtls_client_ca).
+	CAs *x509.CertPool
+	// Roles es el rol de cada cliente por el CN de su certificado
+	// (mtls_clients); el resto tiene defaultMTLSRole.
+	Roles map[string]string
+	// Tenants es el tenant de los clientes de mtls_clients que lo indican;
+	// el resto son del tenant por defecto.
+	Tenants map[string]string
+}
+
+// mtlsEntorno lee mtls (off, admin o all; por defecto off), mtls_client_ca,
+// un fichero PEM con las CA de los certificados de cliente, y mtls_clients,
+// el rol y opcionalmente el tenant de clientes concretos por su CN como
+// "deployer:admin,panel:viewer:acme".
+// Devuelve nil con mtls=off. El certificado del servidor es el de tls_cert y
+// tls_key (o tls_cert_dir), que hacen falta: con admin también el listener
+// de administración (admin_addr) pasa a HTTPS.
+func mtlsEntorno(cfg Config) (*ClientesMTLS, error) {
+	alcance := os.Getenv("mtls")
+	switch alcance {
+	case "", mtlsOff:
+		return nil, nil
+	case mtlsAdmin, mtlsAll:
+	default:
+		return nil, fmt.Errorf("invalid mtls %q (valid: %s, %s, %s)", alcance, mtlsOff, mtlsAdmin, mtlsAll)
+	}
+	if cfg.TLS == nil || cfg.Autocert != nil {
+		return nil, errors.New("mtls requires a server certificate in tls_cert and tls_key or tls_cert_dir")
+	}
+	if alcance == mtlsAdmin && cfg.AdminAddr == "" {
+		return nil, errors.New("mtls=admin requires admin_addr")
+	}
+
+	ruta := os.Getenv("mtls_client_ca")
+	if ruta == "" {
+		return nil, errors.New("mtls requires mtls_client_ca")
+	}
+	pem, err := os.ReadFile(ruta)
+	if err != nil {
+		return nil, fmt.Errorf("error reading mtls_client_ca: %w", err)
+	}
+	m := &ClientesMTLS{Alcance: alcance, CAs: x509.NewCertPool(), Roles: map[string]string{}, Tenants: map[string]string{}}
+	if !m.CAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("invalid mtls_client_ca %q: no PEM certificates found", ruta)
+	}
+	for _, v := range lista(os.Getenv("mtls_clients")) {
+		partes := strings.Split(v, ":")
+		for i := range partes {
+			partes[i] = strings.TrimSpace(partes[i])
+		}
+		if len(partes) < 2 || len(partes) > 3 || partes[0] == "" {
+			return nil, errors.New("invalid mtls_clients: expected cn:role or cn:role:tenant entries separated by commas")
+		}
+		cn := partes[0]
+		if err := validarRol(partes[1]); err != nil {
+			return nil, fmt.Errorf("invalid mtls_clients: client %q: %w", cn, err)
+		}
+		m.Roles[cn] = partes[1]
+		if len(partes) == 3 {
+			if err := repository.ValidateTenant(partes[2]); err != nil {
+				return nil, fmt.Errorf("invalid mtls_clients: client %q: %w", cn, err)
+			}
+			m.Tenants[cn] = partes[2]
+		}
+	}
+	return m, nil
+}
+
+// exigir devuelve una copia de base que pide y verifica el certificado de
+// cliente.
+func (m *ClientesMTLS) exigir(base *tls.Config) *tls.Config {
+	c := base.Clone()
+	c.ClientCAs = m.CAs
+	c.ClientAuth = tls.RequireAndVerifyClientCert
+	return c
+}
+
+// identificar devuelve la identidad del certificado de cliente verificado de
+// r (su CN), o nil si la conexión no trae ninguno. El tenant es el de
+// mtls_clients; autenticar pone el tenant por defecto si no tiene.
+func (m *ClientesMTLS) identificar(r *http.Request) *identidad {
+	if m == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	rol, ok := m.Roles[cn]
+	if !ok {
+		rol = defaultMTLSRole
+	}
+	return &identidad{Sujeto: cn, Metodo: metodoMTLS, Roles: []string{rol}, Tenant: m.Tenants[cn]}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// descubrimientoOIDC obtiene la configuración de un proveedor OIDC (Auth0,
+// Keycloak...) de su documento /.well-known/openid-configuration, para no
+// tener que configurar a mano la URL del JWKS. El documento se pide la
+// primera vez que hace falta y se reintenta hasta conseguirlo, de modo que el
+// servidor arranca aunque el proveedor no responda.
+type descubrimientoOIDC struct {
+	issuer string
+	client *http.Client
+
+	mu      sync.Mutex
+	jwksURI string
+}
+
+func nuevoDescubrimientoOIDC(issuer string) *descubrimientoOIDC {
+	return &descubrimientoOIDC{
+		issuer: issuer,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// jwks devuelve la URL del JWKS del proveedor.
+func (d *descubrimientoOIDC) jwks(ctx context.Context) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.jwksURI != "" {
+		return d.jwksURI, nil
+	}
+
+	url := strings.TrimSuffix(d.issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating OIDC discovery request: %w", err)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error fetching OIDC discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("OIDC discovery endpoint returned status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", fmt.Errorf("error parsing OIDC discovery document: %w", err)
+	}
+	// El issuer del documento tiene que ser el configurado (OIDC Discovery
+	// 1.0, sección 4.3)
+	if doc.Issuer != d.issuer {
+		return "", fmt.Errorf("OIDC discovery document issuer %q does not match oidc_issuer %q", doc.Issuer, d.issuer)
+	}
+	if doc.JWKSURI == "" {
+		return "", fmt.Errorf("OIDC discovery document has no jwks_uri")
+	}
+	d.jwksURI = doc.JWKSURI
+	return d.jwksURI, nil
+}
+
+// getAuthMe es GET /auth/me: la identidad con la que el backend reconoce al
+// usuario (sub del token, método y roles). El frontend la usa tras el login
+// para comprobar que el token vale y mostrar quién ha entrado.
+func getAuthMe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := identidadDe(r.Context())
+		roles := id.Roles
+		if roles == nil {
+			roles = []string{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]any{
+			"subject": id.Sujeto,
+			"method":  id.Metodo,
+			"roles":   roles,
+		})
+	}
+}
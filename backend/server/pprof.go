@@ -0,0 +1,53 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strconv"
+)
+
+// pprofEntorno lee pprof: si se montan los endpoints de profiling de Go
+// (/debug/pprof/...) en el listener de administración, para sacar perfiles
+// de CPU y memoria en producción. Por defecto no. Exige admin_addr: un
+// perfil expone el código y los datos en memoria, no puede quedar en el
+// listener público.
+func pprofEntorno(cfg Config) (bool, error) {
+	v := os.Getenv("pprof")
+	if v == "" {
+		return false, nil
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid pprof %q", v)
+	}
+	if on && cfg.AdminAddr == "" {
+		return false, errors.New("pprof requires admin_addr")
+	}
+	return on, nil
+}
+
+// rutasPprof registra en admin los endpoints de net/http/pprof tras los
+// middlewares de c. Los perfiles de CPU y las trazas duran lo que pida
+// seconds, así que no tienen el límite de escritura del listener. Uso:
+//
+//	curl -H 'X-API-Key: ...' -o cpu.pprof 'http://127.0.0.1:9090/debug/pprof/profile?seconds=30'
+//	go tool pprof cpu.pprof
+func rutasPprof(admin *http.ServeMux, c cadena) {
+	largo := func(h http.HandlerFunc) http.Handler {
+		return c.envolverFunc(func(w http.ResponseWriter, r *http.Request) {
+			sinDeadline(w)
+			h(w, r)
+		})
+	}
+	// Index sirve también los perfiles con nombre: heap, goroutine,
+	// allocs, block, mutex, threadcreate
+	admin.Handle("GET /debug/pprof/", c.envolverFunc(pprof.Index))
+	admin.Handle("GET /debug/pprof/cmdline", c.envolverFunc(pprof.Cmdline))
+	admin.Handle("GET /debug/pprof/symbol", c.envolverFunc(pprof.Symbol))
+	admin.Handle("POST /debug/pprof/symbol", c.envolverFunc(pprof.Symbol))
+	admin.Handle("GET /debug/pprof/profile", largo(pprof.Profile))
+	admin.Handle("GET /debug/pprof/trace", largo(pprof.Trace))
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"regexp"
+
+	"github.com/joho/godotenv"
+)
+
+// Perfiles de entorno conocidos (APP_ENV).
+const (
+	ProfileDevelopment = "development"
+	ProfileProduction  = "production"
+)
+
+// Niveles de log admitidos en log_level.
+const (
+	logDebug = "debug"
+	logInfo  = "info"
+	logWarn  = "warn"
+	logError = "error"
+)
+
+// perfil son los valores por defecto de un entorno, que se aplican cuando la
+// variable correspondiente no está definida ni en el entorno ni en los
+// ficheros .env.
+type perfil struct {
+	logLevel   string
+	logFormat  string
+	corsOrigin string
+	// flags es el valor de los feature flags que no fija feature_flags.
+	flags bool
+}
+
+// perfiles son los perfiles con valores por defecto propios. Un APP_ENV
+// distinto (p. ej. staging) carga su fichero .env.<APP_ENV> y usa los de
+// producción.
+var perfiles = map[string]perfil{
+	// El frontend de desarrollo es el servidor de Vite. Los feature flags
+	// están encendidos para probar lo que aún no se ha publicado.
+	ProfileDevelopment: {logLevel: logDebug, logFormat: logFormatText, corsOrigin: "http://localhost:5173", flags: true},
+	ProfileProduction:  {logLevel: logInfo, logFormat: logFormatJSON},
+}
+
+var nombrePerfil = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// perfilActual devuelve el perfil de APP_ENV; vacío es development.
+func perfilActual() string {
+	if p := os.Getenv("APP_ENV"); p != "" {
+		return p
+	}
+	return ProfileDevelopment
+}
+
+// defaultsPerfil devuelve los valores por defecto del perfil p.
+func defaultsPerfil(p string) perfil {
+	if d, ok := perfiles[p]; ok {
+		return d
+	}
+	return perfiles[ProfileProduction]
+}
+
+// LoadEnv carga las variables de los ficheros del perfil de APP_ENV:
+// primero .env.<APP_ENV> y después .env, de modo que el fichero del perfil
+// manda sobre el común y las variables ya definidas en el proceso mandan
+// sobre ambos. Los ficheros que no existan se ignoran. Devuelve el perfil
+// cargado.
+//
+// Debe llamarse una sola vez al arrancar, antes de LoadConfig; después
+// Reload vuelve a leer los ficheros.
+func LoadEnv() (string, error) {
+	p := perfilActual()
+	if !nombrePerfil.MatchString(p) {
+		return "", fmt.Errorf("invalid APP_ENV %q", p)
+	}
+
+	vals, cargados, err := leerFicheros(p)
+	if err != nil {
+		return "", err
+	}
+	aplicarFicheros(vals)
+	if len(cargados) == 0 {
+		slog.Info("Perfil sin ficheros .env, usando variables de entorno del sistema", "profile", p)
+	} else {
+		slog.Info("Variables de entorno cargadas", "profile", p, "files", cargados)
+	}
+	return p, nil
+}
+
+// deFicheros son las variables que se pusieron en el entorno desde los
+// ficheros .env, con su valor.
+var deFicheros = map[string]string{}
+
+// leerFicheros lee las variables de .env.<p> y .env, con las del primero por
+// encima de las del segundo, y devuelve también los ficheros que existían.
+func leerFicheros(p string) (map[string]string, []string, error) {
+	vals := map[string]string{}
+	var cargados []string
+	for _, f := range []string{".env." + p, ".env"} {
+		m, err := godotenv.Read(f)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error loading %s: %w", f, err)
+		}
+		for k, v := range m {
+			if _, ok := vals[k]; !ok {
+				vals[k] = v
+			}
+		}
+		cargados = append(cargados, f)
+	}
+	return vals, cargados, nil
+}
+
+// aplicarFicheros pone en el entorno las variables vals de los ficheros
+// salvo las que vengan del proceso o de los flags: solo se escriben las que
+// no estaban definidas o se cargaron de los ficheros y nadie ha cambiado
+// desde entonces. Las de los ficheros que ya no aparecen se quitan. Devuelve
+// una función que deja el entorno como estaba.
+func aplicarFicheros(vals map[string]string) (deshacer func()) {
+	previos := map[string]*string{}
+	anteriores := maps.Clone(deFicheros)
+	guardar := func(k string) {
+		if _, ok := previos[k]; ok {
+			return
+		}
+		if v, ok := os.LookupEnv(k); ok {
+			previos[k] = &v
+		} else {
+			previos[k] = nil
+		}
+	}
+
+	for k, v := range deFicheros {
+		if _, sigue := vals[k]; !sigue && os.Getenv(k) == v {
+			guardar(k)
+			os.Unsetenv(k)
+			delete(deFicheros, k)
+		}
+	}
+	for k, v := range vals {
+		actual, definida := os.LookupEnv(k)
+		if cargado, nuestro := deFicheros[k]; definida && !(nuestro && actual == cargado) {
+			continue
+		}
+		guardar(k)
+		os.Setenv(k, v)
+		deFicheros[k] = v
+	}
+
+	return func() {
+		for k, v := range previos {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+		deFicheros = anteriores
+	}
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"prueba/internal/metrics"
+	"prueba/pkg/cache"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Contadores que se guardan en memoria sin Redis: dos por clave de la API.
+const defaultQuotaCounters = 10000
+
+var (
+	quotaExceeded = metrics.NewCounter("api_key_quota_exceeded_total",
+		"Peticiones rechazadas con 429 por agotar la cuota de su clave de la API, por ventana (minute o day).", "window")
+	quotaErrors = metrics.NewCounter("api_key_quota_errors_total",
+		"Errores del almacén de los contadores de las cuotas (Redis).")
+)
+
+// cuota son las peticiones que puede hacer una clave de la API por minuto y
+// por día (UTC); 0 es sin límite.
+type cuota struct {
+	minuto int64
+	dia    int64
+}
+
+// Cuotas son las cuotas de las claves de la API.
+type Cuotas struct {
+	defecto  cuota
+	porClave map[string]cuota
+}
+
+// de devuelve la cuota de la clave nombre.
+func (c Cuotas) de(nombre string) cuota {
+	if q, ok := c.porClave[nombre]; ok {
+		return q
+	}
+	return c.defecto
+}
+
+// cuotasEntorno lee api_key_quota_per_minute y api_key_quota_per_day, las
+// cuotas de todas las claves (sin definir, sin límite), y api_key_quotas, las
+// de claves concretas por nombre como "cron:60/10000,panel:0/500", con 0
+// para no limitar esa ventana.
+func cuotasEntorno() (Cuotas, error) {
+	c := Cuotas{
+		defecto: cuota{
+			minuto: int64(envInt("api_key_quota_per_minute", 0)),
+			dia:    int64(envInt("api_key_quota_per_day", 0)),
+		},
+		porClave: map[string]cuota{},
+	}
+	for _, v := range lista(os.Getenv("api_key_quotas")) {
+		nombre, limites, ok := strings.Cut(v, ":")
+		minuto, dia, ok2 := strings.Cut(limites, "/")
+		var q cuota
+		var err1, err2 error
+		q.minuto, err1 = strconv.ParseInt(strings.TrimSpace(minuto), 10, 64)
+		q.dia, err2 = strconv.ParseInt(strings.TrimSpace(dia), 10, 64)
+		if !ok || !ok2 || strings.TrimSpace(nombre) == "" || err1 != nil || err2 != nil || q.minuto < 0 || q.dia < 0 {
+			return Cuotas{}, fmt.Errorf("invalid api_key_quotas entry %q: expected name:per_minute/per_day", v)
+		}
+		c.porClave[strings.TrimSpace(nombre)] = q
+	}
+	return c, nil
+}
+
+// almacenContadores es donde se cuentan las peticiones: la LRU del proceso
+// o Redis, compartido por las réplicas.
+type almacenContadores interface {
+	cache.Cache
+	cache.Counter
+}
+
+// cuotasAPI cuenta las peticiones de cada clave de la API por minuto y por
+// día y rechaza con 429 las que superan su cuota. Con Redis la cuenta es
+// común a todas las réplicas; en memoria cada réplica cuenta las suyas. Si el
+// almacén falla la petición pasa sin contar.
+type cuotasAPI struct {
+	cuotas Cuotas
+	store  almacenContadores
+}
+
+func nuevasCuotasAPI(cuotas Cuotas, redis *cache.Redis) *cuotasAPI {
+	c := &cuotasAPI{cuotas: cuotas}
+	if redis != nil {
+		c.store = redis
+	} else {
+		c.store = cache.NewLRU(defaultQuotaCounters, 0)
+	}
+	return c
+}
+
+// ventanaCuota es una de las ventanas en las que se cuentan las peticiones.
+type ventanaCuota struct {
+	nombre string
+	clave  string
+	limite int64
+	// reinicio es cuando empieza la ventana siguiente.
+	reinicio time.Time
+}
+
+// ventanas devuelve las ventanas de la clave nombre en el instante now.
+func (c *cuotasAPI) ventanas(nombre string, now time.Time) []ventanaCuota {
+	now = now.UTC()
+	q := c.cuotas.de(nombre)
+	minuto := now.Truncate(time.Minute)
+	dia := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return []ventanaCuota{
+		{nombre: "minute", clave: "quota:" + nombre + ":m:" + minuto.Format("200601021504"), limite: q.minuto, reinicio: minuto.Add(time.Minute)},
+		{nombre: "day", clave: "quota:" + nombre + ":d:" + dia.Format("20060102"), limite: q.dia, reinicio: dia.AddDate(0, 0, 1)},
+	}
+}
+
+// middleware cuenta las peticiones autenticadas con clave de la API; las
+// demás pasan sin contar.
+func (c *cuotasAPI) middleware() middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := identidadDe(r.Context())
+			if id == nil || id.Metodo != metodoAPIKey {
+				next.ServeHTTP(w, r)
+				return
+			}
+			now := time.Now()
+			for _, v := range c.ventanas(id.Sujeto, now) {
+				// La ventana dura un poco más que su periodo para que /auth/usage
+				// la encuentre hasta el final
+				n, err := c.store.Incr(r.Context(), v.clave, v.reinicio.Sub(now)+time.Minute)
+				if err != nil {
+					quotaErrors.Inc()
+					logDe("auth").WarnContext(r.Context(), "Error contando la cuota de la clave de la API, se deja pasar la petición", errAttr(err))
+					break
+				}
+				if v.limite > 0 && n > v.limite {
+					quotaExceeded.Inc(v.nombre)
+					w.Header().Set("Retry-After", strconv.Itoa(int(v.reinicio.Sub(now).Seconds())+1))
+					errorHTTP(w, r, http.StatusTooManyRequests, msgQuotaExceeded, v.nombre)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// usoVentana es el consumo de una ventana en GET /auth/usage.
+type usoVentana struct {
+	Used int64 `json:"used"`
+	// Limit es null si la ventana no tiene límite.
+	Limit *int64    `json:"limit"`
+	Reset time.Time `json:"reset"`
+}
+
+// uso devuelve el consumo de la clave nombre en cada ventana.
+func (c *cuotasAPI) uso(ctx context.Context, nombre string) (map[string]usoVentana, error) {
+	out := map[string]usoVentana{}
+	for _, v := range c.ventanas(nombre, time.Now()) {
+		u := usoVentana{Reset: v.reinicio}
+		if v.limite > 0 {
+			u.Limit = &v.limite
+		}
+		raw, ok, err := c.store.Get(ctx, v.clave)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			u.Used, _ = strconv.ParseInt(string(raw), 10, 64)
+		}
+		out[v.nombre] = u
+	}
+	return out, nil
+}
+
+// getAuthUsage es GET /auth/usage: lo que lleva consumido de su cuota la
+// clave de la API de la petición, por minuto y por día. Esta petición no
+// cuenta.
+func (s *Server) getAuthUsage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := identidadDe(r.Context())
+		if id.Metodo != metodoAPIKey {
+			errorHTTP(w, r, http.StatusBadRequest, msgQuotaAPIKeyOnly)
+			return
+		}
+		uso, err := s.cuotas.uso(r.Context(), id.Sujeto)
+		if err != nil {
+			errorHTTP(w, r, http.StatusServiceUnavailable, msgQuotaError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]any{
+			"key":    id.Sujeto,
+			"minute": uso["minute"],
+			"day":    uso["day"],
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"prueba/internal/metrics"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Límites por defecto. Las lecturas admiten ráfagas (el frontend pide varias
+// vistas a la vez); la sincronización es cara y basta con unas pocas por
+// minuto. El registro y el inicio de sesión se limitan aparte para frenar la
+// creación masiva de cuentas y el probar contraseñas desde una misma IP.
+const (
+	defaultRateLimitRPS       = 10
+	defaultRateLimitBurst     = 30
+	defaultRateLimitSyncRPM   = 6
+	defaultRateLimitSyncBurst = 2
+	defaultRateLimitAuthRPM   = 10
+	defaultRateLimitAuthBurst = 5
+
+	// rateLimitIdle es el tiempo tras el cual se olvida el bucket de un
+	// cliente que no ha vuelto a llamar.
+	rateLimitIdle = 10 * time.Minute
+)
+
+var rateLimited = metrics.NewCounter("http_rate_limited_total",
+	"Peticiones rechazadas con 429 por el límite de peticiones por cliente.", "limit")
+
+// bucket es el token bucket de un cliente.
+type bucket struct {
+	tokens float64
+	ultimo time.Time
+}
+
+// limite es la configuración de un limitador: rate peticiones por segundo y
+// ráfagas de burst. Con activo false no se limita. proxies son los
+// trusted_proxies con los que se averigua la IP del cliente (ver ipCliente).
+type limite struct {
+	activo  bool
+	rate    float64
+	burst   float64
+	proxies []netip.Prefix
+}
+
+// limitador es un token bucket por cliente: cada cliente dispone de burst
+// peticiones y recupera rate por segundo. La configuración se puede cambiar
+// en caliente con ajustar.
+type limitador struct {
+	nombre string
+
+	mu       sync.Mutex
+	limite   limite
+	buckets  map[string]*bucket
+	limpieza time.Time
+}
+
+func nuevoLimitador(nombre string, lim limite) *limitador {
+	return &limitador{
+		nombre:  nombre,
+		limite:  lim,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// ajustar cambia la configuración del limitador. Los clientes conservan los
+// tokens que tuvieran, acotados al nuevo burst.
+func (l *limitador) ajustar(lim limite) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limite = lim
+}
+
+// config devuelve la configuración en vigor.
+func (l *limitador) config() limite {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limite
+}
+
+// permitir consume un token del cliente k. Si no le quedan devuelve false y
+// lo que falta para el siguiente.
+func (l *limitador) permitir(k string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limpiar(now)
+	lim := l.limite
+	b, ok := l.buckets[k]
+	if !ok {
+		b = &bucket{tokens: lim.burst, ultimo: now}
+		l.buckets[k] = b
+	}
+	b.tokens = math.Min(lim.burst, b.tokens+now.Sub(b.ultimo).Seconds()*lim.rate)
+	b.ultimo = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / lim.rate * float64(time.Second))
+}
+
+// limpiar olvida, como mucho una vez por minuto, los buckets de los clientes
+// inactivos (que ya estarían llenos).
+func (l *limitador) limpiar(now time.Time) {
+	if now.Sub(l.limpieza) < time.Minute {
+		return
+	}
+	l.limpieza = now
+	for k, b := range l.buckets {
+		if now.Sub(b.ultimo) > rateLimitIdle {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// middleware aplica el límite a las rutas; mientras el limitador no esté
+// activo deja pasar todas las peticiones.
+func (l *limitador) middleware() middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lim := l.config()
+			if !lim.activo {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ok, espera := l.permitir(claveCliente(r, lim.proxies), time.Now())
+			if !ok {
+				rateLimited.Inc(l.nombre)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(espera.Seconds()))))
+				errorHTTP(w, r, http.StatusTooManyRequests, msgTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitesPeticiones lee los límites de lecturas (rate_limit_rps,
+// rate_limit_burst), de sincronización (rate_limit_sync_per_minute,
+// rate_limit_sync_burst) y de registro e inicio de sesión
+// (rate_limit_auth_per_minute, rate_limit_auth_burst). rate_limit_enabled=false
+// los desactiva.
+func limitesPeticiones(proxies []netip.Prefix) (lecturas, sincronizacion, auth limite) {
+	activo := true
+	if on, err := strconv.ParseBool(os.Getenv("rate_limit_enabled")); err == nil && !on {
+		activo = false
+	}
+	lecturas = limite{
+		activo:  activo,
+		rate:    float64(envInt("rate_limit_rps", defaultRateLimitRPS)),
+		burst:   float64(envInt("rate_limit_burst", defaultRateLimitBurst)),
+		proxies: proxies,
+	}
+	sincronizacion = limite{
+		activo:  activo,
+		rate:    float64(envInt("rate_limit_sync_per_minute", defaultRateLimitSyncRPM)) / 60,
+		burst:   float64(envInt("rate_limit_sync_burst", defaultRateLimitSyncBurst)),
+		proxies: proxies,
+	}
+	auth = limite{
+		activo:  activo,
+		rate:    float64(envInt("rate_limit_auth_per_minute", defaultRateLimitAuthRPM)) / 60,
+		burst:   float64(envInt("rate_limit_auth_burst", defaultRateLimitAuthBurst)),
+		proxies: proxies,
+	}
+	return lecturas, sincronizacion, auth
+}
+
+// claveCliente identifica al cliente por su IP, la misma que la auditoría y
+// admin_allowed_cidrs: detrás de trusted_proxies se recorre X-Forwarded-For
+// de derecha a izquierda (ver ipCliente), así que el cliente no puede
+// cambiar de bucket inventándose la cabecera.
+func claveCliente(r *http.Request, proxies []netip.Prefix) string {
+	if ip := ipCliente(r, proxies); ip.IsValid() {
+		return ip.String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClaveCliente(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name    string
+		remote  string
+		xff     string
+		proxies []netip.Prefix
+		want    string
+	}{
+		{"sin proxies", "203.0.113.7:4000", "", nil, "203.0.113.7"},
+		{"XFF sin trusted_proxies no cambia el bucket", "203.0.113.7:4000", "198.51.100.1", nil, "203.0.113.7"},
+		{"detrás de un proxy", "10.0.0.2:4000", "198.51.100.1", proxies, "198.51.100.1"},
+		{"entrada inventada a la izquierda", "10.0.0.2:4000", "1.2.3.4, 198.51.100.1", proxies, "198.51.100.1"},
+		{"XFF no válido usa RemoteAddr", "10.0.0.2:4000", "basura", proxies, "10.0.0.2"},
+		{"RemoteAddr sin puerto", "pipe", "", nil, "pipe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := claveCliente(r, tt.proxies); got != tt.want {
+				t.Errorf("claveCliente() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaveClienteSocketUnix(t *testing.T) {
+	// Cada cliente tras el proxy del socket tiene su propio bucket
+	a := claveCliente(peticionSocketUnix("@", "198.51.100.1"), nil)
+	b := claveCliente(peticionSocketUnix("@", "198.51.100.2"), nil)
+	if a != "198.51.100.1" || b != "198.51.100.2" {
+		t.Errorf("claveCliente() = %q and %q, want each client IP", a, b)
+	}
+}
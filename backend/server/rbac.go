@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"prueba/pkg/repository"
+	"slices"
+)
+
+// Roles de la API, de menos a más permisos; cada uno incluye los anteriores.
+const (
+	// rolViewer lee los items y sus estadísticas.
+	rolViewer = "viewer"
+	// rolAnalyst además edita los items.
+	rolAnalyst = "analyst"
+	// rolAdmin además lanza sincronizaciones y usa las rutas de
+	// administración.
+	rolAdmin = "admin"
+)
+
+// roles son los roles válidos en orden de permisos.
+var roles = []string{rolViewer, rolAnalyst, rolAdmin}
+
+// validarRol comprueba que rol es uno de roles.
+func validarRol(rol string) error {
+	if !slices.Contains(roles, rol) {
+		return fmt.Errorf("unknown role %q (valid: %s, %s, %s)", rol, rolViewer, rolAnalyst, rolAdmin)
+	}
+	return nil
+}
+
+// tieneRol indica si la identidad tiene rol o uno con más permisos. Los roles
+// desconocidos (otros del proveedor de identidad) se ignoran.
+func (id *identidad) tieneRol(rol string) bool {
+	nivel := slices.Index(roles, rol)
+	for _, r := range id.Roles {
+		if slices.Index(roles, r) >= nivel {
+			return true
+		}
+	}
+	return false
+}
+
+// requerirRol responde 401 a las peticiones anónimas y 403 a las de
+// identidades sin rol; estas quedan en el registro de auditoría.
+func requerirRol(rol string, audit *auditoria) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := identidadDe(r.Context())
+			if id == nil {
+				errorHTTP(w, r, http.StatusUnauthorized, msgUnauthorized)
+				return
+			}
+			if !id.tieneRol(rol) {
+				logDe("auth").WarnContext(r.Context(), "Acceso denegado por rol", "required_role", rol, "roles", id.Roles)
+				audit.registrar(r, repository.AuditEvent{Action: repository.AuditRoleDenied, Status: http.StatusForbidden, Detail: "required role " + rol})
+				errorHTTP(w, r, http.StatusForbidden, msgForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// exigirRol devuelve requerirRol(rol) si el modo de api_key_auth de la
+// configuración está entre modos, y nil (sin exigir nada) si no.
+func (s *Server) exigirRol(rol string, modos ...string) middleware {
+	if slices.Contains(modos, s.cfg.AuthMode) {
+		return requerirRol(rol, s.auditoria)
+	}
+	return nil
+}
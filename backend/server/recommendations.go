@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"prueba/pkg/repository"
+	"prueba/pkg/scoring"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Valores por defecto de /recommendations, los mismos que usaba el frontend.
+const (
+	defaultRecommendationMinScore = 50
+	defaultRecommendationLimit    = 6
+)
+
+// pesosRecomendacion lee recommendation_weights: los puntos máximos de cada
+// criterio de la puntuación como "upside=40,action=30,rating=30,recency=10".
+// Los criterios que no aparecen conservan su peso por defecto.
+func pesosRecomendacion() (scoring.Weights, error) {
+	w := scoring.DefaultWeights
+	v := os.Getenv("recommendation_weights")
+	if v == "" {
+		return w, nil
+	}
+	campos := map[string]*int{"upside": &w.Upside, "action": &w.Action, "rating": &w.Rating, "recency": &w.Recency}
+	for _, par := range lista(v) {
+		k, valor, _ := strings.Cut(par, "=")
+		campo, ok := campos[strings.TrimSpace(k)]
+		n, err := strconv.Atoi(strings.TrimSpace(valor))
+		if !ok || err != nil || n < 0 {
+			return w, fmt.Errorf("invalid recommendation_weights %q: expected upside=N,action=N,rating=N,recency=N", v)
+		}
+		*campo = n
+	}
+	return w, nil
+}
+
+// getItemLatest devuelve la última valoración de cada ticker.
+func (s *Server) getItemLatest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := zonaPeticion(r)
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgInvalidParam, err)
+			return
+		}
+		list, err := s.store.Items.Latest(r.Context())
+		if err != nil {
+			responderError(w, r, msgLatestError, err)
+			return
+		}
+		itemsEnZona(list, loc)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Items []repository.Item `json:"items"`
+		}{
+			Items: list,
+		})
+	}
+}
+
+// getRecommendations puntúa la última valoración de cada ticker y devuelve las
+// mejores. Admite ?min_score= (por defecto 50), ?limit= (por defecto 6) y
+// ?tz= (ver zonaPeticion).
+func (s *Server) getRecommendations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		minScore, err := queryInt(r, "min_score", defaultRecommendationMinScore)
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgInvalidParam, err)
+			return
+		}
+		limit, err := queryInt(r, "limit", defaultRecommendationLimit)
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgInvalidParam, err)
+			return
+		}
+
+		loc, err := zonaPeticion(r)
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgInvalidParam, err)
+			return
+		}
+
+		list, err := s.store.Items.Latest(r.Context())
+		if err != nil {
+			responderError(w, r, msgLatestError, err)
+			return
+		}
+		itemsEnZona(list, loc)
+
+		recs := enVigor.pesos.Load().Rank(list, time.Now(), minScore, limit)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Recommendations []scoring.Recommendation `json:"recommendations"`
+		}{
+			Recommendations: recs,
+		})
+	}
+}
+
+// queryInt lee un parámetro entero de la query string, con valor por defecto.
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return n, nil
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"prueba/pkg/scoring"
+	"sync"
+	"sync/atomic"
+)
+
+// enVigor son los ajustes que se pueden cambiar sin reiniciar el proceso
+// (ver Reload). El nivel de log está en nivelLog y la programación de la cola
+// de reintentos (sync_retry_*) se lee del entorno en cada vuelta del worker.
+var enVigor = struct {
+	cors  atomic.Pointer[CORS]
+	pesos atomic.Pointer[scoring.Weights]
+	flags atomic.Pointer[map[string]bool]
+	// Limitadores de las lecturas, de las sincronizaciones y del registro e
+	// inicio de sesión
+	lecturas, sincronizacion, auth *limitador
+}{
+	lecturas:       nuevoLimitador("read", limite{}),
+	sincronizacion: nuevoLimitador("sync", limite{}),
+	auth:           nuevoLimitador("auth", limite{}),
+}
+
+// recargaMu evita dos recargas a la vez (SIGHUP y POST /admin/reload).
+var recargaMu sync.Mutex
+
+// aplicarAjustes pone en vigor los ajustes recargables de cfg y del entorno.
+func aplicarAjustes(cfg Config) {
+	ajusteNivelLog.configurar(cfg.LogLevel)
+	enVigor.cors.Store(&cfg.CORS)
+	pesos := cfg.RecommendationWeights
+	enVigor.pesos.Store(&pesos)
+	flags := maps.Clone(cfg.FeatureFlags)
+	if cfg.MaintenanceMode {
+		flags[flagMantenimiento] = true
+	}
+	enVigor.flags.Store(&flags)
+	lecturas, sincronizacion, auth := limitesPeticiones(cfg.TrustedProxies)
+	enVigor.lecturas.ajustar(lecturas)
+	enVigor.sincronizacion.ajustar(sincronizacion)
+	enVigor.auth.ajustar(auth)
+}
+
+// Reload vuelve a leer los ficheros .env del perfil y aplica los ajustes que
+// se pueden cambiar en caliente: log_level, cors_*, rate_limit_*,
+// sync_retry_*, recommendation_weights, feature_flags y maintenance_mode. El resto (puerto, base de datos,
+// TLS...) requiere reiniciar. La configuración se valida entera como al
+// arrancar: si hay algún valor inválido no se aplica nada y el entorno queda
+// como estaba.
+func Reload() error {
+	recargaMu.Lock()
+	defer recargaMu.Unlock()
+
+	vals, cargados, err := leerFicheros(perfilActual())
+	if err != nil {
+		return err
+	}
+	deshacer := aplicarFicheros(vals)
+	cfg, err := LoadConfig()
+	if err != nil {
+		deshacer()
+		return err
+	}
+	aplicarAjustes(cfg)
+	logDe("config").Info("Configuración recargada", "files", cargados,
+		"log_level", cfg.LogLevel, "cors_origins", cfg.CORS.Origins,
+		"rate_limit_enabled", enVigor.lecturas.config().activo,
+		"recommendation_weights", cfg.RecommendationWeights, "feature_flags", cfg.FeatureFlags, "maintenance_mode", cfg.MaintenanceMode)
+	return nil
+}
+
+// recargar es POST /admin/reload: Reload desde el listener de
+// administración.
+func recargar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := Reload(); err != nil {
+			errorHTTP(w, r, http.StatusUnprocessableEntity, msgReloadError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"message": %q}`, mensaje(r, msgConfigReloaded))
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// requestIDHeader es la cabecera con el identificador de la petición. Si el
+// cliente (o el balanceador) la manda se respeta; si no, se genera. Siempre
+// se devuelve en la respuesta, de modo que un error reportado desde el
+// frontend se puede buscar en los logs.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestID es la longitud máxima que se acepta de un X-Request-ID del
+// cliente.
+const maxRequestID = 128
+
+type claveRequestID struct{}
+
+// RequestIDFrom devuelve el id de la petición de ctx, o "" si no lo tiene.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(claveRequestID{}).(string)
+	return id
+}
+
+// requestIDMiddleware asigna a cada petición su id: lo pone en el contexto
+// (y en los atributos de log, como request_id) y en la cabecera de la
+// respuesta.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDValido(id) {
+			id = nuevoRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), claveRequestID{}, id)
+		ctx = conLog(ctx, "request_id", id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestIDValido indica si id se puede usar tal cual: no vacío, acotado y
+// solo con caracteres que no rompan los logs ni las cabeceras.
+func requestIDValido(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// nuevoRequestID genera un id aleatorio de 128 bits en hexadecimal.
+func nuevoRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"prueba/internal/metrics"
+	"prueba/pkg/cache"
+	"prueba/pkg/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Valores por defecto de la caché de respuestas (ver nuevaCacheRespuestas).
+const (
+	defaultResponseCacheTTL     = 5 * time.Second
+	defaultResponseCacheEntries = 1000
+	defaultResponseCacheBytes   = 64 << 20
+	defaultRedisTimeout         = 500 * time.Millisecond
+)
+
+// Cabecera que indica si la respuesta salió de la caché (HIT) o no (MISS).
+const cacheHeader = "X-Cache"
+
+var (
+	responseCacheRequests = metrics.NewCounter("response_cache_requests_total",
+		"Lecturas que pasan por la caché de respuestas, por resultado (hit o miss).", "result")
+	responseCacheErrors = metrics.NewCounter("response_cache_errors_total",
+		"Errores del almacén de la caché de respuestas (Redis).")
+)
+
+// redisDesdeEntorno lee redis_url (redis://[:contraseña@]host[:puerto][/db]
+// o rediss:// con TLS) y redis_timeout. Sin redis_url devuelve nil.
+func redisDesdeEntorno() (*cache.Redis, error) {
+	v := os.Getenv("redis_url")
+	if v == "" {
+		return nil, nil
+	}
+	return cache.NewRedis(v, envDuration("redis_timeout", defaultRedisTimeout))
+}
+
+// cacheRespuestas guarda durante ttl las respuestas de los endpoints de
+// lectura (items, estadísticas...), para que el dashboard y varias pestañas
+// abiertas no repitan las mismas consultas. La clave es el tenant, la ruta y
+// la query normalizada.
+//
+// El almacén es una LRU en memoria del proceso o, con redis_url, Redis,
+// compartido por todas las réplicas. Las respuestas de un tenant se invalidan al
+// terminar una sincronización suya, al editar un item y con cada cambio del
+// changefeed: la clave lleva la generación del tenant, que se cambia al
+// invalidar, de modo que las respuestas anteriores dejan de encontrarse y
+// caducan solas. Con Redis la invalidación llega a todas las réplicas; en
+// memoria, las demás pueden servir datos de hasta ttl de antigüedad.
+type cacheRespuestas struct {
+	ttl   time.Duration
+	store cache.Cache
+}
+
+// nuevaCacheRespuestas lee response_cache_ttl y, para la caché en memoria
+// (una LRU), response_cache_max_entries y response_cache_max_bytes; con redis
+// no nil guarda las respuestas ahí. response_cache_enabled=false la desactiva
+// y devuelve nil.
+func nuevaCacheRespuestas(redis *cache.Redis) *cacheRespuestas {
+	if on, err := strconv.ParseBool(os.Getenv("response_cache_enabled")); err == nil && !on {
+		return nil
+	}
+	c := &cacheRespuestas{ttl: envDuration("response_cache_ttl", defaultResponseCacheTTL)}
+	if redis != nil {
+		c.store = redis
+	} else {
+		c.store = cache.NewLRU(
+			envInt("response_cache_max_entries", defaultResponseCacheEntries),
+			envInt("response_cache_max_bytes", defaultResponseCacheBytes),
+		)
+	}
+	return c
+}
+
+// claveGeneracion es la clave con la generación actual de las respuestas del
+// tenant.
+func claveGeneracion(tenant string) string {
+	return "resp-gen:" + tenant
+}
+
+// nuevaGeneracion genera un valor de generación aleatorio: si la clave se
+// pierde (desalojada, Redis reiniciado) la siguiente no coincide con
+// ninguna anterior.
+func nuevaGeneracion() []byte {
+	var b [8]byte
+	rand.Read(b[:])
+	return []byte(hex.EncodeToString(b[:]))
+}
+
+// generacion devuelve la generación del tenant, creándola si no hay.
+func (c *cacheRespuestas) generacion(ctx context.Context, tenant string) (string, error) {
+	gen, ok, err := c.store.Get(ctx, claveGeneracion(tenant))
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		gen = nuevaGeneracion()
+		if err := c.store.Set(ctx, claveGeneracion(tenant), gen, 0); err != nil {
+			return "", err
+		}
+	}
+	return string(gen), nil
+}
+
+// middleware sirve desde la caché las peticiones GET. Solo se guardan las
+// respuestas 200; con Cache-Control: no-cache se calcula la respuesta de
+// nuevo y se guarda. Si el almacén falla la petición sigue sin caché.
+func (c *cacheRespuestas) middleware() middleware {
+	if c == nil {
+		return nil
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tenant := repository.TenantFrom(r.Context())
+			gen, err := c.generacion(r.Context(), tenant)
+			if err != nil {
+				c.registrarError(r.Context(), err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			// Tenant, generación, ruta y query con los parámetros ordenados
+			clave := "resp:" + tenant + ":" + gen + ":" + r.URL.Path + "?" + r.URL.Query().Encode()
+
+			if !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+				v, ok, err := c.store.Get(r.Context(), clave)
+				if err != nil {
+					c.registrarError(r.Context(), err)
+				}
+				// El valor es el Content-Type y el cuerpo, separados por \n
+				if tipo, cuerpo, valido := bytes.Cut(v, []byte("\n")); ok && valido {
+					responseCacheRequests.Inc("hit")
+					w.Header().Set("Content-Type", string(tipo))
+					w.Header().Set(cacheHeader, "HIT")
+					w.Write(cuerpo)
+					return
+				}
+			}
+			responseCacheRequests.Inc("miss")
+
+			w.Header().Set(cacheHeader, "MISS")
+			cw := &capturaRespuesta{ResponseWriter: w}
+			next.ServeHTTP(cw, r)
+			if cw.status != http.StatusOK {
+				return
+			}
+			v := append([]byte(w.Header().Get("Content-Type")+"\n"), cw.buf.Bytes()...)
+			if err := c.store.Set(context.WithoutCancel(r.Context()), clave, v, c.ttl); err != nil {
+				c.registrarError(r.Context(), err)
+			}
+		})
+	}
+}
+
+// invalidar descarta las respuestas guardadas del tenant. Acepta una caché
+// nil (desactivada).
+func (c *cacheRespuestas) invalidar(tenant string) {
+	if c == nil {
+		return
+	}
+	// Se invalida aunque la petición que lo provoca se haya cancelado
+	if err := c.store.Set(context.Background(), claveGeneracion(tenant), nuevaGeneracion(), 0); err != nil {
+		responseCacheErrors.Inc()
+		logDe("cache").Error("Error invalidando la caché de respuestas: puede servir datos antiguos hasta que caduquen",
+			"tenant", tenant, "ttl", c.ttl, errAttr(err))
+	}
+}
+
+func (c *cacheRespuestas) registrarError(ctx context.Context, err error) {
+	responseCacheErrors.Inc()
+	logDe("cache").WarnContext(ctx, "Error en la caché de respuestas, se responde sin ella", errAttr(err))
+}
+
+// capturaRespuesta copia lo que escribe el handler para guardarlo en la
+// caché. Unwrap da acceso a la conexión a http.ResponseController.
+type capturaRespuesta struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (cw *capturaRespuesta) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *capturaRespuesta) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.buf.Write(b)
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *capturaRespuesta) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
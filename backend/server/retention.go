@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"prueba/pkg/repository"
+	"prueba/pkg/syncengine"
+	"time"
+)
+
+// retencionItems es la antigüedad máxima de los items que se guardan
+// (items_retention, p. ej. "8760h"). 0 los guarda todos.
+func retencionItems() time.Duration {
+	return envDuration("items_retention", 0)
+}
+
+// loteBorradoItems son las filas que se borran por sentencia al aplicar la
+// retención a lo ya guardado (items_purge_batch).
+func loteBorradoItems() int {
+	return envInt("items_purge_batch", syncengine.DefaultPurgeBatch)
+}
+
+// configurarTTL deja en manos de la base de datos el borrado de los items
+// fuera de items_retention si el backend lo soporta (row-level TTL de
+// CockroachDB); si no, o si falla, la etapa purge los sigue borrando por
+// lotes desde la aplicación.
+func configurarTTL(ctx context.Context, store *repository.Store, retention time.Duration) {
+	if store.TTL == nil {
+		return
+	}
+	if err := store.TTL.SetTTL(ctx, retention); err != nil {
+		logDe("db").Warn("No se pudo configurar el row-level TTL, los items antiguos se borran desde la aplicación", errAttr(err))
+		return
+	}
+	if retention > 0 {
+		logDe("db").Info("Items antiguos borrados por row-level TTL", "retention", retention)
+	}
+}
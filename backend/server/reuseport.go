@@ -0,0 +1,25 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package server
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reusePortSoportado indica si el sistema admite SO_REUSEPORT.
+const reusePortSoportado = true
+
+// controlReusePort activa SO_REUSEPORT en el socket antes de hacer bind, de
+// modo que otro proceso pueda escuchar en el mismo puerto a la vez.
+func controlReusePort(network, address string, c syscall.RawConn) error {
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
@@ -1,30 +1,126 @@
 package server
 
-import (
-	"fmt"
-	"net/http"
-)
-
-func initRoutes() {
-	http.HandleFunc("/", index)
-
-	http.HandleFunc("/item", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			getItem(w, r)
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			fmt.Fprintf(w, "Method not allowed")
-		}
-
-	})
-	http.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodPost:
-			sincItems(w, r)
-		default:
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			fmt.Fprintf(w, "Method not allowed")
-		}
-	})
+import "net/http"
+
+// routes registra las rutas en un mux propio. Cada patrón declara su
+// método (sintaxis de Go 1.22); el mux responde 405 con la cabecera Allow a
+// los métodos no registrados. Un patrón GET atiende también HEAD.
+//
+// Con separarAdmin las rutas de administración (gestión de
+// sincronizaciones, recarga de la configuración, feature flags,
+// mantenimiento, nivel de log, métricas, pprof) van en un segundo mux, el
+// del listener de admin_addr; si no, admin es el mismo mux.
+//
+// Los middlewares de cada grupo de rutas se montan con cadena; los comunes a
+// todas (CORS, logs, tenant...) los pone New alrededor del mux.
+func (s *Server) routes(separarAdmin bool) (mux, admin *http.ServeMux) {
+	mux = http.NewServeMux()
+	admin = mux
+	if separarAdmin {
+		admin = http.NewServeMux()
+	}
+
+	// Tiempo máximo de respuesta según el tipo de ruta (http_*_budget)
+	budget := presupuestosTiempo()
+	// Límite de lo que tardan las consultas de los handlers GET
+	// (db_statement_timeout)
+	consultas := encadenar(limiteTiempo(budget.lectura), conDeadline(timeoutConsultas()))
+	// Lecturas de items: con api_key_auth=all exigen el rol viewer, y tienen
+	// límite de peticiones por cliente y cuota por clave de la API
+	lector := encadenar(s.exigirRol(rolViewer, authAll), s.cuotas.middleware(), enVigor.lecturas.middleware())
+	lecturas := lector.con(consultas...)
+	// Lecturas que se sirven desde la caché de respuestas mientras no cambien
+	// los items
+	cacheadas := lector.con(s.cache.middleware()).con(consultas...)
+	// GET /item devuelve la tabla entera: tiene más tiempo
+	exportacion := lector.con(s.cache.middleware(), limiteTiempo(budget.exportacion), conDeadline(timeoutConsultas()))
+	// Sincronizaciones y administración: solo desde admin_allowed_cidrs
+	soloRedesAdmin := permitirIPs(s.cfg.AdminAllowedCIDRs, s.cfg.TrustedProxies, s.auditoria)
+	// Escrituras: cuentan en la cuota de la clave de la API y se bloquean en
+	// modo mantenimiento
+	escrituras := encadenar(s.cuotas.middleware(), s.bloquearEnMantenimiento)
+	// Edición de items: exige el rol analyst salvo con api_key_auth=off
+	edicion := escrituras.con(s.exigirRol(rolAnalyst, authSync, authAll), limiteTiempo(budget.lectura))
+	// Sincronizaciones lanzadas por usuarios: exigen el rol admin salvo con
+	// api_key_auth=off y quedan en el registro de auditoría
+	sincronizacion := escrituras.con(soloRedesAdmin, s.exigirRol(rolAdmin, authSync, authAll), s.auditoria.acciones(), enVigor.sincronizacion.middleware(), limiteTiempo(budget.sincronizacion))
+	// Sincronización del scheduler externo, autenticada. No se limita por IP:
+	// Cloud Scheduler no tiene direcciones fijas
+	scheduler := escrituras.con(s.programador.requireScheduler, s.auditoria.acciones(), limiteTiempo(budget.sincronizacion))
+
+	// Solo la raíz: con "GET /" cualquier GET a una ruta de otro método
+	// (GET /sync) acabaría en index en lugar de en un 405.
+	mux.HandleFunc("GET /{$}", index)
+
+	// Sondas de Kubernetes y versión: sin autenticación ni límites
+	mux.HandleFunc("GET /healthz", getHealthz)
+	mux.Handle("GET /readyz", s.getReadyz())
+	mux.HandleFunc("GET /version", getVersion)
+
+	mux.Handle("GET /item", exportacion.envolverFunc(s.getItem()))
+	mux.Handle("PATCH /item", edicion.envolverFunc(s.patchItem()))
+	mux.Handle("GET /item/stats", cacheadas.envolverFunc(s.getItemStats()))
+	mux.Handle("GET /item/latest", cacheadas.envolverFunc(s.getItemLatest()))
+	mux.Handle("GET /item/daily", cacheadas.envolverFunc(s.getItemDaily()))
+	mux.Handle("GET /item/events", encadenar(s.exigirRol(rolViewer, authAll), s.cuotas.middleware()).envolverFunc(streamEventos(eventos)))
+	mux.Handle("GET /status", lecturas.envolverFunc(s.getStatus(s.programador.configurado())))
+	mux.Handle("GET /recommendations", lecturas.con(s.flags.requerir(flagRecommendations)).envolverFunc(s.getRecommendations()))
+
+	// Sesión y cuentas: todas con límite de peticiones por IP; el registro y
+	// el inicio de sesión con el suyo, más estricto. Iniciar sesión sigue
+	// funcionando en modo mantenimiento, para poder usar las lecturas (y que
+	// un admin lo quite); crear cuentas no
+	consultasAuth := encadenar(enVigor.lecturas.middleware())
+	accesos := encadenar(s.cuotas.middleware(), enVigor.auth.middleware())
+	mux.Handle("GET /auth/me", consultasAuth.con(requerirIdentidad).envolverFunc(getAuthMe()))
+	mux.Handle("GET /auth/csrf", consultasAuth.envolver(getAuthCSRF(s.cfg.Profile != ProfileDevelopment)))
+	mux.Handle("POST /auth/register", accesos.con(s.bloquearEnMantenimiento).envolverFunc(s.registrarUsuario()))
+	mux.Handle("POST /auth/login", accesos.envolverFunc(s.iniciarSesion()))
+	mux.Handle("POST /auth/logout", consultasAuth.con(requerirIdentidad).envolverFunc(s.cerrarSesion()))
+	mux.Handle("GET /auth/usage", consultasAuth.con(requerirIdentidad).envolverFunc(s.getAuthUsage()))
+
+	// Filtros guardados de la vista de items, de cada identidad; los cambios
+	// son escrituras y se bloquean en modo mantenimiento
+	mios := encadenar(requerirIdentidad, s.cuotas.middleware())
+	misCambios := encadenar(requerirIdentidad).con(escrituras...)
+	mux.Handle("GET /me/filters", mios.envolverFunc(s.listarFiltros()))
+	mux.Handle("POST /me/filters", misCambios.envolverFunc(s.crearFiltro()))
+	mux.Handle("PUT /me/filters/{id}", misCambios.envolverFunc(s.editarFiltro()))
+	mux.Handle("DELETE /me/filters/{id}", misCambios.envolverFunc(s.borrarFiltro()))
+
+	mux.Handle("POST /sync", sincronizacion.envolverFunc(s.sincItems()))
+	mux.Handle("POST /sync/scheduled", scheduler.envolverFunc(s.sincItemsProgramado()))
+
+	// Administración: exige el rol admin salvo con api_key_auth=off; las
+	// acciones (no las consultas) quedan en el registro de auditoría
+	administracion := encadenar(soloRedesAdmin, s.exigirRol(rolAdmin, authSync, authAll), s.cuotas.middleware(), s.auditoria.acciones())
+	admin.Handle("GET /admin/api-keys", administracion.envolverFunc(s.listarClaves()))
+	admin.Handle("POST /admin/api-keys", administracion.envolverFunc(s.crearClave()))
+	admin.Handle("PATCH /admin/api-keys/{id}", administracion.envolverFunc(s.editarClave()))
+	admin.Handle("POST /admin/api-keys/{id}/rotate", administracion.envolverFunc(s.rotarClave()))
+	admin.Handle("DELETE /admin/api-keys/{id}", administracion.envolverFunc(s.revocarClave()))
+	admin.Handle("GET /admin/audit", administracion.con(consultas...).envolverFunc(s.listarAuditoria()))
+	admin.Handle("GET /sync/history", administracion.con(consultas...).envolverFunc(s.listarSyncRuns()))
+	admin.Handle("POST /sync/history/{id}/retry", sincronizacion.envolverFunc(s.reintentarSyncRun()))
+	admin.Handle("POST /admin/reload", administracion.envolverFunc(recargar()))
+	admin.Handle("GET /admin/flags", administracion.envolverFunc(s.listarFlags()))
+	admin.Handle("PUT /admin/flags/{name}", administracion.envolverFunc(s.fijarFlag()))
+	admin.Handle("DELETE /admin/flags/{name}", administracion.envolverFunc(s.borrarFlag()))
+	admin.Handle("GET /admin/maintenance", administracion.envolverFunc(s.verMantenimiento()))
+	admin.Handle("PUT /admin/maintenance", administracion.envolverFunc(s.fijarMantenimiento()))
+	admin.Handle("DELETE /admin/maintenance", administracion.envolverFunc(s.quitarMantenimiento()))
+	admin.Handle("GET /admin/log-level", administracion.envolverFunc(verNivelLog()))
+	admin.Handle("PUT /admin/log-level", administracion.envolverFunc(s.fijarNivelLog()))
+	admin.Handle("DELETE /admin/log-level", administracion.envolverFunc(s.quitarNivelLog()))
+
+	// Métricas para Prometheus: con su propio token (metrics_token), que
+	// Prometheus manda como Bearer, en lugar de las credenciales de la API
+	admin.Handle("GET /metrics", encadenar(soloRedesAdmin, tokenMetricas(s.cfg.MetricsToken)).envolverFunc(getMetrics()))
+
+	// Profiling (pprof=true, solo con admin_addr)
+	if s.cfg.Pprof {
+		rutasPprof(admin, administracion)
+	}
+
+	return mux, admin
 }
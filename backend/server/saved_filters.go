@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"prueba/pkg/repository"
+	"strconv"
+	"strings"
+)
+
+// Filtros que puede guardar cada propietario.
+const maxSavedFilters = 100
+
+// propietario es la clave con la que se guardan los datos de la identidad
+// (los filtros de /me/filters): el id de la cuenta con sesiones, que no
+// cambia aunque cambie el email, y el método y el sujeto con el resto.
+func (id *identidad) propietario() string {
+	if id.Usuario != 0 {
+		return "user:" + strconv.FormatInt(id.Usuario, 10)
+	}
+	return id.Metodo + ":" + id.Sujeto
+}
+
+// filtroDeBody lee {"name", "query", "sort_by", "sort_order"} y lo valida;
+// responde 400 si no es válido. El orden por defecto es el del frontend:
+// por fecha, lo más reciente primero.
+func filtroDeBody(w http.ResponseWriter, r *http.Request) (repository.SavedFilter, bool) {
+	f := repository.SavedFilter{SortBy: "date", SortOrder: "desc"}
+	if !decodificarJSON(w, r, &f) {
+		return f, false
+	}
+	f.Name = strings.TrimSpace(f.Name)
+	f.Query = strings.TrimSpace(f.Query)
+	if err := f.Validate(); err != nil {
+		errorHTTP(w, r, http.StatusBadRequest, msgFilterInvalid, err)
+		return f, false
+	}
+	return f, true
+}
+
+// idFiltro lee el {id} de la ruta; responde 400 si no es válido.
+func idFiltro(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		errorHTTP(w, r, http.StatusBadRequest, msgFilterIDInvalid)
+		return 0, false
+	}
+	return id, true
+}
+
+// responderErrorFiltro responde al error de una operación sobre el filtro f
+// (id).
+func responderErrorFiltro(w http.ResponseWriter, r *http.Request, id int64, f repository.SavedFilter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		errorHTTP(w, r, http.StatusNotFound, msgFilterNotFound, id)
+	case errors.Is(err, repository.ErrConflict):
+		errorHTTP(w, r, http.StatusConflict, msgFilterExists, f.Name)
+	default:
+		responderError(w, r, msgFilterError, err)
+	}
+}
+
+// listarFiltros es GET /me/filters: los filtros guardados de quien hace la
+// petición, por nombre.
+func (s *Server) listarFiltros() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filtros, err := s.store.Filters.List(r.Context(), identidadDe(r.Context()).propietario())
+		if err != nil {
+			responderError(w, r, msgFilterError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(struct {
+			Filters []repository.SavedFilter `json:"filters"`
+		}{Filters: filtros})
+	}
+}
+
+// crearFiltro es POST /me/filters con {"name", "query", "sort_by",
+// "sort_order"}: guarda un filtro (201). Los nombres no se repiten (409) y
+// cada uno puede guardar hasta maxSavedFilters.
+func (s *Server) crearFiltro() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, ok := filtroDeBody(w, r)
+		if !ok {
+			return
+		}
+		propietario := identidadDe(r.Context()).propietario()
+		filtros, err := s.store.Filters.List(r.Context(), propietario)
+		if err != nil {
+			responderError(w, r, msgFilterError, err)
+			return
+		}
+		if len(filtros) >= maxSavedFilters {
+			errorHTTP(w, r, http.StatusConflict, msgFilterLimit, maxSavedFilters)
+			return
+		}
+		out, err := s.store.Filters.Create(r.Context(), propietario, f)
+		if err != nil {
+			responderErrorFiltro(w, r, 0, f, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// editarFiltro es PUT /me/filters/{id}: sustituye el nombre, la búsqueda y
+// el orden de un filtro propio.
+func (s *Server) editarFiltro() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := idFiltro(w, r)
+		if !ok {
+			return
+		}
+		f, ok := filtroDeBody(w, r)
+		if !ok {
+			return
+		}
+		out, err := s.store.Filters.Update(r.Context(), identidadDe(r.Context()).propietario(), id, f)
+		if err != nil {
+			responderErrorFiltro(w, r, id, f, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// borrarFiltro es DELETE /me/filters/{id}.
+func (s *Server) borrarFiltro() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := idFiltro(w, r)
+		if !ok {
+			return
+		}
+		if err := s.store.Filters.Delete(r.Context(), identidadDe(r.Context()).propietario(), id); err != nil {
+			responderErrorFiltro(w, r, id, repository.SavedFilter{}, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
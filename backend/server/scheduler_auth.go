@@ -0,0 +1,122 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Valores por defecto para tokens OIDC de Google Cloud Scheduler.
+const (
+	defaultSchedulerJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+	defaultSchedulerIssuers = "https://accounts.google.com,accounts.google.com"
+)
+
+// schedulerSecretHeader es el header con el secreto compartido del scheduler.
+const schedulerSecretHeader = "X-Scheduler-Secret"
+
+// schedulerAuth valida que una petición viene del scheduler externo, ya sea por
+// un secreto compartido o por un token OIDC emitido para su cuenta de servicio.
+// Es independiente de cualquier autenticación de usuarios.
+type schedulerAuth struct {
+	secret string
+
+	verifier *jwksVerifier
+	issuers  []string
+	audience string
+	email    string
+}
+
+func cargarSchedulerAuth() *schedulerAuth {
+	a := &schedulerAuth{
+		secret:   os.Getenv("scheduler_secret"),
+		audience: os.Getenv("scheduler_oidc_audience"),
+		email:    os.Getenv("scheduler_oidc_email"),
+	}
+
+	if a.audience != "" {
+		jwksURL := os.Getenv("scheduler_oidc_jwks_url")
+		if jwksURL == "" {
+			jwksURL = defaultSchedulerJWKSURL
+		}
+		issuers := os.Getenv("scheduler_oidc_issuer")
+		if issuers == "" {
+			issuers = defaultSchedulerIssuers
+		}
+		a.verifier = newJWKSVerifier(jwksURL)
+		a.issuers = strings.Split(issuers, ",")
+		if a.email == "" {
+			logDe("scheduler_auth").Warn("scheduler_oidc_email no definido: se aceptará cualquier identidad con la audiencia configurada")
+		}
+	}
+	return a
+}
+
+func (a *schedulerAuth) configurado() bool {
+	return a.secret != "" || a.verifier != nil
+}
+
+// autorizado indica si la petición trae credenciales válidas del scheduler.
+func (a *schedulerAuth) autorizado(r *http.Request) bool {
+	if a.secret != "" {
+		if got := r.Header.Get(schedulerSecretHeader); got != "" {
+			return subtle.ConstantTimeCompare([]byte(got), []byte(a.secret)) == 1
+		}
+	}
+
+	if a.verifier != nil {
+		token := bearerToken(r)
+		if token == "" {
+			return false
+		}
+		claims, err := a.verifier.Verify(r.Context(), token)
+		if err != nil {
+			logDe("scheduler_auth").WarnContext(r.Context(), "Token OIDC del scheduler rechazado", errAttr(err))
+			return false
+		}
+		return a.claimsValidos(claims)
+	}
+	return false
+}
+
+func (a *schedulerAuth) claimsValidos(claims jwtClaims) bool {
+	issuerOK := false
+	for _, iss := range a.issuers {
+		if claims.str("iss") == strings.TrimSpace(iss) {
+			issuerOK = true
+			break
+		}
+	}
+	if !issuerOK {
+		logDe("scheduler_auth").Warn("Token OIDC del scheduler con issuer inesperado", "iss", claims.str("iss"))
+		return false
+	}
+	if !claims.hasAudience(a.audience) {
+		logDe("scheduler_auth").Warn("Token OIDC del scheduler con audiencia inesperada", "aud", claims.audiences())
+		return false
+	}
+	if a.email != "" {
+		verified, _ := claims["email_verified"].(bool)
+		if claims.str("email") != a.email || !verified {
+			logDe("scheduler_auth").Warn("Token OIDC del scheduler con identidad inesperada", "email", claims.str("email"))
+			return false
+		}
+	}
+	return true
+}
+
+// requireScheduler protege un handler para que solo lo invoque el scheduler.
+func (a *schedulerAuth) requireScheduler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.configurado() {
+			errorHTTP(w, r, http.StatusNotFound, msgSchedulerOff)
+			return
+		}
+		if !a.autorizado(r) {
+			errorHTTP(w, r, http.StatusUnauthorized, msgUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"prueba/internal/redact"
+	"prueba/pkg/repository"
+	"prueba/pkg/secrets"
+	"strings"
+)
+
+// Proveedores de secretos de secrets_provider.
+const (
+	// secretosEntorno: dsn, dsn_read y token son los valores tal cual (por
+	// defecto).
+	secretosEntorno = "env"
+	// secretosVault: pueden ser referencias vault:ruta#campo a secretos de
+	// Vault.
+	secretosVault = "vault"
+	// secretosAWS: pueden ser referencias aws:sm:<nombre o ARN>[#campo] a
+	// Secrets Manager o aws:ssm:<nombre> a Parameter Store.
+	secretosAWS = "aws"
+)
+
+// proveedorSecretos lee secrets_provider y la configuración del gestor
+// elegido. Devuelve el nombre del proveedor, que es también el prefijo de
+// sus referencias, y el gestor; nil con secretos en el entorno.
+//
+// Con vault: vault_addr, vault_namespace (Vault Enterprise) y la
+// autenticación, vault_token o, en Kubernetes, vault_k8s_role con
+// vault_k8s_mount y vault_k8s_token_path.
+//
+// Con aws: aws_region (por defecto AWS_REGION o AWS_DEFAULT_REGION) y
+// aws_endpoint_url (por defecto AWS_ENDPOINT_URL) para usar otro endpoint;
+// las credenciales son las del entorno, las del rol de la cuenta de servicio
+// en EKS o las del rol de la tarea en ECS.
+func proveedorSecretos() (string, secrets.Provider, error) {
+	switch p := os.Getenv("secrets_provider"); p {
+	case "", secretosEntorno:
+		return secretosEntorno, nil, nil
+	case secretosVault:
+		v, err := secrets.NewVault(secrets.VaultConfig{
+			Addr:                os.Getenv("vault_addr"),
+			Namespace:           os.Getenv("vault_namespace"),
+			Token:               os.Getenv("vault_token"),
+			KubernetesRole:      os.Getenv("vault_k8s_role"),
+			KubernetesMount:     os.Getenv("vault_k8s_mount"),
+			KubernetesTokenPath: os.Getenv("vault_k8s_token_path"),
+		})
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid vault configuration: %w", err)
+		}
+		v.Logger = logDe("secrets")
+		return p, v, nil
+	case secretosAWS:
+		a, err := secrets.NewAWS(
+			primeraVariable("aws_region", "AWS_REGION", "AWS_DEFAULT_REGION"),
+			primeraVariable("aws_endpoint_url", "AWS_ENDPOINT_URL"),
+		)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid aws configuration: %w", err)
+		}
+		return p, a, nil
+	default:
+		return "", nil, fmt.Errorf("invalid secrets_provider %q (valid: %s, %s, %s)", p, secretosEntorno, secretosVault, secretosAWS)
+	}
+}
+
+// primeraVariable devuelve la primera de las variables de entorno que no
+// está vacía.
+func primeraVariable(nombres ...string) string {
+	for _, n := range nombres {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// validarSecretos comprueba que las referencias a secretos de la
+// configuración son del gestor de secrets_provider y que
+// vault_db_creds_path se puede usar.
+func validarSecretos(cfg Config) []error {
+	var errs []error
+	for nombre, v := range map[string]string{"dsn": cfg.DSN, "dsn_read": cfg.ReadDSN, "token": cfg.UpstreamToken} {
+		for _, p := range []string{secretosVault, secretosAWS} {
+			if strings.HasPrefix(v, p+":") && cfg.SecretsProvider != p {
+				errs = append(errs, fmt.Errorf("%s references a %s secret but secrets_provider is not %s", nombre, p, p))
+			}
+		}
+	}
+	if os.Getenv("vault_db_creds_path") != "" {
+		if cfg.SecretsProvider != secretosVault {
+			errs = append(errs, fmt.Errorf("vault_db_creds_path requires secrets_provider=%s", secretosVault))
+		}
+		if cfg.DBDriver != "" && cfg.DBDriver != "postgres" {
+			errs = append(errs, fmt.Errorf("vault_db_creds_path is not supported by %s", cfg.DBDriver))
+		}
+	}
+	return errs
+}
+
+// resolverSecretos sustituye en cfg las referencias de dsn, dsn_read y
+// token al gestor de secrets_provider (<proveedor>:<referencia>) por sus
+// valores.
+//
+// Con Vault inicia antes sesión y, con vault_db_creds_path (p. ej.
+// database/creds/prueba), pide además credenciales dinámicas de base de
+// datos, que sustituyen al usuario y la contraseña del dsn en cada conexión
+// nueva (ver nuevoPool). El token de Vault y las credenciales se renuevan en
+// segundo plano hasta que se cancele ctx.
+//
+// Al terminar, con o sin gestor, registra los secretos en redact (ver
+// registrarSecretos).
+func resolverSecretos(ctx context.Context, cfg *Config) error {
+	defer registrarSecretos(cfg)
+	if cfg.Secrets == nil {
+		return nil
+	}
+	vault, _ := cfg.Secrets.(*secrets.Vault)
+	if vault != nil {
+		if err := vault.Login(ctx); err != nil {
+			return fmt.Errorf("vault login: %w", err)
+		}
+	}
+	for _, v := range []*string{&cfg.DSN, &cfg.ReadDSN, &cfg.UpstreamToken} {
+		if ref, ok := strings.CutPrefix(*v, cfg.SecretsProvider+":"); ok {
+			s, err := cfg.Secrets.Secret(ctx, ref)
+			if err != nil {
+				return fmt.Errorf("%s secret %q: %w", cfg.SecretsProvider, ref, err)
+			}
+			*v = s
+		}
+	}
+	if vault != nil {
+		if path := os.Getenv("vault_db_creds_path"); path != "" {
+			creds, err := vault.DatabaseCredentials(ctx, path)
+			if err != nil {
+				return fmt.Errorf("vault database credentials: %w", err)
+			}
+			cfg.DBCredentials = creds
+			logDe("secrets").Info("Credenciales de base de datos dinámicas de Vault", "path", path, "ttl", creds.TTL())
+		}
+		go vault.Run(ctx)
+	}
+	logDe("secrets").Info("Secretos leídos del gestor de secretos", "provider", cfg.SecretsProvider)
+	return nil
+}
+
+// registrarSecretos da a redact los tokens de la API upstream y de
+// /metrics y las
+// contraseñas de los dsn, para quitarlos de los logs y de las respuestas
+// aunque aparezcan sin una forma reconocible.
+func registrarSecretos(cfg *Config) {
+	redact.Register(cfg.UpstreamToken, cfg.MetricsToken)
+	redact.Register(repository.DSNPassword(cfg.DBDriver, cfg.DSN), repository.DSNPassword(cfg.DBDriver, cfg.ReadDSN))
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/http"
+	"os"
+)
+
+// defaultCSP es la Content-Security-Policy por defecto: la API solo devuelve
+// JSON y eventos, así que no se permite cargar nada ni incrustarla en frames.
+const defaultCSP = "default-src 'none'; frame-ancestors 'none'"
+
+// politicaCSP es la Content-Security-Policy de las respuestas
+// (content_security_policy); "off" no manda la cabecera.
+func politicaCSP() string {
+	switch v := os.Getenv("content_security_policy"); v {
+	case "":
+		return defaultCSP
+	case "off":
+		return ""
+	default:
+		return v
+	}
+}
+
+// cabecerasSeguridadMiddleware pone en todas las respuestas las cabeceras de
+// seguridad para navegadores: sin sniffing de tipos, sin frames, sin Referer
+// hacia otros orígenes y la CSP csp. Con hsts (el servidor termina TLS) añade
+// Strict-Transport-Security.
+func cabecerasSeguridadMiddleware(csp string, hsts bool) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+			if csp != "" {
+				h.Set("Content-Security-Policy", csp)
+			}
+			if hsts {
+				h.Set("Strict-Transport-Security", "max-age=31536000")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"prueba/internal/redact"
+	"prueba/internal/sentry"
+	"prueba/internal/tracing"
+	"prueba/internal/version"
+	"prueba/pkg/repository"
+	"strconv"
+	"time"
+)
+
+// Tiempo máximo para enviar los eventos pendientes al apagar.
+const timeoutCierreSentry = 5 * time.Second
+
+// Cabeceras de la petición que van en los eventos. El resto (Authorization,
+// Cookie, X-API-Key...) no salen del proceso.
+var cabecerasSentry = []string{"User-Agent", "Accept", "Accept-Language", "Content-Type", "Origin", "Referer", requestIDHeader}
+
+// sentryEntorno lee la configuración de Sentry: sentry_dsn (o SENTRY_DSN) es
+// el DSN del proyecto, sentry_environment el entorno (por defecto el perfil,
+// APP_ENV) y sentry_release la versión desplegada (por defecto la del
+// binario, ver el paquete version). Sin DSN devuelve nil.
+func sentryEntorno(perfil string) (*sentry.Config, error) {
+	dsn := primeraVariable("sentry_dsn", "SENTRY_DSN")
+	if dsn == "" {
+		return nil, nil
+	}
+	if err := sentry.ValidateDSN(dsn); err != nil {
+		return nil, fmt.Errorf("invalid sentry_dsn: %w", err)
+	}
+	redact.Register(dsn)
+	cfg := &sentry.Config{
+		DSN:         dsn,
+		Environment: primeraVariable("sentry_environment", "SENTRY_ENVIRONMENT"),
+		Release:     primeraVariable("sentry_release", "SENTRY_RELEASE"),
+	}
+	if cfg.Environment == "" {
+		cfg.Environment = perfil
+	}
+	if cfg.Release == "" {
+		cfg.Release = version.Get().Version
+	}
+	return cfg, nil
+}
+
+// iniciarSentry activa el envío de errores a Sentry con cfg (nil lo deja
+// desactivado). Los eventos pendientes se envían al apagar, en cierres.
+func iniciarSentry(cfg *sentry.Config) error {
+	if cfg == nil {
+		return nil
+	}
+	c := *cfg
+	c.Logger = logDe("sentry")
+	cliente, err := sentry.New(c)
+	if err != nil {
+		return err
+	}
+	sentry.Default = cliente
+	cierres = append(cierres, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutCierreSentry)
+		defer cancel()
+		if err := sentry.Default.Close(ctx); err != nil {
+			logDe("sentry").Warn("No se enviaron todos los eventos a Sentry al apagar", errAttr(err))
+		}
+	})
+	logDe("sentry").Info("Errores enviados a Sentry", "environment", c.Environment, "release", c.Release)
+	return nil
+}
+
+// reportarPanic envía a Sentry un panic de un handler, con la pila del
+// panic. Se llama desde la función diferida del recover.
+func reportarPanic(r *http.Request, v any) {
+	if sentry.Default == nil {
+		return
+	}
+	err, ok := v.(error)
+	if !ok {
+		err = fmt.Errorf("%v", v)
+	}
+	ev := eventoPeticion(r, "panic: "+redact.String(err.Error()))
+	ev.Level = sentry.LevelFatal
+	// Sin reportarPanic ni la función diferida del recover: la pila acaba
+	// en el panic
+	ex := sentry.NewException(err, 2)
+	ex.Value = redact.String(ex.Value)
+	ev.Exception = []sentry.Exception{ex}
+	ev.Tags["mechanism"] = "panic"
+	sentry.Capture(ev)
+}
+
+// reportarErrorHTTP envía a Sentry el error con el que un handler respondió
+// status (5xx). Los errores de contexto (cliente desconectado, tiempo
+// agotado) no se envían: no son fallos del servidor.
+func reportarErrorHTTP(r *http.Request, status int, err error) {
+	if sentry.Default == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	ev := eventoPeticion(r, redact.String(err.Error()))
+	ex := sentry.NewException(err, 2)
+	ex.Value = redact.String(ex.Value)
+	ev.Exception = []sentry.Exception{ex}
+	ev.Tags["status_code"] = strconv.Itoa(status)
+	sentry.Capture(ev)
+}
+
+// reportarSyncFallida envía a Sentry una sincronización que terminó con
+// error (no las interrumpidas).
+func reportarSyncFallida(ctx context.Context, trigger string, runID int64, err error) {
+	if sentry.Default == nil {
+		return
+	}
+	ex := sentry.NewException(err, 1)
+	ex.Value = redact.String(ex.Value)
+	ev := &sentry.Event{
+		Logger:    "sync",
+		Message:   "sync failed: " + redact.String(err.Error()),
+		Exception: []sentry.Exception{ex},
+		Tags: map[string]string{
+			"tenant":  repository.TenantFrom(ctx),
+			"trigger": trigger,
+		},
+		Extra:    map[string]any{"run_id": runID},
+		Contexts: contextoTraza(ctx),
+	}
+	sentry.Capture(ev)
+}
+
+// eventoPeticion crea un evento con los datos de la petición r: URL, método,
+// algunas cabeceras, quién la hizo y su id y traza.
+func eventoPeticion(r *http.Request, mensaje string) *sentry.Event {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	req := &sentry.Request{
+		URL:         scheme + "://" + r.Host + r.URL.Path,
+		Method:      r.Method,
+		QueryString: redact.String(r.URL.RawQuery),
+		Headers:     map[string]string{},
+	}
+	for _, h := range cabecerasSentry {
+		if v := r.Header.Get(h); v != "" {
+			req.Headers[h] = v
+		}
+	}
+	ev := &sentry.Event{
+		Logger:   "http",
+		Message:  mensaje,
+		Request:  req,
+		Tags:     map[string]string{"tenant": repository.TenantFrom(r.Context())},
+		Contexts: contextoTraza(r.Context()),
+	}
+	if id := RequestIDFrom(r.Context()); id != "" {
+		ev.Tags["request_id"] = id
+	}
+	if r.Pattern != "" {
+		ev.Tags["route"] = r.Pattern
+	}
+	if id := identidadDe(r.Context()); id != nil {
+		ev.User = &sentry.User{ID: id.propietario()}
+		ev.Tags["auth_method"] = id.Metodo
+	}
+	return ev
+}
+
+// contextoTraza enlaza el evento con la traza de ctx, si la hay.
+func contextoTraza(ctx context.Context) map[string]any {
+	span := tracing.FromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	return map[string]any{"trace": map[string]string{"trace_id": span.TraceID(), "span_id": span.SpanID()}}
+}
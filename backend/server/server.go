@@ -1,57 +1,327 @@
 package server
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"prueba/internal/tracing"
+	"prueba/pkg/repository"
+	"strconv"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-func init() {
-	// Cargar variables de entorno desde .env
-	if err := godotenv.Load(); err != nil {
-		log.Println("No se encontró archivo .env, usando variables de entorno del sistema")
+// New monta el servidor HTTP con la configuración cfg (ver LoadConfig): abre
+// la base de datos, registra las rutas y arranca los procesos en segundo
+// plano.
+func New(cfg Config) (*http.Server, error) {
+	if err := resolverSecretos(syncBaseCtx, &cfg); err != nil {
+		return nil, err
 	}
+	// Antes de abrir la base de datos: los pools de pgx trazan sus consultas
+	iniciarTrazas(cfg.Tracing)
+	if err := iniciarSentry(cfg.Sentry); err != nil {
+		return nil, err
+	}
+	if err := iniciarExportacion(cfg.Metrics); err != nil {
+		return nil, err
+	}
+	store, err := abrirStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	store = repository.WithTimeouts(store, timeoutsOperaciones())
+	if cfg.Redis != nil {
+		cierres = append(cierres, cfg.Redis.Close)
+		logDe("cache").Info("Caché de respuestas en Redis (redis_url)")
+	}
+	if err := esperarBaseDatos(syncBaseCtx, store); err != nil {
+		return nil, err
+	}
+	if err := migrarBaseDatos(syncBaseCtx, store); err != nil {
+		return nil, err
+	}
+	configurarTTL(syncBaseCtx, store, retencionItems())
+
+	app := NewServer(cfg, store, clienteUpstream(), slog.Default())
+	alertasErrores = nuevasAlertas(cfg.Alerts, app.webhooks)
+	// Los eventos de auditoría en cola se escriben antes de cerrar la base de
+	// datos; los webhooks y latidos en curso se terminan de entregar
+	cierres = append([]func(){app.auditoria.cerrar, app.webhooks.cerrar, app.latido.cerrar}, cierres...)
+	// Ajustes que Reload puede cambiar después (CORS, límites, pesos...)
+	aplicarAjustes(cfg)
+
+	// Aquí registras tus rutas
+	mux, admin := app.routes(cfg.AdminAddr != "")
+	if cfg.AdminAddr != "" {
+		servidorAdmin = nuevoServidorAdmin(cfg, admin, app.autenticar, app.tenantMiddleware)
+	}
+
+	// Worker que procesa la cola de reintentos de sincronizaciones fallidas
+	app.iniciarWorkerReintentos(syncBaseCtx)
+
+	// Estado de los pools de conexiones en las métricas
+	iniciarMetricasPool(syncBaseCtx, store)
+
+	// Cambios en items (de cualquier proceso) hacia los clientes SSE
+	iniciarCDC(syncBaseCtx, store.Changes, eventos, app.cache)
+
+	// Middlewares comunes a todas las rutas, del más externo al más interno.
+	// El access log va dentro del id de la petición para que lo incluya, y
+	// recuperar dentro del access log para que registre el 500.
+	comunes := encadenar(
+		requestIDMiddleware,
+		versionMiddleware,
+		metricasHTTPMiddleware,
+		trazasHTTPMiddleware,
+		idiomaMiddleware(cfg.DefaultLanguage),
+		accessLogMiddleware(logDe("http")),
+		recuperarMiddleware,
+		cabecerasSeguridadMiddleware(politicaCSP(), cfg.TLS != nil),
+		corsMiddleware(&enVigor.cors),
+		limiteCuerpoMiddleware(int64(envInt("max_body_bytes", defaultMaxBodyBytes))),
+		comentarSQLMiddleware(),
+		app.autenticar,
+		app.tenantMiddleware,
+		csrfMiddleware(cfg.CSRF, app.auditoria),
+	)
+
+	srv := &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           comunes.envolver(anotarRuta(mux)),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		TLSConfig:         cfg.TLS,
+		Protocols:         cfg.Protocols,
+		ErrorLog:          logErroresHTTP(slog.Default()),
+	}
+	// Al apagar se desconecta a los clientes de eventos, que se reconectan
+	// al proceso que siga escuchando. Las sincronizaciones en curso las
+	// interrumpe Shutdown (no Handover).
+	srv.RegisterOnShutdown(eventos.Cerrar)
+	return srv, nil
 }
 
-// Middleware CORS
-func corsMiddleware(next http.Handler) http.Handler {
-	urlfront := os.Getenv("urlfront")
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Origen permitido: tu frontend en Vite
-		w.Header().Set("Access-Control-Allow-Origin", urlfront)
-		w.Header().Set("Vary", "Origin")
+// sinDeadline quita los límites de lectura y escritura de la conexión para
+// una respuesta de larga duración (SSE, sincronización síncrona), que si no
+// se cortaría al vencer http_write_timeout. El de lectura también se quita:
+// al vencer, el servidor da la conexión por cerrada y cancela la petición.
+func sinDeadline(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		logDe("http").Warn("Error quitando el límite de lectura", errAttr(err))
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		logDe("http").Warn("Error quitando el límite de escritura", errAttr(err))
+	}
+}
+
+// cierres son los recursos que Shutdown libera al final (pool de conexiones...).
+var cierres []func()
 
-		// Métodos permitidos
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+// abrirStore abre el backend de base de datos de cfg.DBDriver. Por
+// defecto es CockroachDB/PostgreSQL con pgx; el resto (mysql, sqlite) van por
+// database/sql. sqlite solo está si se compiló con -tags sqlite.
+//
+// Si cfg.ReadDSN no está vacío, las lecturas de items de los endpoints GET van a
+// esa réplica para no competir con las escrituras de la sincronización.
+//
+// cfg.Tablas fija el esquema y el nombre de la tabla de items (db_schema,
+// items_table); en CockroachDB el esquema se aplica con el search_path del
+// pool, de modo que todas las tablas de la instancia quedan en él.
+//
+// cfg.DBTLSMode y cfg.DBTLS vienen de db_tls_* (ver tlsBD); con el modo vacío
+// manda el dsn. En los backends de database/sql "disable" también deja el dsn
+// como está.
+func abrirStore(cfg Config) (*repository.Store, error) {
+	if cfg.ReadDSN != "" {
+		logDe("db").Info("Lecturas de items dirigidas a la réplica (dsn_read)")
+	}
+	opts := repository.Options{
+		TLS:           cfg.DBTLS,
+		SlowQuery:     umbralConsultaLenta(),
+		OnSlowQuery:   registrarConsultaLenta,
+		RLS:           cfg.rls(),
+		FollowerReads: retrasoFollowerReads(),
+	}
 
-		// Headers permitidos (IMPORTANTE: Content-Type para tu POST /sync)
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if cfg.DBDriver == "" || cfg.DBDriver == "postgres" {
+		if opts.FollowerReads > 0 {
+			logDe("db").Info("Lecturas de los endpoints con AS OF SYSTEM TIME (db_follower_reads)", "delay", opts.FollowerReads)
+		}
+		// Pool de conexiones compartido por todos los handlers. Es perezoso: las
+		// conexiones se abren con la primera consulta y luego se reutilizan.
+		db, err := nuevoPool(context.Background(), cfg.DSN, cfg)
+		if err != nil {
+			return nil, err
+		}
+		cierres = append(cierres, db.Close)
 
-		// Peticiones preflight (OPTIONS)
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
+		var replica *pgxpool.Pool
+		if cfg.ReadDSN != "" {
+			if replica, err = nuevoPool(context.Background(), cfg.ReadDSN, cfg); err != nil {
+				return nil, fmt.Errorf("read replica: %w", err)
+			}
+			cierres = append(cierres, replica.Close)
 		}
+		return repository.NewPostgres(db, replica, cfg.Tablas, opts), nil
+	}
 
-		// Para GET/POST normales, sigue la cadena
-		next.ServeHTTP(w, r)
-	})
+	store, cerrar, err := repository.Open(cfg.DBDriver, cfg.DSN, cfg.ReadDSN, cfg.Tablas, opts)
+	if err != nil {
+		return nil, err
+	}
+	cierres = append(cierres, cerrar)
+	logDe("db").Info("Usando base de datos", "driver", cfg.DBDriver)
+	return store, nil
 }
 
-func New(addr string) *http.Server {
-	// Aquí registras tus rutas
-	// initRoutes seguramente hace algo tipo:
-	// http.HandleFunc("/item", getItem)
-	// http.HandleFunc("/sync", sincItems)
-	initRoutes()
+// nuevoPool crea un pool de pgx para dsn con los ajustes de base de datos de
+// c.
+func nuevoPool(ctx context.Context, dsn string, c Config) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing dsn: %w", err)
+	}
+	cfg.LazyConnect = true
+	if c.Tablas.Schema != "" {
+		cfg.ConnConfig.RuntimeParams["search_path"] = c.Tablas.Schema
+	}
+	if c.DBTLSMode != "" {
+		// La configuración explícita sustituye a la del dsn, incluidos los
+		// fallbacks de sslmode=prefer (que reintentan sin TLS).
+		tlsCfg := c.DBTLS
+		if tlsCfg != nil {
+			tlsCfg = tlsCfg.Clone()
+			if c.DBTLSMode == tlsVerifyFull {
+				tlsCfg.ServerName = cfg.ConnConfig.Host
+			}
+		}
+		cfg.ConnConfig.TLSConfig = tlsCfg
+		cfg.ConnConfig.Fallbacks = nil
+	}
+	// Compatibilidad con poolers en modo transacción (PgBouncer): cada sentencia
+	// puede ir a una conexión distinta del servidor, así que no se pueden usar
+	// sentencias preparadas. Con el pooler los parámetros de arranque
+	// (search_path, statement_timeout) deben estar permitidos en su
+	// configuración.
+	if on, _ := strconv.ParseBool(os.Getenv("db_simple_protocol")); on {
+		cfg.ConnConfig.PreferSimpleProtocol = true
+		cfg.ConnConfig.BuildStatementCache = nil
+	}
+	if c.rls() {
+		cfg.BeforeAcquire = repository.TenantBeforeAcquire
+	}
+	// Credenciales dinámicas de Vault: cada conexión nueva usa las vigentes,
+	// y las conexiones se renuevan antes de que caduque su lease
+	if creds := c.DBCredentials; creds != nil {
+		cfg.BeforeConnect = func(_ context.Context, cc *pgx.ConnConfig) error {
+			cc.User, cc.Password = creds.Current()
+			return nil
+		}
+		if ttl := creds.TTL() / 2; ttl > 0 && (cfg.MaxConnLifetime == 0 || ttl < cfg.MaxConnLifetime) {
+			cfg.MaxConnLifetime = ttl
+		}
+	}
+	// Límite por sentencia en el servidor, para que una consulta patológica no
+	// retenga la conexión indefinidamente.
+	if t := timeoutConsultas(); t > 0 {
+		cfg.ConnConfig.RuntimeParams["statement_timeout"] = statementTimeoutParam(t)
+	}
+	// pgx informa de la duración de cada consulta con nivel info; el logger
+	// solo se queda con las que superan el umbral. Con trazas, cada consulta
+	// es además un span.
+	if t := umbralConsultaLenta(); t > 0 {
+		cfg.ConnConfig.Logger = repository.SlowQueryLogger(t, registrarConsultaLenta)
+		cfg.ConnConfig.LogLevel = pgx.LogLevelInfo
+	}
+	if tracing.Default != nil {
+		cfg.ConnConfig.Logger = repository.TracingLogger(cfg.ConnConfig.Logger)
+		cfg.ConnConfig.LogLevel = pgx.LogLevelInfo
+	}
+
+	db, err := pgxpool.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating connection pool: %w", err)
+	}
+	return db, nil
+}
 
-	// Usas el DefaultServeMux, pero envuelto con CORS
-	handlerConCORS := corsMiddleware(http.DefaultServeMux)
+// ListenAndServe sirve srv hasta que se apague: en HTTPS si se configuró un
+// certificado (cfg.TLS, ver tlsHTTP y autocertHTTP) y en HTTP plano si no.
+// Con autocert_http_addr levanta además el servidor del reto HTTP-01, que se
+// cierra junto con srv, y con admin_addr el de administración, que se apaga
+// en Shutdown. Con unix_socket srv escucha también en ese socket. Con
+// reuse_port todos los listeners TCP admiten otro proceso en el mismo puerto
+// (ver Handover).
+func ListenAndServe(srv *http.Server, cfg Config) error {
+	if cfg.UnixSocket != "" {
+		if err := servirUnix(srv, cfg); err != nil {
+			return err
+		}
+	}
+	if servidorAdmin != nil {
+		go func() {
+			logDe("admin").Info("Servidor de administración iniciado", "addr", servidorAdmin.Addr)
+			if err := servirTCP(servidorAdmin, cfg.ReusePort, servidorAdmin.TLSConfig != nil); err != nil && err != http.ErrServerClosed {
+				logDe("admin").Error("Error en el servidor de administración", errAttr(err))
+			}
+		}()
+	}
+	if cfg.Autocert != nil && cfg.AutocertHTTPAddr != "" {
+		reto := servidorRetoACME(cfg.Autocert, cfg.AutocertHTTPAddr)
+		srv.RegisterOnShutdown(func() { reto.Close() })
+		go func() {
+			logDe("http").Info("Reto ACME HTTP-01", "addr", reto.Addr)
+			if err := servirTCP(reto, cfg.ReusePort, false); err != nil && err != http.ErrServerClosed {
+				logDe("http").Error("Error en el servidor del reto ACME", errAttr(err))
+			}
+		}()
+	}
+	return servirTCP(srv, cfg.ReusePort, cfg.TLS != nil)
+}
+
+// Shutdown apaga el servidor de forma ordenada: interrumpe las sincronizaciones
+// en curso, espera a que registren su estado y a que terminen las peticiones
+// HTTP activas, o hasta que venza ctx.
+func Shutdown(ctx context.Context, srv *http.Server) error {
+	return apagar(ctx, srv, true)
+}
+
+// apagar es Shutdown, o Handover si no interrumpir.
+func apagar(ctx context.Context, srv *http.Server, interrumpir bool) error {
+	pararTrabajos.Do(func() { close(sinTrabajosNuevos) })
+	if interrumpir {
+		cancelarSyncs()
+	}
+	err := srv.Shutdown(ctx)
+	if servidorAdmin != nil {
+		err = errors.Join(err, servidorAdmin.Shutdown(ctx))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		syncWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		cancelarSyncs()
+		logDe("sync").Warn("Tiempo de apagado agotado con sincronizaciones en curso")
+		return ctx.Err()
+	}
 
-	return &http.Server{
-		Addr:    addr,
-		Handler: handlerConCORS,
+	for _, cerrar := range cierres {
+		cerrar()
 	}
+	return err
 }
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"prueba/internal/metrics"
+	"strings"
+	"time"
+)
+
+// Exportadores de métricas de metrics_exporter.
+const (
+	exportadorPrometheus = "prometheus"
+	exportadorStatsD     = "statsd"
+	exportadorDogStatsD  = "dogstatsd"
+)
+
+// Dirección del servidor StatsD (o del agente de Datadog) y cada cuánto se
+// le envían las métricas si no se indican otros.
+const (
+	defaultStatsDAddr     = "127.0.0.1:8125"
+	defaultStatsDInterval = 10 * time.Second
+)
+
+// ExportacionMetricas es la configuración del envío de métricas a un sistema
+// de tipo push (ver exportacionEntorno).
+type ExportacionMetricas struct {
+	StatsD    metrics.StatsDConfig
+	Intervalo time.Duration
+}
+
+// exportacionEntorno lee metrics_exporter: prometheus (por defecto) deja
+// solo GET /metrics; statsd y dogstatsd además envían las métricas por UDP
+// a statsd_addr (por defecto el agente local; con dogstatsd también vale
+// DD_AGENT_HOST y DD_DOGSTATSD_PORT, las variables del agente de Datadog)
+// cada statsd_interval. statsd_prefix se antepone a los nombres y
+// statsd_tags (o DD_TAGS) son tags k:v separados por comas que se añaden a
+// todas las métricas, solo con dogstatsd. Con prometheus devuelve nil.
+func exportacionEntorno() (*ExportacionMetricas, error) {
+	tipo := strings.ToLower(os.Getenv("metrics_exporter"))
+	switch tipo {
+	case "", exportadorPrometheus:
+		return nil, nil
+	case exportadorStatsD, exportadorDogStatsD:
+	default:
+		return nil, fmt.Errorf("invalid metrics_exporter %q: expected %s, %s or %s", tipo, exportadorPrometheus, exportadorStatsD, exportadorDogStatsD)
+	}
+
+	exp := &ExportacionMetricas{
+		StatsD: metrics.StatsDConfig{
+			Addr:      os.Getenv("statsd_addr"),
+			Prefix:    os.Getenv("statsd_prefix"),
+			DogStatsD: tipo == exportadorDogStatsD,
+		},
+		Intervalo: defaultStatsDInterval,
+	}
+	if exp.StatsD.Addr == "" && exp.StatsD.DogStatsD {
+		if host := os.Getenv("DD_AGENT_HOST"); host != "" {
+			puerto := os.Getenv("DD_DOGSTATSD_PORT")
+			if puerto == "" {
+				puerto = "8125"
+			}
+			exp.StatsD.Addr = net.JoinHostPort(host, puerto)
+		}
+	}
+	if exp.StatsD.Addr == "" {
+		exp.StatsD.Addr = defaultStatsDAddr
+	}
+	if _, _, err := net.SplitHostPort(exp.StatsD.Addr); err != nil {
+		return nil, fmt.Errorf("invalid statsd_addr %q: expected host:port", exp.StatsD.Addr)
+	}
+
+	if v := os.Getenv("statsd_interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid statsd_interval %q: expected a positive duration", v)
+		}
+		exp.Intervalo = d
+	}
+
+	// DD_TAGS separa los tags por espacios o por comas
+	tags := lista(strings.Join(strings.Fields(primeraVariable("statsd_tags", "DD_TAGS")), ","))
+	if len(tags) > 0 && !exp.StatsD.DogStatsD {
+		return nil, fmt.Errorf("statsd_tags requires metrics_exporter=%s: plain StatsD has no tags", exportadorDogStatsD)
+	}
+	for _, t := range tags {
+		if strings.ContainsAny(t, "|#") {
+			return nil, fmt.Errorf("invalid statsd_tags entry %q", t)
+		}
+	}
+	exp.StatsD.Tags = tags
+	return exp, nil
+}
+
+// nuevoExportador crea el exportador de metrics_exporter.
+func nuevoExportador(cfg *ExportacionMetricas) (metrics.Exporter, error) {
+	return metrics.NewStatsD(cfg.StatsD)
+}
+
+// iniciarExportacion envía las métricas cada cfg.Intervalo (nil no envía
+// nada). Al apagar, en cierres, se para el envío y se manda lo último que
+// haya cambiado.
+func iniciarExportacion(cfg *ExportacionMetricas) error {
+	if cfg == nil {
+		return nil
+	}
+	exp, err := nuevoExportador(cfg)
+	if err != nil {
+		return err
+	}
+	log := logDe("metrics")
+	exportar := func() {
+		actualizarMetricasRuntime()
+		if err := exp.Export(metrics.Default); err != nil {
+			log.Warn("Error enviando las métricas", errAttr(err))
+		}
+	}
+
+	parar := make(chan struct{})
+	hecho := make(chan struct{})
+	go func() {
+		defer close(hecho)
+		ticker := time.NewTicker(cfg.Intervalo)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-parar:
+				return
+			case <-ticker.C:
+				exportar()
+			}
+		}
+	}()
+	cierres = append(cierres, func() {
+		close(parar)
+		<-hecho
+		exportar()
+		exp.Close()
+	})
+	log.Info("Enviando métricas por StatsD", "addr", cfg.StatsD.Addr, "dogstatsd", cfg.StatsD.DogStatsD, "interval", cfg.Intervalo)
+	return nil
+}
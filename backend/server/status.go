@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"prueba/pkg/repository"
+	"sync"
+	"time"
+)
+
+// Cada cuánto se vuelve a comprobar la API upstream para GET /status: el
+// frontend lo consulta a menudo y no debe traducirse en una petición a la
+// API por cada visita.
+const ttlEstadoUpstream = 30 * time.Second
+
+// Estado global de GET /status.
+const (
+	statusOK       = "ok"
+	statusDegraded = "degraded"
+)
+
+// alcanceUpstream guarda el resultado de la última comprobación de la API
+// upstream.
+type alcanceUpstream struct {
+	mu         sync.Mutex
+	alcanzable bool
+	comprobado time.Time
+}
+
+// comprobar devuelve si la API responde, comprobándolo con ping si el último
+// resultado tiene más de ttlEstadoUpstream.
+func (a *alcanceUpstream) comprobar(ctx context.Context, ping func(context.Context) error) (bool, time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if time.Since(a.comprobado) < ttlEstadoUpstream {
+		return a.alcanzable, a.comprobado
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeoutComprobacion)
+	defer cancel()
+	err := ping(ctx)
+	if err != nil {
+		logDe("status").WarnContext(ctx, "La API upstream no responde", errAttr(err))
+	}
+	a.alcanzable, a.comprobado = err == nil, time.Now().UTC()
+	return a.alcanzable, a.comprobado
+}
+
+// estadoServicio es la respuesta de GET /status.
+type estadoServicio struct {
+	// Status es "degraded" si la última sincronización falló o la API
+	// upstream no responde.
+	Status string `json:"status"`
+	// DataAsOf es cuándo terminó la última sincronización correcta: la
+	// antigüedad de los datos que se sirven.
+	DataAsOf           *time.Time        `json:"data_as_of"`
+	LastSuccessfulSync *resumenRun       `json:"last_successful_sync"`
+	LastSync           *resumenRun       `json:"last_sync"`
+	Items              estadoItems       `json:"items"`
+	Upstream           estadoUpstream    `json:"upstream"`
+	Scheduler          estadoProgramador `json:"scheduler"`
+}
+
+// resumenRun es una ejecución de sync_runs sin los detalles (error,
+// parámetros) que no debe ver cualquier lector.
+type resumenRun struct {
+	ID         int64      `json:"id"`
+	Trigger    string     `json:"trigger"`
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type estadoItems struct {
+	Total      int64      `json:"total"`
+	Tickers    int64      `json:"tickers"`
+	LatestTime *time.Time `json:"latest_time,omitempty"`
+}
+
+type estadoUpstream struct {
+	Reachable bool      `json:"reachable"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// estadoProgramador es el de las sincronizaciones programadas: si
+// POST /sync/scheduled tiene credenciales configuradas, la última que
+// lanzó el scheduler y si hay una sincronización en curso o el
+// mantenimiento las tiene paradas.
+type estadoProgramador struct {
+	Configured  bool        `json:"configured"`
+	LastRun     *resumenRun `json:"last_run"`
+	SyncRunning bool        `json:"sync_running"`
+	Paused      bool        `json:"paused"`
+}
+
+func resumir(run *repository.SyncRun) *resumenRun {
+	if run == nil {
+		return nil
+	}
+	return &resumenRun{ID: run.ID, Trigger: run.Trigger, Status: run.Status, StartedAt: run.StartedAt, FinishedAt: run.FinishedAt}
+}
+
+// ultimaEjecucion es la última ejecución que cumple f, o nil si no hay
+// ninguna.
+func (s *Server) ultimaEjecucion(ctx context.Context, f repository.SyncRunFilter) (*repository.SyncRun, error) {
+	run, err := s.store.SyncRuns.Last(ctx, f)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	return run, err
+}
+
+// getStatus es GET /status: la frescura de los datos del tenant (cuándo se
+// sincronizaron por última vez con éxito y cuántos items hay), si la API
+// upstream responde y el estado de las sincronizaciones programadas. Para
+// que el frontend muestre "datos a fecha de..." y para los paneles de
+// operación. programador indica si el scheduler externo tiene credenciales
+// (ver schedulerAuth).
+func (s *Server) getStatus(programador bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		var e estadoServicio
+
+		exito, err := s.ultimaEjecucion(ctx, repository.SyncRunFilter{Status: repository.RunSuccess})
+		if err != nil {
+			responderError(w, r, msgStatusError, err)
+			return
+		}
+		ultima, err := s.ultimaEjecucion(ctx, repository.SyncRunFilter{})
+		if err != nil {
+			responderError(w, r, msgStatusError, err)
+			return
+		}
+		programada, err := s.ultimaEjecucion(ctx, repository.SyncRunFilter{Trigger: triggerScheduler})
+		if err != nil {
+			responderError(w, r, msgStatusError, err)
+			return
+		}
+		stats, err := s.store.Items.Stats(ctx)
+		if err != nil {
+			responderError(w, r, msgStatusError, err)
+			return
+		}
+
+		e.LastSuccessfulSync, e.LastSync = resumir(exito), resumir(ultima)
+		if exito != nil {
+			e.DataAsOf = exito.FinishedAt
+		}
+		e.Items = estadoItems{Total: stats.Total, Tickers: stats.Tickers, LatestTime: stats.LatestTime}
+		e.Upstream.Reachable, e.Upstream.CheckedAt = s.upstream.comprobar(ctx, func(ctx context.Context) error {
+			return s.engine.Upstream.Ping(ctx, s.cfg.UpstreamURL)
+		})
+
+		syncMu.Lock()
+		_, enCurso := syncActual[repository.TenantFrom(ctx)]
+		syncMu.Unlock()
+		e.Scheduler = estadoProgramador{
+			Configured:  programador,
+			LastRun:     resumir(programada),
+			SyncRunning: enCurso,
+			Paused:      s.enMantenimiento(ctx),
+		}
+
+		e.Status = statusOK
+		if !e.Upstream.Reachable || (ultima != nil && ultima.Status == repository.RunFailed) {
+			e.Status = statusDegraded
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(e)
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"prueba/pkg/repository"
+	"sync"
+)
+
+// syncResult es el resultado de una ejecución de sincronización.
+type syncResult struct {
+	RunID    int64
+	Inserted int64
+	Total    int
+	Err      error
+}
+
+// syncJob es una sincronización en curso a la que pueden unirse otros
+// solicitantes mientras no termine.
+type syncJob struct {
+	done   chan struct{}
+	result syncResult
+}
+
+var (
+	syncMu sync.Mutex
+	// syncActual es la sincronización en curso de cada tenant.
+	syncActual = map[string]*syncJob{}
+
+	// syncBaseCtx es el contexto del que cuelgan todas las sincronizaciones;
+	// se cancela al apagar el servidor para interrumpirlas de forma ordenada.
+	syncBaseCtx, cancelarSyncs = context.WithCancel(context.Background())
+	// syncWG permite esperar a que las sincronizaciones registren su estado
+	// antes de salir del proceso.
+	syncWG sync.WaitGroup
+)
+
+// coordinarSync lanza una sincronización del tenant de ctx o, si ya hay una
+// en curso para ese tenant, espera a que termine y devuelve su resultado
+// (coalesced = true). Así los reintentos rápidos del frontend o de la cola no
+// apilan varios refrescos completos.
+func (s *Server) coordinarSync(ctx context.Context, trigger string, params repository.SyncParams, retryOf *int64) (res syncResult, coalesced bool) {
+	tenant := repository.TenantFrom(ctx)
+	syncMu.Lock()
+	if job := syncActual[tenant]; job != nil {
+		syncMu.Unlock()
+		syncCoalesced.Inc(trigger)
+		select {
+		case <-job.done:
+			return job.result, true
+		case <-ctx.Done():
+			return syncResult{Err: ctx.Err()}, true
+		}
+	}
+	job := &syncJob{done: make(chan struct{})}
+	syncActual[tenant] = job
+	syncWG.Add(1)
+	syncMu.Unlock()
+
+	defer func() {
+		// También si falla: puede haber escrito parte de los items
+		s.cache.invalidar(tenant)
+		syncMu.Lock()
+		delete(syncActual, tenant)
+		syncMu.Unlock()
+		close(job.done)
+		syncWG.Done()
+	}()
+
+	job.result = s.ejecutarSyncRegistrado(ctx, trigger, params, retryOf)
+	return job.result, false
+}
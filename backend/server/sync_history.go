@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"prueba/internal/redact"
+	"prueba/internal/tracing"
+	"prueba/pkg/repository"
+	"prueba/pkg/syncengine"
+	"strconv"
+	"time"
+)
+
+// Origen de cada ejecución registrada en sync_runs.
+const (
+	triggerManual    = "manual"
+	triggerScheduler = "scheduler"
+	triggerRetry     = "retry"
+	triggerRequeue   = "requeue"
+)
+
+// Número de ejecuciones que devuelve GET /sync/history.
+const historyLimit = 50
+
+// paramsPorDefecto son los parámetros de las sincronizaciones que no indican
+// otros: la API upstream configurada.
+func (s *Server) paramsPorDefecto() repository.SyncParams {
+	return repository.SyncParams{Source: s.cfg.UpstreamURL}
+}
+
+// ejecutarSyncRegistrado ejecuta la sincronización dejando constancia en
+// sync_runs de quién la lanzó, con qué parámetros y cómo terminó. Si no se
+// puede registrar la ejecución, la sincronización se hace igualmente.
+func (s *Server) ejecutarSyncRegistrado(ctx context.Context, trigger string, params repository.SyncParams, retryOf *int64) syncResult {
+	// El registro debe poder completarse aunque se cancele la sincronización
+	recordCtx := context.WithoutCancel(ctx)
+
+	runID, err := s.store.SyncRuns.Start(recordCtx, trigger, params, retryOf)
+	if err != nil {
+		s.logSync.ErrorContext(ctx, "No se pudo registrar la ejecución de sincronización", errAttr(err))
+	}
+	// Los logs de la sincronización llevan el id de la ejecución
+	ctx = conLog(ctx, "run_id", runID, "trigger", trigger)
+	recordCtx = context.WithoutCancel(ctx)
+
+	// Las llamadas al upstream y las consultas de la sincronización cuelgan
+	// de este span
+	ctx, span := tracing.Start(ctx, "sync", tracing.KindInternal)
+	span.SetAttr("sync.trigger", trigger)
+	span.SetAttr("sync.run_id", runID)
+	start := time.Now()
+	resSync, syncErr := s.ejecutarSync(ctx, params, runID)
+	insertedCount, total := resSync.Inserted, resSync.Fetched
+	span.SetAttr("sync.fetched", total)
+	span.SetAttr("sync.inserted", insertedCount)
+	span.SetError(syncErr)
+	span.End()
+
+	res := resultadoRun(total, insertedCount, syncErr)
+	// Para ver en el historial qué etapa se alarga al crecer los datos
+	res.Stages = resSync.Stages
+	syncRuns.Inc(trigger, res.Status)
+	syncDuration.ObserveSince(start, trigger, res.Status)
+
+	if runID != 0 {
+		if err := s.store.SyncRuns.Finish(recordCtx, runID, res); err != nil {
+			s.logSync.ErrorContext(recordCtx, "No se pudo actualizar la ejecución", errAttr(err))
+		}
+	}
+	if res.Status == repository.RunFailed {
+		reportarSyncFallida(recordCtx, trigger, runID, syncErr)
+	}
+	alertasErrores.sincronizacion(res.Status == repository.RunFailed)
+	s.actualizarMetricasItems(recordCtx, repository.TenantFrom(ctx))
+	s.webhooks.enviar(eventoSyncCompletada, webhookSync{
+		RunID:    runID,
+		Tenant:   repository.TenantFrom(ctx),
+		Trigger:  trigger,
+		Status:   res.Status,
+		Inserted: insertedCount,
+		Total:    total,
+		Error:    res.Error,
+		Duration: time.Since(start).Seconds(),
+	})
+	return syncResult{RunID: runID, Inserted: insertedCount, Total: total, Err: syncErr}
+}
+
+// resultadoRun traduce el resultado de una sincronización a lo que se guarda
+// en el historial.
+func resultadoRun(fetched int, inserted int64, syncErr error) repository.SyncRunResult {
+	res := repository.SyncRunResult{
+		Status:        repository.RunSuccess,
+		ItemsFetched:  fetched,
+		ItemsInserted: inserted,
+	}
+	if syncErr == nil {
+		return res
+	}
+
+	// Se devuelve en GET /sync/history y en los webhooks
+	msg := redact.String(syncErr.Error())
+	res.Error = &msg
+	res.Status = repository.RunFailed
+
+	if cp, ok := syncengine.IsInterrupted(syncErr); ok {
+		res.Status = repository.RunInterrupted
+		res.Checkpoint = &cp
+	}
+	return res
+}
+
+// listarSyncRuns devuelve las últimas ejecuciones de sincronización.
+func (s *Server) listarSyncRuns() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc, err := zonaPeticion(r)
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgInvalidParam, err)
+			return
+		}
+		list, err := s.store.SyncRuns.List(r.Context(), historyLimit)
+		if err != nil {
+			responderError(w, r, msgHistoryError, err)
+			return
+		}
+		for i := range list {
+			fechaEnZona(&list[i].StartedAt, loc)
+			fechaEnZona(list[i].FinishedAt, loc)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Runs []repository.SyncRun `json:"runs"`
+		}{Runs: list})
+	}
+}
+
+// reintentarSyncRun vuelve a lanzar una ejecución fallida con sus mismos
+// parámetros (POST /sync/history/{id}/retry).
+func (s *Server) reintentarSyncRun() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgRunIDInvalid)
+			return
+		}
+
+		run, err := s.store.SyncRuns.Get(r.Context(), id)
+		if err != nil {
+			clave := msgRunError
+			if errors.Is(err, repository.ErrNotFound) {
+				clave = msgRunNotFound
+			}
+			responderError(w, r, clave, err)
+			return
+		}
+		if run.Status != repository.RunFailed && run.Status != repository.RunInterrupted {
+			errorHTTP(w, r, http.StatusConflict, msgRunNotRetryable, run.Status)
+			return
+		}
+
+		s.logSync.InfoContext(r.Context(), "Reintentando ejecución de sincronización", "retry_of", id)
+		sinDeadline(w)
+		ctx := conLog(repository.WithTenant(syncBaseCtx, repository.TenantFrom(r.Context())), "request_id", RequestIDFrom(r.Context()))
+		ctx = tracing.ContextWithSpan(ctx, tracing.FromContext(r.Context()))
+		res, coalesced := s.coordinarSync(ctx, triggerRequeue, run.Params, &run.ID)
+		if res.Err != nil {
+			s.logSync.ErrorContext(r.Context(), "Error reintentando ejecución", "retry_of", id, "run_id", res.RunID, errAttr(res.Err))
+			responderError(w, r, msgSyncError, res.Err)
+			return
+		}
+
+		s.logSync.InfoContext(r.Context(), "Reintento de ejecución completado", "retry_of", id, "run_id", res.RunID, "inserted", res.Inserted, "total", res.Total)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			Message     string `json:"message"`
+			ItemsSynced int64  `json:"items_synced"`
+			RunID       int64  `json:"run_id"`
+			RetryOf     int64  `json:"retry_of"`
+			Coalesced   bool   `json:"coalesced"`
+		}{mensaje(r, msgSyncCompleted), res.Inserted, res.RunID, id, coalesced})
+	}
+}
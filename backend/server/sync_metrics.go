@@ -0,0 +1,29 @@
+package server
+
+import "prueba/internal/metrics"
+
+// Métricas del pipeline de sincronización.
+var (
+	syncPagesFetched = metrics.NewCounter("sync_pages_fetched_total",
+		"Páginas obtenidas de la API upstream.")
+	syncPageDuration = metrics.NewHistogram("sync_page_fetch_duration_seconds",
+		"Latencia de cada petición de página a la API upstream.", nil)
+	syncItemsFetched = metrics.NewCounter("sync_items_fetched_total",
+		"Items recibidos de la API upstream.")
+	syncItemsUpserted = metrics.NewCounter("sync_items_upserted_total",
+		"Items escritos en la base de datos.")
+	syncItemsRejected = metrics.NewCounter("sync_items_rejected_total",
+		"Items recibidos que no llegaron a escribirse.")
+	syncItemsExpired = metrics.NewCounter("sync_items_expired_total",
+		"Items recibidos descartados por ser más antiguos que items_retention.")
+	syncItemsPurged = metrics.NewCounter("sync_items_purged_total",
+		"Filas de items y de su histórico borradas por ser más antiguas que items_retention.")
+	syncStageDuration = metrics.NewHistogram("sync_stage_duration_seconds",
+		"Duración de cada etapa de la sincronización.", nil, "stage")
+	syncRuns = metrics.NewCounter("sync_runs_total",
+		"Ejecuciones de sincronización por origen y resultado.", "trigger", "status")
+	syncDuration = metrics.NewHistogram("sync_duration_seconds",
+		"Duración total de cada sincronización.", nil, "trigger", "status")
+	syncCoalesced = metrics.NewCounter("sync_coalesced_total",
+		"Solicitudes de sincronización unidas a una ya en curso.", "trigger")
+)
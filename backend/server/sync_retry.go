@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"prueba/internal/redact"
+	"prueba/pkg/repository"
+	"prueba/pkg/syncengine"
+	"strconv"
+	"time"
+)
+
+// Valores por defecto de la cola de reintentos, sobreescribibles por entorno.
+const (
+	defaultRetryMaxAttempts = 5
+	defaultRetryBackoff     = time.Minute
+	defaultRetryMaxBackoff  = 30 * time.Minute
+	defaultRetryPoll        = 30 * time.Second
+
+	// retryStaleAfter es el tiempo tras el cual un reintento "running" se
+	// considera abandonado (p. ej. el proceso murió a mitad de la sincronización).
+	retryStaleAfter = time.Hour
+)
+
+// retryConfig agrupa la configuración de la cola de reintentos.
+type retryConfig struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	poll        time.Duration
+}
+
+func cargarRetryConfig() retryConfig {
+	return retryConfig{
+		maxAttempts: envInt("sync_retry_max", defaultRetryMaxAttempts),
+		backoff:     envDuration("sync_retry_backoff", defaultRetryBackoff),
+		maxBackoff:  envDuration("sync_retry_max_backoff", defaultRetryMaxBackoff),
+		poll:        envDuration("sync_retry_poll", defaultRetryPoll),
+	}
+}
+
+// siguienteEspera calcula el backoff exponencial para el intento indicado
+// (1, 2, 4, ... veces el backoff base), acotado por maxBackoff.
+func (c retryConfig) siguienteEspera(attempt int) time.Duration {
+	wait := c.backoff
+	for i := 1; i < attempt; i++ {
+		wait *= 2
+		if wait >= c.maxBackoff {
+			return c.maxBackoff
+		}
+	}
+	return wait
+}
+
+// encolarReintento registra un reintento pendiente tras una sincronización
+// fallida. Si ya hay uno pendiente o en curso no se encola otro. El error se
+// guarda en sync_retries.last_error sin secretos (ver redact).
+func encolarReintento(ctx context.Context, retries repository.RetryRepository, cause error) error {
+	cfg := cargarRetryConfig()
+
+	wait := cfg.siguienteEspera(1)
+	encolado, err := retries.Enqueue(ctx, cfg.maxAttempts, time.Now().Add(wait), redact.String(cause.Error()), time.Now().Add(-retryStaleAfter))
+	if err != nil {
+		return err
+	}
+	if encolado {
+		logDe("sync").InfoContext(ctx, "Reintento de sincronización encolado", "wait", wait)
+	}
+	return nil
+}
+
+// iniciarWorkerReintentos lanza la goroutine que procesa la cola de reintentos
+// hasta que se cancele el contexto. La configuración se vuelve a leer en cada
+// vuelta, de modo que sync_retry_* se pueden cambiar con Reload.
+func (s *Server) iniciarWorkerReintentos(ctx context.Context) {
+	cfg := cargarRetryConfig()
+
+	go func() {
+		ticker := time.NewTicker(cfg.poll)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sinTrabajosNuevos:
+				return
+			case <-ticker.C:
+				if err := s.procesarReintento(ctx, cfg); err != nil {
+					s.logSync.Error("Error procesando cola de reintentos", errAttr(err))
+				}
+				nueva := cargarRetryConfig()
+				if nueva.poll != cfg.poll {
+					ticker.Reset(nueva.poll)
+				}
+				cfg = nueva
+			}
+		}
+	}()
+}
+
+// procesarReintento toma el siguiente reintento vencido (si hay) y ejecuta la
+// sincronización, reprogramándolo con backoff o marcándolo como fallido al
+// agotar los intentos.
+func (s *Server) procesarReintento(ctx context.Context, cfg retryConfig) error {
+	// En mantenimiento la cola espera, como las sincronizaciones de la API
+	if s.enMantenimiento(ctx) {
+		return nil
+	}
+	rt, err := s.store.Retries.Claim(ctx, time.Now().Add(-retryStaleAfter))
+	if err != nil || rt == nil {
+		return err
+	}
+
+	ctx = conLog(repository.WithTenant(ctx, rt.Tenant), "tenant", rt.Tenant, "retry_id", rt.ID)
+	s.logSync.InfoContext(ctx, "Reintento de sincronización", "attempt", rt.Attempt, "max_attempts", rt.MaxAttempts)
+	res, _ := s.coordinarSync(ctx, triggerRetry, s.paramsPorDefecto(), nil)
+	syncErr := res.Err
+
+	// La actualización del reintento debe hacerse aunque nos estén apagando
+	ctx = context.WithoutCancel(ctx)
+	_, interrumpido := syncengine.IsInterrupted(syncErr)
+
+	switch {
+	case interrumpido:
+		// No cuenta como intento: se deja pendiente para el próximo arranque
+		s.logSync.WarnContext(ctx, "Reintento interrumpido, queda pendiente")
+		return s.store.Retries.Release(ctx, rt.ID)
+	case syncErr == nil:
+		s.logSync.InfoContext(ctx, "Reintento completado", "inserted", res.Inserted, "total", res.Total)
+		return s.store.Retries.Complete(ctx, rt.ID)
+	case rt.Attempt >= rt.MaxAttempts:
+		s.logSync.ErrorContext(ctx, "Reintento agotado", "attempt", rt.Attempt, errAttr(syncErr))
+		return s.store.Retries.Fail(ctx, rt.ID, redact.String(syncErr.Error()))
+	default:
+		wait := cfg.siguienteEspera(rt.Attempt + 1)
+		s.logSync.WarnContext(ctx, "Reintento fallido, se reprograma", "wait", wait, errAttr(syncErr))
+		return s.store.Retries.Reschedule(ctx, rt.ID, redact.String(syncErr.Error()), time.Now().Add(wait))
+	}
+}
+
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		slog.Warn("Valor inválido, se usa el valor por defecto", "key", key, "value", v, "default", def)
+		return def
+	}
+	return n
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		slog.Warn("Valor inválido, se usa el valor por defecto", "key", key, "value", v, "default", def)
+		return def
+	}
+	return d
+}
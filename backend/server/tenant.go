@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"prueba/pkg/repository"
+)
+
+// tenantHeader es la cabecera con la que el cliente indica su organización.
+// Sin ella las peticiones van al tenant de su identidad (ver
+// tenantMiddleware).
+const tenantHeader = "X-Tenant-ID"
+
+// Modos de tenant_isolation.
+const (
+	// aislamientoWhere filtra por tenant en cada consulta (por defecto).
+	aislamientoWhere = "where"
+	// aislamientoRLS además deja que la base de datos lo imponga con
+	// row-level security (solo CockroachDB/PostgreSQL).
+	aislamientoRLS = "rls"
+)
+
+// aislamientoTenants lee tenant_isolation y valida su valor.
+func aislamientoTenants() (string, error) {
+	switch v := os.Getenv("tenant_isolation"); v {
+	case "", aislamientoWhere:
+		return aislamientoWhere, nil
+	case aislamientoRLS:
+		return v, nil
+	default:
+		return "", fmt.Errorf("invalid tenant_isolation %q (valid: %s, %s)", v, aislamientoWhere, aislamientoRLS)
+	}
+}
+
+// tenantMiddleware pone en el contexto de la petición el tenant al que
+// quedan limitadas todas las consultas y sincronizaciones que lance. Va
+// después de autenticar: el tenant es el de la identidad (ver
+// identidad.Tenant) y X-Tenant-ID solo puede repetirlo, o la petición se
+// rechaza con 403, también para los admin de un tenant. Eligen el tenant con
+// la cabecera los administradores de la plataforma (identidad.Plataforma) y
+// el scheduler, que sincroniza cualquiera de ellos; con api_key_auth=off,
+// sin identidades a las que ligarlo, cualquiera. Las peticiones anónimas van
+// al tenant por defecto.
+func (s *Server) tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pedido := r.Header.Get(tenantHeader)
+		if pedido != "" && repository.ValidateTenant(pedido) != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgInvalidTenant, tenantHeader)
+			return
+		}
+		tenant := repository.TenantPorDefecto
+		id := identidadDe(r.Context())
+		if id != nil {
+			tenant = id.Tenant
+		}
+		if pedido != "" && pedido != tenant {
+			switch {
+			case id != nil && id.Plataforma, id == nil && (s.cfg.AuthMode == authOff || s.programador.autorizado(r)):
+				tenant = pedido
+			case id == nil:
+				errorHTTP(w, r, http.StatusUnauthorized, msgUnauthorized)
+				return
+			default:
+				logDe("auth").WarnContext(r.Context(), "Acceso denegado a otro tenant", "tenant", id.Tenant, "requested_tenant", pedido)
+				s.auditoria.registrar(r, repository.AuditEvent{Action: repository.AuditTenantDenied, Status: http.StatusForbidden, Detail: "requested tenant " + pedido})
+				errorHTTP(w, r, http.StatusForbidden, msgTenantForbidden, pedido)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(repository.WithTenant(r.Context(), tenant)))
+	})
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"prueba/pkg/repository"
+	"testing"
+)
+
+func TestTenantMiddleware(t *testing.T) {
+	const secreto = "secreto-del-scheduler"
+	viewerAcme := &identidad{Sujeto: "ana", Roles: []string{rolViewer}, Tenant: "acme"}
+	adminAcme := &identidad{Sujeto: "root", Roles: []string{rolAdmin}, Tenant: "acme"}
+	plataforma := &identidad{Sujeto: "ops", Roles: []string{rolAdmin}, Tenant: repository.TenantPorDefecto, Plataforma: true}
+
+	tests := []struct {
+		name       string
+		modo       string
+		id         *identidad
+		pedido     string
+		scheduler  bool
+		wantStatus int
+		wantTenant string
+	}{
+		{"anónimo sin cabecera", authSync, nil, "", false, http.StatusOK, repository.TenantPorDefecto},
+		{"identidad sin cabecera", authSync, viewerAcme, "", false, http.StatusOK, "acme"},
+		{"identidad que repite su tenant", authSync, viewerAcme, "acme", false, http.StatusOK, "acme"},
+		{"identidad que pide otro tenant", authSync, viewerAcme, "globex", false, http.StatusForbidden, ""},
+		{"admin de acme que pide otro tenant", authSync, adminAcme, "globex", false, http.StatusForbidden, ""},
+		{"admin de acme que pide el tenant por defecto", authSync, adminAcme, repository.TenantPorDefecto, false, http.StatusForbidden, ""},
+		{"admin de acme sin cabecera", authSync, adminAcme, "", false, http.StatusOK, "acme"},
+		{"admin de la plataforma que pide otro tenant", authSync, plataforma, "globex", false, http.StatusOK, "globex"},
+		{"admin de la plataforma sin cabecera", authSync, plataforma, "", false, http.StatusOK, repository.TenantPorDefecto},
+		{"anónimo que pide otro tenant", authSync, nil, "globex", false, http.StatusUnauthorized, ""},
+		{"scheduler que pide otro tenant", authSync, nil, "globex", true, http.StatusOK, "globex"},
+		{"sin autenticación cualquiera elige", authOff, nil, "globex", false, http.StatusOK, "globex"},
+		{"tenant no válido", authOff, nil, "../otro", false, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{
+				cfg:         Config{AuthMode: tt.modo},
+				programador: &schedulerAuth{secret: secreto},
+			}
+			var tenant string
+			h := s.tenantMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tenant = repository.TenantFrom(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/items", nil)
+			if tt.id != nil {
+				r = r.WithContext(context.WithValue(r.Context(), claveIdentidad{}, tt.id))
+			}
+			if tt.pedido != "" {
+				r.Header.Set(tenantHeader, tt.pedido)
+			}
+			if tt.scheduler {
+				r.Header.Set(schedulerSecretHeader, secreto)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tenant != tt.wantTenant {
+				t.Errorf("tenant = %q, want %q", tenant, tt.wantTenant)
+			}
+		})
+	}
+}
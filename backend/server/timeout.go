@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tiempo máximo por defecto de cada tipo de ruta (ver presupuestosTiempo).
+const (
+	defaultReadBudget   = 10 * time.Second
+	defaultExportBudget = time.Minute
+	defaultSyncBudget   = 10 * time.Minute
+)
+
+// presupuestos son los tiempos máximos de respuesta de cada tipo de ruta.
+type presupuestos struct {
+	// lectura es el de las consultas y ediciones puntuales
+	lectura time.Duration
+	// exportacion es el de las que devuelven la tabla entera (GET /item)
+	exportacion time.Duration
+	// sincronizacion es el de las que esperan a una sincronización
+	sincronizacion time.Duration
+}
+
+// presupuestosTiempo lee http_read_budget, http_export_budget y
+// http_sync_budget.
+func presupuestosTiempo() presupuestos {
+	return presupuestos{
+		lectura:        envDuration("http_read_budget", defaultReadBudget),
+		exportacion:    envDuration("http_export_budget", defaultExportBudget),
+		sincronizacion: envDuration("http_sync_budget", defaultSyncBudget),
+	}
+}
+
+// limiteTiempo es como http.TimeoutHandler pero responde con el error JSON
+// de la API (504, "timeout"): si el handler no termina en d, se cancela su
+// contexto y se responde al cliente sin esperarlo. Lo que el handler escriba
+// después se descarta. La respuesta se guarda en memoria hasta que termina,
+// así que no sirve para respuestas en streaming (eventos SSE).
+//
+// Una sincronización que supera el plazo sigue en segundo plano: solo se deja
+// de esperar por ella.
+func limiteTiempo(d time.Duration) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			rw := &respuestaDiferida{w: w, h: make(http.Header)}
+			hecho := make(chan struct{})
+			var panico any
+			go func() {
+				defer func() {
+					if v := recover(); v != nil {
+						if v != http.ErrAbortHandler {
+							v = fmt.Sprintf("%v\n\n%s", v, strings.TrimSpace(string(debug.Stack())))
+						}
+						panico = v
+					}
+					close(hecho)
+				}()
+				next.ServeHTTP(rw, r.WithContext(ctx))
+			}()
+
+			select {
+			case <-hecho:
+				if panico != nil {
+					// Lo trata recuperarMiddleware en la goroutine de la petición
+					panic(panico)
+				}
+				rw.volcar()
+			case <-ctx.Done():
+				rw.mu.Lock()
+				defer rw.mu.Unlock()
+				rw.vencida = true
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					logDe("http").WarnContext(r.Context(), "Petición cortada por tiempo", "budget", d)
+					errorJSON(w, r, http.StatusGatewayTimeout, "timeout", msgTimeout)
+				}
+			}
+		})
+	}
+}
+
+// respuestaDiferida guarda la respuesta de un handler con plazo hasta que
+// termina. Unwrap da acceso a la conexión a http.ResponseController (lo usa
+// sinDeadline).
+type respuestaDiferida struct {
+	w http.ResponseWriter
+
+	mu      sync.Mutex
+	h       http.Header
+	buf     bytes.Buffer
+	status  int
+	vencida bool
+}
+
+func (rw *respuestaDiferida) Header() http.Header {
+	return rw.h
+}
+
+func (rw *respuestaDiferida) WriteHeader(status int) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.status == 0 && !rw.vencida {
+		rw.status = status
+	}
+}
+
+func (rw *respuestaDiferida) Write(b []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.vencida {
+		return 0, http.ErrHandlerTimeout
+	}
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	return rw.buf.Write(b)
+}
+
+func (rw *respuestaDiferida) Unwrap() http.ResponseWriter {
+	return rw.w
+}
+
+// volcar escribe en la conexión la respuesta guardada.
+func (rw *respuestaDiferida) volcar() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	dst := rw.w.Header()
+	for k, v := range rw.h {
+		dst[k] = v
+	}
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.w.WriteHeader(rw.status)
+	rw.w.Write(rw.buf.Bytes())
+}
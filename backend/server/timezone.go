@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"prueba/pkg/repository"
+	"time"
+
+	// Base de datos de zonas horarias incluida en el binario, para ?tz= en
+	// imágenes sin /usr/share/zoneinfo
+	_ "time/tzdata"
+)
+
+// zonaPeticion lee ?tz=, la zona horaria IANA (p. ej. Europe/Madrid) en la
+// que se devuelven las fechas de la respuesta. Sin ella van en UTC. En
+// cualquier caso son RFC 3339 con el desfase de la zona, así que representan
+// el mismo instante; ?tz= solo cambia cómo se muestran. Los días de
+// /item/daily son siempre días UTC.
+func zonaPeticion(r *http.Request) (*time.Location, error) {
+	v := r.URL.Query().Get("tz")
+	if v == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(v)
+	if err != nil || v == "Local" {
+		return nil, fmt.Errorf("invalid tz %q: expected an IANA time zone (e.g. Europe/Madrid)", v)
+	}
+	return loc, nil
+}
+
+// itemsEnZona pasa las fechas de items a loc.
+func itemsEnZona(items []repository.Item, loc *time.Location) {
+	for i := range items {
+		items[i].Time = items[i].Time.In(loc)
+	}
+}
+
+// fechaEnZona pasa t a loc; t puede ser nil.
+func fechaEnZona(t *time.Time, loc *time.Location) {
+	if t != nil {
+		*t = t.In(loc)
+	}
+}
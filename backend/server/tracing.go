@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"prueba/internal/redact"
+	"prueba/internal/tracing"
+	"prueba/internal/version"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Nombre del servicio en las trazas si no se indica otro.
+const servicioTrazas = "prueba-backend"
+
+// Tiempo máximo para enviar las trazas pendientes al apagar.
+const timeoutCierreTrazas = 5 * time.Second
+
+// trazasEntorno lee la configuración de las trazas de OpenTelemetry. Se
+// activan con otel_exporter_otlp_endpoint (la URL base del colector, a la
+// que se añade /v1/traces) u otel_exporter_otlp_traces_endpoint (la URL
+// completa); también valen las variables estándar de OpenTelemetry en
+// mayúsculas. otel_exporter_otlp_headers son cabeceras k=v separadas por
+// comas (autenticación del colector), otel_service_name el nombre del
+// servicio y otel_traces_sampler_arg la fracción de trazas que se guardan
+// (de 0 a 1, por defecto todas). Sin endpoint devuelve nil.
+func trazasEntorno() (*tracing.Config, error) {
+	endpoint := primeraVariable("otel_exporter_otlp_traces_endpoint", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := primeraVariable("otel_exporter_otlp_endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("invalid otel_exporter_otlp_endpoint %q: expected an http(s) URL", endpoint)
+	}
+	cfg := &tracing.Config{
+		Endpoint: endpoint,
+		Headers:  map[string]string{},
+		Service:  primeraVariable("otel_service_name", "OTEL_SERVICE_NAME"),
+		Version:  version.Get().Version,
+		Ratio:    1,
+	}
+	if cfg.Service == "" {
+		cfg.Service = servicioTrazas
+	}
+	for _, h := range lista(primeraVariable("otel_exporter_otlp_headers", "OTEL_EXPORTER_OTLP_HEADERS")) {
+		k, v, ok := strings.Cut(h, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid otel_exporter_otlp_headers entry %q: expected key=value", h)
+		}
+		cfg.Headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		redact.Register(strings.TrimSpace(v))
+	}
+	if v := primeraVariable("otel_traces_sampler_arg", "OTEL_TRACES_SAMPLER_ARG"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r < 0 || r > 1 {
+			return nil, fmt.Errorf("invalid otel_traces_sampler_arg %q: expected a number between 0 and 1", v)
+		}
+		cfg.Ratio = r
+	}
+	return cfg, nil
+}
+
+// iniciarTrazas activa las trazas con cfg (nil las deja desactivadas). Las
+// pendientes se envían al apagar, en cierres.
+func iniciarTrazas(cfg *tracing.Config) {
+	if cfg == nil {
+		return
+	}
+	c := *cfg
+	c.Logger = logDe("tracing")
+	tracing.Default = tracing.New(c)
+	cierres = append(cierres, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutCierreTrazas)
+		defer cancel()
+		if err := tracing.Default.Shutdown(ctx); err != nil {
+			logDe("tracing").Warn("No se enviaron todas las trazas al apagar", errAttr(err))
+		}
+	})
+	logDe("tracing").Info("Trazas de OpenTelemetry activadas", "endpoint", c.Endpoint, "service", c.Service, "ratio", c.Ratio)
+}
+
+// clienteUpstream es el cliente HTTP de las llamadas a la API upstream: con
+// las trazas activas cada llamada es un span y lleva el traceparent.
+func clienteUpstream() *http.Client {
+	if tracing.Default == nil {
+		return &http.Client{}
+	}
+	return &http.Client{Transport: tracing.Transport(nil)}
+}
+
+// trazasHTTPMiddleware crea el span de servidor de cada petición, hijo del
+// traceparent que traiga si viene de otro servicio traceado. Se llama como
+// la ruta del mux (ver anotarRuta), y el trace_id va en los logs de la
+// petición y en la cabecera traceresponse. Sin trazas no hace nada.
+func trazasHTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tracing.Default == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if sc, ok := tracing.Extract(r.Header); ok {
+			ctx = tracing.WithRemote(ctx, sc)
+		}
+		ctx, span := tracing.Start(ctx, r.Method, tracing.KindServer)
+		if span == nil {
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		defer span.End()
+		ctx = conLog(ctx, "trace_id", span.TraceID())
+		w.Header().Set("traceresponse", "00-"+span.TraceID()+"-"+span.SpanID()+"-01")
+
+		rw := &respuestaRegistrada{ResponseWriter: w}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		status := rw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ruta := rutaSinPatron
+		if p, ok := r.Context().Value(claveRuta{}).(*string); ok && *p != "" {
+			ruta = *p
+		}
+		span.SetName(ruta)
+		span.SetAttr("http.route", ruta)
+		span.SetAttr("http.request.method", r.Method)
+		span.SetAttr("http.response.status_code", status)
+		span.SetAttr("url.path", r.URL.Path)
+		if status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("HTTP %d", status))
+		}
+	})
+}
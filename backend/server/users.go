@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"os"
+	"prueba/pkg/repository"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Los tokens de sesión son sessionTokenPrefix seguido de 32 bytes aleatorios
+// en base64url; el prefijo los distingue de los JWT en Authorization: Bearer.
+const sessionTokenPrefix = "ses_"
+
+// Duración por defecto de las sesiones (session_ttl).
+const defaultSessionTTL = 24 * time.Hour
+
+// Longitud de las contraseñas, en caracteres la mínima y en bytes la máxima
+// (bcrypt ignora lo que pasa de 72 bytes).
+const (
+	minPassword = 10
+	maxPassword = 72
+)
+
+// Rol de los usuarios que se registran.
+const defaultUserRole = rolViewer
+
+// Usuarios es la configuración de las cuentas de usuario.
+type Usuarios struct {
+	// Registro permite crear cuentas con POST /auth/register
+	// (user_registration). Por defecto solo en el perfil development: en el
+	// resto cualquiera podría crearse una cuenta con rol viewer.
+	Registro bool
+	// TTL es lo que dura una sesión desde el inicio de sesión (session_ttl).
+	TTL time.Duration
+}
+
+// usuariosEntorno lee user_registration y session_ttl.
+func usuariosEntorno(perfil string) (Usuarios, error) {
+	u := Usuarios{Registro: perfil == ProfileDevelopment, TTL: envDuration("session_ttl", defaultSessionTTL)}
+	if v := os.Getenv("user_registration"); v != "" {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			return u, fmt.Errorf("invalid user_registration %q", v)
+		}
+		u.Registro = on
+	}
+	return u, nil
+}
+
+// hashFalso es un hash bcrypt con el que se compara la contraseña cuando el
+// usuario no existe, para que el inicio de sesión tarde lo mismo y no revele
+// qué emails tienen cuenta.
+var hashFalso = sync.OnceValue(func() []byte {
+	h, _ := bcrypt.GenerateFromPassword([]byte("contraseña que no se usa"), bcrypt.DefaultCost)
+	return h
+})
+
+// normalizarEmail valida email y lo devuelve en minúsculas y sin espacios.
+func normalizarEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	a, err := mail.ParseAddress(email)
+	if err != nil || a.Address != email || a.Name != "" {
+		return "", fmt.Errorf("invalid email %q", email)
+	}
+	return email, nil
+}
+
+func validarPassword(p string) error {
+	if utf8.RuneCountInString(p) < minPassword {
+		return fmt.Errorf("password must have at least %d characters", minPassword)
+	}
+	if len(p) > maxPassword {
+		return fmt.Errorf("password must have at most %d bytes", maxPassword)
+	}
+	return nil
+}
+
+// registrarUsuario es POST /auth/register con {"email", "password", "name"}:
+// crea una cuenta con el rol viewer en el tenant por defecto (el cliente no
+// elige a qué datos tiene acceso: otro rol o tenant se asigna en la tabla
+// users). Con user_registration=false responde 403.
+func (s *Server) registrarUsuario() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.cfg.Users.Registro {
+			errorHTTP(w, r, http.StatusForbidden, msgRegistrationClosed)
+			return
+		}
+		var body struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+			Name     string `json:"name"`
+		}
+		if !decodificarJSON(w, r, &body) {
+			return
+		}
+		email, err := normalizarEmail(body.Email)
+		if err == nil {
+			err = validarPassword(body.Password)
+		}
+		if err != nil {
+			errorHTTP(w, r, http.StatusBadRequest, msgUserInvalid, err)
+			return
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+		if err != nil {
+			responderError(w, r, msgUserError, err)
+			return
+		}
+
+		u, err := s.store.Users.Create(r.Context(), repository.User{
+			Email:        email,
+			Name:         strings.TrimSpace(body.Name),
+			Role:         defaultUserRole,
+			Tenant:       repository.TenantPorDefecto,
+			PasswordHash: string(hash),
+		})
+		if errors.Is(err, repository.ErrConflict) {
+			errorHTTP(w, r, http.StatusConflict, msgUserExists)
+			return
+		}
+		if err != nil {
+			responderError(w, r, msgUserError, err)
+			return
+		}
+		s.log.InfoContext(r.Context(), "Usuario registrado", "user_id", u.ID)
+		s.auditoria.registrar(r, repository.AuditEvent{Action: repository.AuditUserCreated, Actor: u.Email, Status: http.StatusCreated})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(u)
+	}
+}
+
+// iniciarSesion es POST /auth/login con {"email", "password"}: abre una
+// sesión y devuelve su token, que se manda después como Authorization:
+// Bearer. El token solo se devuelve aquí; se guarda su hash.
+func (s *Server) iniciarSesion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		if !decodificarJSON(w, r, &body) {
+			return
+		}
+		email := strings.ToLower(strings.TrimSpace(body.Email))
+		if s.rechazarBloqueada(w, r, metodoPassword, email) {
+			return
+		}
+
+		u, err := s.store.Users.FindByEmail(r.Context(), email)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			responderError(w, r, msgUserError, err)
+			return
+		}
+		hash := hashFalso()
+		if u != nil {
+			hash = []byte(u.PasswordHash)
+		}
+		if bcrypt.CompareHashAndPassword(hash, []byte(body.Password)) != nil || u == nil {
+			logDe("auth").WarnContext(r.Context(), "Inicio de sesión fallido", "email", email)
+			s.anotarFallo(r, metodoPassword, email)
+			s.auditoria.registrar(r, repository.AuditEvent{Action: repository.AuditAuthFailure, Actor: email, AuthMethod: metodoPassword, Status: http.StatusUnauthorized})
+			errorHTTP(w, r, http.StatusUnauthorized, msgLoginFailed)
+			return
+		}
+
+		s.bloqueos.exito(metodoPassword, email)
+
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			responderError(w, r, msgUserError, err)
+			return
+		}
+		token := sessionTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+		expira := time.Now().Add(s.cfg.Users.TTL).UTC()
+		if err := s.store.Sessions.Create(r.Context(), repository.HashAPIKey(token), u.ID, expira); err != nil {
+			responderError(w, r, msgUserError, err)
+			return
+		}
+		if err := s.store.Users.RecordLogin(r.Context(), u.ID); err != nil {
+			s.log.WarnContext(r.Context(), "No se pudo guardar el último inicio de sesión", "user_id", u.ID, errAttr(err))
+		}
+		s.auditoria.registrar(r, repository.AuditEvent{Action: repository.AuditLogin, Actor: u.Email, AuthMethod: metodoPassword, Status: http.StatusOK})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]any{
+			"token":      token,
+			"expires_at": expira,
+			"user":       u,
+		})
+	}
+}
+
+// cerrarSesion es POST /auth/logout: revoca la sesión con la que se hace la
+// petición.
+func (s *Server) cerrarSesion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if id := identidadDe(r.Context()); id == nil || id.Metodo != metodoSession {
+			errorHTTP(w, r, http.StatusBadRequest, msgNotASession)
+			return
+		}
+		if err := s.store.Sessions.Revoke(r.Context(), repository.HashAPIKey(token)); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			responderError(w, r, msgUserError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// identificarSesion devuelve la identidad del usuario de la sesión del
+// token, o repository.ErrNotFound si no existe, está revocada o caducó.
+func (s *Server) identificarSesion(ctx context.Context, token string) (*identidad, error) {
+	ses, err := s.store.Sessions.Find(ctx, repository.HashAPIKey(token), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &identidad{Sujeto: ses.User.Email, Metodo: metodoSession, Roles: []string{ses.User.Role}, Usuario: ses.User.ID, Tenant: ses.User.Tenant}, nil
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"prueba/internal/version"
+)
+
+// versionHeader es la cabecera de todas las respuestas con la versión y el
+// commit del binario (ver version.Info.String).
+const versionHeader = "X-App-Version"
+
+// versionMiddleware pone versionHeader en todas las respuestas, para saber
+// qué build atendió cada petición sin llamar a /version.
+func versionMiddleware(next http.Handler) http.Handler {
+	v := version.Get().String()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(versionHeader, v)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getVersion es GET /version: versión, commit y fecha de compilación del
+// binario (ver el paquete version).
+func getVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version.Get())
+}
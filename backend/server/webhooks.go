@@ -0,0 +1,224 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"prueba/internal/metrics"
+	"prueba/internal/redact"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cabeceras de los webhooks. La firma es "v1=" seguido del HMAC-SHA256 en
+// hexadecimal, con el secreto de la suscripción, de
+// "<id>.<timestamp>.<cuerpo>". El receptor debe recalcularla, rechazar los
+// timestamps de hace más de unos minutos y los id repetidos: los reintentos
+// de una entrega llevan el mismo id, pero se firman de nuevo con la hora de
+// cada intento.
+const (
+	webhookIDHeader        = "X-Webhook-Id"
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// Longitud mínima de los secretos de webhooks.
+const minWebhookSecret = 16
+
+// Eventos de los webhooks.
+const eventoSyncCompletada = "sync.completed"
+
+// Intentos de cada entrega y espera antes del primer reintento (se dobla en
+// cada uno).
+const (
+	webhookAttempts = 4
+	webhookBackoff  = 2 * time.Second
+)
+
+// webhookSync son los datos del evento sync.completed: cómo terminó una
+// sincronización (status es el de sync_runs: success, failed o interrupted).
+type webhookSync struct {
+	RunID    int64   `json:"run_id"`
+	Tenant   string  `json:"tenant"`
+	Trigger  string  `json:"trigger"`
+	Status   string  `json:"status"`
+	Inserted int64   `json:"inserted"`
+	Total    int     `json:"total"`
+	Error    *string `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+var webhookDeliveries = metrics.NewCounter("webhook_deliveries_total",
+	"Entregas de webhooks por evento y resultado (ok, error).", "event", "status")
+
+// suscripcionWebhook es un destino de webhooks con su secreto.
+type suscripcionWebhook struct {
+	url     string
+	secreto []byte
+}
+
+// webhooksEntorno lee webhooks: destinos separados por comas, cada uno
+// url|secreto, como "https://a.example/hook|secreto-a,https://b.example|secreto-b".
+// Cada destino firma con su secreto.
+func webhooksEntorno() ([]suscripcionWebhook, error) {
+	var out []suscripcionWebhook
+	for _, v := range lista(os.Getenv("webhooks")) {
+		destino, secreto, ok := strings.Cut(v, "|")
+		destino, secreto = strings.TrimSpace(destino), strings.TrimSpace(secreto)
+		if !ok || destino == "" || secreto == "" {
+			return nil, fmt.Errorf("invalid webhooks: expected url|secret entries separated by commas")
+		}
+		u, err := url.Parse(destino)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid webhooks: %q is not an http(s) URL", destino)
+		}
+		if len(secreto) < minWebhookSecret {
+			return nil, fmt.Errorf("invalid webhooks: secret for %s is shorter than %d characters", u.Redacted(), minWebhookSecret)
+		}
+		redact.Register(secreto)
+		out = append(out, suscripcionWebhook{url: destino, secreto: []byte(secreto)})
+	}
+	return out, nil
+}
+
+// firmaWebhook es el valor de X-Webhook-Signature de cuerpo.
+func firmaWebhook(secreto []byte, id, timestamp string, cuerpo []byte) string {
+	mac := hmac.New(sha256.New, secreto)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(cuerpo)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhooks envía los eventos a las suscripciones de webhooks en segundo
+// plano, con reintentos. Un *webhooks nil no envía nada (sin webhooks).
+type webhooks struct {
+	destinos []suscripcionWebhook
+	client   *http.Client
+
+	// ctx se cancela al cerrar para abandonar los reintentos pendientes.
+	ctx      context.Context
+	cancelar context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// nuevosWebhooks devuelve nil si no hay destinos. Cada petición tiene como
+// mucho webhook_timeout (10s por defecto).
+func nuevosWebhooks(destinos []suscripcionWebhook) *webhooks {
+	if len(destinos) == 0 {
+		return nil
+	}
+	ctx, cancelar := context.WithCancel(context.Background())
+	return &webhooks{
+		destinos: destinos,
+		client:   &http.Client{Timeout: envDuration("webhook_timeout", 10*time.Second)},
+		ctx:      ctx,
+		cancelar: cancelar,
+	}
+}
+
+// enviar manda el evento con datos (en "data") a todos los destinos sin
+// esperar a que lo reciban.
+func (wh *webhooks) enviar(evento string, datos any) {
+	if wh == nil {
+		return
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		logDe("webhooks").Error("Error generando el id del webhook", errAttr(err))
+		return
+	}
+	id := "wh_" + hex.EncodeToString(b)
+	cuerpo, err := json.Marshal(struct {
+		ID    string    `json:"id"`
+		Event string    `json:"event"`
+		Time  time.Time `json:"time"`
+		Data  any       `json:"data"`
+	}{ID: id, Event: evento, Time: time.Now().UTC(), Data: datos})
+	if err != nil {
+		logDe("webhooks").Error("Error codificando el webhook", "event", evento, errAttr(err))
+		return
+	}
+	for _, d := range wh.destinos {
+		wh.wg.Add(1)
+		go func() {
+			defer wh.wg.Done()
+			wh.entregar(d, id, evento, cuerpo)
+		}()
+	}
+}
+
+// entregar manda cuerpo a d hasta que responde 2xx o se agotan los intentos.
+func (wh *webhooks) entregar(d suscripcionWebhook, id, evento string, cuerpo []byte) {
+	destino := d.url
+	if u, err := url.Parse(d.url); err == nil {
+		destino = u.Redacted()
+	}
+	log := logDe("webhooks").With("event", evento, "webhook_id", id, "url", destino)
+	espera := webhookBackoff
+	var err error
+reintentos:
+	for intento := 1; intento <= webhookAttempts; intento++ {
+		if err = wh.post(d, id, evento, cuerpo); err == nil {
+			webhookDeliveries.Inc(evento, "ok")
+			log.Debug("Webhook entregado", "attempt", intento)
+			return
+		}
+		log.Warn("Error entregando el webhook", "attempt", intento, errAttr(err))
+		if intento == webhookAttempts {
+			break
+		}
+		select {
+		case <-time.After(espera):
+			espera *= 2
+		case <-wh.ctx.Done():
+			break reintentos
+		}
+	}
+	webhookDeliveries.Inc(evento, "error")
+	log.Error("Webhook no entregado", errAttr(err))
+}
+
+func (wh *webhooks) post(d suscripcionWebhook, id, evento string, cuerpo []byte) error {
+	// Sin wh.ctx: al cerrar, las entregas en curso terminan (como mucho en
+	// webhook_timeout)
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(cuerpo))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookIDHeader, id)
+	req.Header.Set(webhookEventHeader, evento)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, firmaWebhook(d.secreto, id, timestamp, cuerpo))
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// cerrar espera a las entregas en curso y abandona los reintentos
+// pendientes. Va en cierres.
+func (wh *webhooks) cerrar() {
+	if wh == nil {
+		return
+	}
+	wh.cancelar()
+	wh.wg.Wait()
+}
@@ -0,0 +1,224 @@
+import { defineStore } from 'pinia'
+import { computed, ref } from 'vue'
+
+// Login con el proveedor OIDC (Auth0, Keycloak...) por Authorization Code con
+// PKCE, sin secreto de cliente. El access token se manda al backend como
+// Authorization: Bearer; el backend lo valida con oidc_issuer.
+const ISSUER = (import.meta.env.VITE_OIDC_ISSUER || '').replace(/\/$/, '')
+const CLIENT_ID = import.meta.env.VITE_OIDC_CLIENT_ID || ''
+// Auth0 pide la audiencia de la API para emitir un access token JWT
+const AUDIENCE = import.meta.env.VITE_OIDC_AUDIENCE || ''
+const SCOPES = import.meta.env.VITE_OIDC_SCOPES || 'openid profile email'
+
+// El token vive en sessionStorage: se pierde al cerrar la pestaña
+const TOKEN_KEY = 'oidc_token'
+// Estado del login en curso (state y code_verifier) mientras se vuelve del
+// proveedor
+const PENDING_KEY = 'oidc_pending'
+
+export interface AuthUser {
+  subject: string
+  method: string
+  roles: string[]
+}
+
+interface Discovery {
+  authorization_endpoint: string
+  token_endpoint: string
+  end_session_endpoint?: string
+}
+
+interface StoredToken {
+  accessToken: string
+  idToken: string
+  expiresAt: number
+}
+
+const base64url = (bytes: Uint8Array) =>
+  btoa(String.fromCharCode(...bytes)).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '')
+
+const randomString = () => base64url(crypto.getRandomValues(new Uint8Array(32)))
+
+const codeChallenge = async (verifier: string) => {
+  const digest = await crypto.subtle.digest('SHA-256', new TextEncoder().encode(verifier))
+  return base64url(new Uint8Array(digest))
+}
+
+// La URL a la que vuelve el proveedor: la página actual sin query
+const redirectUri = () => window.location.origin + window.location.pathname
+
+export const useAuthStore = defineStore('auth', () => {
+  const token = ref<StoredToken | null>(null)
+  const user = ref<AuthUser | null>(null)
+  const error = ref('')
+
+  const enabled = ISSUER !== '' && CLIENT_ID !== ''
+  const loggedIn = computed(() => token.value !== null && token.value.expiresAt > Date.now())
+
+  let discovery: Discovery | null = null
+  const discover = async () => {
+    if (!discovery) {
+      const response = await fetch(ISSUER + '/.well-known/openid-configuration')
+      if (!response.ok) {
+        throw new Error(`Error al obtener la configuración OIDC: ${response.status}`)
+      }
+      discovery = await response.json()
+    }
+    return discovery as Discovery
+  }
+
+  const loadToken = () => {
+    try {
+      const stored = sessionStorage.getItem(TOKEN_KEY)
+      token.value = stored ? JSON.parse(stored) : null
+      if (token.value && token.value.expiresAt <= Date.now()) {
+        clearToken()
+      }
+    } catch (err) {
+      console.error('Error loading token from sessionStorage:', err)
+    }
+  }
+
+  const saveToken = (t: StoredToken) => {
+    token.value = t
+    sessionStorage.setItem(TOKEN_KEY, JSON.stringify(t))
+  }
+
+  const clearToken = () => {
+    token.value = null
+    user.value = null
+    sessionStorage.removeItem(TOKEN_KEY)
+  }
+
+  // Cabeceras para las peticiones a la API
+  const authHeaders = (): Record<string, string> =>
+    loggedIn.value ? { 'Authorization': `Bearer ${token.value!.accessToken}` } : {}
+
+  const login = async () => {
+    error.value = ''
+    try {
+      const config = await discover()
+      const state = randomString()
+      const verifier = randomString()
+      sessionStorage.setItem(PENDING_KEY, JSON.stringify({ state, verifier }))
+
+      const params = new URLSearchParams({
+        response_type: 'code',
+        client_id: CLIENT_ID,
+        redirect_uri: redirectUri(),
+        scope: SCOPES,
+        state,
+        code_challenge: await codeChallenge(verifier),
+        code_challenge_method: 'S256'
+      })
+      if (AUDIENCE) {
+        params.set('audience', AUDIENCE)
+      }
+      window.location.assign(`${config.authorization_endpoint}?${params}`)
+    } catch (err: any) {
+      error.value = err.message || 'Error al iniciar sesión'
+    }
+  }
+
+  // Si la página se abre al volver del proveedor (?code=...&state=...),
+  // cambia el código por el token y limpia la URL
+  const handleCallback = async () => {
+    const query = new URLSearchParams(window.location.search)
+    const code = query.get('code')
+    const state = query.get('state')
+    if (!enabled || (!code && !query.get('error'))) {
+      return
+    }
+    window.history.replaceState({}, '', redirectUri())
+
+    const pending = JSON.parse(sessionStorage.getItem(PENDING_KEY) || 'null')
+    sessionStorage.removeItem(PENDING_KEY)
+    if (query.get('error')) {
+      error.value = query.get('error_description') || query.get('error') || 'Error al iniciar sesión'
+      return
+    }
+    if (!pending || pending.state !== state) {
+      error.value = 'La respuesta del proveedor de identidad no corresponde a este login'
+      return
+    }
+
+    try {
+      const config = await discover()
+      const response = await fetch(config.token_endpoint, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+        body: new URLSearchParams({
+          grant_type: 'authorization_code',
+          code: code!,
+          redirect_uri: redirectUri(),
+          client_id: CLIENT_ID,
+          code_verifier: pending.verifier
+        })
+      })
+      if (!response.ok) {
+        throw new Error(`Error al obtener el token: ${response.status}`)
+      }
+      const data = await response.json()
+      saveToken({
+        accessToken: data.access_token,
+        idToken: data.id_token || '',
+        expiresAt: Date.now() + (data.expires_in || 3600) * 1000
+      })
+    } catch (err: any) {
+      error.value = err.message || 'Error al iniciar sesión'
+    }
+  }
+
+  // Pide al backend la identidad del token (GET /auth/me)
+  const fetchUser = async () => {
+    if (!loggedIn.value) {
+      return
+    }
+    try {
+      const response = await fetch(import.meta.env.VITE_API_URL + '/auth/me', {
+        headers: { 'Accept': 'application/json', ...authHeaders() }
+      })
+      if (response.status === 401) {
+        clearToken()
+        return
+      }
+      if (!response.ok) {
+        throw new Error(`Error al obtener el usuario: ${response.status}`)
+      }
+      user.value = await response.json()
+    } catch (err: any) {
+      error.value = err.message || 'Error al obtener el usuario'
+    }
+  }
+
+  const logout = async () => {
+    const idToken = token.value?.idToken
+    clearToken()
+    try {
+      const config = await discover()
+      if (config.end_session_endpoint) {
+        const params = new URLSearchParams({ client_id: CLIENT_ID, post_logout_redirect_uri: redirectUri() })
+        if (idToken) {
+          params.set('id_token_hint', idToken)
+        }
+        window.location.assign(`${config.end_session_endpoint}?${params}`)
+      }
+    } catch (err) {
+      console.error('Error logging out from the identity provider:', err)
+    }
+  }
+
+  loadToken()
+
+  return {
+    user,
+    error,
+    enabled,
+    loggedIn,
+    authHeaders,
+    login,
+    logout,
+    handleCallback,
+    fetchUser
+  }
+})
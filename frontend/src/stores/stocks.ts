@@ -1,16 +1,19 @@
 import { defineStore } from 'pinia'
 import { ref } from 'vue'
+import { useAuthStore } from './auth'
 
 export interface StockItem {
   ticker: string
-  target_from: string
-  target_to: string
+  // null cuando la API upstream no envió el dato
+  target_from: number | null
+  target_to: number | null
   company: string
   action: string
   brokerage: string
-  rating_from: string
-  rating_to: string
+  rating_from: string | null
+  rating_to: string | null
   time: string
+  version: number
 }
 
 export const useStocksStore = defineStore('stocks', () => {
@@ -19,14 +22,51 @@ export const useStocksStore = defineStore('stocks', () => {
   const error = ref('')
   const syncing = ref(false)
   const syncMessage = ref('')
+  // Fin de la última sincronización correcta (GET /status): la antigüedad
+  // de los datos. null si no se sabe o nunca se ha sincronizado
+  const dataAsOf = ref<string | null>(null)
 
   const API_URL = import.meta.env.VITE_API_URL + '/item' || 'http://localhost:8080/item'
   const SYNC_URL = import.meta.env.VITE_API_URL + '/sync' || 'http://localhost:8080/sync'
+  const STATUS_URL = import.meta.env.VITE_API_URL + '/status'
+  // Clave de la API (cabecera X-API-Key) para las rutas que la exigen
+  // (api_key_auth en el backend). Queda en el bundle, así que solo es para
+  // despliegues internos
+  const API_KEY = import.meta.env.VITE_API_KEY || ''
+  // Con login OIDC se manda además el token del usuario
+  const auth = useAuthStore()
+  const authHeaders = (): Record<string, string> => ({
+    ...auth.authHeaders(),
+    ...(API_KEY ? { 'X-API-Key': API_KEY } : {})
+  })
+
+  // Sin token ni clave, el navegador manda solo las credenciales (cookies,
+  // Basic) y el backend pide el token CSRF (csrf_protection) en las
+  // escrituras: se pide una vez a /auth/csrf, que lo deja también en cookie
+  const CSRF_URL = import.meta.env.VITE_API_URL + '/auth/csrf'
+  let csrfToken = ''
+  const csrfHeaders = async (): Promise<Record<string, string>> => {
+    if (auth.loggedIn || API_KEY) {
+      return {}
+    }
+    if (!csrfToken) {
+      const response = await fetch(CSRF_URL, { credentials: 'include' })
+      if (!response.ok) {
+        throw new Error(`Error al obtener el token CSRF: ${response.status}`)
+      }
+      csrfToken = (await response.json()).token
+    }
+    return { 'X-CSRF-Token': csrfToken }
+  }
+
+  // La clave lleva versión: los items guardados antes de tipar los precios
+  // (strings con "$") no son compatibles con el formato actual
+  const STORAGE_KEY = 'stocks_items_v2'
 
   // Cargar datos del localStorage al inicializar
   const loadFromStorage = () => {
     try {
-      const stored = localStorage.getItem('stocks_items')
+      const stored = localStorage.getItem(STORAGE_KEY)
       if (stored) {
         items.value = JSON.parse(stored)
       }
@@ -38,12 +78,26 @@ export const useStocksStore = defineStore('stocks', () => {
   // Guardar datos en localStorage
   const saveToStorage = () => {
     try {
-      localStorage.setItem('stocks_items', JSON.stringify(items.value))
+      localStorage.setItem(STORAGE_KEY, JSON.stringify(items.value))
     } catch (err) {
       console.error('Error saving to localStorage:', err)
     }
   }
 
+  // El estado es informativo: si falla se deja el anterior sin mostrar error
+  const fetchStatus = async () => {
+    try {
+      const response = await fetch(STATUS_URL, {
+        headers: { 'Accept': 'application/json', ...authHeaders() }
+      })
+      if (response.ok) {
+        dataAsOf.value = (await response.json()).data_as_of
+      }
+    } catch (err) {
+      console.error('Error fetching status:', err)
+    }
+  }
+
   const fetchData = async () => {
     loading.value = true
     error.value = ''
@@ -55,7 +109,8 @@ export const useStocksStore = defineStore('stocks', () => {
       const response = await fetch(API_URL, {
         method: 'GET',
         headers: {
-          'Accept': 'application/json'
+          'Accept': 'application/json',
+          ...authHeaders()
         },
         signal: controller.signal
       })
@@ -75,6 +130,7 @@ export const useStocksStore = defineStore('stocks', () => {
 
       items.value = data.items
       saveToStorage() // Guardar en localStorage
+      fetchStatus()
 
     } catch (err: any) {
       if (err.name === 'AbortError') {
@@ -94,10 +150,17 @@ export const useStocksStore = defineStore('stocks', () => {
     try {
       const response = await fetch(SYNC_URL, {
         method: 'POST',
+        credentials: 'include',
         headers: {
-          'Content-Type': 'application/json'
+          'Content-Type': 'application/json',
+          ...authHeaders(),
+          ...(await csrfHeaders())
         }
       })
+      if (response.status === 403) {
+        // El token CSRF pudo caducar con la cookie: se pide otro la próxima vez
+        csrfToken = ''
+      }
       
       if (!response.ok) {
         throw new Error(`Error al sincronizar: ${response.status}`)
@@ -128,6 +191,7 @@ export const useStocksStore = defineStore('stocks', () => {
     error,
     syncing,
     syncMessage,
+    dataAsOf,
     fetchData,
     syncData
   }